@@ -0,0 +1,98 @@
+// Command backfill downloads the history of the market indicators into the
+// time series store. Runs are idempotent and resume from the last
+// checkpoint of every source.
+//
+//	go run ./cmd/backfill -from 2018-01-01
+//	go run ./cmd/backfill -sources klines,funding -reset
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go-vue/pkg/backfill"
+	"go-vue/pkg/config"
+	"go-vue/pkg/market"
+	"go-vue/pkg/storage"
+	"go-vue/pkg/timeseries"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	from := flag.String("from", "2018-01-01", "first day to backfill")
+	to := flag.String("to", "", "day after the last backfilled day, now when empty")
+	names := flag.String("sources", "", "comma separated source name prefixes, all sources when empty")
+	reset := flag.Bool("reset", false, "ignore the checkpoints and fetch the whole range again")
+	list := flag.Bool("list", false, "list the sources and their checkpoints")
+	flag.Parse()
+
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	var end time.Time
+	if *to != "" {
+		if end, err = time.Parse("2006-01-02", *to); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+	}
+
+	godotenv.Load()
+	if err := config.LoadBaseConfig(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	store, err := storage.NewStoreFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	sources, err := backfill.Select(backfill.Sources(market.NewBinanceService(),
+		market.NewCoinGeckoService(config.GlobalConfig.CoinGeckoAPIKey)), *names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.GlobalConfig.CoinGeckoAPIKey == "" {
+		log.Printf("COINGECKO_API_KEY is not set, skipping the market cap and dominance history")
+	}
+	b := backfill.New(store, timeseries.NewStore(store))
+	ctx := context.Background()
+
+	if *list {
+		for _, source := range sources {
+			checkpoint, err := b.Checkpoint(ctx, source.Name())
+			if err != nil {
+				log.Fatal(err)
+			}
+			if checkpoint == nil {
+				fmt.Printf("%-24s not backfilled\n", source.Name())
+				continue
+			}
+			fmt.Printf("%-24s %s to %s\n", source.Name(), checkpoint.From.Format(time.RFC3339), checkpoint.Through.Format(time.RFC3339))
+		}
+		return
+	}
+
+	failed := false
+	for _, source := range sources {
+		if *reset {
+			if err := b.Reset(ctx, source.Name()); err != nil {
+				log.Fatal(err)
+			}
+		}
+		report, err := b.Backfill(ctx, source, start, end)
+		if err != nil {
+			// the checkpoint keeps the progress, running again resumes
+			log.Printf("%s failed after %d new points: %v", source.Name(), report.Added, err)
+			failed = true
+			continue
+		}
+		log.Printf("%s: %d calls, %d new points, %d derived", source.Name(), report.Calls, report.Added, report.Derived)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
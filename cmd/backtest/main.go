@@ -0,0 +1,106 @@
+// Command backtest replays the stored market history through the weighted
+// signal rules and prints the performance of the resulting positions.
+//
+//	go run ./cmd/backtest -symbol BTCUSDT -from 2022-01-01 -fetch
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go-vue/pkg/backtest"
+	"go-vue/pkg/config"
+	"go-vue/pkg/market"
+	"go-vue/pkg/storage"
+	"go-vue/pkg/timeseries"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	cfg := backtest.DefaultConfig()
+	from := flag.String("from", time.Now().AddDate(-3, 0, 0).Format("2006-01-02"), "first day to simulate")
+	to := flag.String("to", "", "day after the last simulated day, today when empty")
+	strategyFile := flag.String("strategy", "", "JSON file with the rules and thresholds to test")
+	fetch := flag.Bool("fetch", false, "download missing klines from Binance before the run")
+	asJSON := flag.Bool("json", false, "print the full result as JSON")
+	flag.StringVar(&cfg.Symbol, "symbol", cfg.Symbol, "Binance symbol to trade")
+	flag.StringVar(&cfg.Interval, "interval", cfg.Interval, "kline interval")
+	flag.Float64Var(&cfg.InitialCapital, "capital", cfg.InitialCapital, "initial capital")
+	flag.Float64Var(&cfg.FeeRate, "fee", cfg.FeeRate, "fee rate per fill")
+	flag.Float64Var(&cfg.Slippage, "slippage", cfg.Slippage, "slippage per fill")
+	flag.BoolVar(&cfg.AllowShort, "short", cfg.AllowShort, "go short on sell signals")
+	flag.Parse()
+
+	var err error
+	if cfg.From, err = time.Parse("2006-01-02", *from); err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	cfg.To = time.Now()
+	if *to != "" {
+		if cfg.To, err = time.Parse("2006-01-02", *to); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+	}
+	if *strategyFile != "" {
+		data, err := os.ReadFile(*strategyFile)
+		if err != nil {
+			log.Fatalf("Failed to read strategy: %v", err)
+		}
+		if err := json.Unmarshal(data, &cfg.Strategy); err != nil {
+			log.Fatalf("Failed to parse strategy: %v", err)
+		}
+	}
+
+	godotenv.Load()
+	if err := config.LoadBaseConfig(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	store, err := storage.NewStoreFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	series := timeseries.NewStore(store)
+	ctx := context.Background()
+
+	if *fetch {
+		d, err := backtest.IntervalDuration(cfg.Interval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		added, err := backtest.StoreKlines(ctx, market.NewBinanceService(), series, cfg.Symbol, cfg.Interval, cfg.From.Add(-backtest.WarmupBars*d), cfg.To)
+		if err != nil {
+			log.Fatalf("Failed to fetch klines: %v", err)
+		}
+		log.Printf("Stored %d new %s %s klines", added, cfg.Symbol, cfg.Interval)
+	}
+
+	result, err := backtest.Run(ctx, series, cfg)
+	if err != nil {
+		log.Fatalf("Backtest failed: %v", err)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	m := result.Metrics
+	fmt.Printf("%s %s from %s to %s, fee %.3f%%, slippage %.3f%%\n", cfg.Symbol, cfg.Interval,
+		result.Equity[0].Time.Format("2006-01-02"), result.Equity[len(result.Equity)-1].Time.Format("2006-01-02"),
+		cfg.FeeRate*100, cfg.Slippage*100)
+	fmt.Printf("Final equity:  %.2f (%+.2f%%, buy and hold %+.2f%%)\n", m.FinalEquity, m.TotalReturn*100, m.BuyAndHoldReturn*100)
+	fmt.Printf("CAGR:          %+.2f%%\n", m.CAGR*100)
+	fmt.Printf("Sharpe:        %.2f\n", m.Sharpe)
+	fmt.Printf("Max drawdown:  %.2f%%\n", m.MaxDrawdown*100)
+	fmt.Printf("Trades:        %d, hit rate %.1f%%, fees %.2f\n", m.Trades, m.HitRate*100, m.Fees)
+	fmt.Printf("Exposure:      %.1f%%\n", m.Exposure*100)
+}
@@ -0,0 +1,156 @@
+// Command optimize searches the weights and thresholds of the signal rules
+// over the stored market history with walk-forward validation and saves
+// the winner as a new version of a strategy profile.
+//
+//	go run ./cmd/optimize -name btc-daily -method coordinate -from 2021-01-01
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-vue/pkg/backtest"
+	"go-vue/pkg/config"
+	"go-vue/pkg/storage"
+	"go-vue/pkg/strategy"
+	"go-vue/pkg/timeseries"
+
+	"github.com/joho/godotenv"
+)
+
+func parseFloats(value string) ([]float64, error) {
+	var values []float64
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, f)
+	}
+	return values, nil
+}
+
+func main() {
+	opt := backtest.OptimizeConfig{
+		Backtest:  backtest.DefaultConfig(),
+		Space:     backtest.DefaultSearchSpace(),
+		Method:    backtest.MethodCoordinate,
+		Objective: backtest.ObjectiveSharpe,
+		Folds:     4,
+		Seed:      1,
+	}
+	cfg := &opt.Backtest
+	name := flag.String("name", "", "profile name, the new version is saved to the profile directory")
+	description := flag.String("description", "", "profile description")
+	dir := flag.String("dir", "", "profile directory, STRATEGY_PROFILE_DIR when empty")
+	from := flag.String("from", time.Now().AddDate(-4, 0, 0).Format("2006-01-02"), "first day of the history")
+	to := flag.String("to", "", "day after the last day of the history, today when empty")
+	base := flag.String("strategy", "", "JSON file with the starting rules, the dashboard strategy when empty")
+	spaceFile := flag.String("space", "", "JSON file with the search space")
+	weights := flag.String("weights", "", "comma separated candidate weights")
+	metrics := flag.String("metrics", "", "comma separated metrics whose weight is searched")
+	flag.StringVar(&opt.Method, "method", opt.Method, "search method: grid, random or coordinate")
+	flag.StringVar(&opt.Objective, "objective", opt.Objective, "objective: sharpe, cagr, calmar or return")
+	flag.IntVar(&opt.Folds, "folds", opt.Folds, "walk-forward test windows")
+	flag.IntVar(&opt.Iterations, "iterations", 0, "random candidates or coordinate passes")
+	flag.Int64Var(&opt.Seed, "seed", opt.Seed, "random search seed")
+	flag.StringVar(&cfg.Symbol, "symbol", cfg.Symbol, "Binance symbol to trade")
+	flag.StringVar(&cfg.Interval, "interval", cfg.Interval, "kline interval")
+	flag.Float64Var(&cfg.FeeRate, "fee", cfg.FeeRate, "fee rate per fill")
+	flag.Float64Var(&cfg.Slippage, "slippage", cfg.Slippage, "slippage per fill")
+	flag.BoolVar(&cfg.AllowShort, "short", cfg.AllowShort, "go short on sell signals")
+	flag.Parse()
+
+	if err := strategy.ValidateProfileName(*name); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	if cfg.From, err = time.Parse("2006-01-02", *from); err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	cfg.To = time.Now()
+	if *to != "" {
+		if cfg.To, err = time.Parse("2006-01-02", *to); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+	}
+	if *base != "" {
+		data, err := os.ReadFile(*base)
+		if err != nil {
+			log.Fatalf("Failed to read strategy: %v", err)
+		}
+		if err := json.Unmarshal(data, &cfg.Strategy); err != nil {
+			log.Fatalf("Failed to parse strategy: %v", err)
+		}
+	}
+	if *spaceFile != "" {
+		data, err := os.ReadFile(*spaceFile)
+		if err != nil {
+			log.Fatalf("Failed to read search space: %v", err)
+		}
+		if err := json.Unmarshal(data, &opt.Space); err != nil {
+			log.Fatalf("Failed to parse search space: %v", err)
+		}
+	}
+	if *weights != "" {
+		if opt.Space.Weights, err = parseFloats(*weights); err != nil {
+			log.Fatalf("Invalid -weights: %v", err)
+		}
+	}
+	if *metrics != "" {
+		opt.Space.Metrics = strings.Split(*metrics, ",")
+	}
+
+	godotenv.Load()
+	if err := config.LoadBaseConfig(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *dir == "" {
+		*dir = config.GlobalConfig.StrategyProfileDir
+	}
+	store, err := storage.NewStoreFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	data, err := backtest.Load(context.Background(), timeseries.NewStore(store), cfg.Symbol, cfg.Interval, cfg.From, cfg.To, cfg.Strategy)
+	if err != nil {
+		log.Fatalf("Failed to load history: %v", err)
+	}
+	best, report, err := backtest.Optimize(opt, data)
+	if err != nil {
+		log.Fatalf("Optimization failed: %v", err)
+	}
+
+	objective := func(name string, m backtest.Metrics) float64 {
+		value, _ := backtest.Objective(name, m)
+		return value
+	}
+	for i, fold := range report.Folds {
+		fmt.Printf("Fold %d: test %s to %s, %s %.3f (baseline %.3f)\n", i+1,
+			fold.TestFrom.Format("2006-01-02"), fold.TestTo.Format("2006-01-02"), opt.Objective,
+			objective(opt.Objective, fold.Test), objective(opt.Objective, fold.Baseline))
+	}
+	fmt.Printf("Walk-forward %s: %.3f, baseline %.3f, %d evaluations\n", opt.Objective, report.TestObjective, report.BaselineObjective, report.Evaluations)
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		log.Fatal(err)
+	}
+	profile := &strategy.Profile{Name: *name, Description: *description, Strategy: best, Optimization: encoded}
+	path, err := strategy.SaveProfile(*dir, profile)
+	if err != nil {
+		log.Fatalf("Failed to save profile: %v", err)
+	}
+	fmt.Printf("Saved %s version %d to %s\n", profile.Name, profile.Version, path)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"go-vue/internal/models"
 	"go-vue/pkg/telegram"
 )
 
@@ -28,36 +29,17 @@ func (c *TelegramController) GetAuthLink(w http.ResponseWriter, r *http.Request)
 }
 
 func (c *TelegramController) GetUserGroups(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from session or database
-	// For now, we'll use a mock user ID
-	userID := int64(123456789)
+	groups, err := c.telegramService.GetUserGroups(telegram.GroupsOptions{
+		Folder: telegram.FolderAll,
+		Enrich: true,
+	})
 
-	groups, err := c.telegramService.GetUserGroups(userID)
+	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		http.Error(w, "Failed to get user groups", http.StatusInternalServerError)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(models.TelegramGroupsResponse{Error: "Failed to get user groups"})
 		return
 	}
 
-	// Convert map[string]interface{} to proper response format
-	type GroupResponse struct {
-		ID          string `json:"id"`
-		Title       string `json:"title"`
-		Username    string `json:"username"`
-		Type        string `json:"type"`
-		Description string `json:"description"`
-	}
-
-	response := make([]GroupResponse, len(groups))
-	for i, group := range groups {
-		response[i] = GroupResponse{
-			ID:          group["id"].(string),
-			Title:       group["title"].(string),
-			Username:    group["username"].(string),
-			Type:        group["type"].(string),
-			Description: group["description"].(string),
-		}
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(models.TelegramGroupsResponse{Groups: groups})
 }
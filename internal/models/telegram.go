@@ -7,12 +7,34 @@ type TelegramUser struct {
 	LastName  string `json:"last_name"`
 }
 
+// Group types reported in TelegramGroup.Type
+const (
+	GroupTypeChannel    = "channel"
+	GroupTypeSupergroup = "supergroup"
+	GroupTypeGroup      = "group"
+)
+
 type TelegramGroup struct {
-	ID          int64  `json:"id"`
-	Title       string `json:"title"`
-	Username    string `json:"username"`
-	Type        string `json:"type"`
-	Description string `json:"description"`
+	ID           int64  `json:"id"`
+	Title        string `json:"title"`
+	Username     string `json:"username"`
+	Type         string `json:"type"`
+	Description  string `json:"description"`
+	Members      int    `json:"members"`
+	PhotoID      int64  `json:"photo_id,omitempty"`
+	Verified     bool   `json:"verified"`
+	Scam         bool   `json:"scam"`
+	Fake         bool   `json:"fake"`
+	LinkedChatID int64  `json:"linked_chat_id,omitempty"`
+	FolderID     int    `json:"folder_id"`
+	Archived     bool   `json:"archived"`
+	Pinned       bool   `json:"pinned"`
+}
+
+// TelegramFolder is a user defined chat folder (dialog filter)
+type TelegramFolder struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
 }
 
 type TelegramAuthResponse struct {
@@ -4,25 +4,38 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"image/png"
+	"io"
 	"log"
 	"math"
-	"math/big"
-	"math/rand"
 	"net/http"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"go-vue/pkg/altseason"
+	"go-vue/pkg/backfill"
+	"go-vue/pkg/backtest"
 	"go-vue/pkg/config"
+	"go-vue/pkg/events"
+	"go-vue/pkg/funding"
+	"go-vue/pkg/indicators"
+	"go-vue/pkg/liquidations"
 	"go-vue/pkg/market"
+	"go-vue/pkg/onchain"
+	"go-vue/pkg/portfolio"
+	"go-vue/pkg/positioning"
+	"go-vue/pkg/solana"
+	"go-vue/pkg/storage"
+	"go-vue/pkg/strategy"
 	"go-vue/pkg/telegram"
+	"go-vue/pkg/timeseries"
 
-	"github.com/gagliardetto/solana-go"
-	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -30,6 +43,27 @@ import (
 var (
 	telegramService *telegram.TelegramService
 	marketService   *market.MarketService
+	eventBus        *events.Bus
+	walletService   *solana.WalletService
+
+	transactionIndexer   *solana.TransactionIndexer
+	discoveryService     *solana.DiscoveryService
+	pnlEngine            *solana.PnLEngine
+	solanaMonitor        *solana.Monitor
+	solanaRPCPool        *solana.RPCPool
+	tokenResolver        *solana.TokenResolver
+	stakingService       *solana.StakingService
+	solanaWatchlist      *solana.Watchlist
+	copyTrader           *solana.CopyTrader
+	portfolioService     *portfolio.Service
+	timeSeries           *timeseries.Store
+	backfiller           *backfill.Backfiller
+	fundingVenues        []funding.Venue
+	liquidationCollector *liquidations.Collector
+	coinGecko            *market.CoinGeckoService
+	altcoinSeason        *altseason.Index
+	onchainTracker       *onchain.Tracker
+	strategyProfiles     *strategy.Registry
 )
 
 // SSRResponse represents the response for SSR endpoint
@@ -39,40 +73,497 @@ type SSRResponse struct {
 	Labels     []string  `json:"labels"`
 }
 
-func getBalance(walletAddress string) (float64, error) {
-	pubKey, err := solana.PublicKeyFromBase58(walletAddress)
+// solanaContext returns the request context with the commitment selected
+// by the optional commitment query parameter
+func solanaContext(c *gin.Context) (context.Context, bool) {
+	value := c.Query("commitment")
+	if value == "" {
+		return c.Request.Context(), true
+	}
+	commitment, err := solana.ParseCommitment(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return solana.WithCommitment(c.Request.Context(), commitment), true
+}
+
+func handleBalance(c *gin.Context) {
+	ctx, ok := solanaContext(c)
+	if !ok {
+		return
+	}
+	walletAddress := config.GlobalConfig.WalletAddress
+	balance, err := walletService.GetSOLBalance(ctx, walletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balance": balance})
+}
+
+func handleSolanaWallet(c *gin.Context) {
+	address := c.Param("address")
+	if _, err := solana.ParseAddress(address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, ok := solanaContext(c)
+	if !ok {
+		return
+	}
+	wallet, err := walletService.GetWallet(ctx, address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Liquid balances are still shown when stake accounts cannot be loaded
+	if accounts, _, err := stakingService.Accounts(ctx, address); err == nil {
+		wallet.AddStake(accounts)
+	} else {
+		log.Printf("Failed to load stake accounts of %s: %v", address, err)
+	}
+
+	c.JSON(http.StatusOK, wallet)
+}
+
+func handleSolanaStaking(c *gin.Context) {
+	address := c.Param("address")
+	if _, err := solana.ParseAddress(address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	epochs, err := intQuery(c, "epochs")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, ok := solanaContext(c)
+	if !ok {
+		return
+	}
+
+	limit := solana.DefaultRewardEpochs
+	if epochs != nil {
+		limit = *epochs
+	}
+	overview, err := stakingService.Overview(ctx, address, limit)
 	if err != nil {
-		return 0, err
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(http.StatusOK, overview)
+}
 
-	rpcClient := rpc.New(config.GlobalConfig.RpcEndpoint)
+func handleSolanaToken(c *gin.Context) {
+	mint := c.Param("mint")
+	if _, err := solana.ParseAddress(mint); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, ok := solanaContext(c)
+	if !ok {
+		return
+	}
 
-	balance, err := rpcClient.GetBalance(
-		context.Background(),
-		pubKey,
-		rpc.CommitmentConfirmed,
-	)
+	token, err := tokenResolver.Token(ctx, mint)
 	if err != nil {
-		return 0, err
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(http.StatusOK, token)
+}
 
-	lamports := balance.Value
-	solBalance := new(big.Float).SetUint64(uint64(lamports))
-	solBalanceInSOL := new(big.Float).Quo(solBalance, new(big.Float).SetUint64(solana.LAMPORTS_PER_SOL))
+func handleSolanaRPCStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"commitment": solanaRPCPool.Commitment(),
+		"endpoints":  solanaRPCPool.Status(),
+	})
+}
 
-	solBalanceFloat, _ := solBalanceInSOL.Float64()
-	return solBalanceFloat, nil
+// parseTimeQuery accepts unix seconds, RFC 3339 or a YYYY-MM-DD date
+func parseTimeQuery(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
 }
 
-func handleBalance(c *gin.Context) {
-	walletAddress := config.GlobalConfig.WalletAddress
-	balance, err := getBalance(walletAddress)
+func handleSolanaTransactions(c *gin.Context) {
+	address := c.Param("address")
+	if _, err := solana.ParseAddress(address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := solana.TransactionFilter{
+		Type:   solana.TxType(c.Query("type")),
+		Mint:   c.Query("mint"),
+		Venue:  c.Query("venue"),
+		Before: c.Query("before"),
+	}
+	switch filter.Type {
+	case "", solana.TxTransfer, solana.TxSwap, solana.TxStake, solana.TxNFTMint, solana.TxOther:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be transfer, swap, stake, nft_mint or other"})
+		return
+	}
+	var err error
+	if filter.From, err = parseTimeQuery(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time"})
+		return
+	}
+	if filter.To, err = parseTimeQuery(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time"})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 || filter.Limit > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+	}
+
+	// New transactions are indexed on every request, older history is
+	// backfilled a little at a time unless sync=false
+	var state *solana.SyncState
+	if c.DefaultQuery("sync", "true") != "false" {
+		backfill, err := strconv.Atoi(c.DefaultQuery("backfill", "100"))
+		if err != nil || backfill < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backfill"})
+			return
+		}
+		if state, err = transactionIndexer.Sync(c.Request.Context(), address, backfill); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to sync transactions: %v", err)})
+			return
+		}
+	}
+
+	page, err := transactionIndexer.Transactions(c.Request.Context(), address, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if state == nil {
+		if state, err = transactionIndexer.State(c.Request.Context(), address); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	page.Sync = state
 
-	c.JSON(http.StatusOK, gin.H{"balance": balance})
+	c.JSON(http.StatusOK, page)
+}
+
+func handleSolanaTransactionsSync(c *gin.Context) {
+	address := c.Param("address")
+	if _, err := solana.ParseAddress(address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	backfill, err := strconv.Atoi(c.DefaultQuery("backfill", "1000"))
+	if err != nil || backfill < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backfill"})
+		return
+	}
+
+	state, err := transactionIndexer.Sync(c.Request.Context(), address, backfill)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to sync transactions: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// floatQuery parses an optional float query parameter
+func floatQuery(c *gin.Context, name string) (*float64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &f, nil
+}
+
+// intQuery parses an optional integer query parameter
+func intQuery(c *gin.Context, name string) (*int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &i, nil
+}
+
+// handleSolanaPnL reports the PnL of the wallet in the path, or of the
+// configured wallet when there is none
+func handleSolanaPnL(c *gin.Context) {
+	address := c.Param("address")
+	if address == "" {
+		address = config.GlobalConfig.WalletAddress
+	}
+	if _, err := solana.ParseAddress(address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.DefaultQuery("sync", "true") != "false" {
+		backfill, err := strconv.Atoi(c.DefaultQuery("backfill", "1000"))
+		if err != nil || backfill < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backfill"})
+			return
+		}
+		if _, err := transactionIndexer.Sync(c.Request.Context(), address, backfill); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to sync transactions: %v", err)})
+			return
+		}
+	}
+
+	report, err := pnlEngine.Report(c.Request.Context(), address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func handleSolanaMonitorStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, solanaMonitor.Status())
+}
+
+func handleSolanaMonitorWatch(c *gin.Context) {
+	var req struct {
+		Address string `json:"address" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address is required"})
+		return
+	}
+	if err := solanaMonitor.Watch(req.Address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, solanaMonitor.Status())
+}
+
+func handleSolanaMonitorUnwatch(c *gin.Context) {
+	if err := solanaMonitor.Unwatch(c.Param("address")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, solanaMonitor.Status())
+}
+
+func handleSolanaAwaitSignature(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+
+	event, err := solanaMonitor.AwaitSignature(ctx, c.Param("signature"))
+	if err != nil {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, event)
+}
+
+// watchlistRequest is the body of watchlist create and update requests,
+// an update leaves the omitted fields unchanged
+type watchlistRequest struct {
+	Address string    `json:"address"`
+	Label   *string   `json:"label"`
+	Tags    *[]string `json:"tags"`
+	Notify  *bool     `json:"notify"`
+}
+
+// watchlistError maps watchlist errors to HTTP responses
+func watchlistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, solana.ErrWatchNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, solana.ErrWatchExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func handleSolanaWatchlist(c *gin.Context) {
+	wallets, err := solanaWatchlist.List(c.Request.Context(), c.Query("tag"))
+	if err != nil {
+		watchlistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"wallets": wallets})
+}
+
+func handleSolanaWatchlistAdd(c *gin.Context) {
+	var req watchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Address == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address is required"})
+		return
+	}
+	if _, err := solana.ParseAddress(req.Address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wallet := solana.WatchedWallet{Address: req.Address, Notify: req.Notify == nil || *req.Notify}
+	if req.Label != nil {
+		wallet.Label = *req.Label
+	}
+	if req.Tags != nil {
+		wallet.Tags = *req.Tags
+	}
+	added, err := solanaWatchlist.Add(c.Request.Context(), wallet)
+	if err != nil {
+		watchlistError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, added)
+}
+
+func handleSolanaWatchlistGet(c *gin.Context) {
+	wallet, err := solanaWatchlist.Get(c.Request.Context(), c.Param("address"))
+	if err != nil {
+		watchlistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+func handleSolanaWatchlistUpdate(c *gin.Context) {
+	var req watchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wallet, err := solanaWatchlist.Update(c.Request.Context(), c.Param("address"), solana.WatchedWalletUpdate{
+		Label:  req.Label,
+		Tags:   req.Tags,
+		Notify: req.Notify,
+	})
+	if err != nil {
+		watchlistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+func handleSolanaWatchlistRemove(c *gin.Context) {
+	if err := solanaWatchlist.Remove(c.Request.Context(), c.Param("address")); err != nil {
+		watchlistError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func handleSolanaCopyTradeSignals(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"signals": copyTrader.Signals(c.Query("wallet"))})
+}
+
+func handleProfitableWallets(c *gin.Context) {
+	query := solana.WalletQuery{
+		Search: c.Query("search"),
+		Token:  c.Query("token"),
+		Sort:   c.DefaultQuery("sort", "profit"),
+		Desc:   c.DefaultQuery("order", "desc") == "desc",
+	}
+	if !solana.ValidWalletSort(query.Sort) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort key"})
+		return
+	}
+
+	floats := map[string]**float64{
+		"min_winrate":            &query.MinWinRate,
+		"min_profit":             &query.MinProfit,
+		"max_profit":             &query.MaxProfit,
+		"min_pnl":                &query.MinPnL,
+		"max_pnl":                &query.MaxPnL,
+		"min_avg_tokens_per_day": &query.MinTokensPerDay,
+		"max_avg_tokens_per_day": &query.MaxTokensPerDay,
+		"min_avg_hold_time":      &query.MinHoldTime,
+		"max_avg_hold_time":      &query.MaxHoldTime,
+	}
+	for name, target := range floats {
+		value, err := floatQuery(c, name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		*target = value
+	}
+	var err error
+	if query.MinTx, err = intQuery(c, "min_tx"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.MaxTx, err = intQuery(c, "max_tx"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query.ActiveFrom, err = parseTimeQuery(c.Query("last_active_from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last_active_from"})
+		return
+	}
+	if query.ActiveTo, err = parseTimeQuery(c.Query("last_active_to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last_active_to"})
+		return
+	}
+	// A plain date includes the whole day
+	if len(c.Query("last_active_to")) == len("2006-01-02") {
+		query.ActiveTo = query.ActiveTo.Add(24*time.Hour - time.Nanosecond)
+	}
+	if query.Page, err = strconv.Atoi(c.DefaultQuery("page", "1")); err != nil || query.Page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	if query.PageSize, err = strconv.Atoi(c.DefaultQuery("page_size", "50")); err != nil || query.PageSize < 1 || query.PageSize > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 500"})
+		return
+	}
+
+	page, err := discoveryService.Wallets(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"wallets":   page.Wallets,
+		"total":     page.Total,
+		"page":      page.Page,
+		"page_size": page.PageSize,
+		"scan":      discoveryService.Status(),
+	})
+}
+
+func handleProfitableWalletsScan(c *gin.Context) {
+	var opts solana.ScanOptions
+	if err := c.ShouldBindJSON(&opts); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := discoveryService.StartScan(c.Request.Context(), opts); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, discoveryService.Status())
+}
+
+func handleProfitableWalletsScanStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, discoveryService.Status())
 }
 
 func handleTelegramAuthCallback(c *gin.Context) {
@@ -127,19 +618,14 @@ func handleTelegramVerifyCode(c *gin.Context) {
 		Hash     string `json:"hash"`
 	}
 
-	// Log the raw request body
-	body, _ := c.GetRawData()
-	log.Printf("Raw request body: %s", string(body))
-	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-
 	if err := c.ShouldBindJSON(&data); err != nil {
 		log.Printf("Failed to bind JSON: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	log.Printf("Received verification request - Phone: %s, Code: %s, Hash: %s, Has Password: %v",
-		data.Phone, data.Code, data.Hash, data.Password != "")
+	log.Printf("Received verification request - Phone: %s, Has Password: %v",
+		data.Phone, data.Password != "")
 
 	// Validate required fields
 	if data.Phone == "" {
@@ -264,20 +750,33 @@ func handleTelegramVerify2FA(c *gin.Context) {
 	})
 }
 
+// handleGetGroups lists the groups and channels of the logged in account.
+// Query parameters: folder (main, archived or all), filter (chat folder id)
+// and full=false to skip loading channel details.
 func handleGetGroups(c *gin.Context) {
-	userID := c.Query("user_id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is required"})
+	opts := telegram.GroupsOptions{Folder: telegram.FolderAll, Enrich: c.DefaultQuery("full", "true") != "false"}
+
+	switch c.DefaultQuery("folder", "all") {
+	case "all":
+	case "main":
+		opts.Folder = telegram.FolderMain
+	case "archived":
+		opts.Folder = telegram.FolderArchive
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "folder must be main, archived or all"})
 		return
 	}
 
-	id, err := strconv.ParseInt(userID, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
+	if filter := c.Query("filter"); filter != "" {
+		id, err := strconv.Atoi(filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter ID"})
+			return
+		}
+		opts.FilterID = id
 	}
 
-	groups, err := telegramService.GetUserGroups(id)
+	groups, err := telegramService.GetUserGroups(opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get user groups: %v", err)})
 		return
@@ -289,6 +788,16 @@ func handleGetGroups(c *gin.Context) {
 	})
 }
 
+func handleGetFolders(c *gin.Context) {
+	folders, err := telegramService.GetFolders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
 func handleGetCurrentUser(c *gin.Context) {
 	user, err := telegramService.GetCurrentUser()
 	if err != nil {
@@ -326,38 +835,316 @@ func handleTelegramLogout(c *gin.Context) {
 	})
 }
 
-func handleCMCGlobal(c *gin.Context) {
-	apiKey := os.Getenv("CMC_API_KEY")
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "API key not set"})
-		return
+func handleTelegramSessionExport(c *gin.Context) {
+	var data struct {
+		Passphrase string `json:"passphrase"`
 	}
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://pro-api.coinmarketcap.com/v1/global-metrics/quotes/latest", nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
+	if err := c.ShouldBindJSON(&data); err != nil || data.Passphrase == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "passphrase is required"})
 		return
 	}
 
-	req.Header.Set("X-CMC_PRO_API_KEY", apiKey)
-	resp, err := client.Do(req)
+	bundle, err := telegramService.ExportSession(data.Passphrase)
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch from CoinMarketCap"})
-		return
-	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse response"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"session": json.RawMessage(bundle),
+	})
 }
 
-func handleTrends(c *gin.Context) {
+func handleTelegramSessionImport(c *gin.Context) {
+	var data struct {
+		Passphrase string          `json:"passphrase"`
+		Session    json.RawMessage `json:"session"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if data.Passphrase == "" || len(data.Session) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "session and passphrase are required"})
+		return
+	}
+
+	if err := telegramService.ImportSession(data.Session, data.Passphrase); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"status":  telegramService.GetStatus(),
+	})
+}
+
+func handleTelegramQRStart(c *gin.Context) {
+	status, err := telegramService.StartQRLogin()
+	if err != nil {
+		log.Printf("Failed to start QR login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func handleTelegramQRStatus(c *gin.Context) {
+	status, err := telegramService.GetQRLoginStatus(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func handleTelegramQRImage(c *gin.Context) {
+	img, err := telegramService.GetQRLoginImage(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode QR code"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
+
+// handleTelegramQRStream streams QR login status changes as server-sent events
+// until the login succeeds, fails or expires
+func handleTelegramQRStream(c *gin.Context) {
+	updates, unsubscribe, err := telegramService.SubscribeQRLogin(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer unsubscribe()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case status := <-updates:
+			c.SSEvent("status", status)
+			return !status.Done()
+		case <-time.After(15 * time.Second):
+			c.SSEvent("ping", gin.H{"time": time.Now().Unix()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func handleTelegramQR2FA(c *gin.Context) {
+	var data struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil || data.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
+		return
+	}
+
+	if err := telegramService.VerifyQR2FA(c.Param("id"), data.Password); err != nil {
+		log.Printf("QR login 2FA verification failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "2FA_FAILED",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	status, _ := telegramService.GetQRLoginStatus(c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"user_id": status.UserID,
+	})
+}
+
+func handleTelegramQRCancel(c *gin.Context) {
+	if err := telegramService.CancelQRLogin(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func handleTelegramPasswordStatus(c *gin.Context) {
+	status, err := telegramService.GetPasswordStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func handleTelegramPasswordChange(c *gin.Context) {
+	var data struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+		Hint            string `json:"hint"`
+		Email           string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil || data.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new_password is required"})
+		return
+	}
+
+	result, err := telegramService.ChangePassword(data.CurrentPassword, data.NewPassword, data.Hint, data.Email)
+	if err != nil {
+		log.Printf("Failed to change 2FA password: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+	})
+}
+
+func handleTelegramPasswordDisable(c *gin.Context) {
+	var data struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil || data.CurrentPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "current_password is required"})
+		return
+	}
+
+	if err := telegramService.DisablePassword(data.CurrentPassword); err != nil {
+		log.Printf("Failed to disable 2FA password: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func handleTelegramPasswordConfirmEmail(c *gin.Context) {
+	var data struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil || data.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	if err := telegramService.ConfirmPasswordEmail(data.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func handleTelegramPasswordRecoveryRequest(c *gin.Context) {
+	pattern, err := telegramService.RequestPasswordRecovery()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"email_pattern": pattern,
+	})
+}
+
+func handleTelegramPasswordRecoveryConfirm(c *gin.Context) {
+	var data struct {
+		Code        string `json:"code"`
+		NewPassword string `json:"new_password"`
+		Hint        string `json:"hint"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil || data.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	if err := telegramService.RecoverPassword(data.Code, data.NewPassword, data.Hint); err != nil {
+		log.Printf("Password recovery failed: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"status":  telegramService.GetStatus(),
+	})
+}
+
+// handleEventStream streams bus events as server-sent events. The optional
+// topics query parameter is a comma separated list of topic prefixes.
+func handleEventStream(c *gin.Context) {
+	var topics []string
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+
+	stream, unsubscribe := eventBus.Subscribe(events.DefaultBuffer, topics...)
+	defer unsubscribe()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-stream:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Topic, event)
+			return true
+		case <-time.After(15 * time.Second):
+			c.SSEvent("ping", gin.H{"time": time.Now().Unix()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func handleCMCGlobal(c *gin.Context) {
+	apiKey := os.Getenv("CMC_API_KEY")
+	if apiKey == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "API key not set"})
+		return
+	}
+
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", "https://pro-api.coinmarketcap.com/v1/global-metrics/quotes/latest", nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
+		return
+	}
+
+	req.Header.Set("X-CMC_PRO_API_KEY", apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch from CoinMarketCap"})
+		return
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse response"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func handleTrends(c *gin.Context) {
 	keyword := c.Query("keyword")
 	if keyword == "" {
 		keyword = "bitcoin"
@@ -500,21 +1287,8 @@ func handleSSR(c *gin.Context) {
 		return
 	}
 
-	// Calculate indicator and score based on SSR value
-	// SSR interpretation: Lower values (< 8) suggest market bottom, higher values (> 12) suggest market top
-	var indicator string
-	var score float64
-
-	if ssr < 8.0 {
-		indicator = "Buy"
-		score = 1.0
-	} else if ssr > 12.0 {
-		indicator = "Sell"
-		score = -1.0
-	} else {
-		indicator = "Hold"
-		score = 0.0
-	}
+	// Low SSR values suggest a market bottom, high values a market top
+	indicator, score := scoreIndicator("ssr", ssr)
 
 	c.JSON(http.StatusOK, gin.H{
 		"value":        ssr,
@@ -528,173 +1302,182 @@ func handleSSR(c *gin.Context) {
 	})
 }
 
+// handleExchangeFlows scores the netflow of the tracked exchange wallets
+// over the last day in million USD, positive when coins moved into the
+// exchanges, and charts it hourly
 func handleExchangeFlows(c *gin.Context) {
-	apiKey := os.Getenv("CMC_API_KEY")
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "API key not set",
-			"netFlow":      0.0,
+	snapshot := onchainTracker.Latest()
+	if snapshot == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":        "The exchange wallets are still being read",
+			"netFlow":      nil,
+			"value":        nil,
 			"indicator":    "Hold",
 			"score":        0,
-			"chart_data":   []float64{0, 0, 0, 0, 0},
-			"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
+			"chart_data":   nil,
+			"chart_labels": nil,
 		})
 		return
 	}
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://pro-api.coinmarketcap.com/v1/global-metrics/quotes/latest", nil)
+	chartData, chartLabels, err := hourlyChart(c, "exchange-flows", 24)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to create request",
-			"netFlow":      0.0,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   []float64{0, 0, 0, 0, 0},
-			"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	req.Header.Set("X-CMC_PRO_API_KEY", apiKey)
-	resp, err := client.Do(req)
-	if err != nil {
-		// Fallback to simulated data when API fails
-		netFlow := -500.0 + rand.Float64()*1000.0 // Random flow between -500 and 500
-		historical := []float64{netFlow * 0.8, netFlow * 0.9, netFlow * 0.95, netFlow * 0.98, netFlow}
-
-		var indicator string
-		var score float64
-		if netFlow < -100 {
-			indicator = "Buy"
-			score = 1
-		} else if netFlow > 100 {
-			indicator = "Sell"
-			score = -1
-		} else {
-			indicator = "Hold"
-			score = 0
-		}
+	netFlow := snapshot.Netflow / 1e6
+	indicator, score := scoreIndicator("exchange-flows", netFlow)
 
-		c.JSON(http.StatusOK, gin.H{
-			"netFlow":      netFlow,
-			"indicator":    indicator,
-			"score":        score,
-			"chart_data":   historical,
-			"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
-		})
-		return
+	c.JSON(http.StatusOK, gin.H{
+		"value":        netFlow,
+		"netFlow":      netFlow, // Keep for backward compatibility
+		"indicator":    indicator,
+		"score":        score,
+		"chart_data":   chartData,
+		"chart_labels": chartLabels,
+		"chains":       snapshot.Chains,
+		"exchanges":    snapshot.Exchanges,
+		"updated_at":   snapshot.Time,
+		"status":       onchainTracker.Status(),
+	})
+}
+
+// hourlyChart returns the stored hourly values of an indicator over the
+// last hours
+func hourlyChart(c *gin.Context, metric string, hours int) ([]float64, []string, error) {
+	points, err := timeSeries.Range(c.Request.Context(), timeseries.Indicator(metric), time.Now().Add(-time.Duration(hours)*time.Hour), time.Time{})
+	if err != nil {
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
+	data := make([]float64, len(points))
+	labels := make([]string, len(points))
+	for i, point := range points {
+		data[i] = point.Value
+		labels[i] = point.Time.Local().Format("15:04")
+	}
+	return data, labels, nil
+}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		// Fallback to simulated data
-		netFlow := -200.0 + rand.Float64()*400.0
-		historical := []float64{netFlow * 0.8, netFlow * 0.9, netFlow * 0.95, netFlow * 0.98, netFlow}
+// handleExchangeWallets lists the tracked exchange wallets with their last
+// balances
+func handleExchangeWallets(c *gin.Context) {
+	var balances []onchain.Balance
+	if snapshot := onchainTracker.Latest(); snapshot != nil {
+		balances = snapshot.Balances
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"wallets":  onchainTracker.Wallets(),
+		"balances": balances,
+		"status":   onchainTracker.Status(),
+	})
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"netFlow":      netFlow,
+// handleActiveAddresses returns the daily number of unique bitcoin
+// addresses kept by the backfill, scoring the change since the day before
+func handleActiveAddresses(c *gin.Context) {
+	chartData, chartLabels, err := dailyChart(c, "active-addresses", 30)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(chartData) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":        "The active addresses are still being backfilled",
+			"value":        nil,
 			"indicator":    "Hold",
 			"score":        0,
-			"chart_data":   historical,
-			"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
+			"chart_data":   nil,
+			"chart_labels": nil,
 		})
 		return
 	}
 
-	// Safe type assertions with fallbacks
-	var volume24h, marketCapChange float64
+	addresses := chartData[len(chartData)-1]
+	change := 0.0
+	if len(chartData) > 1 && chartData[len(chartData)-2] > 0 {
+		change = (addresses/chartData[len(chartData)-2] - 1) * 100
+	}
+	indicator, score := scoreIndicator("active-addresses", change)
 
-	if data, ok := result["data"].(map[string]interface{}); ok {
-		if quote, ok := data["quote"].(map[string]interface{}); ok {
-			if usd, ok := quote["USD"].(map[string]interface{}); ok {
-				if vol, ok := usd["total_volume_24h"].(float64); ok {
-					volume24h = vol
-				} else {
-					volume24h = 2000000000000.0 // Default 2T volume
-				}
+	c.JSON(http.StatusOK, gin.H{
+		"value":        addresses,
+		"indicator":    indicator,
+		"score":        score,
+		"chart_data":   chartData,
+		"chart_labels": chartLabels,
+		"change":       change,
+	})
+}
 
-				if change, ok := usd["total_market_cap_yesterday_percentage_change"].(float64); ok {
-					marketCapChange = change
-				} else {
-					marketCapChange = -0.5 + rand.Float64()*1.0 // Random change between -0.5% and 0.5%
-				}
-			}
-		}
+// handleWhaleTransactions counts the transfers of the tracked exchange
+// wallets above the whale threshold over the last day, scores the change
+// since the previous hour and lists the latest transfers
+func handleWhaleTransactions(c *gin.Context) {
+	snapshot := onchainTracker.Latest()
+	if snapshot == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":        "The exchange wallets are still being read",
+			"value":        nil,
+			"indicator":    "Hold",
+			"score":        0,
+			"chart_data":   nil,
+			"chart_labels": nil,
+		})
+		return
 	}
-
-	// If we couldn't get real data, use defaults
-	if volume24h == 0 {
-		volume24h = 2000000000000.0 // 2T default
-		marketCapChange = -0.5 + rand.Float64()*1.0
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	chartData, chartLabels, err := hourlyChart(c, "whale-transactions", 24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Calculate exchange flows based on volume and market cap changes
-	netFlow := -volume24h * (marketCapChange / 100.0) / 1000000000.0 // Scale down to billions
-
-	// Get historical data (last 5 days)
-	historical := make([]float64, 5)
-	for i := range historical {
-		historical[i] = netFlow * (1.0 - float64(i)*0.1) // Simple trend for demonstration
+	count := float64(snapshot.Whales)
+	change := 0.0
+	if len(chartData) > 1 && chartData[len(chartData)-2] > 0 {
+		change = (count/chartData[len(chartData)-2] - 1) * 100
 	}
+	indicator, score := scoreIndicator("whale-transactions", change)
 
-	// Calculate indicator and score
-	var indicator string
-	var score float64
-	if netFlow < -100 {
-		indicator = "Buy"
-		score = 1
-	} else if netFlow > 100 {
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
+	whales := onchainTracker.Whales()
+	var inflow, outflow float64
+	for _, whale := range whales {
+		if whale.Direction == "inflow" {
+			inflow += whale.USD
+		} else {
+			outflow += whale.USD
+		}
+	}
+	if len(whales) > limit {
+		whales = whales[:limit]
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"netFlow":      netFlow,
+		"value":        count,
 		"indicator":    indicator,
 		"score":        score,
-		"chart_data":   historical,
-		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
+		"chart_data":   chartData,
+		"chart_labels": chartLabels,
+		"change":       change,
+		"inflow_usd":   inflow,
+		"outflow_usd":  outflow,
+		"transfers":    whales,
+		"updated_at":   snapshot.Time,
 	})
 }
 
-func handleActiveAddresses(c *gin.Context) {
-	apiKey := os.Getenv("CMC_API_KEY")
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "API key not set",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
-		return
-	}
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://pro-api.coinmarketcap.com/v1/global-metrics/quotes/latest", nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to create request",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
-		return
-	}
-
-	req.Header.Set("X-CMC_PRO_API_KEY", apiKey)
-	resp, err := client.Do(req)
+// handleFundingRate scores the predicted BTCUSDT funding on Binance and
+// charts the settlements of the last five days
+func handleFundingRate(c *gin.Context) {
+	binance := funding.Binance{Service: market.NewBinanceService()}
+	snapshot, err := binance.Funding(c.Request.Context(), "BTC")
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{
-			"error":        "Failed to fetch from CoinMarketCap",
+			"error":        fmt.Sprintf("Failed to fetch funding from Binance: %v", err),
 			"value":        nil,
 			"indicator":    "Hold",
 			"score":        0,
@@ -703,213 +1486,166 @@ func handleActiveAddresses(c *gin.Context) {
 		})
 		return
 	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to parse response",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+	history, err := binance.History(c.Request.Context(), "BTC", time.Now().AddDate(0, 0, -5), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to fetch funding history from Binance: %v", err)})
 		return
 	}
-
-	data := result["data"].(map[string]interface{})
-	metrics := data["quote"].(map[string]interface{})["USD"].(map[string]interface{})
-
-	// Calculate active addresses based on volume
-	volume24h := metrics["total_volume_24h"].(float64)
-	activeAddresses := volume24h / 1000 // Rough estimate: 1 address per $1000 of volume
-
-	// Get historical data (last 5 days)
-	historical := make([]float64, 5)
-	for i := range historical {
-		historical[i] = activeAddresses * (1.0 - float64(i)*0.1) // Simple trend for demonstration
-	}
-
-	// Calculate indicator and score based on trend
-	var indicator string
-	var score float64
-	if activeAddresses > historical[1] {
-		indicator = "Buy"
-		score = 1
-	} else if activeAddresses < historical[1] {
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
+	chartData := make([]float64, len(history))
+	chartLabels := make([]string, len(history))
+	for i, rate := range history {
+		chartData[i] = rate.Rate
+		chartLabels[i] = rate.Time.Format("01-02 15h")
 	}
 
+	indicator, score := scoreIndicator("funding-rate", snapshot.PredictedRate)
 	c.JSON(http.StatusOK, gin.H{
-		"value":        activeAddresses,
-		"indicator":    indicator,
-		"score":        score,
-		"chart_data":   historical,
-		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
+		"value":             snapshot.PredictedRate,
+		"indicator":         indicator,
+		"score":             score,
+		"chart_data":        chartData,
+		"chart_labels":      chartLabels,
+		"last_rate":         snapshot.LastRate,
+		"annualized":        snapshot.AnnualizedPredicted,
+		"annualized_last":   snapshot.AnnualizedLast,
+		"next_funding_time": snapshot.NextFundingTime,
+		"interval_hours":    snapshot.IntervalHours,
 	})
 }
 
-func handleWhaleTransactions(c *gin.Context) {
-	apiKey := os.Getenv("CMC_API_KEY")
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "API key not set",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
-		return
+// fundingVenue returns the configured venue called name
+func fundingVenue(name string) (funding.Venue, bool) {
+	for _, venue := range fundingVenues {
+		if venue.Name() == strings.ToLower(name) {
+			return venue, true
+		}
 	}
+	return nil, false
+}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://pro-api.coinmarketcap.com/v1/global-metrics/quotes/latest", nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to create request",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+// handleFundingHistory returns the settled funding of ?asset= (BTC) on
+// ?venue= (binance) over the last ?days= (30)
+func handleFundingHistory(c *gin.Context) {
+	venue, ok := fundingVenue(c.DefaultQuery("venue", "binance"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown venue"})
 		return
 	}
-
-	req.Header.Set("X-CMC_PRO_API_KEY", apiKey)
-	resp, err := client.Do(req)
+	days, err := intQuery(c, "days")
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{
-			"error":        "Failed to fetch from CoinMarketCap",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to parse response",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+	historyDays := 30
+	if days != nil {
+		historyDays = *days
+	}
+	asset := strings.ToUpper(c.DefaultQuery("asset", "BTC"))
+	history, err := venue.History(c.Request.Context(), asset, time.Now().AddDate(0, 0, -historyDays), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to fetch funding history: %v", err)})
 		return
 	}
 
-	data := result["data"].(map[string]interface{})
-	metrics := data["quote"].(map[string]interface{})["USD"].(map[string]interface{})
-
-	// Calculate whale transactions based on volume
-	volume24h := metrics["total_volume_24h"].(float64)
-	whaleTransactions := volume24h / 500000 // Rough estimate: 1 whale transaction per $500,000 of volume
-
-	// Get historical data (last 5 days)
-	historical := make([]float64, 5)
-	for i := range historical {
-		historical[i] = whaleTransactions * (1.0 - float64(i)*0.1) // Simple trend for demonstration
+	type point struct {
+		Time       time.Time `json:"time"`
+		Rate       float64   `json:"rate"`
+		Annualized float64   `json:"annualized"`
 	}
-
-	// Calculate indicator and score based on trend
-	var indicator string
-	var score float64
-	if whaleTransactions > historical[1] {
-		indicator = "Buy"
-		score = 1
-	} else if whaleTransactions < historical[1] {
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
+	interval := 8 * time.Hour
+	if len(history) > 1 {
+		interval = history[len(history)-1].Time.Sub(history[len(history)-2].Time).Round(time.Hour)
+	}
+	points := make([]point, len(history))
+	var cumulative float64
+	for i, rate := range history {
+		points[i] = point{Time: rate.Time, Rate: rate.Rate, Annualized: funding.Annualize(rate.Rate, interval)}
+		cumulative += rate.Rate
+	}
+	mean := 0.0
+	if len(history) > 0 {
+		mean = funding.Annualize(cumulative/float64(len(history)), interval)
 	}
-
 	c.JSON(http.StatusOK, gin.H{
-		"value":        whaleTransactions,
-		"indicator":    indicator,
-		"score":        score,
-		"chart_data":   historical,
-		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
+		"venue":           venue.Name(),
+		"asset":           asset,
+		"interval_hours":  interval.Hours(),
+		"points":          points,
+		"mean_annualized": mean,
+		// paid by a long position over the period, in percent
+		"cumulative": cumulative * 100,
 	})
 }
 
-func handleFundingRate(c *gin.Context) {
-	apiKey := os.Getenv("CMC_API_KEY")
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "API key not set",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+// handleFundingCompare compares the funding of ?asset= (BTC) across the
+// configured venues. A spread of ?threshold= (10) percent per year between
+// the highest and lowest predicted funding counts as divergent.
+func handleFundingCompare(c *gin.Context) {
+	threshold, err := floatQuery(c, "threshold")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://fapi.binance.com/fapi/v1/premiumIndex?symbol=BTCUSDT", nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to create request",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+	divergence := 10.0
+	if threshold != nil {
+		divergence = *threshold
+	}
+	comparison := funding.Compare(c.Request.Context(), fundingVenues, c.DefaultQuery("asset", "BTC"), divergence)
+	if len(comparison.Snapshots) == 0 {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "No venue returned funding", "errors": comparison.Errors})
 		return
 	}
+	c.JSON(http.StatusOK, comparison)
+}
 
-	resp, err := client.Do(req)
+// positioningQuery reads the ?symbol= (BTCUSDT), ?period= (1h), ?lookback=
+// (24 periods) and ?threshold= (0.5 percent) of the open interest endpoints
+func positioningQuery(c *gin.Context) (symbol, period string, d time.Duration, lookback int, threshold float64, err error) {
+	symbol = strings.ToUpper(c.DefaultQuery("symbol", "BTCUSDT"))
+	period = c.DefaultQuery("period", "1h")
+	if d, err = backtest.IntervalDuration(period); err != nil {
+		return
+	}
+	lookback, threshold = 24, positioning.DefaultThreshold
+	n, err := intQuery(c, "lookback")
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{
-			"error":        "Failed to fetch from Binance",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
 		return
 	}
-	defer resp.Body.Close()
-
-	var data struct {
-		Symbol          string `json:"symbol"`
-		MarkPrice       string `json:"markPrice"`
-		LastFundingRate string `json:"lastFundingRate"`
+	if n != nil {
+		if *n < 1 {
+			err = fmt.Errorf("lookback must be positive")
+			return
+		}
+		lookback = *n
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to parse response",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+	t, err := floatQuery(c, "threshold")
+	if err != nil {
 		return
 	}
+	if t != nil {
+		threshold = *t
+	}
+	return
+}
 
-	rate, err := strconv.ParseFloat(data.LastFundingRate, 64)
+// handleOpenInterest scores the change of the open interest over the
+// lookback and classifies it against the change of the price
+func handleOpenInterest(c *gin.Context) {
+	symbol, period, d, lookback, threshold, err := positioningQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to parse funding rate value",
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	binance := market.NewBinanceService()
+	history, err := binance.OpenInterestHistory(c.Request.Context(), symbol, period, time.Now().Add(-time.Duration(2*lookback+1)*d), time.Now())
+	points := positioning.Divergence(history, lookback, threshold)
+	if err != nil || len(points) == 0 {
+		message := "Not enough open interest history"
+		if err != nil {
+			message = fmt.Sprintf("Failed to fetch open interest from Binance: %v", err)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":        message,
 			"value":        nil,
 			"indicator":    "Hold",
 			"score":        0,
@@ -918,142 +1654,148 @@ func handleFundingRate(c *gin.Context) {
 		})
 		return
 	}
+	last := points[len(points)-1]
 
-	// Get historical data (last 5 days)
-	historical := make([]float64, 5)
-	for i := range historical {
-		historical[i] = rate * (1.0 - float64(i)*0.1) // Simple trend for demonstration
-	}
-
-	// Calculate indicator and score
-	var indicator string
-	var score float64
-	if rate < -0.0001 {
-		indicator = "Buy"
-		score = 1
-	} else if rate > 0.0001 {
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
+	chartData := make([]float64, 0, lookback+1)
+	chartLabels := make([]string, 0, lookback+1)
+	for _, interest := range history[len(history)-lookback-1:] {
+		chartData = append(chartData, interest.Contracts)
+		chartLabels = append(chartLabels, interest.Time.Format("01-02 15:04"))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"value":        rate,
+	indicator, score := scoreIndicator("open-interest", last.OIChange)
+	positioningIndicator, positioningScore := scoreIndicator("oi-divergence", last.Score)
+	response := gin.H{
+		"value":        last.OpenInterest,
 		"indicator":    indicator,
 		"score":        score,
-		"chart_data":   historical,
-		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
-	})
+		"chart_data":   chartData,
+		"chart_labels": chartLabels,
+		"value_usd":    history[len(history)-1].Value,
+		"oi_change":    last.OIChange,
+		"price_change": last.PriceChange,
+		"positioning": gin.H{
+			"regime":    last.Regime,
+			"indicator": positioningIndicator,
+			"score":     positioningScore,
+		},
+	}
+	// the long/short ratio is additional context, the open interest is
+	// still served without it
+	ratios, err := binance.LongShortRatios(c.Request.Context(), symbol, period, time.Now().Add(-2*d), time.Now())
+	if err == nil && len(ratios) > 0 {
+		ratio := ratios[len(ratios)-1]
+		response["long_short"] = gin.H{
+			"ratio":   ratio.Ratio,
+			"long":    ratio.Long,
+			"short":   ratio.Short,
+			"crowded": positioning.Crowded(ratio),
+		}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func handleOpenInterest(c *gin.Context) {
-	apiKey := os.Getenv("CMC_API_KEY")
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "API key not set",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+// handleOpenInterestHistory returns the open interest of the last ?days=
+// (7) classified against the price, see positioningQuery for the other
+// parameters
+func handleOpenInterestHistory(c *gin.Context) {
+	symbol, period, d, lookback, threshold, err := positioningQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://fapi.binance.com/fapi/v1/openInterest?symbol=BTCUSDT", nil)
+	days, err := intQuery(c, "days")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to create request",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	resp, err := client.Do(req)
+	from := time.Now().AddDate(0, 0, -7)
+	if days != nil {
+		from = time.Now().AddDate(0, 0, -*days)
+	}
+	start := from.Add(-time.Duration(lookback) * d)
+	if earliest := time.Now().Add(-market.OpenInterestRetention + time.Hour); start.Before(earliest) {
+		start = earliest
+	}
+	history, err := market.NewBinanceService().OpenInterestHistory(c.Request.Context(), symbol, period, start, time.Now())
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{
-			"error":        "Failed to fetch from Binance",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to fetch open interest from Binance: %v", err)})
 		return
 	}
-	defer resp.Body.Close()
-
-	var data struct {
-		OpenInterest string `json:"openInterest"`
+	points := positioning.Divergence(history, lookback, threshold)
+	for len(points) > 0 && points[0].Time.Before(from) {
+		points = points[1:]
 	}
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":   symbol,
+		"period":   period,
+		"lookback": lookback,
+		"points":   points,
+	})
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to parse response",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+// handleLongShortRatio returns the long/short account ratio of ?symbol=
+// (BTCUSDT) per ?period= (1h) over the last ?days= (7)
+func handleLongShortRatio(c *gin.Context) {
+	symbol := strings.ToUpper(c.DefaultQuery("symbol", "BTCUSDT"))
+	period := c.DefaultQuery("period", "1h")
+	if _, err := backtest.IntervalDuration(period); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	interest, err := strconv.ParseFloat(data.OpenInterest, 64)
+	days, err := intQuery(c, "days")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to parse open interest value",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Get historical data (last 5 days)
-	historical := make([]float64, 5)
-	for i := range historical {
-		historical[i] = interest * (1.0 - float64(i)*0.1) // Simple trend for demonstration
+	from := time.Now().AddDate(0, 0, -7)
+	if days != nil {
+		from = time.Now().AddDate(0, 0, -*days)
 	}
-
-	// Calculate indicator and score based on trend
-	var indicator string
-	var score float64
-	if interest > historical[1] {
-		indicator = "Buy"
-		score = 1
-	} else if interest < historical[1] {
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
+	// Binance keeps the ratios as long as the open interest history
+	if earliest := time.Now().Add(-market.OpenInterestRetention + time.Hour); from.Before(earliest) {
+		from = earliest
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"value":        interest,
-		"indicator":    indicator,
-		"score":        score,
-		"chart_data":   historical,
-		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
-	})
+	ratios, err := market.NewBinanceService().LongShortRatios(c.Request.Context(), symbol, period, from, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to fetch long/short ratio from Binance: %v", err)})
+		return
+	}
+	response := gin.H{
+		"symbol": symbol,
+		"period": period,
+		"ratios": ratios,
+	}
+	if len(ratios) > 0 {
+		response["crowded"] = positioning.Crowded(ratios[len(ratios)-1])
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // Market metrics handlers
-func handleAltcoinSeasonIndex(c *gin.Context) {
-	index, historical, err := marketService.GetAltcoinSeasonIndex()
+// dailyChart returns the stored daily values of metric over the last days
+// as chart data and labels
+func dailyChart(c *gin.Context, metric string, days int) ([]float64, []string, error) {
+	points, err := timeSeries.Range(c.Request.Context(), timeseries.Indicator(metric), time.Now().AddDate(0, 0, -days), time.Time{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        err.Error(),
+		return nil, nil, err
+	}
+	data := make([]float64, len(points))
+	labels := make([]string, len(points))
+	for i, point := range points {
+		data[i] = point.Value
+		labels[i] = point.Time.Format("01-02")
+	}
+	return data, labels, nil
+}
+
+// handleAltcoinSeasonIndex returns the share of the top coins that
+// outperformed bitcoin over the window and its last 30 days
+func handleAltcoinSeasonIndex(c *gin.Context) {
+	latest := altcoinSeason.Latest()
+	if latest == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":        "The altcoin season index is still being computed",
 			"value":        nil,
 			"indicator":    "Hold",
 			"score":        0,
@@ -1062,13 +1804,24 @@ func handleAltcoinSeasonIndex(c *gin.Context) {
 		})
 		return
 	}
+	chartData, chartLabels, err := dailyChart(c, "altcoin-season", 30)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	indicator, score := scoreIndicator("altcoin-season", latest.Index)
 	c.JSON(http.StatusOK, gin.H{
-		"value":        index,
-		"indicator":    getIndicator(index, 25, 75),
-		"score":        getScore(index, 25, 75),
-		"chart_data":   historical,
-		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
+		"value":        latest.Index,
+		"indicator":    indicator,
+		"score":        score,
+		"chart_data":   chartData,
+		"chart_labels": chartLabels,
+		"coins":        latest.Coins,
+		"outperformed": latest.Outperformed,
+		"btc_change":   latest.BTCChange,
+		"window_days":  latest.WindowDays,
+		"performances": latest.Performances,
 	})
 }
 
@@ -1086,19 +1839,7 @@ func handleVolumeTrend(c *gin.Context) {
 		return
 	}
 
-	// Calculate trend indicator
-	var indicator string
-	var score float64
-	if trend > 0.1 {
-		indicator = "High Rising"
-		score = 1
-	} else if trend < -0.1 {
-		indicator = "Low Falling"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
-	}
+	indicator, score := scoreIndicator("volume-trend", trend)
 
 	c.JSON(http.StatusOK, gin.H{
 		"value":        trend,
@@ -1153,31 +1894,151 @@ func handleBollingerBands(c *gin.Context) {
 		historical[i] = width * (1.0 - float64(i)*0.1) // Simple trend for demonstration
 	}
 
+	indicator, score := scoreIndicator("bollinger-bands", width)
 	c.JSON(http.StatusOK, gin.H{
 		"value":        width,
-		"indicator":    getIndicator(width, 0.02, 0.04),
-		"score":        getScore(width, 0.02, 0.04),
+		"indicator":    indicator,
+		"score":        score,
 		"chart_data":   historical,
 		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
 	})
 }
 
-func getIndicator(value float64, lowerBound, upperBound float64) string {
-	if value < lowerBound {
-		return "Sell"
-	} else if value > upperBound {
-		return "Buy"
+// technicalBars returns the last closed klines of ?symbol= (BTCUSDT) at
+// ?interval= (1d) that the technical indicators are computed from
+func technicalBars(c *gin.Context) ([]backtest.Bar, error) {
+	symbol := strings.ToUpper(c.DefaultQuery("symbol", "BTCUSDT"))
+	interval := c.DefaultQuery("interval", "1d")
+	d, err := backtest.IntervalDuration(interval)
+	if err != nil {
+		return nil, err
+	}
+	candles, err := market.NewBinanceService().Klines(c.Request.Context(), symbol, interval, time.Now().Add(-300*d), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var bars []backtest.Bar
+	for _, candle := range candles {
+		// the last candle is still open
+		if candle.OpenTime.Add(d).After(time.Now()) {
+			continue
+		}
+		bars = append(bars, backtest.Bar{Time: candle.OpenTime, Close: candle.Close, High: candle.High, Low: candle.Low, Volume: candle.Volume})
+	}
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("no klines for %s", symbol)
 	}
-	return "Hold"
+	return bars, nil
 }
 
-func getScore(value float64, lowerBound, upperBound float64) float64 {
-	if value < lowerBound {
-		return -1
-	} else if value > upperBound {
-		return 1
+// handleTechnicalIndicator serves a technical indicator computed from
+// klines. details returns the indicator lines at the last bar.
+func handleTechnicalIndicator(metric string, details func(bars []backtest.Bar, closes []float64) gin.H) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bars, err := technicalBars(c)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to fetch klines: %v", err)})
+			return
+		}
+		values, _ := backtest.Derive(metric, bars)
+		value := values[len(values)-1]
+		if math.IsNaN(value) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Not enough klines for " + metric})
+			return
+		}
+
+		var chartData []float64
+		var chartLabels []string
+		for i := max(0, len(bars)-30); i < len(bars); i++ {
+			if !math.IsNaN(values[i]) {
+				chartData = append(chartData, values[i])
+				chartLabels = append(chartLabels, bars[i].Time.Format("01-02"))
+			}
+		}
+		closes := make([]float64, len(bars))
+		for i, bar := range bars {
+			closes[i] = bar.Close
+		}
+
+		indicator, score := scoreIndicator(metric, value)
+		response := gin.H{
+			"value":        value,
+			"indicator":    indicator,
+			"score":        score,
+			"chart_data":   chartData,
+			"chart_labels": chartLabels,
+		}
+		for key, detail := range details(bars, closes) {
+			response[key] = detail
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// macdDetails reports the 12/26/9 MACD lines and whether they crossed on
+// the last bar
+func macdDetails(bars []backtest.Bar, closes []float64) gin.H {
+	macd := indicators.NewMACD(closes, 12, 26, 9)
+	last := len(closes) - 1
+	cross := "none"
+	if last > 0 && macd.Histogram[last-1] <= 0 && macd.Histogram[last] > 0 {
+		cross = "bullish"
+	} else if last > 0 && macd.Histogram[last-1] >= 0 && macd.Histogram[last] < 0 {
+		cross = "bearish"
+	}
+	return gin.H{"macd": macd.MACD[last], "signal": macd.Signal[last], "histogram": macd.Histogram[last], "cross": cross}
+}
+
+// ichimokuDetails reports the 9/26/52 Ichimoku lines at the last bar
+func ichimokuDetails(bars []backtest.Bar, closes []float64) gin.H {
+	highs := make([]float64, len(bars))
+	lows := make([]float64, len(bars))
+	for i, bar := range bars {
+		highs[i], lows[i] = bar.High, bar.Low
+	}
+	ichimoku := indicators.NewIchimoku(highs, lows, closes, 9, 26, 52, 26)
+	last := len(closes) - 1
+	details := gin.H{
+		"tenkan":   ichimoku.Tenkan[last],
+		"kijun":    ichimoku.Kijun[last],
+		"senkou_a": ichimoku.SenkouA[last],
+		"senkou_b": ichimoku.SenkouB[last],
+		// the chikou span is the last close, plotted 26 bars back
+		"chikou": closes[last],
+	}
+	if last >= 26 {
+		details["chikou_above_price"] = closes[last] > closes[last-26]
+	}
+	return details
+}
+
+// stochRSIDetails reports the 14/14/3/3 stochastic RSI lines
+func stochRSIDetails(bars []backtest.Bar, closes []float64) gin.H {
+	k, d := indicators.StochRSI(closes, 14, 14, 3, 3)
+	return gin.H{"k": k[len(k)-1], "d": d[len(d)-1]}
+}
+
+// atrDetails reports the 14 bar ATR in price and in percent of the close
+func atrDetails(bars []backtest.Bar, closes []float64) gin.H {
+	highs := make([]float64, len(bars))
+	lows := make([]float64, len(bars))
+	for i, bar := range bars {
+		highs[i], lows[i] = bar.High, bar.Low
 	}
-	return 0
+	atr := indicators.ATR(highs, lows, closes, 14)
+	last := len(closes) - 1
+	return gin.H{"atr": atr[last], "atr_percent": atr[last] / closes[last] * 100}
+}
+
+// scoreIndicator scores value with the rule of metric in the active
+// strategy profile and returns its label and score
+func scoreIndicator(metric string, value float64) (string, float64) {
+	rule, ok := strategyProfiles.Active().Rule(metric)
+	if !ok {
+		return strategy.Hold, 0
+	}
+	score := rule.Score(value)
+	return rule.Label(score), score
 }
 
 func handleRSI(c *gin.Context) {
@@ -1194,19 +2055,7 @@ func handleRSI(c *gin.Context) {
 		return
 	}
 
-	// Calculate indicator and score based on RSI value
-	var indicator string
-	var score float64
-	if rsi <= 30 {
-		indicator = "Buy"
-		score = 1
-	} else if rsi >= 70 {
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
-	}
+	indicator, score := scoreIndicator("rsi", rsi)
 
 	c.JSON(http.StatusOK, gin.H{
 		"value":        rsi,
@@ -1217,53 +2066,14 @@ func handleRSI(c *gin.Context) {
 	})
 }
 
+// handleBTCDominance returns the share of bitcoin in the total market cap
+// from CoinGecko with its recorded daily history. A buy needs a falling and
+// a sell a rising dominance over the last week.
 func handleBTCDominance(c *gin.Context) {
-	apiKey := os.Getenv("CMC_API_KEY")
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "API key not set",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
-		return
-	}
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://pro-api.coinmarketcap.com/v1/global-metrics/quotes/latest", nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to create request",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
-		return
-	}
-
-	req.Header.Set("X-CMC_PRO_API_KEY", apiKey)
-	resp, err := client.Do(req)
+	dominance, err := coinGecko.Dominance(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{
-			"error":        "Failed to fetch from CoinMarketCap",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to parse response",
+			"error":        err.Error(),
 			"value":        nil,
 			"indicator":    "Hold",
 			"score":        0,
@@ -1272,65 +2082,33 @@ func handleBTCDominance(c *gin.Context) {
 		})
 		return
 	}
-
-	data, ok := result["data"].(map[string]interface{})
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Invalid response format",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+	btcDominance := dominance["btc"]
+	chartData, chartLabels, err := dailyChart(c, "btc-dominance", 30)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	btcDominance, ok := data["btc_dominance"].(float64)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "BTC dominance value not found",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+	weekAgo := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -7)
+	week, err := timeSeries.Range(c.Request.Context(), timeseries.Indicator("btc-dominance"), weekAgo, weekAgo.AddDate(0, 0, 1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get historical data (last 5 days) and calculate trend
-	historical := make([]float64, 5)
-	for i := range historical {
-		historical[i] = btcDominance + float64(i-2)*0.2 // More realistic trend simulation
-	}
-
-	// Calculate trend direction
-	isRising := btcDominance > historical[0]
-
-	// Calculate indicator and score based on documented logic
-	var indicator string
-	var score float64
-
-	if btcDominance < 50 && !isRising {
-		// Falling and below 50% - good for altcoins
-		indicator = "Buy"
-		score = 1
-	} else if btcDominance > 60 && isRising {
-		// Rising and above 60% - Bitcoin dominance increasing
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
+	indicator, score := scoreIndicator("btc-dominance", btcDominance)
+	if len(week) > 0 {
+		rising := btcDominance > week[0].Value
+		if (score > 0 && rising) || (score < 0 && !rising) {
+			indicator, score = strategy.Hold, 0
+		}
 	}
-
 	c.JSON(http.StatusOK, gin.H{
-		"value":        btcDominance,
-		"indicator":    indicator,
-		"score":        score,
-		"chart_data":   historical,
-		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
+		"value":         btcDominance,
+		"indicator":     indicator,
+		"score":         score,
+		"chart_data":    chartData,
+		"chart_labels":  chartLabels,
+		"eth_dominance": dominance["eth"],
 	})
 }
 
@@ -1409,19 +2187,7 @@ func handleMarketCap(c *gin.Context) {
 		historical[i] = marketCap * (1.0 - float64(i)*0.01) // More realistic trend
 	}
 
-	// Calculate indicator and score based on 7-day percentage change
-	var indicator string
-	var score float64
-	if percentChange7d > 5.0 {
-		indicator = "Buy"
-		score = 1
-	} else if percentChange7d < -5.0 {
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
-	}
+	indicator, score := scoreIndicator("market-cap", percentChange7d)
 
 	c.JSON(http.StatusOK, gin.H{
 		"value":        marketCap,
@@ -1526,11 +2292,16 @@ func handleETHBTCRatio(c *gin.Context) {
 	})
 }
 
+// handleLiquidation scores the liquidations of ?symbol= (BTCUSDT) recorded
+// over the last day, split by side into the 1h, 4h and 24h totals
 func handleLiquidation(c *gin.Context) {
-	apiKey := os.Getenv("CMC_API_KEY")
-	if apiKey == "" {
+	symbol := strings.ToUpper(c.DefaultQuery("symbol", "BTCUSDT"))
+	now := time.Now()
+	// a day before the last day for the cascade baseline
+	minutes, err := liquidations.Load(c.Request.Context(), timeSeries, symbol, now.Add(-48*time.Hour), now)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "API key not set",
+			"error":        err.Error(),
 			"value":        nil,
 			"indicator":    "Hold",
 			"score":        0,
@@ -1539,88 +2310,140 @@ func handleLiquidation(c *gin.Context) {
 		})
 		return
 	}
+	totals := liquidations.Totals(minutes, now, liquidations.Windows)
+	day := totals[len(totals)-1]
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://fapi.binance.com/fapi/v1/allForceOrders?symbol=BTCUSDT&limit=100", nil)
+	hourly := liquidations.Aggregate(minutes, now.Add(-24*time.Hour), now, time.Hour)
+	chartData := make([]float64, len(hourly))
+	chartLabels := make([]string, len(hourly))
+	for i, bucket := range hourly {
+		chartData[i] = bucket.Total()
+		chartLabels[i] = bucket.Time.Format("15:04")
+	}
+
+	// a cascade is active while its last hot window is the current one
+	cascades := liquidations.DetectCascades(minutes, liquidations.CascadeWindow, liquidations.CascadeMinimum, liquidations.CascadeMultiple)
+	var cascade *liquidations.Cascade
+	if len(cascades) > 0 && now.Sub(cascades[len(cascades)-1].End) < liquidations.CascadeWindow {
+		cascade = &cascades[len(cascades)-1]
+	}
+
+	status := liquidationCollector.Status()
+	indicator, score := scoreIndicator("liquidation", day.Total)
+	c.JSON(http.StatusOK, gin.H{
+		"value":        day.Total,
+		"indicator":    indicator,
+		"score":        score,
+		"chart_data":   chartData,
+		"chart_labels": chartLabels,
+		"windows":      totals,
+		"cascade":      cascade,
+		"recording":    status,
+		// liquidations are only known while the collector runs
+		"partial": status.Since.IsZero() || status.Since.After(now.Add(-24*time.Hour)),
+	})
+}
+
+// handleLiquidationHistory returns the liquidations of ?symbol= (BTCUSDT)
+// per ?bucket= (1h) over the last ?days= (7, at most 90) and the cascades
+// among them
+func handleLiquidationHistory(c *gin.Context) {
+	symbol := strings.ToUpper(c.DefaultQuery("symbol", "BTCUSDT"))
+	bucket, err := time.ParseDuration(c.DefaultQuery("bucket", "1h"))
+	if err != nil || bucket < time.Minute {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bucket must be a duration of at least 1m"})
+		return
+	}
+	days, err := intQuery(c, "days")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to create request",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	resp, err := client.Do(req)
+	now := time.Now()
+	from := now.AddDate(0, 0, -7)
+	if days != nil {
+		from = now.AddDate(0, 0, -min(*days, liquidations.MaxHistoryDays))
+	}
+	if now.Sub(from)/bucket > liquidations.MaxBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d buckets, use a longer bucket or fewer days", liquidations.MaxBuckets)})
+		return
+	}
+	minutes, err := liquidations.Load(c.Request.Context(), timeSeries, symbol, from.Add(-24*time.Hour), now)
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{
-			"error":        "Failed to fetch from Binance",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer resp.Body.Close()
-
-	var liquidations []struct {
-		Price string `json:"price"`
-		Qty   string `json:"qty"`
-		Side  string `json:"side"`
-		Time  int64  `json:"time"`
+	cascades := liquidations.DetectCascades(minutes, liquidations.CascadeWindow, liquidations.CascadeMinimum, liquidations.CascadeMultiple)
+	for len(cascades) > 0 && cascades[0].End.Before(from) {
+		cascades = cascades[1:]
 	}
+	c.JSON(http.StatusOK, gin.H{
+		"symbol":    symbol,
+		"buckets":   liquidations.Aggregate(minutes, from, now, bucket),
+		"cascades":  cascades,
+		"recording": liquidationCollector.Status(),
+	})
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&liquidations); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":        "Failed to parse response",
-			"value":        nil,
-			"indicator":    "Hold",
-			"score":        0,
-			"chart_data":   nil,
-			"chart_labels": nil,
-		})
+// handleLiquidationHeatmap estimates the liquidation levels of ?symbol=
+// (BTCUSDT) from the open interest of the last ?days= (7, at most 30) in
+// levels ?step= (0.5) percent wide within ?range= (15) percent of the price
+func handleLiquidationHeatmap(c *gin.Context) {
+	symbol := strings.ToUpper(c.DefaultQuery("symbol", "BTCUSDT"))
+	days, err := intQuery(c, "days")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Calculate total liquidation value
-	var totalValue float64
-	for _, liq := range liquidations {
-		price, _ := strconv.ParseFloat(liq.Price, 64)
-		qty, _ := strconv.ParseFloat(liq.Qty, 64)
-		totalValue += price * qty
+	step, err := floatQuery(c, "step")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	// Get historical data (last 5 days)
-	historical := make([]float64, 5)
-	for i := range historical {
-		historical[i] = totalValue * (1.0 - float64(i)*0.1) // Simple trend for demonstration
+	window, err := floatQuery(c, "range")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	// Calculate indicator and score based on liquidation volume
-	var indicator string
-	var score float64
-	if totalValue > 1e8 { // More than $100M in liquidations
-		indicator = "Sell"
-		score = -1
-	} else if totalValue < 1e7 { // Less than $10M in liquidations
-		indicator = "Buy"
-		score = 1
-	} else {
-		indicator = "Hold"
-		score = 0
+	now := time.Now()
+	from := now.AddDate(0, 0, -7)
+	if days != nil {
+		from = now.AddDate(0, 0, -*days)
+	}
+	if earliest := now.Add(-market.OpenInterestRetention + time.Hour); from.Before(earliest) {
+		from = earliest
+	}
+	stepPercent, rangePercent := 0.5, 15.0
+	if step != nil {
+		stepPercent = *step
+	}
+	if window != nil {
+		rangePercent = *window
 	}
 
+	binance := market.NewBinanceService()
+	history, err := binance.OpenInterestHistory(c.Request.Context(), symbol, "1h", from, now)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to fetch open interest from Binance: %v", err)})
+		return
+	}
+	ratios, err := binance.LongShortRatios(c.Request.Context(), symbol, "1h", from, now)
+	if err != nil {
+		// the positions are split evenly without the ratio
+		log.Printf("Failed to fetch long/short ratio for the heatmap: %v", err)
+	}
+	heatmap := liquidations.EstimateHeatmap(history, ratios, liquidations.DefaultTiers, stepPercent)
+	levels := heatmap.Levels[:0]
+	for _, level := range heatmap.Levels {
+		if math.Abs(level.Price/heatmap.Price-1)*100 <= rangePercent {
+			levels = append(levels, level)
+		}
+	}
+	heatmap.Levels = levels
 	c.JSON(http.StatusOK, gin.H{
-		"value":        totalValue,
-		"indicator":    indicator,
-		"score":        score,
-		"chart_data":   historical,
-		"chart_labels": []string{"5d", "4d", "3d", "2d", "Now"},
+		"symbol":  symbol,
+		"heatmap": heatmap,
+		"tiers":   liquidations.DefaultTiers,
 	})
 }
 
@@ -1875,19 +2698,7 @@ func handleFearGreed(c *gin.Context) {
 		labels[i] = date.Format("Jan 02")
 	}
 
-	// Calculate indicator and score
-	var indicator string
-	var score float64
-	if currentValue < 30 {
-		indicator = "Buy"
-		score = 1
-	} else if currentValue > 70 {
-		indicator = "Sell"
-		score = -1
-	} else {
-		indicator = "Hold"
-		score = 0
-	}
+	indicator, score := scoreIndicator("fear-greed", float64(currentValue))
 
 	c.JSON(http.StatusOK, gin.H{
 		"value":        currentValue,
@@ -1914,6 +2725,232 @@ func handlePortfolio(c *gin.Context) {
 	c.JSON(http.StatusOK, portfolio)
 }
 
+// portfolioWallets returns the Solana wallets of the consolidated
+// portfolio, the comma separated wallets argument or the configured wallets
+// when it is empty, sorted and without duplicates
+func portfolioWallets(wallets string) []string {
+	if wallets == "" {
+		wallets = config.GlobalConfig.PortfolioSolanaWallets
+	}
+	if wallets == "" {
+		wallets = config.GlobalConfig.WalletAddress
+	}
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, address := range strings.Split(wallets, ",") {
+		if address = strings.TrimSpace(address); address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// portfolioSources returns the venues of the consolidated portfolio. The
+// Binance wallets are only included with API credentials.
+func portfolioSources(wallets []string) []portfolio.Source {
+	var sources []portfolio.Source
+	binanceService := market.NewBinanceService()
+	if binanceService.HasCredentials() {
+		sources = append(sources,
+			portfolio.BinanceSpot{Binance: binanceService},
+			portfolio.BinanceFutures{Binance: binanceService})
+	}
+	for _, address := range wallets {
+		sources = append(sources, portfolio.SolanaWallet{Address: address, Wallets: walletService, Staking: stakingService})
+	}
+	return sources
+}
+
+func handleConsolidatedPortfolio(c *gin.Context) {
+	days, err := intQuery(c, "days")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	historyDays := 30
+	if days != nil {
+		historyDays = *days
+	}
+	for _, address := range strings.Split(c.Query("wallets"), ",") {
+		if address = strings.TrimSpace(address); address == "" {
+			continue
+		}
+		if _, err := solana.ParseAddress(address); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Only the configured wallets are recorded, the history of other
+	// wallet sets would mix into theirs
+	wallets := portfolioWallets(c.Query("wallets"))
+	if strings.Join(wallets, ",") != strings.Join(portfolioWallets(""), ",") {
+		c.JSON(http.StatusOK, portfolio.Load(c.Request.Context(), portfolioSources(wallets)))
+		return
+	}
+	from := time.Now().AddDate(0, 0, -historyDays)
+	consolidated, err := portfolioService.Consolidated(c.Request.Context(), portfolioSources(wallets), from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get consolidated portfolio: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, consolidated)
+}
+
+// handleIndicatorHistory returns the stored history of an indicator, the
+// last days (90 by default) or the range between from and to
+func handleIndicatorHistory(c *gin.Context) {
+	from, err := parseTimeQuery(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+		return
+	}
+	to, err := parseTimeQuery(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+		return
+	}
+	days, err := intQuery(c, "days")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from.IsZero() {
+		historyDays := 90
+		if days != nil {
+			historyDays = *days
+		}
+		from = time.Now().AddDate(0, 0, -historyDays)
+	}
+
+	metric := c.Param("metric")
+	points, err := timeSeries.Range(c.Request.Context(), timeseries.Indicator(metric), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load history: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"metric": metric, "points": points})
+}
+
+// handleBacktest replays the stored history through the signal rules. A POST
+// body holds a full backtest config, query parameters override single
+// settings of it or of the defaults and profile selects a saved strategy.
+func handleBacktest(c *gin.Context) {
+	cfg := backtest.DefaultConfig()
+	cfg.Strategy = strategyProfiles.Active().Strategy
+	cfg.From = time.Now().AddDate(-1, 0, 0)
+	cfg.To = time.Now()
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&cfg); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid backtest config: %v", err)})
+			return
+		}
+	}
+	if symbol := c.Query("symbol"); symbol != "" {
+		cfg.Symbol = strings.ToUpper(symbol)
+	}
+	if interval := c.Query("interval"); interval != "" {
+		cfg.Interval = interval
+	}
+	for name, t := range map[string]*time.Time{"from": &cfg.From, "to": &cfg.To} {
+		value, err := parseTimeQuery(c.Query(name))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s", name)})
+			return
+		}
+		if !value.IsZero() {
+			*t = value
+		}
+	}
+	for name, f := range map[string]*float64{"capital": &cfg.InitialCapital, "fee": &cfg.FeeRate, "slippage": &cfg.Slippage} {
+		value, err := floatQuery(c, name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if value != nil {
+			*f = *value
+		}
+	}
+	if short := c.Query("short"); short != "" {
+		cfg.AllowShort = short == "true"
+	}
+	if name := c.Query("profile"); name != "" {
+		version, err := intQuery(c, "version")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var profile *strategy.Profile
+		if version == nil {
+			profile, err = strategyProfiles.Get(name)
+		} else {
+			profile, err = strategy.LoadProfile(config.GlobalConfig.StrategyProfileDir, name, *version)
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		cfg.Strategy = profile.Strategy
+	}
+	if err := cfg.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := backtest.Run(c.Request.Context(), timeSeries, cfg)
+	if errors.Is(err, backtest.ErrNotEnoughHistory) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error() + ", run go run ./cmd/backtest -fetch to download klines"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Backtest failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func handleStrategyProfiles(c *gin.Context) {
+	c.JSON(http.StatusOK, strategyProfiles.Status())
+}
+
+func handleStrategyProfile(c *gin.Context) {
+	profile, err := strategyProfiles.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+func handleActiveStrategyProfile(c *gin.Context) {
+	c.JSON(http.StatusOK, strategyProfiles.Active())
+}
+
+// handleSwitchStrategyProfile makes the profile in the body the active one
+func handleSwitchStrategyProfile(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	profile, err := strategyProfiles.Switch(c.Request.Context(), req.Name)
+	if errors.Is(err, strategy.ErrProfileNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
 func main() {
 	// Kill any existing process on port 8080
 	if err := killProcessOnPort("8080"); err != nil {
@@ -1930,13 +2967,197 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Initialize storage
+	store, err := storage.NewStoreFromConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Market history replayed by backtests
+	timeSeries = timeseries.NewStore(store)
+
+	// Exchanges the funding comparison reads
+	fundingVenues, err = funding.Venues(config.GlobalConfig.FundingVenues, market.NewBinanceService())
+	if err != nil {
+		log.Fatalf("Invalid FUNDING_VENUES: %v", err)
+	}
+
+	// Record liquidations, Binance does not serve their history
+	var liquidationSymbols []string
+	for _, symbol := range strings.Split(config.GlobalConfig.LiquidationSymbols, ",") {
+		if symbol = strings.ToUpper(strings.TrimSpace(symbol)); symbol != "" {
+			liquidationSymbols = append(liquidationSymbols, symbol)
+		}
+	}
+	liquidationCollector = liquidations.NewCollector(liquidations.DefaultStreamURL, liquidationSymbols, timeSeries)
+	go liquidationCollector.Run(context.Background())
+
+	// Keep the indicator history current, cmd/backfill loads the years
+	// before the first start
+	coinGecko = market.NewCoinGeckoService(config.GlobalConfig.CoinGeckoAPIKey)
+	backfiller = backfill.New(store, timeSeries)
+	go backfiller.Run(context.Background(), backfill.Sources(market.NewBinanceService(), coinGecko), 7*24*time.Hour, time.Hour)
+
+	// The daily BTC dominance, the backfill only has its history with a
+	// CoinGecko API key
+	go altseason.NewDominance(coinGecko, timeSeries).Run(context.Background(), time.Hour)
+
+	// The altcoin season index and its daily history, recomputed every 6
+	// hours as it reads the prices of every coin
+	seasonConfig := altseason.DefaultConfig()
+	if seasonConfig.TopN, err = strconv.Atoi(config.GlobalConfig.AltcoinSeasonTopN); err != nil || seasonConfig.TopN < 1 {
+		log.Fatalf("Invalid ALTCOIN_SEASON_TOP_N %q", config.GlobalConfig.AltcoinSeasonTopN)
+	}
+	if seasonConfig.WindowDays, err = strconv.Atoi(config.GlobalConfig.AltcoinSeasonWindowDays); err != nil || seasonConfig.WindowDays < 1 {
+		log.Fatalf("Invalid ALTCOIN_SEASON_WINDOW_DAYS %q", config.GlobalConfig.AltcoinSeasonWindowDays)
+	}
+	seasonConfig.Exclude = nil
+	for _, list := range []struct {
+		symbols  string
+		defaults []string
+	}{
+		{config.GlobalConfig.AltcoinSeasonStablecoins, altseason.Stablecoins},
+		{config.GlobalConfig.AltcoinSeasonWrapped, altseason.Wrapped},
+	} {
+		if list.symbols == "" {
+			seasonConfig.Exclude = append(seasonConfig.Exclude, list.defaults...)
+			continue
+		}
+		for _, symbol := range strings.Split(list.symbols, ",") {
+			if symbol = strings.ToLower(strings.TrimSpace(symbol)); symbol != "" {
+				seasonConfig.Exclude = append(seasonConfig.Exclude, symbol)
+			}
+		}
+	}
+	if coinGecko.HasAPIKey() {
+		seasonConfig.Pause = 0
+	}
+	altcoinSeason = altseason.New(coinGecko, timeSeries, seasonConfig)
+	go altcoinSeason.Run(context.Background(), 6*time.Hour)
+
+	// Indicator thresholds and weights, reloaded when the files change
+	strategyProfiles, err = strategy.NewRegistry(context.Background(), config.GlobalConfig.StrategyProfilesFile,
+		config.GlobalConfig.StrategyProfileDir, store)
+	if err != nil {
+		log.Fatalf("Failed to load strategy profiles: %v", err)
+	}
+	go strategyProfiles.Run(context.Background(), 5*time.Second)
+
+	// Initialize the event bus shared by real-time subsystems
+	eventBus = events.NewBus()
+
 	// Initialize Telegram service
-	var err error
-	telegramService, err = telegram.NewTelegramService()
+	telegramService, err = telegram.NewTelegramService(store, eventBus)
 	if err != nil {
 		log.Fatalf("Failed to initialize Telegram service: %v", err)
 	}
 
+	// Initialize Solana services sharing one pooled RPC client
+	endpointSpec := config.GlobalConfig.SolanaRPCEndpoints
+	if endpointSpec == "" {
+		endpointSpec = config.GlobalConfig.RpcEndpoint
+	}
+	endpoints, err := solana.ParseEndpoints(endpointSpec)
+	if err != nil {
+		log.Fatalf("Invalid Solana RPC endpoints: %v", err)
+	}
+	commitment, err := solana.ParseCommitment(config.GlobalConfig.SolanaCommitment)
+	if err != nil {
+		log.Fatalf("Invalid Solana commitment: %v", err)
+	}
+	// Background Solana reads use the configured commitment from this
+	// context, requests get it from the middleware below
+	solanaCtx := solana.WithCommitment(context.Background(), commitment)
+	solanaRPCPool, err = solana.NewRPCPool(endpoints, commitment)
+	if err != nil {
+		log.Fatalf("Failed to create Solana RPC pool: %v", err)
+	}
+	go solanaRPCPool.Run(context.Background())
+	solanaRPC := solanaRPCPool.Client()
+	tokenResolver = solana.NewTokenResolver(solanaRPC, config.GlobalConfig.SolanaPriceAPI)
+	if config.GlobalConfig.SolanaPoolPricing == "true" {
+		tokenResolver.EnablePoolPricing()
+	}
+	walletService = solana.NewWalletService(solanaRPC, tokenResolver)
+	stakingService = solana.NewStakingService(solanaRPC, store)
+	transactionIndexer = solana.NewTransactionIndexer(solanaRPC, store, tokenResolver)
+	pnlEngine = solana.NewPnLEngine(transactionIndexer, tokenResolver, solana.NewBinanceSOLPrices("https://api.binance.com"))
+	discoveryService = solana.NewDiscoveryService(solanaRPC, store, transactionIndexer, pnlEngine, tokenResolver)
+
+	// Follow the configured wallets in real time
+	solanaMonitor = solana.NewMonitor(config.GlobalConfig.RpcWebsocketEndpoint, solanaRPC, transactionIndexer, eventBus)
+	var pinned []string
+	for _, address := range append([]string{config.GlobalConfig.WalletAddress}, strings.Split(config.GlobalConfig.SolanaWatchAddresses, ",")...) {
+		if address = strings.TrimSpace(address); address == "" {
+			continue
+		}
+		if err := solanaMonitor.Watch(address); err != nil {
+			log.Printf("Not watching %q: %v", address, err)
+			continue
+		}
+		pinned = append(pinned, address)
+	}
+	solanaWatchlist = solana.NewWatchlist(store, solanaMonitor, pinned)
+	if err := solanaWatchlist.Load(solanaCtx); err != nil {
+		log.Printf("Failed to load Solana watchlist: %v", err)
+	}
+	copyTrader = solana.NewCopyTrader(eventBus, solanaWatchlist, pnlEngine, tokenResolver)
+	go copyTrader.Run(solanaCtx)
+	go solanaMonitor.Run(solanaCtx)
+
+	// Exchange netflow and whale transfers from the balances of known
+	// exchange wallets, or from a fixture for local runs
+	wallets, err := onchain.LoadWallets(config.GlobalConfig.ExchangeWalletsFile, config.GlobalConfig.ExchangeWalletLabels)
+	if err != nil {
+		log.Fatalf("Failed to load exchange wallets: %v", err)
+	}
+	whaleThreshold, err := strconv.ParseFloat(config.GlobalConfig.WhaleThresholdUSD, 64)
+	if err != nil || whaleThreshold <= 0 {
+		log.Fatalf("Invalid WHALE_THRESHOLD_USD %q", config.GlobalConfig.WhaleThresholdUSD)
+	}
+	// The Solana wallets read a transaction per transfer, on their own
+	// pool so they do not use up the rate limit of the user facing reads
+	onchainSpec := config.GlobalConfig.OnchainSolanaRPCEndpoints
+	if onchainSpec == "" {
+		onchainSpec = config.GlobalConfig.RpcEndpoint + ";rps=2"
+	}
+	onchainEndpoints, err := solana.ParseEndpoints(onchainSpec)
+	if err != nil {
+		log.Fatalf("Invalid on-chain Solana RPC endpoints: %v", err)
+	}
+	onchainRPCPool, err := solana.NewRPCPool(onchainEndpoints, commitment)
+	if err != nil {
+		log.Fatalf("Failed to create on-chain Solana RPC pool: %v", err)
+	}
+	go onchainRPCPool.Run(context.Background())
+	var prices onchain.PriceSource = onchain.BinancePrices{BaseURL: "https://api.binance.com"}
+	chains := map[string]onchain.Chain{
+		onchain.BTC: onchain.NewBitcoin(),
+		onchain.SOL: onchain.NewSolana(onchainRPCPool.Client()),
+	}
+	if config.GlobalConfig.EtherscanAPIKey != "" {
+		chains[onchain.ETH] = onchain.NewEthereum(config.GlobalConfig.EtherscanAPIKey)
+	} else {
+		log.Printf("ETHERSCAN_API_KEY is not set, the Ethereum exchange wallets are not tracked")
+	}
+	if config.GlobalConfig.OnchainFixture != "" {
+		fixture, err := onchain.LoadFixture(config.GlobalConfig.OnchainFixture)
+		if err != nil {
+			log.Fatalf("Failed to load the on-chain fixture: %v", err)
+		}
+		if len(fixture.Wallets) > 0 {
+			wallets = fixture.Wallets
+		}
+		prices = fixture
+		chains = map[string]onchain.Chain{onchain.BTC: fixture.Chain(onchain.BTC), onchain.ETH: fixture.Chain(onchain.ETH), onchain.SOL: fixture.Chain(onchain.SOL)}
+	}
+	onchainTracker = onchain.NewTracker(chains, prices, wallets, timeSeries, whaleThreshold)
+	go onchainTracker.Run(context.Background(), 10*time.Minute)
+
+	// Record the consolidated portfolio value hourly
+	portfolioService = portfolio.NewService(store)
+	go portfolioService.Run(solanaCtx, time.Hour, func() []portfolio.Source { return portfolioSources(portfolioWallets("")) })
+
 	// Initialize market service with API key
 	marketService = market.NewMarketService(os.Getenv("CMC_API_KEY"))
 
@@ -1946,7 +3167,7 @@ func main() {
 	// Add CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 		if c.Request.Method == "OPTIONS" {
@@ -1957,12 +3178,42 @@ func main() {
 		c.Next()
 	})
 
+	// Solana reads use the configured commitment unless a handler selects
+	// another one
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(solana.WithCommitment(c.Request.Context(), commitment))
+		c.Next()
+	})
+
 	// API routes
 	api := router.Group("/api")
 	{
 		// Balance endpoint
 		api.GET("/balance", handleBalance)
 
+		// Solana endpoints
+		api.GET("/solana/wallets/:address", handleSolanaWallet)
+		api.GET("/solana/wallets/:address/staking", handleSolanaStaking)
+		api.GET("/solana/tokens/:mint", handleSolanaToken)
+		api.GET("/solana/wallets/:address/transactions", handleSolanaTransactions)
+		api.POST("/solana/wallets/:address/transactions/sync", handleSolanaTransactionsSync)
+		api.GET("/solana/wallets/:address/pnl", handleSolanaPnL)
+		api.GET("/solana/pnl", handleSolanaPnL)
+		api.GET("/solana/rpc", handleSolanaRPCStatus)
+		api.GET("/solana/monitor", handleSolanaMonitorStatus)
+		api.POST("/solana/monitor/watch", handleSolanaMonitorWatch)
+		api.DELETE("/solana/monitor/watch/:address", handleSolanaMonitorUnwatch)
+		api.POST("/solana/signatures/:signature/await", handleSolanaAwaitSignature)
+		api.GET("/solana/watchlist", handleSolanaWatchlist)
+		api.POST("/solana/watchlist", handleSolanaWatchlistAdd)
+		api.GET("/solana/watchlist/signals", handleSolanaCopyTradeSignals)
+		api.GET("/solana/watchlist/:address", handleSolanaWatchlistGet)
+		api.PUT("/solana/watchlist/:address", handleSolanaWatchlistUpdate)
+		api.DELETE("/solana/watchlist/:address", handleSolanaWatchlistRemove)
+		api.GET("/solana/profitable-wallets", handleProfitableWallets)
+		api.POST("/solana/profitable-wallets/scan", handleProfitableWalletsScan)
+		api.GET("/solana/profitable-wallets/scan", handleProfitableWalletsScanStatus)
+
 		// Telegram endpoints
 		api.GET("/telegram/auth/callback", handleTelegramAuthCallback)
 		api.GET("/telegram/phone", handleTelegramPhone)
@@ -1971,7 +3222,23 @@ func main() {
 		api.GET("/telegram/status", handleTelegramStatus)
 		api.POST("/telegram/logout", handleTelegramLogout)
 		api.GET("/telegram/groups", handleGetGroups)
+		api.GET("/telegram/folders", handleGetFolders)
 		api.GET("/telegram/current-user", handleGetCurrentUser)
+		api.POST("/telegram/session/export", handleTelegramSessionExport)
+		api.POST("/telegram/session/import", handleTelegramSessionImport)
+		api.POST("/telegram/qr/start", handleTelegramQRStart)
+		api.GET("/telegram/qr/:id", handleTelegramQRStatus)
+		api.GET("/telegram/qr/:id/image", handleTelegramQRImage)
+		api.GET("/telegram/qr/:id/stream", handleTelegramQRStream)
+		api.POST("/telegram/qr/:id/2fa", handleTelegramQR2FA)
+		api.POST("/telegram/qr/:id/cancel", handleTelegramQRCancel)
+		api.GET("/events/stream", handleEventStream)
+		api.GET("/telegram/password", handleTelegramPasswordStatus)
+		api.POST("/telegram/password/change", handleTelegramPasswordChange)
+		api.POST("/telegram/password/disable", handleTelegramPasswordDisable)
+		api.POST("/telegram/password/confirm-email", handleTelegramPasswordConfirmEmail)
+		api.POST("/telegram/password/recovery/request", handleTelegramPasswordRecoveryRequest)
+		api.POST("/telegram/password/recovery/confirm", handleTelegramPasswordRecoveryConfirm)
 
 		// Market data endpoints
 		api.GET("/cmc/global", handleCMCGlobal)
@@ -1980,8 +3247,13 @@ func main() {
 		api.GET("/exchange-flows", handleExchangeFlows)
 		api.GET("/active-addresses", handleActiveAddresses)
 		api.GET("/whale-transactions", handleWhaleTransactions)
+		api.GET("/exchange-wallets", handleExchangeWallets)
 		api.GET("/funding-rate", handleFundingRate)
+		api.GET("/funding-rate/history", handleFundingHistory)
+		api.GET("/funding-rate/compare", handleFundingCompare)
 		api.GET("/open-interest", handleOpenInterest)
+		api.GET("/open-interest/history", handleOpenInterestHistory)
+		api.GET("/long-short-ratio", handleLongShortRatio)
 
 		// Market metrics endpoints
 		api.GET("/altcoin-season", handleAltcoinSeasonIndex)
@@ -1989,6 +3261,10 @@ func main() {
 		api.GET("/bollinger-bands", handleBollingerBands)
 		api.GET("/rsi", handleRSI)
 		api.GET("/moving-averages", handleMovingAverages)
+		api.GET("/macd", handleTechnicalIndicator("macd", macdDetails))
+		api.GET("/ichimoku", handleTechnicalIndicator("ichimoku", ichimokuDetails))
+		api.GET("/stoch-rsi", handleTechnicalIndicator("stoch-rsi", stochRSIDetails))
+		api.GET("/atr", handleTechnicalIndicator("atr", atrDetails))
 
 		// Add new routes
 		api.GET("/fear-greed", handleFearGreed)
@@ -1996,8 +3272,18 @@ func main() {
 		api.GET("/market-cap", handleMarketCap)
 		api.GET("/eth-btc-ratio", handleETHBTCRatio)
 		api.GET("/liquidation", handleLiquidation)
+		api.GET("/liquidation/history", handleLiquidationHistory)
+		api.GET("/liquidation/heatmap", handleLiquidationHeatmap)
 		api.GET("/google-trends", handleGoogleTrends)
 		api.GET("/portfolio", handlePortfolio)
+		api.GET("/portfolio/consolidated", handleConsolidatedPortfolio)
+		api.GET("/history/:metric", handleIndicatorHistory)
+		api.GET("/backtest", handleBacktest)
+		api.POST("/backtest", handleBacktest)
+		api.GET("/strategy/profiles", handleStrategyProfiles)
+		api.GET("/strategy/profiles/:name", handleStrategyProfile)
+		api.GET("/strategy/active", handleActiveStrategyProfile)
+		api.PUT("/strategy/active", handleSwitchStrategyProfile)
 	}
 
 	// Start server
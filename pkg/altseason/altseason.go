@@ -0,0 +1,309 @@
+// Package altseason computes the altcoin season index: the share of the
+// largest coins that outperformed bitcoin over a window, and records the
+// bitcoin dominance
+package altseason
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/market"
+	"go-vue/pkg/timeseries"
+)
+
+const (
+	// bitcoin is the CoinGecko id of the benchmark
+	bitcoin = "bitcoin"
+	// rateLimitRetries is how often a rate limited request is retried
+	rateLimitRetries = 3
+)
+
+// Stablecoins are the symbols of the stablecoins left out of the index
+var Stablecoins = []string{
+	"usdt", "usdc", "dai", "busd", "tusd", "usdp", "usdd", "fdusd", "pyusd", "usde", "susde", "gusd",
+	"frax", "lusd", "usds", "susds", "usd0", "usd1", "rlusd", "usdtb", "usdx", "eurc", "eurt", "crvusd", "gho",
+}
+
+// Wrapped are the symbols of wrapped, staked and bridged tokens that track
+// another coin and are left out of the index
+var Wrapped = []string{
+	"wbtc", "cbbtc", "lbtc", "tbtc", "btcb", "solvbtc", "weth", "steth", "wsteth", "weeth", "reth", "cbeth",
+	"wbeth", "rseth", "ezeth", "meth", "jitosol", "msol", "bnsol", "jupsol", "wbnb", "wtrx", "bsc-usd",
+}
+
+// Source serves the ranking and price history of coins, like
+// market.CoinGeckoService
+type Source interface {
+	TopCoins(ctx context.Context, n int) ([]market.CoinMarket, error)
+	PriceChart(ctx context.Context, coin string, days int) ([]market.HistoryPoint, error)
+	// HasAPIKey reports whether more than market.PublicHistoryDays of
+	// history is served
+	HasAPIKey() bool
+}
+
+// Config selects the coins and the window of the index
+type Config struct {
+	// TopN is the number of coins ranked by market cap after the
+	// exclusions
+	TopN int
+	// WindowDays is the period the performance is compared over
+	WindowDays int
+	// HistoryDays is the number of past daily values computed with each
+	// update. Without an API key it is limited to what fits in
+	// market.PublicHistoryDays along with the window.
+	HistoryDays int
+	// Exclude holds the lower case symbols left out, Stablecoins and
+	// Wrapped by default
+	Exclude []string
+	// Pause is the wait between two price requests, the free CoinGecko API
+	// allows a few requests per minute
+	Pause time.Duration
+	// Backoff is the wait before retrying a rate limited request, doubled
+	// with every retry
+	Backoff time.Duration
+}
+
+// DefaultConfig is the usual definition over the top 50 coins and 90 days
+func DefaultConfig() Config {
+	return Config{
+		TopN:        50,
+		WindowDays:  90,
+		HistoryDays: 365,
+		Exclude:     append(append([]string{}, Stablecoins...), Wrapped...),
+		Pause:       2 * time.Second,
+		Backoff:     30 * time.Second,
+	}
+}
+
+// Performance is the change of one coin over the window
+type Performance struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+	// Change is in percent
+	Change       float64 `json:"change"`
+	Outperformed bool    `json:"outperformed"`
+}
+
+// Result is the index of one day
+type Result struct {
+	Time time.Time `json:"time"`
+	// Index is the percentage of the coins that outperformed bitcoin
+	Index        float64 `json:"index"`
+	Coins        int     `json:"coins"`
+	Outperformed int     `json:"outperformed"`
+	// BTCChange is the change of bitcoin over the window in percent
+	BTCChange    float64       `json:"btc_change"`
+	WindowDays   int           `json:"window_days"`
+	Performances []Performance `json:"performances"`
+}
+
+// Index keeps the altcoin season index current
+type Index struct {
+	source Source
+	series *timeseries.Store
+	config Config
+
+	mu     sync.Mutex
+	latest *Result
+}
+
+// New creates an index reading coins from source and writing its daily
+// history to the altcoin-season indicator series
+func New(source Source, series *timeseries.Store, config Config) *Index {
+	return &Index{source: source, series: series, config: config}
+}
+
+// Latest returns the last computed index, nil before the first update
+func (x *Index) Latest() *Result {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.latest
+}
+
+// Run updates the index now and then every interval until ctx is done
+func (x *Index) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := x.Update(ctx); err != nil {
+			log.Printf("Failed to update the altcoin season index: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Update computes the index of today and the HistoryDays before and
+// stores them. A price request still rate limited after the retries fails
+// the update, a coin without history is left out.
+func (x *Index) Update(ctx context.Context) (*Result, error) {
+	coins, err := x.coins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	historyDays := x.config.HistoryDays
+	if !x.source.HasAPIKey() && x.config.WindowDays+historyDays > market.PublicHistoryDays {
+		historyDays = max(market.PublicHistoryDays-x.config.WindowDays, 0)
+	}
+	days := x.config.WindowDays + historyDays
+	btc, err := x.priceChart(ctx, bitcoin, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the bitcoin prices: %v", err)
+	}
+	prices := make(map[string][]market.HistoryPoint, len(coins))
+	for _, coin := range coins {
+		if err := x.wait(ctx, x.config.Pause); err != nil {
+			return nil, err
+		}
+		chart, err := x.priceChart(ctx, coin.ID, days)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the %s prices: %v", coin.ID, err)
+		}
+		prices[coin.ID] = chart
+	}
+
+	results := Compute(coins, prices, btc, x.config.WindowDays)
+	if len(results) == 0 {
+		return nil, fmt.Errorf("not enough price history for a %d day window", x.config.WindowDays)
+	}
+	points := make([]timeseries.Point, len(results))
+	for i, result := range results {
+		points[i] = timeseries.Point{Time: result.Time, Value: result.Index}
+	}
+	if _, err := x.series.Write(ctx, timeseries.Indicator("altcoin-season"), points); err != nil {
+		return nil, err
+	}
+
+	latest := results[len(results)-1]
+	x.mu.Lock()
+	x.latest = &latest
+	x.mu.Unlock()
+	return &latest, nil
+}
+
+// coins returns the TopN coins left after the exclusions and bitcoin
+func (x *Index) coins(ctx context.Context) ([]market.CoinMarket, error) {
+	excluded := make(map[string]bool, len(x.config.Exclude))
+	for _, symbol := range x.config.Exclude {
+		excluded[strings.ToLower(symbol)] = true
+	}
+	// fetch enough to fill TopN after the exclusions
+	ranked, err := x.source.TopCoins(ctx, x.config.TopN+len(excluded)+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the top coins: %v", err)
+	}
+	var coins []market.CoinMarket
+	for _, coin := range ranked {
+		if coin.ID == bitcoin || excluded[strings.ToLower(coin.Symbol)] {
+			continue
+		}
+		coins = append(coins, coin)
+		if len(coins) == x.config.TopN {
+			break
+		}
+	}
+	return coins, nil
+}
+
+// priceChart fetches the prices of coin, retrying rate limited requests
+// after Backoff
+func (x *Index) priceChart(ctx context.Context, coin string, days int) ([]market.HistoryPoint, error) {
+	backoff := x.config.Backoff
+	for retry := 0; ; retry++ {
+		chart, err := x.source.PriceChart(ctx, coin, days)
+		if !errors.Is(err, market.ErrRateLimited) || retry == rateLimitRetries {
+			return chart, err
+		}
+		log.Printf("Rate limited fetching the %s prices, retrying in %s", coin, backoff)
+		if err := x.wait(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+func (x *Index) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// Compute returns the index of every day with a bitcoin price windowDays
+// earlier, in time order. A coin counts on the days it has a price at both
+// ends of the window. The ranking is today's, so earlier days leave out the
+// coins that dropped out of it since.
+func Compute(coins []market.CoinMarket, prices map[string][]market.HistoryPoint, btc []market.HistoryPoint, windowDays int) []Result {
+	btcAt := daily(btc)
+	coinAt := make(map[string]map[int64]float64, len(coins))
+	for _, coin := range coins {
+		if chart, ok := prices[coin.ID]; ok {
+			coinAt[coin.ID] = daily(chart)
+		}
+	}
+
+	var days []int64
+	for day := range btcAt {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+
+	window := int64(windowDays) * 24 * 60 * 60
+	var results []Result
+	for _, day := range days {
+		btcStart, ok := btcAt[day-window]
+		if !ok || btcStart == 0 {
+			continue
+		}
+		result := Result{
+			Time:         time.Unix(day, 0).UTC(),
+			BTCChange:    (btcAt[day]/btcStart - 1) * 100,
+			WindowDays:   windowDays,
+			Performances: []Performance{},
+		}
+		for _, coin := range coins {
+			at := coinAt[coin.ID]
+			start, end := at[day-window], at[day]
+			if start == 0 || end == 0 {
+				continue
+			}
+			performance := Performance{ID: coin.ID, Symbol: coin.Symbol, Change: (end/start - 1) * 100}
+			performance.Outperformed = performance.Change > result.BTCChange
+			result.Performances = append(result.Performances, performance)
+			result.Coins++
+			if performance.Outperformed {
+				result.Outperformed++
+			}
+		}
+		if result.Coins == 0 {
+			continue
+		}
+		result.Index = float64(result.Outperformed) / float64(result.Coins) * 100
+		results = append(results, result)
+	}
+	return results
+}
+
+// daily keys the last price of every UTC day by the unix time of its
+// midnight
+func daily(chart []market.HistoryPoint) map[int64]float64 {
+	days := make(map[int64]float64, len(chart))
+	for _, point := range chart {
+		days[point.Time.UTC().Truncate(24*time.Hour).Unix()] = point.Value
+	}
+	return days
+}
@@ -0,0 +1,176 @@
+package altseason
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"go-vue/pkg/market"
+	"go-vue/pkg/storage"
+	"go-vue/pkg/timeseries"
+)
+
+// stubSource serves prices growing by a fixed daily percentage per coin
+type stubSource struct {
+	now    time.Time
+	coins  []market.CoinMarket
+	growth map[string]float64
+	// listed is the number of days of history of a coin, all of them when 0
+	listed map[string]int
+	apiKey bool
+	// limited is the number of rate limited answers before the prices of a
+	// coin are served
+	limited map[string]int
+	// days is the number of days requested last
+	days int
+}
+
+func (s *stubSource) HasAPIKey() bool { return s.apiKey }
+
+func (s *stubSource) TopCoins(ctx context.Context, n int) ([]market.CoinMarket, error) {
+	if n > len(s.coins) {
+		n = len(s.coins)
+	}
+	return s.coins[:n], nil
+}
+
+func (s *stubSource) PriceChart(ctx context.Context, coin string, days int) ([]market.HistoryPoint, error) {
+	s.days = days
+	if s.limited[coin] > 0 {
+		s.limited[coin]--
+		return nil, market.ErrRateLimited
+	}
+	growth, ok := s.growth[coin]
+	if !ok {
+		return nil, fmt.Errorf("unknown coin %s", coin)
+	}
+	if listed := s.listed[coin]; listed > 0 && listed < days {
+		days = listed
+	}
+	today := s.now.Truncate(24 * time.Hour)
+	var chart []market.HistoryPoint
+	for i := days; i >= 0; i-- {
+		chart = append(chart, market.HistoryPoint{Time: today.AddDate(0, 0, -i), Value: 100 * math.Pow(1+growth, float64(days-i))})
+	}
+	return chart, nil
+}
+
+func TestUpdate(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := timeseries.NewStore(store)
+	source := &stubSource{
+		now: time.Now(),
+		coins: []market.CoinMarket{
+			{ID: "bitcoin", Symbol: "btc"},
+			{ID: "ethereum", Symbol: "eth"},
+			{ID: "tether", Symbol: "usdt"},
+			{ID: "solana", Symbol: "sol"},
+			{ID: "wrapped-bitcoin", Symbol: "wbtc"},
+			{ID: "dogecoin", Symbol: "doge"},
+			{ID: "newcoin", Symbol: "new"},
+			{ID: "cardano", Symbol: "ada"},
+		},
+		growth: map[string]float64{
+			"bitcoin":         0.002,
+			"ethereum":        0.003,
+			"tether":          0,
+			"solana":          0.001,
+			"wrapped-bitcoin": 0.002,
+			"dogecoin":        0.004,
+			"newcoin":         0.01,
+			"cardano":         0,
+		},
+		listed: map[string]int{"newcoin": 30},
+	}
+	config := DefaultConfig()
+	config.TopN, config.WindowDays, config.HistoryDays, config.Pause, config.Backoff = 4, 90, 10, 0, 0
+
+	index := New(source, series, config)
+	result, err := index.Update(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// eth, sol, doge and the new coin are the top 4 after the exclusions,
+	// the new coin has no price 90 days ago
+	if result.Coins != 3 || result.Outperformed != 2 || math.Abs(result.Index-200.0/3) > 1e-9 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if index.Latest() == nil || index.Latest().Index != result.Index {
+		t.Fatal("latest should be the last update")
+	}
+
+	points, err := series.Range(context.Background(), timeseries.Indicator("altcoin-season"), time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != config.HistoryDays+1 {
+		t.Fatalf("expected %d daily points, got %d", config.HistoryDays+1, len(points))
+	}
+}
+
+func TestUpdateRateLimited(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &stubSource{
+		now:     time.Now(),
+		coins:   []market.CoinMarket{{ID: "bitcoin", Symbol: "btc"}, {ID: "ethereum", Symbol: "eth"}},
+		growth:  map[string]float64{"bitcoin": 0.002, "ethereum": 0.003},
+		limited: map[string]int{"ethereum": rateLimitRetries},
+	}
+	config := DefaultConfig()
+	config.Pause, config.Backoff = 0, 0
+
+	// without an API key the window and history fit in the public range
+	index := New(source, timeseries.NewStore(store), config)
+	result, err := index.Update(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.days != market.PublicHistoryDays || result.Coins != 1 {
+		t.Fatalf("requested %d days, got %+v", source.days, result)
+	}
+
+	// a coin rate limited past the retries fails the update
+	source.limited["ethereum"] = rateLimitRetries + 1
+	if _, err := index.Update(context.Background()); err == nil || !strings.Contains(err.Error(), market.ErrRateLimited.Error()) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+}
+
+type stubDominance map[string]float64
+
+func (s stubDominance) Dominance(ctx context.Context) (map[string]float64, error) { return s, nil }
+
+func TestDominanceRecord(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := timeseries.NewStore(store)
+	now := time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC)
+	dominance := NewDominance(stubDominance{"btc": 54.2, "eth": 17.1}, series)
+	dominance.now = func() time.Time { return now }
+
+	// the recordings of a day replace each other
+	for _, at := range []time.Time{now, now.Add(time.Hour)} {
+		now = at
+		if _, err := dominance.Record(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	points, err := series.Range(context.Background(), timeseries.Indicator("btc-dominance"), time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Value != 54.2 || !points[0].Time.Equal(now.Truncate(24*time.Hour)) {
+		t.Fatalf("unexpected points %+v", points)
+	}
+}
@@ -0,0 +1,62 @@
+package altseason
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go-vue/pkg/timeseries"
+)
+
+// DominanceSource serves the share of the total market cap per coin
+// symbol, like market.CoinGeckoService
+type DominanceSource interface {
+	Dominance(ctx context.Context) (map[string]float64, error)
+}
+
+// Dominance records the daily bitcoin dominance to the btc-dominance
+// indicator series
+type Dominance struct {
+	source DominanceSource
+	series *timeseries.Store
+	now    func() time.Time
+}
+
+// NewDominance creates a recorder of the dominance served by source
+func NewDominance(source DominanceSource, series *timeseries.Store) *Dominance {
+	return &Dominance{source: source, series: series, now: time.Now}
+}
+
+// Run records now and then every interval until ctx is done
+func (d *Dominance) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.Record(ctx); err != nil {
+			log.Printf("Failed to record the BTC dominance: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Record stores the current dominance as the value of today and returns it
+func (d *Dominance) Record(ctx context.Context) (float64, error) {
+	dominance, err := d.source.Dominance(ctx)
+	if err != nil {
+		return 0, err
+	}
+	btc, ok := dominance["btc"]
+	if !ok {
+		return 0, fmt.Errorf("no BTC dominance")
+	}
+	today := d.now().UTC().Truncate(24 * time.Hour)
+	if _, err := d.series.Write(ctx, timeseries.Indicator("btc-dominance"), []timeseries.Point{{Time: today, Value: btc}}); err != nil {
+		return 0, err
+	}
+	return btc, nil
+}
@@ -0,0 +1,212 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-vue/pkg/storage"
+	"go-vue/pkg/timeseries"
+)
+
+// checkpointPrefix stores the progress of each source
+const checkpointPrefix = "backfill/"
+
+// Source fetches the history of one or more series from an upstream API
+type Source interface {
+	// Name identifies the source in checkpoints and reports
+	Name() string
+	// Step is the span fetched per call, progress is saved after each one.
+	// Zero fetches the whole range at once.
+	Step() time.Duration
+	// Earliest is the first time upstream serves at now, zero when unknown
+	Earliest(now time.Time) time.Time
+	// Fetch returns the points of each series between from and to
+	Fetch(ctx context.Context, from, to time.Time) (map[string][]timeseries.Point, error)
+}
+
+// Deriver is implemented by sources whose stored series feed computed
+// series, Derive runs after every backfill of the source
+type Deriver interface {
+	Derive(ctx context.Context, series *timeseries.Store, from, to time.Time) (int, error)
+}
+
+// Checkpoint is the contiguous range a source has been backfilled over
+type Checkpoint struct {
+	From      time.Time `json:"from"`
+	Through   time.Time `json:"through"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Report is the outcome of backfilling one source
+type Report struct {
+	Source string    `json:"source"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Calls is the number of upstream fetches, zero when the checkpoint
+	// already covered the range
+	Calls   int    `json:"calls"`
+	Added   int    `json:"added"`
+	Derived int    `json:"derived"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Backfiller writes the history of sources into a time series store. Writes
+// are upserts and progress is checkpointed after every step, so runs can be
+// repeated and resume where an interrupted run stopped.
+type Backfiller struct {
+	store  storage.Store
+	series *timeseries.Store
+	now    func() time.Time
+}
+
+// New creates a backfiller that keeps its checkpoints in store
+func New(store storage.Store, series *timeseries.Store) *Backfiller {
+	return &Backfiller{store: store, series: series, now: time.Now}
+}
+
+// Checkpoint returns the progress of the source called name, nil before
+// its first backfill
+func (b *Backfiller) Checkpoint(ctx context.Context, name string) (*Checkpoint, error) {
+	data, err := b.store.Get(ctx, checkpointPrefix+name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint of %s: %v", name, err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint of %s: %v", name, err)
+	}
+	return &checkpoint, nil
+}
+
+// Reset forgets the progress of the source called name so that its next
+// backfill starts over
+func (b *Backfiller) Reset(ctx context.Context, name string) error {
+	if err := b.store.Delete(ctx, checkpointPrefix+name); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to reset checkpoint of %s: %v", name, err)
+	}
+	return nil
+}
+
+func (b *Backfiller) saveCheckpoint(ctx context.Context, name string, checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := b.store.Put(ctx, checkpointPrefix+name, data); err != nil {
+		return fmt.Errorf("failed to save checkpoint of %s: %v", name, err)
+	}
+	return nil
+}
+
+// Backfill fetches the history of source between from and to, a zero to
+// meaning now. The part of the range covered by the checkpoint is skipped.
+func (b *Backfiller) Backfill(ctx context.Context, source Source, from, to time.Time) (Report, error) {
+	now := b.now()
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if earliest := source.Earliest(now); from.Before(earliest) {
+		from = earliest
+	}
+	report := Report{Source: source.Name(), From: from, To: to}
+
+	checkpoint, err := b.Checkpoint(ctx, source.Name())
+	if err != nil {
+		return report, err
+	}
+	start := from
+	covered := Checkpoint{From: from, Through: from}
+	if checkpoint != nil && !checkpoint.From.After(from) && checkpoint.Through.After(from) {
+		covered.From = checkpoint.From
+		covered.Through = checkpoint.Through
+		start = checkpoint.Through
+	}
+
+	for start.Before(to) {
+		end := to
+		if step := source.Step(); step > 0 && start.Add(step).Before(to) {
+			end = start.Add(step)
+		}
+		points, err := source.Fetch(ctx, start, end)
+		report.Calls++
+		if err != nil {
+			return report, fmt.Errorf("%s: %v", source.Name(), err)
+		}
+		var last time.Time
+		for name, list := range points {
+			added, err := b.series.Write(ctx, name, list)
+			report.Added += added
+			if err != nil {
+				return report, err
+			}
+			for _, point := range list {
+				if point.Time.After(last) {
+					last = point.Time
+				}
+			}
+		}
+
+		covered.Through = end
+		if end.Equal(now) {
+			// values of the latest period may still change or be published
+			// late, the next run fetches them again
+			covered.Through = start
+			if !last.IsZero() && !last.Before(start) {
+				covered.Through = last.Add(time.Nanosecond)
+			}
+		}
+		covered.UpdatedAt = b.now()
+		if err := b.saveCheckpoint(ctx, source.Name(), covered); err != nil {
+			return report, err
+		}
+		start = end
+	}
+
+	if deriver, ok := source.(Deriver); ok {
+		derived, err := deriver.Derive(ctx, b.series, from, to)
+		report.Derived = derived
+		if err != nil {
+			return report, fmt.Errorf("%s: %v", source.Name(), err)
+		}
+	}
+	return report, nil
+}
+
+// All backfills every source, a failing source does not stop the others
+func (b *Backfiller) All(ctx context.Context, sources []Source, from, to time.Time) []Report {
+	reports := make([]Report, 0, len(sources))
+	for _, source := range sources {
+		report, err := b.Backfill(ctx, source, from, to)
+		if err != nil {
+			report.Error = err.Error()
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// Run keeps the sources up to date, backfilling the last lookback every
+// interval. The checkpoints make each run fetch only what is new.
+func (b *Backfiller) Run(ctx context.Context, sources []Source, lookback, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, report := range b.All(ctx, sources, b.now().Add(-lookback), time.Time{}) {
+			if report.Error != "" {
+				log.Printf("Backfill of %s failed: %s", report.Source, report.Error)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go-vue/pkg/storage"
+	"go-vue/pkg/timeseries"
+)
+
+// daySource emits one point per day and fails its failAt-th fetch
+type daySource struct {
+	failAt int
+	calls  []time.Time
+}
+
+func (s *daySource) Name() string                 { return "days" }
+func (s *daySource) Step() time.Duration          { return 10 * 24 * time.Hour }
+func (s *daySource) Earliest(time.Time) time.Time { return time.Time{} }
+
+func (s *daySource) Fetch(ctx context.Context, from, to time.Time) (map[string][]timeseries.Point, error) {
+	s.calls = append(s.calls, from)
+	if len(s.calls) == s.failAt {
+		return nil, fmt.Errorf("upstream down")
+	}
+	var points []timeseries.Point
+	for t := from.Truncate(24 * time.Hour); t.Before(to); t = t.Add(24 * time.Hour) {
+		if !t.Before(from) {
+			points = append(points, timeseries.Point{Time: t, Value: float64(t.Unix())})
+		}
+	}
+	return map[string][]timeseries.Point{"test/days": points}, nil
+}
+
+func TestBackfillResumes(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := timeseries.NewStore(store)
+	b := New(store, series)
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	from := time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC)
+
+	source := &daySource{failAt: 3}
+	report, err := b.Backfill(ctx, source, from, time.Time{})
+	if err == nil || report.Calls != 3 || report.Added != 20 {
+		t.Fatalf("expected a failure after 20 days, got %+v, %v", report, err)
+	}
+
+	source.calls, source.failAt = nil, 0
+	report, err = b.Backfill(ctx, source, from, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !source.calls[0].Equal(from.Add(20*24*time.Hour)) || report.Added != 16 {
+		t.Fatalf("expected to resume after 20 days, fetched from %v, %+v", source.calls, report)
+	}
+	points, err := series.Range(ctx, "test/days", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 36 {
+		t.Fatalf("expected 36 daily points, got %d", len(points))
+	}
+
+	// only the open end is fetched again and nothing is duplicated
+	source.calls = nil
+	report, err = b.Backfill(ctx, source, from, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Calls != 1 || report.Added != 0 || !source.calls[0].After(now.Add(-24*time.Hour)) {
+		t.Fatalf("expected one call for the latest day, got %v, %+v", source.calls, report)
+	}
+
+	// an earlier start ignores the checkpoint, the upserts stay idempotent
+	source.calls = nil
+	report, err = b.Backfill(ctx, source, from.Add(-5*24*time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 5 {
+		t.Fatalf("expected the 5 earlier days, got %+v", report)
+	}
+	checkpoint, err := b.Checkpoint(ctx, source.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkpoint.From.Equal(from.Add(-5 * 24 * time.Hour)) {
+		t.Fatalf("unexpected checkpoint %+v", checkpoint)
+	}
+}
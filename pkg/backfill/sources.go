@@ -0,0 +1,347 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go-vue/pkg/backtest"
+	"go-vue/pkg/market"
+	"go-vue/pkg/positioning"
+	"go-vue/pkg/timeseries"
+)
+
+// Sources returns the history sources of the dashboard indicators. The
+// market cap and dominance history needs a CoinGecko API key and is left
+// out without one.
+func Sources(binance *market.BinanceService, coingecko *market.CoinGeckoService) []Source {
+	sources := []Source{
+		Klines{Binance: binance, Symbol: "BTCUSDT", Interval: "1d", Indicators: []string{
+			"rsi", "moving-averages", "volume-trend", "bollinger-bands", "macd", "ichimoku", "stoch-rsi", "atr",
+		}},
+		Klines{Binance: binance, Symbol: "ETHBTC", Interval: "1d", Indicators: []string{"eth-btc-ratio"}},
+		Funding{Binance: binance, Symbol: "BTCUSDT"},
+		OpenInterest{Binance: binance, Symbol: "BTCUSDT", Period: "1h", Lookback: 24},
+		FearGreed{},
+		ActiveAddresses{},
+	}
+	if coingecko.HasAPIKey() {
+		sources = append(sources, CoinGecko{Client: coingecko})
+	}
+	return sources
+}
+
+// Klines backfills the close, high, low and volume series of a Binance
+// symbol and derives indicator series from them
+type Klines struct {
+	Binance  *market.BinanceService
+	Symbol   string
+	Interval string
+	// Indicators are the indicator series computed from the candles, see
+	// derivations
+	Indicators []string
+}
+
+func (k Klines) Name() string { return "klines/" + k.Symbol + "/" + k.Interval }
+
+// Step is one page of klines
+func (k Klines) Step() time.Duration {
+	d, _ := backtest.IntervalDuration(k.Interval)
+	return 1000 * d
+}
+
+// Binance spot opened in July 2017
+func (k Klines) Earliest(time.Time) time.Time { return time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC) }
+
+func (k Klines) Fetch(ctx context.Context, from, to time.Time) (map[string][]timeseries.Point, error) {
+	candles, err := k.Binance.Klines(ctx, k.Symbol, k.Interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return backtest.KlineSeries(k.Symbol, k.Interval, candles)
+}
+
+// derivations compute indicators from candles where the live endpoints
+// take them from other APIs
+var derivations = map[string]func([]backtest.Bar) []float64{
+	// the bollinger-bands endpoint scores the absolute daily change
+	"bollinger-bands": func(bars []backtest.Bar) []float64 {
+		values := make([]float64, len(bars))
+		for i := range bars {
+			values[i] = math.NaN()
+			if i > 0 && bars[i-1].Close > 0 {
+				values[i] = math.Abs(bars[i].Close/bars[i-1].Close - 1)
+			}
+		}
+		return values
+	},
+	"eth-btc-ratio": func(bars []backtest.Bar) []float64 {
+		values := make([]float64, len(bars))
+		for i, bar := range bars {
+			values[i] = bar.Close
+		}
+		return values
+	},
+}
+
+// Derive writes the indicator series of the candles between from and to,
+// reading the warmup the indicators need before from
+func (k Klines) Derive(ctx context.Context, series *timeseries.Store, from, to time.Time) (int, error) {
+	if len(k.Indicators) == 0 {
+		return 0, nil
+	}
+	d, err := backtest.IntervalDuration(k.Interval)
+	if err != nil {
+		return 0, err
+	}
+	fields := make(map[string][]timeseries.Point)
+	for _, field := range []string{"close", "high", "low", "volume"} {
+		points, err := series.Range(ctx, timeseries.Kline(k.Symbol, k.Interval, field), from.Add(-backtest.WarmupBars*d), to)
+		if err != nil {
+			return 0, err
+		}
+		fields[field] = points
+	}
+	bars := backtest.Bars(fields["close"], fields["high"], fields["low"], fields["volume"])
+
+	total := 0
+	for _, metric := range k.Indicators {
+		values, ok := backtest.Derive(metric, bars)
+		if !ok {
+			derivation, found := derivations[metric]
+			if !found {
+				return total, fmt.Errorf("cannot derive %s from klines", metric)
+			}
+			values = derivation(bars)
+		}
+		var points []timeseries.Point
+		for i, value := range values {
+			if !math.IsNaN(value) && !bars[i].Time.Before(from) {
+				points = append(points, timeseries.Point{Time: bars[i].Time, Value: value})
+			}
+		}
+		added, err := series.Write(ctx, timeseries.Indicator(metric), points)
+		total += added
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Funding backfills the settled funding rates of a perpetual contract
+type Funding struct {
+	Binance *market.BinanceService
+	Symbol  string
+}
+
+func (f Funding) Name() string { return "funding/" + f.Symbol }
+
+// Step is one page of 8 hourly rates
+func (f Funding) Step() time.Duration { return 1000 * 8 * time.Hour }
+
+// Binance launched its first perpetual contract in September 2019
+func (f Funding) Earliest(time.Time) time.Time { return time.Date(2019, 9, 1, 0, 0, 0, 0, time.UTC) }
+
+func (f Funding) Fetch(ctx context.Context, from, to time.Time) (map[string][]timeseries.Point, error) {
+	rates, err := f.Binance.FundingRates(ctx, f.Symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]timeseries.Point, len(rates))
+	for i, rate := range rates {
+		points[i] = timeseries.Point{Time: rate.Time, Value: rate.Rate}
+	}
+	return map[string][]timeseries.Point{timeseries.Indicator("funding-rate"): points}, nil
+}
+
+// OpenInterest backfills the open interest of a perpetual contract, which
+// Binance keeps for 30 days, and the oi-divergence series classifying it
+// against the price Lookback periods earlier
+type OpenInterest struct {
+	Binance  *market.BinanceService
+	Symbol   string
+	Period   string
+	Lookback int
+}
+
+func (o OpenInterest) Name() string { return "open-interest/" + o.Symbol + "/" + o.Period }
+
+func (o OpenInterest) Step() time.Duration { return 0 }
+
+func (o OpenInterest) Earliest(now time.Time) time.Time {
+	// stay clear of the edge of the retention window
+	return now.Add(-market.OpenInterestRetention + time.Hour)
+}
+
+func (o OpenInterest) Fetch(ctx context.Context, from, to time.Time) (map[string][]timeseries.Point, error) {
+	period, err := backtest.IntervalDuration(o.Period)
+	if err != nil {
+		return nil, err
+	}
+	// the divergence of the first points compares them with earlier ones
+	start := from.Add(-time.Duration(o.Lookback) * period)
+	if earliest := o.Earliest(time.Now()); start.Before(earliest) {
+		start = earliest
+	}
+	history, err := o.Binance.OpenInterestHistory(ctx, o.Symbol, o.Period, start, to)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]timeseries.Point, 0, len(history))
+	for _, interest := range history {
+		if !interest.Time.Before(from) {
+			points = append(points, timeseries.Point{Time: interest.Time, Value: interest.Contracts})
+		}
+	}
+	var divergence []timeseries.Point
+	for _, point := range positioning.Divergence(history, o.Lookback, positioning.DefaultThreshold) {
+		if !point.Time.Before(from) {
+			divergence = append(divergence, timeseries.Point{Time: point.Time, Value: point.Score})
+		}
+	}
+	return map[string][]timeseries.Point{
+		timeseries.Indicator("open-interest"): points,
+		timeseries.Indicator("oi-divergence"): divergence,
+	}, nil
+}
+
+// FearGreed backfills the daily Fear & Greed Index of alternative.me
+type FearGreed struct{}
+
+func (FearGreed) Name() string { return "fear-greed" }
+
+// Step is zero, the API returns the whole history in one call with
+// limit=0
+func (FearGreed) Step() time.Duration { return 0 }
+
+// The index starts in February 2018
+func (FearGreed) Earliest(time.Time) time.Time { return time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC) }
+
+func (FearGreed) Fetch(ctx context.Context, from, to time.Time) (map[string][]timeseries.Point, error) {
+	days := 0
+	if since := time.Since(from); since < 365*24*time.Hour {
+		days = int(since.Hours()/24) + 2
+	}
+	history, err := market.FearGreedHistory(ctx, days)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]timeseries.Point{timeseries.Indicator("fear-greed"): between(history, from, to)}, nil
+}
+
+// ActiveAddresses backfills the daily number of unique bitcoin addresses
+type ActiveAddresses struct{}
+
+func (ActiveAddresses) Name() string { return "active-addresses" }
+
+// Step is zero, the chart API returns any range in one call
+func (ActiveAddresses) Step() time.Duration { return 0 }
+
+// The chart starts with the genesis block
+func (ActiveAddresses) Earliest(time.Time) time.Time {
+	return time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)
+}
+
+func (ActiveAddresses) Fetch(ctx context.Context, from, to time.Time) (map[string][]timeseries.Point, error) {
+	days := 0
+	if since := time.Since(from); since < 365*24*time.Hour {
+		days = int(since.Hours()/24) + 2
+	}
+	history, err := market.ActiveAddressHistory(ctx, days)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]timeseries.Point{timeseries.Indicator("active-addresses"): between(history, from, to)}, nil
+}
+
+// CoinGecko backfills the daily total market cap and bitcoin dominance
+type CoinGecko struct {
+	Client *market.CoinGeckoService
+}
+
+func (CoinGecko) Name() string { return "coingecko" }
+
+func (CoinGecko) Step() time.Duration { return 0 }
+
+// CoinGecko global data starts in 2013
+func (CoinGecko) Earliest(time.Time) time.Time { return time.Date(2013, 5, 1, 0, 0, 0, 0, time.UTC) }
+
+func (g CoinGecko) Fetch(ctx context.Context, from, to time.Time) (map[string][]timeseries.Point, error) {
+	// the charts end now, so the range starts days before now
+	days := int(math.Ceil(time.Since(from).Hours()/24)) + 1
+	total, err := g.Client.GlobalMarketCapChart(ctx, days)
+	if err != nil {
+		return nil, err
+	}
+	btc, err := g.Client.MarketCapChart(ctx, "bitcoin", days)
+	if err != nil {
+		return nil, err
+	}
+	total, btc = daily(total), daily(btc)
+
+	btcAt := make(map[int64]float64, len(btc))
+	for _, point := range btc {
+		btcAt[point.Time.Unix()] = point.Value
+	}
+	var dominance []market.HistoryPoint
+	for _, point := range total {
+		if value, ok := btcAt[point.Time.Unix()]; ok && point.Value > 0 {
+			dominance = append(dominance, market.HistoryPoint{Time: point.Time, Value: value / point.Value * 100})
+		}
+	}
+	return map[string][]timeseries.Point{
+		timeseries.Indicator("market-cap"):    between(total, from, to),
+		timeseries.Indicator("btc-dominance"): between(dominance, from, to),
+	}, nil
+}
+
+// daily keeps the last point of every UTC day, stamped at midnight
+func daily(points []market.HistoryPoint) []market.HistoryPoint {
+	var days []market.HistoryPoint
+	for _, point := range points {
+		day := point.Time.UTC().Truncate(24 * time.Hour)
+		if len(days) > 0 && days[len(days)-1].Time.Equal(day) {
+			days[len(days)-1].Value = point.Value
+			continue
+		}
+		days = append(days, market.HistoryPoint{Time: day, Value: point.Value})
+	}
+	return days
+}
+
+// between converts the points from from up to, but excluding, to
+func between(history []market.HistoryPoint, from, to time.Time) []timeseries.Point {
+	var points []timeseries.Point
+	for _, point := range history {
+		if !point.Time.Before(from) && point.Time.Before(to) {
+			points = append(points, timeseries.Point{Time: point.Time, Value: point.Value})
+		}
+	}
+	return points
+}
+
+// Select returns the sources whose name starts with one of the comma
+// separated prefixes in names, all of them when names is empty
+func Select(sources []Source, names string) ([]Source, error) {
+	if names == "" {
+		return sources, nil
+	}
+	var selected []Source
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, source := range sources {
+			if strings.HasPrefix(source.Name(), name) {
+				selected = append(selected, source)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown source %q", name)
+		}
+	}
+	return selected, nil
+}
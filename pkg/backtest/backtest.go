@@ -0,0 +1,306 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go-vue/pkg/strategy"
+	"go-vue/pkg/timeseries"
+)
+
+// Config describes a backtest run
+type Config struct {
+	Symbol   string            `json:"symbol"`
+	Interval string            `json:"interval"`
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Strategy strategy.Strategy `json:"strategy"`
+	// InitialCapital is the starting equity in quote currency
+	InitialCapital float64 `json:"initial_capital"`
+	// FeeRate is charged on the notional of every fill, 0.001 is 0.1%
+	FeeRate float64 `json:"fee_rate"`
+	// Slippage moves every fill price against the trade, 0.0005 is 0.05%
+	Slippage float64 `json:"slippage"`
+	// AllowShort goes short on sell signals instead of moving to cash
+	AllowShort bool `json:"allow_short"`
+}
+
+// DefaultConfig returns a daily BTCUSDT run of the dashboard strategy with
+// Binance taker fees
+func DefaultConfig() Config {
+	return Config{
+		Symbol:         "BTCUSDT",
+		Interval:       "1d",
+		Strategy:       strategy.Default(),
+		InitialCapital: 10000,
+		FeeRate:        0.001,
+		Slippage:       0.0005,
+	}
+}
+
+// ErrNotEnoughHistory is returned when fewer than two bars are stored for
+// the simulated period
+var ErrNotEnoughHistory = errors.New("not enough history")
+
+// Validate checks the run settings
+func (cfg Config) Validate() error {
+	if _, err := IntervalDuration(cfg.Interval); err != nil {
+		return err
+	}
+	if cfg.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if !cfg.To.IsZero() && !cfg.From.Before(cfg.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	if cfg.InitialCapital <= 0 {
+		return fmt.Errorf("initial capital must be positive")
+	}
+	if cfg.FeeRate < 0 || cfg.FeeRate >= 1 || cfg.Slippage < 0 || cfg.Slippage >= 1 {
+		return fmt.Errorf("fee rate and slippage must be between 0 and 1")
+	}
+	return cfg.Strategy.Validate()
+}
+
+// Trade is a position from entry to exit
+type Trade struct {
+	Side       string    `json:"side"`
+	EntryTime  time.Time `json:"entry_time"`
+	EntryPrice float64   `json:"entry_price"`
+	ExitTime   time.Time `json:"exit_time"`
+	ExitPrice  float64   `json:"exit_price"`
+	// Return is the change in equity over the trade, after fees and slippage
+	Return float64 `json:"return"`
+	Fees   float64 `json:"fees"`
+}
+
+// EquityPoint is the equity at the close of a bar
+type EquityPoint struct {
+	Time     time.Time `json:"time"`
+	Equity   float64   `json:"equity"`
+	Price    float64   `json:"price"`
+	Position int       `json:"position"`
+	Score    float64   `json:"score"`
+	Signal   string    `json:"signal"`
+}
+
+// Metrics summarizes a run
+type Metrics struct {
+	FinalEquity float64 `json:"final_equity"`
+	TotalReturn float64 `json:"total_return"`
+	CAGR        float64 `json:"cagr"`
+	// Sharpe is the annualized Sharpe ratio of the bar returns, risk free
+	// rate zero
+	Sharpe      float64 `json:"sharpe"`
+	MaxDrawdown float64 `json:"max_drawdown"`
+	// HitRate is the share of trades with a positive return
+	HitRate float64 `json:"hit_rate"`
+	Trades  int     `json:"trades"`
+	Fees    float64 `json:"fees"`
+	// Exposure is the share of bars spent in a position
+	Exposure         float64 `json:"exposure"`
+	BuyAndHoldReturn float64 `json:"buy_and_hold_return"`
+}
+
+// Result is the outcome of a backtest
+type Result struct {
+	Config  Config        `json:"config"`
+	Metrics Metrics       `json:"metrics"`
+	Equity  []EquityPoint `json:"equity"`
+	Trades  []Trade       `json:"trades"`
+}
+
+// Run loads the stored history for cfg and simulates it
+func Run(ctx context.Context, series *timeseries.Store, cfg Config) (*Result, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	data, err := Load(ctx, series, cfg.Symbol, cfg.Interval, cfg.From, cfg.To, cfg.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	return Simulate(cfg, data)
+}
+
+// position is the open position of a simulation
+type position struct {
+	side   int
+	units  float64
+	trade  Trade
+	equity float64
+}
+
+// Simulate replays data bar by bar. The strategy is evaluated at the close
+// of every bar opened from cfg.From until cfg.To and the position is
+// changed at that close.
+func Simulate(cfg Config, data *Dataset) (*Result, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	start, end := 0, len(data.Bars)
+	for start < end && data.Bars[start].Time.Before(cfg.From) {
+		start++
+	}
+	if !cfg.To.IsZero() {
+		for end > start && !data.Bars[end-1].Time.Before(cfg.To) {
+			end--
+		}
+	}
+	if end-start < 2 {
+		return nil, fmt.Errorf("%w of %s %s from %s", ErrNotEnoughHistory, cfg.Symbol, cfg.Interval, cfg.From.Format("2006-01-02"))
+	}
+
+	metrics := data.metricSeries(cfg.Strategy)
+	result := &Result{Config: cfg, Equity: []EquityPoint{}, Trades: []Trade{}}
+	cash := cfg.InitialCapital
+	var pos position
+	var fees float64
+	var inMarket int
+
+	// fill trades units at price moved by slippage and returns the fill price
+	fill := func(units, price float64) float64 {
+		if units > 0 {
+			price *= 1 + cfg.Slippage
+		} else {
+			price *= 1 - cfg.Slippage
+		}
+		fee := math.Abs(units) * price * cfg.FeeRate
+		cash -= units*price + fee
+		pos.units += units
+		fees += fee
+		return price
+	}
+	closePosition := func(bar Bar) {
+		fee := fees
+		pos.trade.ExitPrice = fill(-pos.units, bar.Close)
+		pos.trade.ExitTime = bar.Time.Add(data.Interval)
+		pos.trade.Fees += fees - fee
+		pos.trade.Return = cash/pos.equity - 1
+		result.Trades = append(result.Trades, pos.trade)
+		pos = position{}
+	}
+
+	for i := start; i < end; i++ {
+		bar := data.Bars[i]
+		values := make(map[string]float64)
+		for metric, series := range metrics {
+			if !math.IsNaN(series[i]) {
+				values[metric] = series[i]
+			}
+		}
+		eval := cfg.Strategy.Evaluate(values)
+
+		target := pos.side
+		switch eval.Signal {
+		case strategy.StrongBuy, strategy.Buy:
+			target = 1
+		case strategy.StrongSell, strategy.Sell:
+			target = 0
+			if cfg.AllowShort {
+				target = -1
+			}
+		}
+		// close out on the last bar so the final equity is realized
+		if i == end-1 {
+			target = 0
+		}
+
+		if target != pos.side {
+			if pos.side != 0 {
+				closePosition(bar)
+			}
+			if target != 0 {
+				pos = position{side: target, equity: cash}
+				fee := fees
+				price := bar.Close * (1 + float64(target)*cfg.Slippage)
+				units := float64(target) * cash / (price * (1 + cfg.FeeRate))
+				side := "long"
+				if target < 0 {
+					side = "short"
+				}
+				pos.trade = Trade{Side: side, EntryTime: bar.Time.Add(data.Interval), EntryPrice: fill(units, bar.Close)}
+				pos.trade.Fees = fees - fee
+			}
+		}
+		if pos.side != 0 {
+			inMarket++
+		}
+
+		result.Equity = append(result.Equity, EquityPoint{
+			Time:     bar.Time.Add(data.Interval),
+			Equity:   cash + pos.units*bar.Close,
+			Price:    bar.Close,
+			Position: pos.side,
+			Score:    eval.Score,
+			Signal:   eval.Signal,
+		})
+	}
+
+	first, last := data.Bars[start], data.Bars[end-1]
+	result.Metrics = computeMetrics(cfg.InitialCapital, result.Equity, result.Trades, data.Interval)
+	result.Metrics.Fees = fees
+	result.Metrics.Exposure = float64(inMarket) / float64(len(result.Equity))
+	result.Metrics.BuyAndHoldReturn = last.Close/first.Close - 1
+	return result, nil
+}
+
+// computeMetrics derives the performance statistics of an equity curve
+func computeMetrics(initial float64, equity []EquityPoint, trades []Trade, interval time.Duration) Metrics {
+	final := equity[len(equity)-1].Equity
+	m := Metrics{
+		FinalEquity: final,
+		TotalReturn: final/initial - 1,
+		Trades:      len(trades),
+	}
+
+	// the first point is the close of the first bar, one interval after the
+	// capital was committed
+	years := (equity[len(equity)-1].Time.Sub(equity[0].Time) + interval).Hours() / (365 * 24)
+	if years > 0 && final > 0 {
+		m.CAGR = math.Pow(final/initial, 1/years) - 1
+	}
+
+	returns := make([]float64, 0, len(equity))
+	previous, peak := initial, initial
+	for _, point := range equity {
+		returns = append(returns, point.Equity/previous-1)
+		previous = point.Equity
+		peak = math.Max(peak, point.Equity)
+		m.MaxDrawdown = math.Max(m.MaxDrawdown, (peak-point.Equity)/peak)
+	}
+	mean, std := meanStd(returns)
+	if std > 0 {
+		periodsPerYear := 365 * 24 * float64(time.Hour) / float64(interval)
+		m.Sharpe = mean / std * math.Sqrt(periodsPerYear)
+	}
+
+	if len(trades) > 0 {
+		wins := 0
+		for _, trade := range trades {
+			if trade.Return > 0 {
+				wins++
+			}
+		}
+		m.HitRate = float64(wins) / float64(len(trades))
+	}
+	return m
+}
+
+func meanStd(values []float64) (float64, float64) {
+	if len(values) < 2 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)-1))
+}
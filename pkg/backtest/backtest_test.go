@@ -0,0 +1,128 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go-vue/pkg/indicators"
+	"go-vue/pkg/strategy"
+	"go-vue/pkg/timeseries"
+)
+
+var day = 24 * time.Hour
+
+// testData returns daily bars at prices with a fear and greed reading
+// published at the open of every bar
+func testData(prices, fearGreed []float64) *Dataset {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := &Dataset{Interval: day, Metrics: map[string][]timeseries.Point{}}
+	for i, price := range prices {
+		t := start.Add(time.Duration(i) * day)
+		data.Bars = append(data.Bars, Bar{Time: t, Close: price, Volume: 1})
+		data.Metrics["fear-greed"] = append(data.Metrics["fear-greed"], timeseries.Point{Time: t, Value: fearGreed[i]})
+	}
+	return data
+}
+
+func fearGreedConfig() Config {
+	cfg := DefaultConfig()
+	cfg.From = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.FeeRate = 0
+	cfg.Slippage = 0
+	cfg.Strategy = strategy.Strategy{
+		Rules:      []strategy.Rule{{Metric: "fear-greed", Weight: 1, Buy: 30, Sell: 70}},
+		Thresholds: strategy.Thresholds{Strong: 0.4, Moderate: 0.25, StrongAgreement: 1, ModerateAgreement: 1, Consensus: 0.6},
+	}
+	return cfg
+}
+
+func TestSimulate(t *testing.T) {
+	// buy at 100 on fear, sell at 150 on greed, buy at 120, sell at 90
+	prices := []float64{100, 110, 150, 140, 120, 90, 95}
+	fearGreed := []float64{20, 50, 80, 50, 20, 90, 50}
+	result, err := Simulate(fearGreedConfig(), testData(prices, fearGreed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := result.Metrics
+	if m.Trades != 2 || len(result.Trades) != 2 {
+		t.Fatalf("trades = %d, want 2", m.Trades)
+	}
+	if math.Abs(result.Trades[0].Return-0.5) > 1e-9 || math.Abs(result.Trades[1].Return+0.25) > 1e-9 {
+		t.Fatalf("unexpected trade returns %+v", result.Trades)
+	}
+	if math.Abs(m.FinalEquity-11250) > 1e-6 || math.Abs(m.TotalReturn-0.125) > 1e-9 {
+		t.Fatalf("final equity = %v", m.FinalEquity)
+	}
+	if m.HitRate != 0.5 {
+		t.Fatalf("hit rate = %v, want 0.5", m.HitRate)
+	}
+	// peak 15000 at the first exit, trough 11250 after the second
+	if math.Abs(m.MaxDrawdown-0.25) > 1e-9 {
+		t.Fatalf("max drawdown = %v, want 0.25", m.MaxDrawdown)
+	}
+	if len(result.Equity) != len(prices) || result.Equity[1].Position != 1 || result.Equity[2].Position != 0 {
+		t.Fatalf("unexpected equity curve %+v", result.Equity)
+	}
+	if m.CAGR <= 0 || m.Sharpe == 0 {
+		t.Fatalf("unexpected CAGR %v and Sharpe %v", m.CAGR, m.Sharpe)
+	}
+}
+
+func TestSimulateCosts(t *testing.T) {
+	cfg := fearGreedConfig()
+	cfg.FeeRate = 0.001
+	cfg.Slippage = 0.001
+	prices := []float64{100, 100, 100}
+	fearGreed := []float64{20, 50, 50}
+	result, err := Simulate(cfg, testData(prices, fearGreed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a round trip at an unchanged price costs both fees and slippage
+	want := 10000 * (1 - 0.001) / (1 + 0.001) / (1 + 0.001) * (1 - 0.001)
+	if math.Abs(result.Metrics.FinalEquity-want) > 1e-6 {
+		t.Fatalf("final equity = %v, want %v", result.Metrics.FinalEquity, want)
+	}
+	if result.Metrics.Fees <= 0 || result.Metrics.HitRate != 0 {
+		t.Fatalf("unexpected metrics %+v", result.Metrics)
+	}
+}
+
+func TestSimulateShort(t *testing.T) {
+	cfg := fearGreedConfig()
+	cfg.AllowShort = true
+	prices := []float64{100, 80, 80}
+	fearGreed := []float64{90, 50, 50}
+	result, err := Simulate(cfg, testData(prices, fearGreed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Trades) != 1 || result.Trades[0].Side != "short" || math.Abs(result.Metrics.FinalEquity-12000) > 1e-6 {
+		t.Fatalf("unexpected short result %+v %+v", result.Trades, result.Metrics)
+	}
+}
+
+func TestIndicators(t *testing.T) {
+	closes := make([]float64, 30)
+	for i := range closes {
+		closes[i] = float64(100 + i)
+	}
+	values := indicators.RSI(closes, 14)
+	if !math.IsNaN(values[13]) || values[14] != 100 {
+		t.Fatalf("rsi of a rising series = %v, %v", values[13], values[14])
+	}
+
+	trend := volumeTrend([]float64{10, 10, 10, 10, 10, 15, 10}, 5)
+	if !math.IsNaN(trend[4]) || trend[5] != 0.5 || math.Abs(trend[6]-(10/11.0-1)) > 1e-9 {
+		t.Fatalf("volume trend = %v", trend)
+	}
+
+	spread := maSpread([]float64{1, 1, 1, 3}, 1, 4)
+	if !math.IsNaN(spread[2]) || spread[3] != 100 {
+		t.Fatalf("ma spread = %v", spread)
+	}
+}
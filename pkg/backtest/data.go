@@ -0,0 +1,356 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"go-vue/pkg/indicators"
+	"go-vue/pkg/market"
+	"go-vue/pkg/strategy"
+	"go-vue/pkg/timeseries"
+)
+
+const (
+	// WarmupBars are loaded before the start of a run so that the 200 bar
+	// moving average is defined from the first simulated bar
+	WarmupBars = 210
+	// staleAfter is the age after which a stored metric value is ignored
+	staleAfter = 72 * time.Hour
+)
+
+var intervals = map[string]time.Duration{
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+	"3d":  72 * time.Hour,
+	"1w":  7 * 24 * time.Hour,
+}
+
+// IntervalDuration returns the length of a Binance kline interval
+func IntervalDuration(interval string) (time.Duration, error) {
+	d, ok := intervals[interval]
+	if !ok {
+		return 0, fmt.Errorf("unsupported interval %q", interval)
+	}
+	return d, nil
+}
+
+// Bar is a closed candle of the traded symbol
+type Bar struct {
+	Time  time.Time `json:"time"`
+	Close float64   `json:"close"`
+	// High and Low are zero for klines stored without them
+	High   float64 `json:"high,omitempty"`
+	Low    float64 `json:"low,omitempty"`
+	Volume float64 `json:"volume"`
+}
+
+// Dataset is the history replayed by a backtest
+type Dataset struct {
+	Interval time.Duration
+	Bars     []Bar
+	// Metrics holds the stored history of the metrics that are not derived
+	// from the bars, keyed by metric
+	Metrics map[string][]timeseries.Point
+
+	// aligned caches metricSeries by metric and change, the optimizer
+	// simulates the same data many times
+	aligned map[string][]float64
+}
+
+// Load reads the klines of symbol and the history of every stored metric
+// used by strat from series, including the warmup before from
+func Load(ctx context.Context, series *timeseries.Store, symbol, interval string, from, to time.Time, strat strategy.Strategy) (*Dataset, error) {
+	d, err := IntervalDuration(interval)
+	if err != nil {
+		return nil, err
+	}
+	start := from.Add(-WarmupBars * d)
+	closes, err := series.Range(ctx, timeseries.Kline(symbol, interval, "close"), start, to)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := series.Range(ctx, timeseries.Kline(symbol, interval, "volume"), start, to)
+	if err != nil {
+		return nil, err
+	}
+	highs, err := series.Range(ctx, timeseries.Kline(symbol, interval, "high"), start, to)
+	if err != nil {
+		return nil, err
+	}
+	lows, err := series.Range(ctx, timeseries.Kline(symbol, interval, "low"), start, to)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &Dataset{Interval: d, Bars: Bars(closes, highs, lows, volumes), Metrics: make(map[string][]timeseries.Point)}
+	for _, rule := range strat.Rules {
+		if derived[rule.Metric] {
+			continue
+		}
+		points, err := series.Range(ctx, timeseries.Indicator(rule.Metric), start.Add(-staleAfter), to)
+		if err != nil {
+			return nil, err
+		}
+		if len(points) > 0 {
+			data.Metrics[rule.Metric] = points
+		}
+	}
+	return data, nil
+}
+
+// StoreKlines fetches the klines of symbol between from and to from Binance
+// and writes their close, high, low and volume series. It returns the
+// number of candles that were not stored before.
+func StoreKlines(ctx context.Context, binance *market.BinanceService, series *timeseries.Store, symbol, interval string, from, to time.Time) (int, error) {
+	candles, err := binance.Klines(ctx, symbol, interval, from, to)
+	if err != nil {
+		return 0, err
+	}
+	fields, err := KlineSeries(symbol, interval, candles)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for name, points := range fields {
+		n, err := series.Write(ctx, name, points)
+		if err != nil {
+			return added, err
+		}
+		if name == timeseries.Kline(symbol, interval, "close") {
+			added = n
+		}
+	}
+	return added, nil
+}
+
+// KlineSeries splits the closed candles into their close, high, low and
+// volume series
+func KlineSeries(symbol, interval string, candles []market.Candle) (map[string][]timeseries.Point, error) {
+	d, err := IntervalDuration(interval)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]func(market.Candle) float64{
+		"close":  func(c market.Candle) float64 { return c.Close },
+		"high":   func(c market.Candle) float64 { return c.High },
+		"low":    func(c market.Candle) float64 { return c.Low },
+		"volume": func(c market.Candle) float64 { return c.Volume },
+	}
+	series := make(map[string][]timeseries.Point, len(fields))
+	for _, candle := range candles {
+		// the last candle is still open
+		if candle.OpenTime.Add(d).After(time.Now()) {
+			continue
+		}
+		for field, value := range fields {
+			name := timeseries.Kline(symbol, interval, field)
+			series[name] = append(series[name], timeseries.Point{Time: candle.OpenTime, Value: value(candle)})
+		}
+	}
+	return series, nil
+}
+
+// derived are the metrics computed from the bars rather than loaded
+var derived = map[string]bool{
+	"rsi":             true,
+	"moving-averages": true,
+	"volume-trend":    true,
+	"macd":            true,
+	"stoch-rsi":       true,
+	"ichimoku":        true,
+	"atr":             true,
+}
+
+// technical are the derived indicators that are not part of the dashboard
+// signal unless a profile weights them
+var technical = map[string]bool{
+	"macd":      true,
+	"stoch-rsi": true,
+	"ichimoku":  true,
+	"atr":       true,
+}
+
+// Bars joins the stored kline series into bars, one per close
+func Bars(closes, highs, lows, volumes []timeseries.Point) []Bar {
+	at := func(points []timeseries.Point) map[int64]float64 {
+		values := make(map[int64]float64, len(points))
+		for _, point := range points {
+			values[point.Time.Unix()] = point.Value
+		}
+		return values
+	}
+	highAt, lowAt, volumeAt := at(highs), at(lows), at(volumes)
+	bars := make([]Bar, len(closes))
+	for i, point := range closes {
+		t := point.Time.Unix()
+		bars[i] = Bar{Time: point.Time, Close: point.Value, High: highAt[t], Low: lowAt[t], Volume: volumeAt[t]}
+	}
+	return bars
+}
+
+// Derive computes a metric derived from bars for every bar, NaN where it
+// is not defined yet. It reports false for metrics that are not derived.
+func Derive(metric string, bars []Bar) ([]float64, bool) {
+	closes := make([]float64, len(bars))
+	volumes := make([]float64, len(bars))
+	for i, bar := range bars {
+		closes[i] = bar.Close
+		volumes[i] = bar.Volume
+	}
+	switch metric {
+	case "rsi":
+		return indicators.RSI(closes, 14), true
+	case "moving-averages":
+		return maSpread(closes, 50, 200), true
+	case "volume-trend":
+		return volumeTrend(volumes, 5), true
+	case "macd":
+		// the histogram in percent of the price, comparable across prices
+		macd := indicators.NewMACD(closes, 12, 26, 9)
+		values := make([]float64, len(closes))
+		for i, histogram := range macd.Histogram {
+			values[i] = histogram / closes[i] * 100
+		}
+		return values, true
+	case "stoch-rsi":
+		k, _ := indicators.StochRSI(closes, 14, 14, 3, 3)
+		return k, true
+	case "ichimoku", "atr":
+		return withRange(bars, func(highs, lows, closes []float64) []float64 {
+			if metric == "atr" {
+				return indicators.ATRMove(closes, indicators.ATR(highs, lows, closes, 14))
+			}
+			return indicators.NewIchimoku(highs, lows, closes, 9, 26, 52, 26).CloudPosition(closes)
+		}), true
+	}
+	return nil, false
+}
+
+// withRange computes an indicator that needs highs and lows over the
+// bars after the last one stored without them
+func withRange(bars []Bar, compute func(highs, lows, closes []float64) []float64) []float64 {
+	first := len(bars)
+	for first > 0 && bars[first-1].High > 0 && bars[first-1].Low > 0 {
+		first--
+	}
+	values := make([]float64, len(bars))
+	for i := 0; i < first; i++ {
+		values[i] = math.NaN()
+	}
+	n := len(bars) - first
+	highs, lows, closes := make([]float64, n), make([]float64, n), make([]float64, n)
+	for i, bar := range bars[first:] {
+		highs[i], lows[i], closes[i] = bar.High, bar.Low, bar.Close
+	}
+	copy(values[first:], compute(highs, lows, closes))
+	return values
+}
+
+// metricSeries returns every metric used by strat aligned to the bars. A
+// value is NaN where the metric is not known at the close of the bar.
+func (d *Dataset) metricSeries(strat strategy.Strategy) map[string][]float64 {
+	if d.aligned == nil {
+		d.aligned = make(map[string][]float64)
+	}
+	aligned := make(map[string][]float64)
+	for _, rule := range strat.Rules {
+		key := fmt.Sprintf("%s/%d", rule.Metric, rule.Change)
+		if values, ok := d.aligned[key]; ok {
+			aligned[rule.Metric] = values
+			continue
+		}
+		values, ok := Derive(rule.Metric, d.Bars)
+		if !ok {
+			points, found := d.Metrics[rule.Metric]
+			if !found {
+				continue
+			}
+			values = d.align(points)
+		}
+		if rule.Change > 0 {
+			values = change(values, rule.Change)
+		}
+		d.aligned[key] = values
+		aligned[rule.Metric] = values
+	}
+	return aligned
+}
+
+// align returns the last point published before the close of each bar
+func (d *Dataset) align(points []timeseries.Point) []float64 {
+	values := make([]float64, len(d.Bars))
+	j := -1
+	for i, bar := range d.Bars {
+		closeTime := bar.Time.Add(d.Interval)
+		for j+1 < len(points) && points[j+1].Time.Before(closeTime) {
+			j++
+		}
+		if j < 0 || closeTime.Sub(points[j].Time) > staleAfter {
+			values[i] = math.NaN()
+			continue
+		}
+		values[i] = points[j].Value
+	}
+	return values
+}
+
+// change returns the percent change of values over n points
+func change(values []float64, n int) []float64 {
+	changes := make([]float64, len(values))
+	for i := range values {
+		if i < n || values[i-n] == 0 {
+			changes[i] = math.NaN()
+			continue
+		}
+		changes[i] = (values[i]/values[i-n] - 1) * 100
+	}
+	return changes
+}
+
+// maSpread is the percent distance of the fast moving average above the
+// slow one, positive after a golden cross and negative after a death cross
+func maSpread(closes []float64, fast, slow int) []float64 {
+	values := make([]float64, len(closes))
+	var fastSum, slowSum float64
+	for i, price := range closes {
+		fastSum += price
+		slowSum += price
+		if i >= fast {
+			fastSum -= closes[i-fast]
+		}
+		if i >= slow {
+			slowSum -= closes[i-slow]
+		}
+		if i < slow-1 {
+			values[i] = math.NaN()
+			continue
+		}
+		values[i] = (fastSum/float64(fast)/(slowSum/float64(slow)) - 1) * 100
+	}
+	return values
+}
+
+// volumeTrend compares each volume to the average of the previous n, like
+// MarketService.GetVolumeTrend
+func volumeTrend(volumes []float64, n int) []float64 {
+	values := make([]float64, len(volumes))
+	var sum float64
+	for i, volume := range volumes {
+		values[i] = math.NaN()
+		if i > n {
+			sum -= volumes[i-n-1]
+		}
+		if i >= n && sum > 0 {
+			values[i] = (volume - sum/float64(n)) / (sum / float64(n))
+		}
+		sum += volume
+	}
+	return values
+}
@@ -0,0 +1,434 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"go-vue/pkg/strategy"
+)
+
+// Search methods
+const (
+	MethodGrid       = "grid"
+	MethodRandom     = "random"
+	MethodCoordinate = "coordinate"
+)
+
+// Objectives maximized by the optimizer
+const (
+	ObjectiveSharpe = "sharpe"
+	ObjectiveCAGR   = "cagr"
+	ObjectiveCalmar = "calmar"
+	ObjectiveReturn = "return"
+)
+
+// maxGridSize bounds the number of candidates of a grid search
+const maxGridSize = 20000
+
+// Band is a pair of rule thresholds
+type Band struct {
+	Buy  float64 `json:"buy"`
+	Sell float64 `json:"sell"`
+}
+
+// SearchSpace lists the candidate values of every searched parameter
+type SearchSpace struct {
+	// Metrics are the rules whose weight is searched, every rule with
+	// history when empty, leaving out the technical indicators the base
+	// strategy does not weight
+	Metrics []string  `json:"metrics,omitempty"`
+	Weights []float64 `json:"weights"`
+	// Strong and Moderate are candidate signal thresholds
+	Strong   []float64 `json:"strong,omitempty"`
+	Moderate []float64 `json:"moderate,omitempty"`
+	// Bands are candidate rule thresholds by metric
+	Bands map[string][]Band `json:"bands,omitempty"`
+}
+
+// DefaultSearchSpace searches weights in steps of 5% and the signal
+// thresholds around the dashboard values
+func DefaultSearchSpace() SearchSpace {
+	return SearchSpace{
+		Weights:  []float64{0, 0.05, 0.1, 0.15, 0.2},
+		Strong:   []float64{0.3, 0.4, 0.5},
+		Moderate: []float64{0.15, 0.2, 0.25, 0.3},
+	}
+}
+
+// OptimizeConfig describes an optimizer run
+type OptimizeConfig struct {
+	// Backtest holds the market, period, costs and starting strategy
+	Backtest  Config      `json:"backtest"`
+	Space     SearchSpace `json:"space"`
+	Method    string      `json:"method"`
+	Objective string      `json:"objective"`
+	// Folds is the number of walk-forward test windows
+	Folds int `json:"folds"`
+	// Iterations is the number of random candidates, or the maximum number
+	// of coordinate descent passes
+	Iterations int   `json:"iterations"`
+	Seed       int64 `json:"seed"`
+}
+
+// Fold is one walk-forward step: the best candidate of the training window
+// evaluated on the following test window
+type Fold struct {
+	TrainFrom time.Time         `json:"train_from"`
+	TestFrom  time.Time         `json:"test_from"`
+	TestTo    time.Time         `json:"test_to"`
+	Strategy  strategy.Strategy `json:"strategy"`
+	Train     Metrics           `json:"train"`
+	Test      Metrics           `json:"test"`
+	// Baseline is the starting strategy on the test window
+	Baseline Metrics `json:"baseline"`
+}
+
+// Optimization is the report of an optimizer run
+type Optimization struct {
+	Method      string    `json:"method"`
+	Objective   string    `json:"objective"`
+	Symbol      string    `json:"symbol"`
+	Interval    string    `json:"interval"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Evaluations int       `json:"evaluations"`
+	Folds       []Fold    `json:"folds"`
+	// TestObjective and BaselineObjective average the objective over the
+	// test windows, the out of sample estimate of the optimized and the
+	// starting strategy
+	TestObjective     float64 `json:"test_objective"`
+	BaselineObjective float64 `json:"baseline_objective"`
+	// Full is the final strategy over the whole period
+	Full Metrics `json:"full"`
+}
+
+// param is one searched parameter with a finite number of options
+type param struct {
+	options int
+	apply   func(s *strategy.Strategy, option int)
+}
+
+// Optimize searches the space for the strategy with the best objective.
+// The period is split into Folds+1 windows; for every fold the candidates
+// are trained on all windows before it and the winner is tested on the
+// window itself. The returned strategy is trained on the whole period.
+func Optimize(cfg OptimizeConfig, data *Dataset) (strategy.Strategy, *Optimization, error) {
+	if err := cfg.Backtest.Validate(); err != nil {
+		return strategy.Strategy{}, nil, err
+	}
+	if _, err := Objective(cfg.Objective, Metrics{}); err != nil {
+		return strategy.Strategy{}, nil, err
+	}
+	if cfg.Folds < 1 {
+		return strategy.Strategy{}, nil, fmt.Errorf("at least one walk-forward fold is required")
+	}
+	params, err := searchParams(cfg.Space, cfg.Backtest.Strategy, data)
+	if err != nil {
+		return strategy.Strategy{}, nil, err
+	}
+
+	// bars inside the period split into equal windows
+	var times []time.Time
+	for _, bar := range data.Bars {
+		if !bar.Time.Before(cfg.Backtest.From) && (cfg.Backtest.To.IsZero() || bar.Time.Before(cfg.Backtest.To)) {
+			times = append(times, bar.Time)
+		}
+	}
+	windows := cfg.Folds + 1
+	if len(times) < windows*10 {
+		return strategy.Strategy{}, nil, fmt.Errorf("%w of %s %s for %d walk-forward windows", ErrNotEnoughHistory, cfg.Backtest.Symbol, cfg.Backtest.Interval, windows)
+	}
+	bounds := make([]time.Time, windows+1)
+	for i := 0; i < windows; i++ {
+		bounds[i] = times[i*len(times)/windows]
+	}
+	bounds[windows] = times[len(times)-1].Add(data.Interval)
+
+	report := &Optimization{
+		Method:    cfg.Method,
+		Objective: cfg.Objective,
+		Symbol:    cfg.Backtest.Symbol,
+		Interval:  cfg.Backtest.Interval,
+		From:      bounds[0],
+		To:        bounds[windows],
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	for k := 1; k < windows; k++ {
+		train := cfg.Backtest
+		train.From, train.To = bounds[0], bounds[k]
+		best, trainMetrics, evaluations, err := search(cfg, params, train, data, rng)
+		if err != nil {
+			return strategy.Strategy{}, nil, err
+		}
+		report.Evaluations += evaluations
+
+		test := cfg.Backtest
+		test.From, test.To = bounds[k], bounds[k+1]
+		baseline, err := Simulate(test, data)
+		if err != nil {
+			return strategy.Strategy{}, nil, err
+		}
+		test.Strategy = best
+		tested, err := Simulate(test, data)
+		if err != nil {
+			return strategy.Strategy{}, nil, err
+		}
+		report.Folds = append(report.Folds, Fold{
+			TrainFrom: train.From,
+			TestFrom:  test.From,
+			TestTo:    test.To,
+			Strategy:  best,
+			Train:     trainMetrics,
+			Test:      tested.Metrics,
+			Baseline:  baseline.Metrics,
+		})
+		score, _ := Objective(cfg.Objective, tested.Metrics)
+		report.TestObjective += score / float64(windows-1)
+		score, _ = Objective(cfg.Objective, baseline.Metrics)
+		report.BaselineObjective += score / float64(windows-1)
+	}
+
+	full := cfg.Backtest
+	full.From, full.To = bounds[0], bounds[windows]
+	best, fullMetrics, evaluations, err := search(cfg, params, full, data, rng)
+	if err != nil {
+		return strategy.Strategy{}, nil, err
+	}
+	report.Evaluations += evaluations
+	report.Full = fullMetrics
+	return best, report, nil
+}
+
+// Objective returns the value of the named objective for a run
+func Objective(name string, m Metrics) (float64, error) {
+	switch name {
+	case ObjectiveSharpe, "":
+		return m.Sharpe, nil
+	case ObjectiveCAGR:
+		return m.CAGR, nil
+	case ObjectiveReturn:
+		return m.TotalReturn, nil
+	case ObjectiveCalmar:
+		if m.MaxDrawdown == 0 {
+			return m.CAGR, nil
+		}
+		return m.CAGR / m.MaxDrawdown, nil
+	}
+	return 0, fmt.Errorf("unknown objective %q", name)
+}
+
+// searchParams turns the search space into parameters, leaving out rules
+// without any history in data
+func searchParams(space SearchSpace, base strategy.Strategy, data *Dataset) ([]param, error) {
+	metrics := space.Metrics
+	if len(metrics) == 0 {
+		for _, rule := range base.Rules {
+			if technical[rule.Metric] && rule.Weight == 0 {
+				continue
+			}
+			if derived[rule.Metric] || len(data.Metrics[rule.Metric]) > 0 {
+				metrics = append(metrics, rule.Metric)
+			}
+		}
+	}
+	ruleIndex := make(map[string]int)
+	for i, rule := range base.Rules {
+		ruleIndex[rule.Metric] = i
+	}
+
+	var params []param
+	if len(space.Weights) > 0 {
+		for _, metric := range metrics {
+			i, ok := ruleIndex[metric]
+			if !ok {
+				return nil, fmt.Errorf("no rule for metric %s", metric)
+			}
+			weights := space.Weights
+			params = append(params, param{
+				options: len(weights),
+				apply:   func(s *strategy.Strategy, option int) { s.Rules[i].Weight = weights[option] },
+			})
+		}
+	}
+	// sorted so that a seeded random search is repeatable
+	bandMetrics := make([]string, 0, len(space.Bands))
+	for metric := range space.Bands {
+		bandMetrics = append(bandMetrics, metric)
+	}
+	sort.Strings(bandMetrics)
+	for _, metric := range bandMetrics {
+		bands := space.Bands[metric]
+		i, ok := ruleIndex[metric]
+		if !ok {
+			return nil, fmt.Errorf("no rule for metric %s", metric)
+		}
+		if len(bands) == 0 {
+			continue
+		}
+		params = append(params, param{
+			options: len(bands),
+			apply: func(s *strategy.Strategy, option int) {
+				s.Rules[i].Buy, s.Rules[i].Sell = bands[option].Buy, bands[option].Sell
+			},
+		})
+	}
+	if strong := space.Strong; len(strong) > 0 {
+		params = append(params, param{
+			options: len(strong),
+			apply:   func(s *strategy.Strategy, option int) { s.Thresholds.Strong = strong[option] },
+		})
+	}
+	if moderate := space.Moderate; len(moderate) > 0 {
+		params = append(params, param{
+			options: len(moderate),
+			apply:   func(s *strategy.Strategy, option int) { s.Thresholds.Moderate = moderate[option] },
+		})
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("the search space is empty")
+	}
+	return params, nil
+}
+
+// candidate applies one option of every parameter to a copy of base
+func candidate(base strategy.Strategy, params []param, options []int) strategy.Strategy {
+	s := strategy.Strategy{Rules: append([]strategy.Rule(nil), base.Rules...), Thresholds: base.Thresholds}
+	for i, p := range params {
+		p.apply(&s, options[i])
+	}
+	return s
+}
+
+// search returns the best candidate on the window of cfg and its metrics
+func search(opt OptimizeConfig, params []param, cfg Config, data *Dataset, rng *rand.Rand) (strategy.Strategy, Metrics, int, error) {
+	bestScore := math.Inf(-1)
+	var best strategy.Strategy
+	var bestMetrics Metrics
+	evaluations := 0
+	evaluate := func(options []int) (float64, error) {
+		s := candidate(cfg.Strategy, params, options)
+		// candidates that weigh nothing or cannot rank signals are skipped
+		if s.Validate() != nil || totalWeight(s) == 0 {
+			return math.Inf(-1), nil
+		}
+		run := cfg
+		run.Strategy = s
+		result, err := Simulate(run, data)
+		if err != nil {
+			return 0, err
+		}
+		evaluations++
+		score, _ := Objective(opt.Objective, result.Metrics)
+		if score > bestScore {
+			bestScore, best, bestMetrics = score, s, result.Metrics
+		}
+		return score, nil
+	}
+
+	switch opt.Method {
+	case MethodGrid:
+		size := 1
+		for _, p := range params {
+			size *= p.options
+			if size > maxGridSize {
+				return best, bestMetrics, evaluations, fmt.Errorf("grid has more than %d candidates, use random or coordinate search", maxGridSize)
+			}
+		}
+		options := make([]int, len(params))
+		for n := 0; n < size; n++ {
+			rest := n
+			for i, p := range params {
+				options[i] = rest % p.options
+				rest /= p.options
+			}
+			if _, err := evaluate(options); err != nil {
+				return best, bestMetrics, evaluations, err
+			}
+		}
+	case MethodRandom:
+		iterations := opt.Iterations
+		if iterations <= 0 {
+			iterations = 500
+		}
+		options := make([]int, len(params))
+		for n := 0; n < iterations; n++ {
+			for i, p := range params {
+				options[i] = rng.Intn(p.options)
+			}
+			if _, err := evaluate(options); err != nil {
+				return best, bestMetrics, evaluations, err
+			}
+		}
+	case MethodCoordinate, "":
+		passes := opt.Iterations
+		if passes <= 0 {
+			passes = 5
+		}
+		// start from the options closest to the starting strategy
+		options := make([]int, len(params))
+		for i, p := range params {
+			options[i] = closestOption(cfg.Strategy, p)
+		}
+		current, err := evaluate(options)
+		if err != nil {
+			return best, bestMetrics, evaluations, err
+		}
+		for pass := 0; pass < passes; pass++ {
+			improved := false
+			for i, p := range params {
+				keep := options[i]
+				for option := 0; option < p.options; option++ {
+					if option == keep {
+						continue
+					}
+					options[i] = option
+					score, err := evaluate(options)
+					if err != nil {
+						return best, bestMetrics, evaluations, err
+					}
+					if score > current {
+						current, keep, improved = score, option, true
+					}
+				}
+				options[i] = keep
+			}
+			if !improved {
+				break
+			}
+		}
+	default:
+		return best, bestMetrics, evaluations, fmt.Errorf("unknown search method %q", opt.Method)
+	}
+
+	if math.IsInf(bestScore, -1) {
+		return best, bestMetrics, evaluations, fmt.Errorf("no valid candidate in the search space")
+	}
+	return best, bestMetrics, evaluations, nil
+}
+
+// closestOption returns the option of p that changes base the least
+func closestOption(base strategy.Strategy, p param) int {
+	closest, distance := 0, math.Inf(1)
+	for option := 0; option < p.options; option++ {
+		s := candidate(base, []param{p}, []int{option})
+		d := math.Abs(s.Thresholds.Strong-base.Thresholds.Strong) + math.Abs(s.Thresholds.Moderate-base.Thresholds.Moderate)
+		for i, rule := range s.Rules {
+			d += math.Abs(rule.Weight-base.Rules[i].Weight) + math.Abs(rule.Buy-base.Rules[i].Buy) + math.Abs(rule.Sell-base.Rules[i].Sell)
+		}
+		if d < distance {
+			closest, distance = option, d
+		}
+	}
+	return closest
+}
+
+func totalWeight(s strategy.Strategy) float64 {
+	var total float64
+	for _, rule := range s.Rules {
+		total += rule.Weight
+	}
+	return total
+}
@@ -0,0 +1,71 @@
+package backtest
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"go-vue/pkg/strategy"
+)
+
+func TestOptimize(t *testing.T) {
+	// fear peaks at the troughs of the price cycle, so weighing fear and
+	// greed buys low and sells high while volume carries no signal
+	var prices, fearGreed []float64
+	for i := 0; i < 400; i++ {
+		phase := 2 * math.Pi * float64(i) / 40
+		prices = append(prices, 100-20*math.Cos(phase))
+		fearGreed = append(fearGreed, 50-40*math.Cos(phase))
+	}
+
+	cfg := fearGreedConfig()
+	cfg.Strategy.Rules = append(cfg.Strategy.Rules, strategy.Rule{Metric: "volume-trend", Weight: 1, Buy: 0.1, Sell: -0.1})
+	cfg.Strategy.Rules[0].Weight = 0
+	for _, method := range []string{MethodGrid, MethodRandom, MethodCoordinate} {
+		opt := OptimizeConfig{
+			Backtest:   cfg,
+			Space:      SearchSpace{Weights: []float64{0, 0.5, 1}},
+			Method:     method,
+			Objective:  ObjectiveReturn,
+			Folds:      3,
+			Iterations: 20,
+		}
+		best, report, err := Optimize(opt, testData(prices, fearGreed))
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if best.Rules[0].Weight == 0 {
+			t.Fatalf("%s: fear and greed was not weighed: %+v", method, best.Rules)
+		}
+		if len(report.Folds) != 3 || report.Evaluations == 0 {
+			t.Fatalf("%s: unexpected report %+v", method, report)
+		}
+		if report.TestObjective <= report.BaselineObjective {
+			t.Fatalf("%s: walk-forward %v did not beat the baseline %v", method, report.TestObjective, report.BaselineObjective)
+		}
+		for _, fold := range report.Folds {
+			if !fold.TestFrom.After(fold.TrainFrom) || !fold.TestTo.After(fold.TestFrom) {
+				t.Fatalf("%s: overlapping fold %+v", method, fold)
+			}
+		}
+	}
+}
+
+func TestOptimizeGridLimit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.From = fearGreedConfig().From
+	data := testData(make([]float64, 100), make([]float64, 100))
+	for i := range data.Bars {
+		data.Bars[i].Close = 100
+	}
+	opt := OptimizeConfig{
+		Backtest: cfg,
+		Space:    SearchSpace{Weights: []float64{0, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}},
+		Method:   MethodGrid,
+		Folds:    1,
+	}
+	opt.Space.Metrics = []string{"fear-greed", "rsi", "moving-averages", "volume-trend", "ssr"}
+	if _, _, err := Optimize(opt, data); err == nil || !strings.Contains(err.Error(), "grid") {
+		t.Fatalf("expected the oversized grid to be rejected, got %v", err)
+	}
+}
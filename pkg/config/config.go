@@ -18,11 +18,99 @@ type Config struct {
 	PostgresUser         string
 	PostgresPassword     string
 	PostgresDB           string
+	StorageDriver        string
+	StorageDSN           string
+	StorageDir           string
+	// TelegramSessionKey encrypts the Telegram session, TelegramSessionOldKeys
+	// holds comma separated retired keys that are still accepted for decryption
+	TelegramSessionKey     string
+	TelegramSessionOldKeys string
+	// SolanaPriceAPI is a Jupiter compatible price endpoint for SPL tokens
+	SolanaPriceAPI string
+	// SolanaWatchAddresses is a comma separated list of wallets followed in
+	// real time in addition to WalletAddress
+	SolanaWatchAddresses string
+	// SolanaRPCEndpoints is a comma separated list of pooled RPC endpoints,
+	// each optionally followed by ;weight=N and ;rps=N. RpcEndpoint is used
+	// when it is empty.
+	SolanaRPCEndpoints string
+	// SolanaCommitment is the default commitment of Solana reads
+	SolanaCommitment string
+	// SolanaPoolPricing prices tokens missing from SolanaPriceAPI from
+	// Raydium and Orca pool reserves when set to "true"
+	SolanaPoolPricing string
+	// PortfolioSolanaWallets is a comma separated list of Solana wallets
+	// merged into the consolidated portfolio, WalletAddress when empty
+	PortfolioSolanaWallets string
+	// StrategyProfileDir holds the versioned weight profiles written by the
+	// optimizer
+	StrategyProfileDir string
+	// StrategyProfilesFile is the YAML or JSON file of named indicator
+	// thresholds and weight profiles, reloaded when it changes
+	StrategyProfilesFile string
+	// CoinGeckoAPIKey enables the CoinGecko pro API, needed for the market
+	// cap and dominance history
+	CoinGeckoAPIKey string
+	// FundingVenues is a comma separated list of the exchanges compared by
+	// the funding endpoints: binance, bybit and okx
+	FundingVenues string
+	// LiquidationSymbols is a comma separated list of the Binance futures
+	// symbols whose liquidations are recorded
+	LiquidationSymbols string
+	// AltcoinSeasonTopN and AltcoinSeasonWindowDays are the number of coins
+	// and the days the altcoin season index compares with bitcoin
+	AltcoinSeasonTopN       string
+	AltcoinSeasonWindowDays string
+	// AltcoinSeasonStablecoins and AltcoinSeasonWrapped are comma separated
+	// symbols left out of the altcoin season index, replacing the built-in
+	// lists when set
+	AltcoinSeasonStablecoins string
+	AltcoinSeasonWrapped     string
+	// ExchangeWalletsFile is the YAML or JSON file of labelled exchange
+	// wallets whose flows are tracked, the built-in wallets when missing
+	ExchangeWalletsFile string
+	// ExchangeWalletLabels is a comma separated list of the exchanges whose
+	// wallets are tracked, all of them when empty
+	ExchangeWalletLabels string
+	// WhaleThresholdUSD is the value of a whale transfer
+	WhaleThresholdUSD string
+	// EtherscanAPIKey enables the tracking of the Ethereum wallets
+	EtherscanAPIKey string
+	// OnchainFixture replays the balances and transfers of a JSON fixture
+	// instead of reading the chains
+	OnchainFixture string
+	// OnchainSolanaRPCEndpoints are the RPC endpoints of the Solana exchange
+	// wallets, in the format of SolanaRPCEndpoints. They are kept apart
+	// from the pool of the user facing reads, RpcEndpoint at 2 requests
+	// per second when empty.
+	OnchainSolanaRPCEndpoints string
 }
 
 var GlobalConfig Config
 
+// LoadConfig reads the configuration of the server, which requires the
+// Telegram settings
 func LoadConfig() error {
+	if err := LoadBaseConfig(); err != nil {
+		return err
+	}
+
+	if GlobalConfig.TelegramAPIID == "" {
+		return fmt.Errorf("TELEGRAM_API_ID is required")
+	}
+	if GlobalConfig.TelegramAPIHash == "" {
+		return fmt.Errorf("TELEGRAM_API_HASH is required")
+	}
+	if GlobalConfig.TelegramSessionKey == "" {
+		return fmt.Errorf("TELEGRAM_SESSION_KEY is required")
+	}
+
+	return nil
+}
+
+// LoadBaseConfig reads the configuration without requiring the Telegram
+// settings, for the command line tools
+func LoadBaseConfig() error {
 	GlobalConfig = Config{
 		Port:                 getEnv("PORT", "8080"),
 		RpcEndpoint:          getEnv("RPC_ENDPOINT", "https://api.mainnet-beta.solana.com"),
@@ -36,13 +124,42 @@ func LoadConfig() error {
 		PostgresUser:         getEnv("POSTGRES_USER", "postgres"),
 		PostgresPassword:     getEnv("POSTGRES_PASSWORD", "postgres"),
 		PostgresDB:           getEnv("POSTGRES_DB", "go_vue"),
-	}
+		StorageDriver:        getEnv("STORAGE_DRIVER", "file"),
+		StorageDSN:           getEnv("STORAGE_DSN", ""),
+		StorageDir:           getEnv("STORAGE_DIR", "data"),
 
-	if GlobalConfig.TelegramAPIID == "" {
-		return fmt.Errorf("TELEGRAM_API_ID is required")
+		TelegramSessionKey:     getEnv("TELEGRAM_SESSION_KEY", ""),
+		TelegramSessionOldKeys: getEnv("TELEGRAM_SESSION_OLD_KEYS", ""),
+		SolanaPriceAPI:         getEnv("SOLANA_PRICE_API", "https://api.jup.ag/price/v2"),
+		SolanaWatchAddresses:   getEnv("SOLANA_WATCH_ADDRESSES", ""),
+		SolanaRPCEndpoints:     getEnv("SOLANA_RPC_ENDPOINTS", ""),
+		SolanaCommitment:       getEnv("SOLANA_COMMITMENT", "confirmed"),
+		SolanaPoolPricing:      getEnv("SOLANA_POOL_PRICING", "true"),
+		PortfolioSolanaWallets: getEnv("PORTFOLIO_SOLANA_WALLETS", ""),
+		StrategyProfileDir:     getEnv("STRATEGY_PROFILE_DIR", "profiles"),
+		StrategyProfilesFile:   getEnv("STRATEGY_PROFILES_FILE", "strategy_profiles.yaml"),
+		CoinGeckoAPIKey:        getEnv("COINGECKO_API_KEY", ""),
+		FundingVenues:          getEnv("FUNDING_VENUES", "binance,bybit,okx"),
+		LiquidationSymbols:     getEnv("LIQUIDATION_SYMBOLS", "BTCUSDT,ETHUSDT"),
+
+		AltcoinSeasonTopN:        getEnv("ALTCOIN_SEASON_TOP_N", "50"),
+		AltcoinSeasonWindowDays:  getEnv("ALTCOIN_SEASON_WINDOW_DAYS", "90"),
+		AltcoinSeasonStablecoins: getEnv("ALTCOIN_SEASON_STABLECOINS", ""),
+		AltcoinSeasonWrapped:     getEnv("ALTCOIN_SEASON_WRAPPED", ""),
+
+		ExchangeWalletsFile:  getEnv("EXCHANGE_WALLETS_FILE", "exchange_wallets.yaml"),
+		ExchangeWalletLabels: getEnv("EXCHANGE_WALLET_LABELS", ""),
+		WhaleThresholdUSD:    getEnv("WHALE_THRESHOLD_USD", "1000000"),
+		EtherscanAPIKey:      getEnv("ETHERSCAN_API_KEY", ""),
+		OnchainFixture:       getEnv("ONCHAIN_FIXTURE", ""),
+
+		OnchainSolanaRPCEndpoints: getEnv("ONCHAIN_SOLANA_RPC_ENDPOINTS", ""),
 	}
-	if GlobalConfig.TelegramAPIHash == "" {
-		return fmt.Errorf("TELEGRAM_API_HASH is required")
+
+	switch GlobalConfig.StorageDriver {
+	case "file", "postgres", "sqlite", "sqlite3":
+	default:
+		return fmt.Errorf("STORAGE_DRIVER must be file, postgres or sqlite, got %q", GlobalConfig.StorageDriver)
 	}
 
 	return nil
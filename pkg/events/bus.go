@@ -0,0 +1,103 @@
+// Package events provides an in-process publish/subscribe bus used to fan
+// out real-time events (Telegram messages, on-chain activity, alerts) to the
+// subsystems and streams interested in them.
+package events
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuffer is the subscription buffer used when none is given
+const DefaultBuffer = 64
+
+// Event is a single message published on the bus
+type Event struct {
+	Topic string      `json:"topic"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+type subscription struct {
+	ch     chan Event
+	topics []string
+}
+
+// matches reports whether the subscription wants topic. A subscription topic
+// matches itself and every topic below it, so "telegram" receives
+// "telegram.message.new".
+func (s *subscription) matches(topic string) bool {
+	if len(s.topics) == 0 {
+		return true
+	}
+	for _, t := range s.topics {
+		if topic == t || strings.HasPrefix(topic, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus delivers published events to matching subscribers. Publishing never
+// blocks: events for a subscriber whose buffer is full are dropped.
+type Bus struct {
+	mu      sync.RWMutex
+	subs    map[*subscription]struct{}
+	dropped atomic.Int64
+}
+
+// NewBus creates an empty bus
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*subscription]struct{})}
+}
+
+// Publish sends data to every subscriber of topic
+func (b *Bus) Publish(topic string, data interface{}) {
+	event := Event{Topic: topic, Time: time.Now(), Data: data}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.matches(topic) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events for topics, or all events
+// when no topic is given. Call the returned function to unsubscribe; the
+// channel is closed afterwards.
+func (b *Bus) Subscribe(buffer int, topics ...string) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	sub := &subscription{ch: make(chan Event, buffer), topics: topics}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+	return sub.ch, unsubscribe
+}
+
+// Dropped returns how many events were discarded because a subscriber was
+// not keeping up
+func (b *Bus) Dropped() int64 {
+	return b.dropped.Load()
+}
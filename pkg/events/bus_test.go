@@ -0,0 +1,46 @@
+package events
+
+import "testing"
+
+func TestBusTopicMatching(t *testing.T) {
+	bus := NewBus()
+	telegram, unsubscribeTelegram := bus.Subscribe(4, "telegram")
+	defer unsubscribeTelegram()
+	edits, unsubscribeEdits := bus.Subscribe(4, "telegram.message.edited")
+	defer unsubscribeEdits()
+
+	bus.Publish("telegram.message.new", 1)
+	bus.Publish("telegram.message.edited", 2)
+	bus.Publish("telegramx.other", 3)
+	bus.Publish("solana.account", 4)
+
+	if got := len(telegram); got != 2 {
+		t.Fatalf("telegram subscriber got %d events, want 2", got)
+	}
+	if event := <-edits; event.Data != 2 || len(edits) != 0 {
+		t.Fatalf("edits subscriber got %+v", event)
+	}
+}
+
+func TestBusDropsWhenFull(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe(1)
+
+	bus.Publish("a", 1)
+	bus.Publish("a", 2)
+	if bus.Dropped() != 1 {
+		t.Fatalf("dropped = %d, want 1", bus.Dropped())
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if event := <-ch; event.Data != 1 {
+		t.Fatalf("got %+v, want first event", event)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("channel must be closed after unsubscribe")
+	}
+
+	// Publishing after unsubscribe must not panic on the closed channel
+	bus.Publish("a", 3)
+}
@@ -0,0 +1,185 @@
+// Package funding compares the funding of perpetual contracts across venues
+package funding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/market"
+)
+
+// defaultInterval is the funding interval of most perpetual contracts
+const defaultInterval = 8 * time.Hour
+
+// Venue reads the funding of one exchange. Assets are base assets such as
+// BTC, every venue maps them to its own contract.
+type Venue interface {
+	Name() string
+	// Funding returns the last settled and the predicted funding of asset
+	Funding(ctx context.Context, asset string) (*Snapshot, error)
+	// History returns the funding settled between from and to in time order
+	History(ctx context.Context, asset string, from, to time.Time) ([]market.FundingRate, error)
+}
+
+// Snapshot is the funding of one contract on one venue
+type Snapshot struct {
+	Venue           string    `json:"venue"`
+	Symbol          string    `json:"symbol"`
+	LastRate        float64   `json:"last_rate"`
+	LastFundingTime time.Time `json:"last_funding_time"`
+	// PredictedRate is the rate the next settlement is expected at
+	PredictedRate   float64   `json:"predicted_rate"`
+	NextFundingTime time.Time `json:"next_funding_time"`
+	IntervalHours   float64   `json:"interval_hours"`
+	MarkPrice       float64   `json:"mark_price,omitempty"`
+	// AnnualizedLast and AnnualizedPredicted are the rates in percent per
+	// year
+	AnnualizedLast      float64 `json:"annualized_last"`
+	AnnualizedPredicted float64 `json:"annualized_predicted"`
+}
+
+// Annualize returns a funding rate paid every interval in percent per year
+func Annualize(rate float64, interval time.Duration) float64 {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return rate * float64(365*24*time.Hour) / float64(interval) * 100
+}
+
+// interval is the spacing of the last two settlements, defaultInterval
+// without two of them
+func interval(history []market.FundingRate) time.Duration {
+	if len(history) < 2 {
+		return defaultInterval
+	}
+	d := history[len(history)-1].Time.Sub(history[len(history)-2].Time)
+	if d <= 0 {
+		return defaultInterval
+	}
+	// settlement times drift by a few milliseconds
+	return d.Round(time.Hour)
+}
+
+// fill sets the last settlement, the interval and the annualized rates
+func (s *Snapshot) fill(history []market.FundingRate) {
+	if len(history) > 0 {
+		last := history[len(history)-1]
+		s.LastRate, s.LastFundingTime = last.Rate, last.Time
+	}
+	if s.IntervalHours == 0 {
+		s.IntervalHours = interval(history).Hours()
+	}
+	d := time.Duration(s.IntervalHours * float64(time.Hour))
+	s.AnnualizedLast = Annualize(s.LastRate, d)
+	s.AnnualizedPredicted = Annualize(s.PredictedRate, d)
+}
+
+// Comparison is the funding of one asset across venues
+type Comparison struct {
+	Asset     string      `json:"asset"`
+	Snapshots []*Snapshot `json:"snapshots"`
+	// Errors holds the venues that could not be read
+	Errors map[string]string `json:"errors,omitempty"`
+	// MeanAnnualized is the mean predicted funding in percent per year
+	MeanAnnualized float64 `json:"mean_annualized"`
+	// Spread is the difference between the highest and lowest predicted
+	// funding in percent per year
+	Spread  float64 `json:"spread"`
+	Highest string  `json:"highest,omitempty"`
+	Lowest  string  `json:"lowest,omitempty"`
+	// Divergent is set when the spread reaches the divergence threshold
+	Divergent bool `json:"divergent"`
+}
+
+// Compare reads the funding of asset on every venue concurrently. A
+// failing venue is reported in Errors and left out of the statistics.
+// threshold is the spread in percent per year that counts as divergent.
+func Compare(ctx context.Context, venues []Venue, asset string, threshold float64) *Comparison {
+	comparison := &Comparison{Asset: strings.ToUpper(asset), Snapshots: []*Snapshot{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, venue := range venues {
+		wg.Add(1)
+		go func(venue Venue) {
+			defer wg.Done()
+			snapshot, err := venue.Funding(ctx, comparison.Asset)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if comparison.Errors == nil {
+					comparison.Errors = make(map[string]string)
+				}
+				comparison.Errors[venue.Name()] = err.Error()
+				return
+			}
+			comparison.Snapshots = append(comparison.Snapshots, snapshot)
+		}(venue)
+	}
+	wg.Wait()
+	if len(comparison.Snapshots) == 0 {
+		return comparison
+	}
+
+	sort.Slice(comparison.Snapshots, func(i, j int) bool {
+		return comparison.Snapshots[i].AnnualizedPredicted > comparison.Snapshots[j].AnnualizedPredicted
+	})
+	highest, lowest := comparison.Snapshots[0], comparison.Snapshots[len(comparison.Snapshots)-1]
+	var sum float64
+	for _, snapshot := range comparison.Snapshots {
+		sum += snapshot.AnnualizedPredicted
+	}
+	comparison.MeanAnnualized = sum / float64(len(comparison.Snapshots))
+	comparison.Spread = highest.AnnualizedPredicted - lowest.AnnualizedPredicted
+	if len(comparison.Snapshots) > 1 {
+		comparison.Highest, comparison.Lowest = highest.Venue, lowest.Venue
+		comparison.Divergent = math.Abs(comparison.Spread) >= threshold
+	}
+	return comparison
+}
+
+// Venues returns the adapters named in the comma separated list names
+func Venues(names string, binance *market.BinanceService) ([]Venue, error) {
+	var venues []Venue
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "binance":
+			venues = append(venues, Binance{Service: binance})
+		case "bybit":
+			venues = append(venues, NewBybit())
+		case "okx":
+			venues = append(venues, NewOKX())
+		default:
+			return nil, fmt.Errorf("unknown funding venue %q", name)
+		}
+	}
+	return venues, nil
+}
+
+// getJSON decodes the JSON response of a GET request
+func getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
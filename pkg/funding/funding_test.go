@@ -0,0 +1,172 @@
+package funding
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-vue/pkg/market"
+)
+
+// stubSettlements are the funding times served by the stub, every 8 hours
+// over the last 100 days
+func stubSettlements(now time.Time) []time.Time {
+	last := now.Truncate(8 * time.Hour)
+	var times []time.Time
+	for t := last.Add(-100 * 24 * time.Hour); !t.After(last); t = t.Add(8 * time.Hour) {
+		times = append(times, t)
+	}
+	return times
+}
+
+func millis(r *http.Request, name string, fallback int64) int64 {
+	if value, err := strconv.ParseInt(r.URL.Query().Get(name), 10, 64); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// newStubServer serves the public funding endpoints of Binance, Bybit and
+// OKX. Binance settles at 0.01%, Bybit at 0.02% and OKX at 0.05% every 8
+// hours and the predicted rates are twice that.
+func newStubServer(t *testing.T) *httptest.Server {
+	now := time.Now()
+	times := stubSettlements(now)
+	next := times[len(times)-1].Add(8 * time.Hour)
+	newestFirst := func(from, to int64, limit int) []time.Time {
+		var page []time.Time
+		for i := len(times) - 1; i >= 0 && len(page) < limit; i-- {
+			if ms := times[i].UnixMilli(); ms >= from && ms <= to {
+				page = append(page, times[i])
+			}
+		}
+		return page
+	}
+
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("/fapi/v1/premiumIndex", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"symbol": r.URL.Query().Get("symbol"), "markPrice": "50000.5", "lastFundingRate": "0.0002", "nextFundingTime": next.UnixMilli()})
+	})
+	mux.HandleFunc("/fapi/v1/fundingRate", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		page := newestFirst(millis(r, "startTime", 0), millis(r, "endTime", math.MaxInt64), math.MaxInt)
+		sort.Slice(page, func(i, j int) bool { return page[i].Before(page[j]) })
+		var rates []map[string]interface{}
+		for _, t := range page[:min(limit, len(page))] {
+			rates = append(rates, map[string]interface{}{"fundingTime": t.UnixMilli(), "fundingRate": "0.0001"})
+		}
+		reply(w, rates)
+	})
+	mux.HandleFunc("/v5/market/tickers", func(w http.ResponseWriter, r *http.Request) {
+		ticker := map[string]string{"symbol": r.URL.Query().Get("symbol"), "markPrice": "50010", "fundingRate": "0.0004", "nextFundingTime": strconv.FormatInt(next.UnixMilli(), 10)}
+		reply(w, map[string]interface{}{"retCode": 0, "result": map[string]interface{}{"list": []interface{}{ticker}}})
+	})
+	mux.HandleFunc("/v5/market/funding/history", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		var list []map[string]string
+		for _, t := range newestFirst(millis(r, "startTime", 0), millis(r, "endTime", math.MaxInt64), limit) {
+			list = append(list, map[string]string{"fundingRate": "0.0002", "fundingRateTimestamp": strconv.FormatInt(t.UnixMilli(), 10)})
+		}
+		reply(w, map[string]interface{}{"retCode": 0, "result": map[string]interface{}{"list": list}})
+	})
+	mux.HandleFunc("/api/v5/public/funding-rate", func(w http.ResponseWriter, r *http.Request) {
+		rate := map[string]string{
+			"instId":          r.URL.Query().Get("instId"),
+			"fundingRate":     "0.001",
+			"fundingTime":     strconv.FormatInt(next.UnixMilli(), 10),
+			"nextFundingTime": strconv.FormatInt(next.Add(8*time.Hour).UnixMilli(), 10),
+		}
+		reply(w, map[string]interface{}{"code": "0", "data": []interface{}{rate}})
+	})
+	mux.HandleFunc("/api/v5/public/funding-rate-history", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		var data []map[string]string
+		for _, t := range newestFirst(0, millis(r, "after", math.MaxInt64)-1, limit) {
+			data = append(data, map[string]string{"fundingRate": "0.0005", "fundingTime": strconv.FormatInt(t.UnixMilli(), 10)})
+		}
+		reply(w, map[string]interface{}{"code": "0", "data": data})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func stubVenues(url string) []Venue {
+	return []Venue{
+		Binance{Service: market.NewBinanceServiceWithURLs("", "", url, url)},
+		&Bybit{BaseURL: url},
+		&OKX{BaseURL: url},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	server := newStubServer(t)
+	venues := append(stubVenues(server.URL), &Bybit{BaseURL: server.URL + "/missing"})
+
+	comparison := Compare(context.Background(), venues, "btc", 50)
+	if len(comparison.Snapshots) != 3 || len(comparison.Errors) != 1 {
+		t.Fatalf("expected three venues and one error, got %+v", comparison)
+	}
+	if comparison.Highest != "okx" || comparison.Lowest != "binance" || !comparison.Divergent {
+		t.Fatalf("unexpected ranking %+v", comparison)
+	}
+	for _, snapshot := range comparison.Snapshots {
+		if snapshot.IntervalHours != 8 || snapshot.LastFundingTime.IsZero() || snapshot.NextFundingTime.IsZero() {
+			t.Fatalf("incomplete snapshot %+v", snapshot)
+		}
+		// predicted rates are twice the settled ones
+		if math.Abs(snapshot.AnnualizedPredicted-2*snapshot.AnnualizedLast) > 1e-9 {
+			t.Fatalf("unexpected annualized rates %+v", snapshot)
+		}
+	}
+	binance := comparison.Snapshots[2]
+	if binance.Symbol != "BTCUSDT" || math.Abs(binance.AnnualizedLast-10.95) > 1e-9 || binance.MarkPrice != 50000.5 {
+		t.Fatalf("unexpected binance snapshot %+v", binance)
+	}
+	if math.Abs(comparison.Spread-(109.5-21.9)) > 1e-9 {
+		t.Fatalf("spread = %v", comparison.Spread)
+	}
+}
+
+func TestHistoryPaging(t *testing.T) {
+	server := newStubServer(t)
+	to := time.Now()
+	from := to.Add(-90 * 24 * time.Hour)
+	for _, venue := range stubVenues(server.URL) {
+		history, err := venue.History(context.Background(), "BTC", from, to)
+		if err != nil {
+			t.Fatalf("%s: %v", venue.Name(), err)
+		}
+		// 90 days of settlements span several Bybit and OKX pages
+		if len(history) < 269 || len(history) > 271 {
+			t.Fatalf("%s: got %d settlements", venue.Name(), len(history))
+		}
+		for i := 1; i < len(history); i++ {
+			if history[i].Time.Sub(history[i-1].Time) != 8*time.Hour {
+				t.Fatalf("%s: gap or duplicate at %d", venue.Name(), i)
+			}
+		}
+		if history[0].Time.Before(from) {
+			t.Fatalf("%s: settlement before from", venue.Name())
+		}
+	}
+}
+
+func TestAnnualize(t *testing.T) {
+	if got := Annualize(0.0001, 8*time.Hour); math.Abs(got-10.95) > 1e-9 {
+		t.Fatalf("annualized 0.01%% per 8h = %v", got)
+	}
+	if got := Annualize(0.0001, 4*time.Hour); math.Abs(got-21.9) > 1e-9 {
+		t.Fatalf("annualized 0.01%% per 4h = %v", got)
+	}
+}
@@ -0,0 +1,296 @@
+package funding
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-vue/pkg/market"
+)
+
+// recent is the history read for the last settlement and the interval
+const recent = 3 * 24 * time.Hour
+
+// Binance reads USDT margined perpetuals from Binance futures
+type Binance struct {
+	Service *market.BinanceService
+}
+
+func (Binance) Name() string { return "binance" }
+
+func (Binance) symbol(asset string) string { return asset + "USDT" }
+
+func (b Binance) Funding(ctx context.Context, asset string) (*Snapshot, error) {
+	index, err := b.Service.PremiumIndex(ctx, b.symbol(asset))
+	if err != nil {
+		return nil, err
+	}
+	history, err := b.History(ctx, asset, time.Now().Add(-recent), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{
+		Venue:           b.Name(),
+		Symbol:          b.symbol(asset),
+		PredictedRate:   index.FundingRate,
+		NextFundingTime: index.NextFundingTime,
+		MarkPrice:       index.MarkPrice,
+	}
+	snapshot.fill(history)
+	return snapshot, nil
+}
+
+func (b Binance) History(ctx context.Context, asset string, from, to time.Time) ([]market.FundingRate, error) {
+	return b.Service.FundingRates(ctx, b.symbol(asset), from, to)
+}
+
+// Bybit reads USDT margined perpetuals from the Bybit v5 API
+type Bybit struct {
+	BaseURL string
+}
+
+// NewBybit creates an adapter for the public Bybit API
+func NewBybit() *Bybit {
+	return &Bybit{BaseURL: "https://api.bybit.com"}
+}
+
+func (*Bybit) Name() string { return "bybit" }
+
+func (*Bybit) symbol(asset string) string { return asset + "USDT" }
+
+type bybitResponse[T any] struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		List []T `json:"list"`
+	} `json:"result"`
+}
+
+func bybitGet[T any](ctx context.Context, b *Bybit, path string, params url.Values) ([]T, error) {
+	var response bybitResponse[T]
+	if err := getJSON(ctx, b.BaseURL+path+"?"+params.Encode(), &response); err != nil {
+		return nil, fmt.Errorf("bybit %s: %v", path, err)
+	}
+	if response.RetCode != 0 {
+		return nil, fmt.Errorf("bybit %s: %s", path, response.RetMsg)
+	}
+	return response.Result.List, nil
+}
+
+func (b *Bybit) Funding(ctx context.Context, asset string) (*Snapshot, error) {
+	params := url.Values{}
+	params.Set("category", "linear")
+	params.Set("symbol", b.symbol(asset))
+	tickers, err := bybitGet[struct {
+		Symbol          string `json:"symbol"`
+		MarkPrice       string `json:"markPrice"`
+		FundingRate     string `json:"fundingRate"`
+		NextFundingTime string `json:"nextFundingTime"`
+	}](ctx, b, "/v5/market/tickers", params)
+	if err != nil {
+		return nil, err
+	}
+	if len(tickers) == 0 {
+		return nil, fmt.Errorf("bybit has no ticker for %s", b.symbol(asset))
+	}
+	ticker := tickers[0]
+	snapshot := &Snapshot{Venue: b.Name(), Symbol: ticker.Symbol}
+	if snapshot.PredictedRate, err = parseFloat(ticker.FundingRate); err != nil {
+		return nil, err
+	}
+	if snapshot.MarkPrice, err = parseFloat(ticker.MarkPrice); err != nil {
+		return nil, err
+	}
+	if snapshot.NextFundingTime, err = parseMillis(ticker.NextFundingTime); err != nil {
+		return nil, err
+	}
+
+	history, err := b.History(ctx, asset, time.Now().Add(-recent), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	snapshot.fill(history)
+	return snapshot, nil
+}
+
+// bybitPageLimit is the maximum number of funding rates per call
+const bybitPageLimit = 200
+
+// History pages backwards from to, Bybit returns the newest rates first
+func (b *Bybit) History(ctx context.Context, asset string, from, to time.Time) ([]market.FundingRate, error) {
+	var rates []market.FundingRate
+	end := to
+	for end.After(from) {
+		params := url.Values{}
+		params.Set("category", "linear")
+		params.Set("symbol", b.symbol(asset))
+		params.Set("startTime", strconv.FormatInt(from.UnixMilli(), 10))
+		params.Set("endTime", strconv.FormatInt(end.UnixMilli()-1, 10))
+		params.Set("limit", strconv.Itoa(bybitPageLimit))
+		page, err := bybitGet[struct {
+			FundingRate          string `json:"fundingRate"`
+			FundingRateTimestamp string `json:"fundingRateTimestamp"`
+		}](ctx, b, "/v5/market/funding/history", params)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range page {
+			rate, err := parseFloat(r.FundingRate)
+			if err != nil {
+				return nil, err
+			}
+			t, err := parseMillis(r.FundingRateTimestamp)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, market.FundingRate{Time: t, Rate: rate})
+			if t.Before(end) {
+				end = t
+			}
+		}
+		if len(page) < bybitPageLimit {
+			break
+		}
+	}
+	return sortRates(rates, from, to), nil
+}
+
+// OKX reads USDT margined swaps from the OKX v5 API
+type OKX struct {
+	BaseURL string
+}
+
+// NewOKX creates an adapter for the public OKX API
+func NewOKX() *OKX {
+	return &OKX{BaseURL: "https://www.okx.com"}
+}
+
+func (*OKX) Name() string { return "okx" }
+
+func (*OKX) instrument(asset string) string { return asset + "-USDT-SWAP" }
+
+type okxResponse[T any] struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	Data []T    `json:"data"`
+}
+
+func okxGet[T any](ctx context.Context, o *OKX, path string, params url.Values) ([]T, error) {
+	var response okxResponse[T]
+	if err := getJSON(ctx, o.BaseURL+path+"?"+params.Encode(), &response); err != nil {
+		return nil, fmt.Errorf("okx %s: %v", path, err)
+	}
+	if response.Code != "0" {
+		return nil, fmt.Errorf("okx %s: %s", path, response.Msg)
+	}
+	return response.Data, nil
+}
+
+func (o *OKX) Funding(ctx context.Context, asset string) (*Snapshot, error) {
+	params := url.Values{}
+	params.Set("instId", o.instrument(asset))
+	data, err := okxGet[struct {
+		InstID          string `json:"instId"`
+		FundingRate     string `json:"fundingRate"`
+		FundingTime     string `json:"fundingTime"`
+		NextFundingTime string `json:"nextFundingTime"`
+	}](ctx, o, "/api/v5/public/funding-rate", params)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("okx has no funding for %s", o.instrument(asset))
+	}
+	// fundingRate is the rate of the coming settlement at fundingTime
+	current := data[0]
+	snapshot := &Snapshot{Venue: o.Name(), Symbol: current.InstID}
+	if snapshot.PredictedRate, err = parseFloat(current.FundingRate); err != nil {
+		return nil, err
+	}
+	if snapshot.NextFundingTime, err = parseMillis(current.FundingTime); err != nil {
+		return nil, err
+	}
+	if following, err := parseMillis(current.NextFundingTime); err == nil && following.After(snapshot.NextFundingTime) {
+		snapshot.IntervalHours = following.Sub(snapshot.NextFundingTime).Round(time.Hour).Hours()
+	}
+
+	history, err := o.History(ctx, asset, time.Now().Add(-recent), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	snapshot.fill(history)
+	return snapshot, nil
+}
+
+// okxPageLimit is the maximum number of funding rates per call
+const okxPageLimit = 100
+
+// History pages backwards from to, OKX returns the newest rates first and
+// keeps about three months
+func (o *OKX) History(ctx context.Context, asset string, from, to time.Time) ([]market.FundingRate, error) {
+	var rates []market.FundingRate
+	end := to
+	for end.After(from) {
+		params := url.Values{}
+		params.Set("instId", o.instrument(asset))
+		// after returns the records older than the timestamp
+		params.Set("after", strconv.FormatInt(end.UnixMilli(), 10))
+		params.Set("limit", strconv.Itoa(okxPageLimit))
+		page, err := okxGet[struct {
+			FundingRate string `json:"fundingRate"`
+			FundingTime string `json:"fundingTime"`
+		}](ctx, o, "/api/v5/public/funding-rate-history", params)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range page {
+			rate, err := parseFloat(r.FundingRate)
+			if err != nil {
+				return nil, err
+			}
+			t, err := parseMillis(r.FundingTime)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, market.FundingRate{Time: t, Rate: rate})
+			if t.Before(end) {
+				end = t
+			}
+		}
+		if len(page) < okxPageLimit {
+			break
+		}
+	}
+	return sortRates(rates, from, to), nil
+}
+
+// sortRates orders rates by time and keeps those from from up to to
+func sortRates(rates []market.FundingRate, from, to time.Time) []market.FundingRate {
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Time.Before(rates[j].Time) })
+	kept := rates[:0]
+	for _, rate := range rates {
+		if !rate.Time.Before(from) && rate.Time.Before(to) {
+			kept = append(kept, rate)
+		}
+	}
+	return kept
+}
+
+func parseFloat(value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed number %q", value)
+	}
+	return f, nil
+}
+
+func parseMillis(value string) (time.Time, error) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp %q", value)
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
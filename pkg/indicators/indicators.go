@@ -0,0 +1,234 @@
+// Package indicators computes technical indicators over candle series. Every
+// function returns one value per input bar, NaN where the indicator is not
+// defined yet.
+package indicators
+
+import "math"
+
+func nans(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	return values
+}
+
+// SMA is the simple moving average over period values. Leading NaN values
+// are skipped.
+func SMA(values []float64, period int) []float64 {
+	result := nans(len(values))
+	var sum float64
+	count := 0
+	for i, value := range values {
+		if math.IsNaN(value) {
+			continue
+		}
+		sum += value
+		count++
+		if count > period {
+			sum -= values[i-period]
+		}
+		if count >= period {
+			result[i] = sum / float64(period)
+		}
+	}
+	return result
+}
+
+// EMA is the exponential moving average over period values, seeded with
+// the simple average of the first period values. Leading NaN values are
+// skipped.
+func EMA(values []float64, period int) []float64 {
+	result := nans(len(values))
+	k := 2 / float64(period+1)
+	var sum, ema float64
+	count := 0
+	for i, value := range values {
+		if math.IsNaN(value) {
+			continue
+		}
+		count++
+		switch {
+		case count < period:
+			sum += value
+			continue
+		case count == period:
+			ema = (sum + value) / float64(period)
+		default:
+			ema = value*k + ema*(1-k)
+		}
+		result[i] = ema
+	}
+	return result
+}
+
+// RSI is the Wilder relative strength index
+func RSI(closes []float64, period int) []float64 {
+	values := nans(len(closes))
+	var gain, loss float64
+	for i := 1; i < len(closes); i++ {
+		delta := closes[i] - closes[i-1]
+		up, down := math.Max(delta, 0), math.Max(-delta, 0)
+		if i <= period {
+			gain += up / float64(period)
+			loss += down / float64(period)
+			if i < period {
+				continue
+			}
+		} else {
+			gain = (gain*float64(period-1) + up) / float64(period)
+			loss = (loss*float64(period-1) + down) / float64(period)
+		}
+		if loss == 0 {
+			values[i] = 100
+		} else {
+			values[i] = 100 - 100/(1+gain/loss)
+		}
+	}
+	return values
+}
+
+// MACD holds the moving average convergence divergence lines
+type MACD struct {
+	MACD      []float64
+	Signal    []float64
+	Histogram []float64
+}
+
+// NewMACD computes the MACD of closes, usually with 12, 26 and 9 periods
+func NewMACD(closes []float64, fast, slow, signal int) MACD {
+	fastEMA, slowEMA := EMA(closes, fast), EMA(closes, slow)
+	m := MACD{MACD: make([]float64, len(closes)), Histogram: make([]float64, len(closes))}
+	for i := range closes {
+		m.MACD[i] = fastEMA[i] - slowEMA[i]
+	}
+	m.Signal = EMA(m.MACD, signal)
+	for i := range closes {
+		m.Histogram[i] = m.MACD[i] - m.Signal[i]
+	}
+	return m
+}
+
+// Ichimoku holds the lines of the Ichimoku cloud. SenkouA and SenkouB are
+// shifted forward, so index i holds the cloud in effect at bar i. Chikou
+// is the close shifted back, index i holds the close displacement bars
+// later.
+type Ichimoku struct {
+	Tenkan  []float64
+	Kijun   []float64
+	SenkouA []float64
+	SenkouB []float64
+	Chikou  []float64
+}
+
+// midpoint is the middle of the highest high and lowest low over period
+func midpoint(highs, lows []float64, period int) []float64 {
+	values := nans(len(highs))
+	for i := period - 1; i < len(highs); i++ {
+		high, low := highs[i], lows[i]
+		for j := i - period + 1; j < i; j++ {
+			high, low = math.Max(high, highs[j]), math.Min(low, lows[j])
+		}
+		values[i] = (high + low) / 2
+	}
+	return values
+}
+
+// NewIchimoku computes the Ichimoku cloud, usually with 9, 26, 52 and 26
+// periods
+func NewIchimoku(highs, lows, closes []float64, tenkan, kijun, senkouB, displacement int) Ichimoku {
+	n := len(closes)
+	ichimoku := Ichimoku{
+		Tenkan:  midpoint(highs, lows, tenkan),
+		Kijun:   midpoint(highs, lows, kijun),
+		SenkouA: nans(n),
+		SenkouB: nans(n),
+		Chikou:  nans(n),
+	}
+	spanB := midpoint(highs, lows, senkouB)
+	for i := displacement; i < n; i++ {
+		ichimoku.SenkouA[i] = (ichimoku.Tenkan[i-displacement] + ichimoku.Kijun[i-displacement]) / 2
+		ichimoku.SenkouB[i] = spanB[i-displacement]
+		ichimoku.Chikou[i-displacement] = closes[i]
+	}
+	return ichimoku
+}
+
+// CloudPosition is the percent distance of each close above the top of
+// the cloud, negative below its bottom and 0 inside it
+func (ichimoku Ichimoku) CloudPosition(closes []float64) []float64 {
+	values := nans(len(closes))
+	for i, price := range closes {
+		a, b := ichimoku.SenkouA[i], ichimoku.SenkouB[i]
+		if math.IsNaN(a) || math.IsNaN(b) {
+			continue
+		}
+		top, bottom := math.Max(a, b), math.Min(a, b)
+		switch {
+		case price > top:
+			values[i] = (price/top - 1) * 100
+		case price < bottom:
+			values[i] = (price/bottom - 1) * 100
+		default:
+			values[i] = 0
+		}
+	}
+	return values
+}
+
+// StochRSI is the stochastic oscillator applied to the RSI, scaled to
+// 0-100. K is smoothed over kSmooth values and D is the average of K over
+// dSmooth values.
+func StochRSI(closes []float64, rsiPeriod, stochPeriod, kSmooth, dSmooth int) (k, d []float64) {
+	rsi := RSI(closes, rsiPeriod)
+	raw := nans(len(closes))
+	for i := range rsi {
+		if i < stochPeriod-1 || math.IsNaN(rsi[i-stochPeriod+1]) {
+			continue
+		}
+		high, low := rsi[i], rsi[i]
+		for j := i - stochPeriod + 1; j < i; j++ {
+			high, low = math.Max(high, rsi[j]), math.Min(low, rsi[j])
+		}
+		if high == low {
+			raw[i] = 50
+			continue
+		}
+		raw[i] = (rsi[i] - low) / (high - low) * 100
+	}
+	k = SMA(raw, kSmooth)
+	d = SMA(k, dSmooth)
+	return k, d
+}
+
+// ATR is the Wilder average true range
+func ATR(highs, lows, closes []float64, period int) []float64 {
+	values := nans(len(closes))
+	var atr float64
+	for i := 1; i < len(closes); i++ {
+		tr := math.Max(highs[i]-lows[i], math.Max(math.Abs(highs[i]-closes[i-1]), math.Abs(lows[i]-closes[i-1])))
+		if i <= period {
+			atr += tr / float64(period)
+			if i < period {
+				continue
+			}
+		} else {
+			atr = (atr*float64(period-1) + tr) / float64(period)
+		}
+		values[i] = atr
+	}
+	return values
+}
+
+// ATRMove is the change of each close from the previous one in units of
+// the previous ATR, above 1 or below -1 for moves larger than the usual
+// range
+func ATRMove(closes, atr []float64) []float64 {
+	values := nans(len(closes))
+	for i := 1; i < len(closes); i++ {
+		if atr[i-1] > 0 {
+			values[i] = (closes[i] - closes[i-1]) / atr[i-1]
+		}
+	}
+	return values
+}
@@ -0,0 +1,98 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestMovingAverages(t *testing.T) {
+	values := []float64{math.NaN(), 1, 2, 3, 4}
+	sma := SMA(values, 2)
+	if !math.IsNaN(sma[1]) || sma[2] != 1.5 || sma[4] != 3.5 {
+		t.Fatalf("sma = %v", sma)
+	}
+	ema := EMA(values, 2)
+	// seeded with (1+2)/2, then 3*2/3 + 1.5/3
+	if !math.IsNaN(ema[1]) || ema[2] != 1.5 || !near(ema[3], 2.5) {
+		t.Fatalf("ema = %v", ema)
+	}
+}
+
+func TestMACD(t *testing.T) {
+	closes := make([]float64, 60)
+	for i := range closes {
+		closes[i] = 100
+	}
+	macd := NewMACD(closes, 12, 26, 9)
+	if !math.IsNaN(macd.MACD[24]) || macd.MACD[25] != 0 || !math.IsNaN(macd.Signal[32]) || macd.Histogram[33] != 0 {
+		t.Fatalf("macd of a flat series = %v / %v", macd.MACD[24:27], macd.Signal[32:34])
+	}
+
+	for i := range closes {
+		closes[i] = float64(100 + i)
+	}
+	macd = NewMACD(closes, 12, 26, 9)
+	if last := len(closes) - 1; macd.MACD[last] <= 0 {
+		t.Fatalf("macd of a rising series = %v", macd.MACD[last])
+	}
+}
+
+func TestIchimoku(t *testing.T) {
+	var highs, lows, closes []float64
+	for i := 0; i < 100; i++ {
+		price := float64(100 + i)
+		highs, lows, closes = append(highs, price+1), append(lows, price-1), append(closes, price)
+	}
+	ichimoku := NewIchimoku(highs, lows, closes, 9, 26, 52, 26)
+	// tenkan at bar 8 is the middle of the highest high 109 and lowest low 99
+	if !math.IsNaN(ichimoku.Tenkan[7]) || ichimoku.Tenkan[8] != 104 {
+		t.Fatalf("tenkan = %v", ichimoku.Tenkan[7:9])
+	}
+	if ichimoku.Chikou[0] != closes[26] || !math.IsNaN(ichimoku.Chikou[99]) {
+		t.Fatal("chikou should be the close 26 bars later")
+	}
+	position := ichimoku.CloudPosition(closes)
+	if !math.IsNaN(position[76]) || position[99] <= 0 {
+		t.Fatalf("a rising series should trade above the cloud, got %v", position[99])
+	}
+
+	flat := make([]float64, 100)
+	for i := range flat {
+		flat[i] = 100
+	}
+	if position := NewIchimoku(flat, flat, flat, 9, 26, 52, 26).CloudPosition(flat); position[99] != 0 {
+		t.Fatalf("a flat series should trade in the cloud, got %v", position[99])
+	}
+}
+
+func TestStochRSI(t *testing.T) {
+	closes := make([]float64, 80)
+	for i := range closes {
+		closes[i] = 100 + 10*math.Sin(float64(i)/3)
+	}
+	k, d := StochRSI(closes, 14, 14, 3, 3)
+	if !math.IsNaN(k[28]) || math.IsNaN(k[29]) || !math.IsNaN(d[30]) || math.IsNaN(d[31]) {
+		t.Fatalf("unexpected warmup k %v d %v", k[28:30], d[30:32])
+	}
+	for i := 31; i < len(k); i++ {
+		if k[i] < -1e-9 || k[i] > 100+1e-9 || d[i] < -1e-9 || d[i] > 100+1e-9 {
+			t.Fatalf("stochastic rsi out of range at %d: %v %v", i, k[i], d[i])
+		}
+	}
+}
+
+func TestATR(t *testing.T) {
+	closes := []float64{10, 11, 12, 13, 14, 20}
+	highs := []float64{11, 12, 13, 14, 15, 21}
+	lows := []float64{9, 10, 11, 12, 13, 19}
+	atr := ATR(highs, lows, closes, 3)
+	if !math.IsNaN(atr[2]) || atr[3] != 2 || atr[4] != 2 {
+		t.Fatalf("atr = %v", atr)
+	}
+	move := ATRMove(closes, atr)
+	if !math.IsNaN(move[3]) || move[4] != 0.5 || move[5] != 3 {
+		t.Fatalf("atr move = %v", move)
+	}
+}
@@ -0,0 +1,114 @@
+package liquidations
+
+import "time"
+
+const (
+	// CascadeWindow is the period liquidations are summed over to find a
+	// cascade
+	CascadeWindow = 5 * time.Minute
+	// CascadeMinimum is the smallest value in USD liquidated within a
+	// CascadeWindow that counts as a cascade
+	CascadeMinimum = 5e6
+	// CascadeMultiple is how many times the average of the previous day a
+	// CascadeWindow must liquidate to count as a cascade
+	CascadeMultiple = 5.0
+	// baseline is the period before a window its average is taken over
+	baseline = 24 * time.Hour
+)
+
+// Cascade is a run of windows that each liquidated far more than usual,
+// positions closing at a loss force further liquidations
+type Cascade struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Side is the side most of the value was liquidated from
+	Side  string  `json:"side"`
+	Long  float64 `json:"long"`
+	Short float64 `json:"short"`
+	// Peak is the largest value liquidated within one window
+	Peak float64 `json:"peak"`
+}
+
+// DetectCascades finds the cascades in the recorded minutes. A minute ends
+// a hot window when the liquidations over the window up to it reach minimum
+// USD and multiple times the average window of the day before. Overlapping
+// hot windows form one cascade.
+func DetectCascades(minutes []Bucket, window time.Duration, minimum, multiple float64) []Cascade {
+	cascades := []Cascade{}
+	if len(minutes) == 0 {
+		return cascades
+	}
+	size := int(window / time.Minute)
+	if size < 1 {
+		size = 1
+	}
+	days := int(baseline / time.Minute)
+
+	// dense per minute values and their prefix sums
+	start := minutes[0].Time.Truncate(time.Minute)
+	n := int(minutes[len(minutes)-1].Time.Sub(start)/time.Minute) + 1
+	dense := make([]Bucket, n)
+	for i := range dense {
+		dense[i].Time = start.Add(time.Duration(i) * time.Minute)
+	}
+	for _, minute := range minutes {
+		i := int(minute.Time.Sub(start) / time.Minute)
+		dense[i].Long += minute.Long
+		dense[i].Short += minute.Short
+	}
+	prefix := make([]float64, n+1)
+	for i, minute := range dense {
+		prefix[i+1] = prefix[i] + minute.Total()
+	}
+	sum := func(from, to int) float64 {
+		if from < 0 {
+			from = 0
+		}
+		return prefix[to] - prefix[from]
+	}
+
+	var current *Cascade
+	for i := range dense {
+		value := sum(i+1-size, i+1)
+		// the average window over the day before this one
+		first := i + 1 - size - days
+		if first < 0 {
+			first = 0
+		}
+		var average float64
+		if span := i + 1 - size - first; span > 0 {
+			average = sum(first, i+1-size) / float64(span) * float64(size)
+		}
+		hot := value >= minimum && value >= multiple*average
+		if !hot {
+			continue
+		}
+		windowStart := i + 1 - size
+		if windowStart < 0 {
+			windowStart = 0
+		}
+		if current == nil || dense[windowStart].Time.After(current.End) {
+			cascades = append(cascades, Cascade{Start: dense[windowStart].Time})
+			current = &cascades[len(cascades)-1]
+		}
+		current.End = dense[i].Time.Add(time.Minute)
+		if value > current.Peak {
+			current.Peak = value
+		}
+	}
+
+	for i := range cascades {
+		cascade := &cascades[i]
+		from := int(cascade.Start.Sub(start) / time.Minute)
+		to := int(cascade.End.Sub(start) / time.Minute)
+		for _, minute := range dense[from:to] {
+			cascade.Long += minute.Long
+			cascade.Short += minute.Short
+		}
+		cascade.Side = Long
+		if cascade.Short > cascade.Long {
+			cascade.Side = Short
+		}
+	}
+	return cascades
+}
@@ -0,0 +1,221 @@
+package liquidations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/timeseries"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultStreamURL is the combined stream endpoint of Binance futures
+const DefaultStreamURL = "wss://fstream.binance.com/stream"
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+	// stableConnection is how long a connection must last to reset the
+	// reconnect backoff
+	stableConnection = time.Minute
+	// flushInterval is how often the current minutes are written
+	flushInterval = 10 * time.Second
+)
+
+// Status is the state of the collector
+type Status struct {
+	Connected bool     `json:"connected"`
+	Symbols   []string `json:"symbols"`
+	// Since is when the collector first connected, liquidations before are
+	// only known from earlier runs
+	Since      time.Time `json:"since,omitempty"`
+	LastEvent  time.Time `json:"last_event,omitempty"`
+	Reconnects int       `json:"reconnects"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Collector records the liquidations of symbols from the force order
+// streams of Binance futures, which do not serve their history
+type Collector struct {
+	url      string
+	symbols  []string
+	recorder *Recorder
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewCollector creates a collector of the liquidations of symbols, such as
+// BTCUSDT, from the combined stream at url
+func NewCollector(url string, symbols []string, series *timeseries.Store) *Collector {
+	return &Collector{
+		url:      url,
+		symbols:  symbols,
+		recorder: NewRecorder(series),
+		status:   Status{Symbols: symbols},
+	}
+}
+
+// Status returns the connection state
+func (c *Collector) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Run records liquidations until ctx is done, reconnecting with backoff
+func (c *Collector) Run(ctx context.Context) {
+	if len(c.symbols) == 0 {
+		return
+	}
+	go c.flush(ctx)
+	delay := minReconnectDelay
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := c.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > stableConnection {
+			delay = minReconnectDelay
+		}
+		log.Printf("Liquidation stream disconnected, reconnecting in %s: %v", delay, err)
+		c.mu.Lock()
+		c.status.Connected = false
+		c.status.Reconnects++
+		if err != nil {
+			c.status.LastError = err.Error()
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// flush writes the recorded minutes every flushInterval, and a last time
+// when ctx is done
+func (c *Collector) flush(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.recorder.Flush(context.Background()); err != nil {
+				log.Printf("Failed to write liquidations: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := c.recorder.Flush(ctx); err != nil {
+				log.Printf("Failed to write liquidations: %v", err)
+			}
+		}
+	}
+}
+
+// stream records the liquidations of one connection until it fails
+func (c *Collector) stream(ctx context.Context) error {
+	streams := make([]string, len(c.symbols))
+	for i, symbol := range c.symbols {
+		streams[i] = strings.ToLower(symbol) + "@forceOrder"
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.url+"?streams="+strings.Join(streams, "/"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	// unblock the read when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c.mu.Lock()
+	c.status.Connected = true
+	if c.status.Since.IsZero() {
+		c.status.Since = time.Now()
+	}
+	c.mu.Unlock()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		liquidation, err := ParseForceOrder(message)
+		if err != nil {
+			log.Printf("Skipping liquidation: %v", err)
+			continue
+		}
+		if err := c.recorder.Record(ctx, liquidation); err != nil {
+			log.Printf("Failed to record liquidation: %v", err)
+			continue
+		}
+		c.mu.Lock()
+		c.status.LastEvent = liquidation.Time
+		c.mu.Unlock()
+	}
+}
+
+// ParseForceOrder reads a liquidation from a combined stream message of a
+// force order stream. A sell order closes a long position.
+func ParseForceOrder(message []byte) (Liquidation, error) {
+	var event struct {
+		Data struct {
+			Order struct {
+				Symbol       string `json:"s"`
+				Side         string `json:"S"`
+				Price        string `json:"p"`
+				AveragePrice string `json:"ap"`
+				Quantity     string `json:"q"`
+				Filled       string `json:"z"`
+				Time         int64  `json:"T"`
+			} `json:"o"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(message, &event); err != nil {
+		return Liquidation{}, fmt.Errorf("malformed force order: %v", err)
+	}
+	order := event.Data.Order
+	liquidation := Liquidation{Time: time.UnixMilli(order.Time).UTC(), Symbol: order.Symbol}
+	switch order.Side {
+	case "SELL":
+		liquidation.Side = Long
+	case "BUY":
+		liquidation.Side = Short
+	default:
+		return Liquidation{}, fmt.Errorf("unknown force order side %q", order.Side)
+	}
+	// the filled quantity at the average price, the order quantity at the
+	// order price before the first fill
+	price, quantity := order.AveragePrice, order.Filled
+	if value, err := strconv.ParseFloat(quantity, 64); err != nil || value == 0 {
+		price, quantity = order.Price, order.Quantity
+	}
+	var err error
+	if liquidation.Price, err = strconv.ParseFloat(price, 64); err != nil {
+		return Liquidation{}, fmt.Errorf("malformed force order price %q", price)
+	}
+	if liquidation.Quantity, err = strconv.ParseFloat(quantity, 64); err != nil {
+		return Liquidation{}, fmt.Errorf("malformed force order quantity %q", quantity)
+	}
+	return liquidation, nil
+}
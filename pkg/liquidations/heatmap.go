@@ -0,0 +1,132 @@
+package liquidations
+
+import (
+	"math"
+	"sort"
+
+	"go-vue/pkg/market"
+)
+
+// MaintenanceMargin is the margin rate below which a position is
+// liquidated, that of the lowest notional bracket on Binance
+const MaintenanceMargin = 0.004
+
+// Tier is the share of the open interest assumed to be opened at one
+// leverage
+type Tier struct {
+	Leverage float64 `json:"leverage"`
+	Share    float64 `json:"share"`
+}
+
+// DefaultTiers spread new positions over the common leverage settings
+var DefaultTiers = []Tier{
+	{Leverage: 5, Share: 0.1},
+	{Leverage: 10, Share: 0.3},
+	{Leverage: 25, Share: 0.3},
+	{Leverage: 50, Share: 0.2},
+	{Leverage: 100, Share: 0.1},
+}
+
+// Level is the estimated value in USD liquidated when the price reaches
+// Price, on each side
+type Level struct {
+	Price float64 `json:"price"`
+	Long  float64 `json:"long"`
+	Short float64 `json:"short"`
+}
+
+// Heatmap is the estimated liquidation value per price level
+type Heatmap struct {
+	// Price is the last mark price and Step the width of a level
+	Price  float64 `json:"price"`
+	Step   float64 `json:"step"`
+	Levels []Level `json:"levels"`
+}
+
+// position is the open value of one side and tier liquidated at level
+type position struct {
+	level float64
+	long  bool
+	value float64
+}
+
+// EstimateHeatmap estimates where the positions still open would be
+// liquidated. Every rise of the open interest is taken as positions opened
+// at the mark price of the time, split between longs and shorts by the
+// long/short account ratio then and over leverage by tiers. A fall of the
+// open interest closes all positions in proportion, and positions whose
+// level the price reached since are gone. Levels are stepPercent of the
+// last price wide.
+func EstimateHeatmap(history []market.OpenInterest, ratios []market.LongShortRatio, tiers []Tier, stepPercent float64) *Heatmap {
+	heatmap := &Heatmap{Levels: []Level{}}
+	var positions []position
+	price := func(interest market.OpenInterest) float64 {
+		if interest.Contracts == 0 {
+			return 0
+		}
+		return interest.Value / interest.Contracts
+	}
+	r := 0
+	for i := 1; i < len(history); i++ {
+		previous, current := history[i-1], history[i]
+		mark := price(current)
+		if mark == 0 || previous.Contracts == 0 {
+			continue
+		}
+
+		kept := positions[:0]
+		for _, p := range positions {
+			if (p.long && mark <= p.level) || (!p.long && mark >= p.level) {
+				continue
+			}
+			if current.Contracts < previous.Contracts {
+				p.value *= current.Contracts / previous.Contracts
+			}
+			kept = append(kept, p)
+		}
+		positions = kept
+
+		if current.Contracts > previous.Contracts {
+			for r+1 < len(ratios) && !ratios[r+1].Time.After(current.Time) {
+				r++
+			}
+			longShare := 0.5
+			if r < len(ratios) && !ratios[r].Time.After(current.Time) {
+				longShare = ratios[r].Long
+			}
+			opened := (current.Contracts - previous.Contracts) * mark
+			for _, tier := range tiers {
+				value := opened * tier.Share
+				positions = append(positions,
+					position{level: mark * (1 - 1/tier.Leverage + MaintenanceMargin), long: true, value: value * longShare},
+					position{level: mark * (1 + 1/tier.Leverage - MaintenanceMargin), long: false, value: value * (1 - longShare)},
+				)
+			}
+		}
+		heatmap.Price = mark
+	}
+	if heatmap.Price == 0 || stepPercent <= 0 {
+		return heatmap
+	}
+
+	heatmap.Step = heatmap.Price * stepPercent / 100
+	levels := make(map[float64]*Level)
+	for _, p := range positions {
+		at := math.Round(p.level/heatmap.Step) * heatmap.Step
+		level, ok := levels[at]
+		if !ok {
+			level = &Level{Price: at}
+			levels[at] = level
+		}
+		if p.long {
+			level.Long += p.value
+		} else {
+			level.Short += p.value
+		}
+	}
+	for _, level := range levels {
+		heatmap.Levels = append(heatmap.Levels, *level)
+	}
+	sort.Slice(heatmap.Levels, func(i, j int) bool { return heatmap.Levels[i].Price < heatmap.Levels[j].Price })
+	return heatmap
+}
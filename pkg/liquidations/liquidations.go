@@ -0,0 +1,205 @@
+// Package liquidations records the forced liquidations of perpetual
+// contracts, aggregates them by side and time and detects cascades
+package liquidations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go-vue/pkg/timeseries"
+)
+
+// Sides of a liquidation, named after the position that was closed
+const (
+	Long  = "long"
+	Short = "short"
+)
+
+const (
+	// MaxHistoryDays bounds the period of a history request
+	MaxHistoryDays = 90
+	// MaxBuckets bounds the number of buckets of a history request
+	MaxBuckets = 5000
+)
+
+// Windows are the periods the liquidation totals are reported for
+var Windows = []time.Duration{time.Hour, 4 * time.Hour, 24 * time.Hour}
+
+// Liquidation is one forced order
+type Liquidation struct {
+	Time     time.Time `json:"time"`
+	Symbol   string    `json:"symbol"`
+	Side     string    `json:"side"`
+	Price    float64   `json:"price"`
+	Quantity float64   `json:"quantity"`
+}
+
+// Value is the liquidated amount in USD
+func (l Liquidation) Value() float64 { return l.Price * l.Quantity }
+
+// Series names the USD value liquidated per minute on one side of symbol,
+// for example liquidations/BTCUSDT/long
+func Series(symbol, side string) string {
+	return "liquidations/" + symbol + "/" + side
+}
+
+// Recorder sums liquidations into per minute points of their series. The
+// current minute of every series is kept in memory and written when the
+// minute is over or on Flush.
+type Recorder struct {
+	series *timeseries.Store
+
+	mu      sync.Mutex
+	minutes map[string]timeseries.Point
+	// dirty holds the series whose minute is not written yet
+	dirty map[string]bool
+}
+
+// NewRecorder creates a recorder writing to series
+func NewRecorder(series *timeseries.Store) *Recorder {
+	return &Recorder{series: series, minutes: make(map[string]timeseries.Point), dirty: make(map[string]bool)}
+}
+
+// Record adds l to the total of its minute
+func (r *Recorder) Record(ctx context.Context, l Liquidation) error {
+	name := Series(l.Symbol, l.Side)
+	minute := l.Time.Truncate(time.Minute)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	point, ok := r.minutes[name]
+	if !ok || !point.Time.Equal(minute) {
+		if r.dirty[name] {
+			if _, err := r.series.Write(ctx, name, []timeseries.Point{point}); err != nil {
+				return err
+			}
+		}
+		point = timeseries.Point{Time: minute}
+		// continue a minute written before a restart
+		last, err := r.series.Last(ctx, name)
+		if err != nil {
+			return err
+		}
+		if last != nil && last.Time.Equal(minute) {
+			point.Value = last.Value
+		}
+	}
+	point.Value += l.Value()
+	r.minutes[name] = point
+	r.dirty[name] = true
+	return nil
+}
+
+// Flush writes the minutes recorded since the last write
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range r.dirty {
+		if _, err := r.series.Write(ctx, name, []timeseries.Point{r.minutes[name]}); err != nil {
+			return err
+		}
+		delete(r.dirty, name)
+	}
+	return nil
+}
+
+// Bucket is the USD value liquidated on each side during a period
+type Bucket struct {
+	Time  time.Time `json:"time"`
+	Long  float64   `json:"long"`
+	Short float64   `json:"short"`
+}
+
+// Total is the value liquidated on both sides
+func (b Bucket) Total() float64 { return b.Long + b.Short }
+
+// Load returns the recorded minutes of symbol from from up to to in time
+// order, leaving out the minutes without liquidations
+func Load(ctx context.Context, series *timeseries.Store, symbol string, from, to time.Time) ([]Bucket, error) {
+	minutes := make(map[int64]*Bucket)
+	for _, side := range []string{Long, Short} {
+		points, err := series.Range(ctx, Series(symbol, side), from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			bucket, ok := minutes[point.Time.Unix()]
+			if !ok {
+				bucket = &Bucket{Time: point.Time}
+				minutes[point.Time.Unix()] = bucket
+			}
+			if side == Long {
+				bucket.Long += point.Value
+			} else {
+				bucket.Short += point.Value
+			}
+		}
+	}
+	buckets := make([]Bucket, 0, len(minutes))
+	for _, bucket := range minutes {
+		buckets = append(buckets, *bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Time.Before(buckets[j].Time) })
+	return buckets, nil
+}
+
+// Aggregate sums minutes into consecutive buckets of length d covering from
+// up to to, including the empty ones
+func Aggregate(minutes []Bucket, from, to time.Time, d time.Duration) []Bucket {
+	start := from.Truncate(d)
+	var buckets []Bucket
+	for t := start; t.Before(to); t = t.Add(d) {
+		buckets = append(buckets, Bucket{Time: t})
+	}
+	for _, minute := range minutes {
+		if minute.Time.Before(start) || !minute.Time.Before(to) {
+			continue
+		}
+		i := int(minute.Time.Sub(start) / d)
+		buckets[i].Long += minute.Long
+		buckets[i].Short += minute.Short
+	}
+	return buckets
+}
+
+// Window is the value liquidated on each side over the period before now
+type Window struct {
+	Window string  `json:"window"`
+	Long   float64 `json:"long"`
+	Short  float64 `json:"short"`
+	Total  float64 `json:"total"`
+	// LongShare is the part of the total liquidated from longs, 0 without
+	// liquidations
+	LongShare float64 `json:"long_share"`
+}
+
+// Totals sums the minutes within each of windows before now
+func Totals(minutes []Bucket, now time.Time, windows []time.Duration) []Window {
+	totals := make([]Window, len(windows))
+	for i, d := range windows {
+		totals[i].Window = formatWindow(d)
+		for _, minute := range minutes {
+			if minute.Time.After(now.Add(-d)) && !minute.Time.After(now) {
+				totals[i].Long += minute.Long
+				totals[i].Short += minute.Short
+			}
+		}
+		totals[i].Total = totals[i].Long + totals[i].Short
+		if totals[i].Total > 0 {
+			totals[i].LongShare = totals[i].Long / totals[i].Total
+		}
+	}
+	return totals
+}
+
+// formatWindow names a window in hours or days, like 4h and 1d
+func formatWindow(d time.Duration) string {
+	hours := int(d.Hours())
+	if hours%24 == 0 {
+		return fmt.Sprintf("%dd", hours/24)
+	}
+	return fmt.Sprintf("%dh", hours)
+}
@@ -0,0 +1,154 @@
+package liquidations
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"go-vue/pkg/market"
+	"go-vue/pkg/storage"
+	"go-vue/pkg/timeseries"
+)
+
+func TestRecordAndAggregate(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := timeseries.NewStore(store)
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	recorded := []Liquidation{
+		{Time: now.Add(-30 * time.Minute), Symbol: "BTCUSDT", Side: Long, Price: 60000, Quantity: 1},
+		{Time: now.Add(-30*time.Minute + 10*time.Second), Symbol: "BTCUSDT", Side: Long, Price: 60000, Quantity: 0.5},
+		{Time: now.Add(-3 * time.Hour), Symbol: "BTCUSDT", Side: Short, Price: 61000, Quantity: 2},
+		{Time: now.Add(-20 * time.Hour), Symbol: "BTCUSDT", Side: Long, Price: 58000, Quantity: 1},
+		{Time: now.Add(-time.Hour), Symbol: "ETHUSDT", Side: Long, Price: 3000, Quantity: 10},
+	}
+	recorder := NewRecorder(series)
+	for _, liquidation := range recorded[:1] {
+		if err := recorder.Record(ctx, liquidation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the current minute is only written on flush
+	if last, err := series.Last(ctx, Series("BTCUSDT", Long)); err != nil || last != nil {
+		t.Fatalf("minute written before flush: %v, %v", last, err)
+	}
+	if err := recorder.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a restarted recorder continues the minute written before
+	recorder = NewRecorder(series)
+	for _, liquidation := range recorded[1:] {
+		if err := recorder.Record(ctx, liquidation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	minutes, err := Load(ctx, series, "BTCUSDT", now.Add(-24*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(minutes) != 3 || minutes[2].Long != 90000 {
+		t.Fatalf("unexpected minutes %+v", minutes)
+	}
+
+	totals := Totals(minutes, now, Windows)
+	want := []Window{
+		{Window: "1h", Long: 90000, Total: 90000, LongShare: 1},
+		{Window: "4h", Long: 90000, Short: 122000, Total: 212000, LongShare: 90000.0 / 212000},
+		{Window: "1d", Long: 148000, Short: 122000, Total: 270000, LongShare: 148000.0 / 270000},
+	}
+	for i := range want {
+		if totals[i] != want[i] {
+			t.Fatalf("window %d = %+v, want %+v", i, totals[i], want[i])
+		}
+	}
+
+	hourly := Aggregate(minutes, now.Add(-24*time.Hour), now, time.Hour)
+	if len(hourly) != 24 || hourly[23].Long != 90000 || hourly[21].Short != 122000 {
+		t.Fatalf("unexpected hourly buckets %+v", hourly)
+	}
+}
+
+func TestDetectCascades(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var minutes []Bucket
+	// a quiet day of 100k per minute, then 3 minutes of heavy long
+	// liquidations
+	for i := 0; i < 24*60; i++ {
+		minutes = append(minutes, Bucket{Time: start.Add(time.Duration(i) * time.Minute), Long: 5e4, Short: 5e4})
+	}
+	for i := 0; i < 3; i++ {
+		minutes = append(minutes, Bucket{Time: start.Add(time.Duration(24*60+i) * time.Minute), Long: 4e6, Short: 1e5})
+	}
+	minutes = append(minutes, Bucket{Time: start.Add(time.Duration(24*60+30) * time.Minute), Long: 5e4})
+
+	cascades := DetectCascades(minutes, CascadeWindow, CascadeMinimum, CascadeMultiple)
+	if len(cascades) != 1 {
+		t.Fatalf("expected one cascade, got %+v", cascades)
+	}
+	cascade := cascades[0]
+	if cascade.Side != Long || cascade.Peak < 12e6 {
+		t.Fatalf("unexpected cascade %+v", cascade)
+	}
+	// the first hot window ends with the second heavy minute, the last
+	// one holds the second and third
+	if !cascade.Start.Equal(start.Add(time.Duration(24*60-3)*time.Minute)) || !cascade.End.Equal(start.Add(time.Duration(24*60+6)*time.Minute)) {
+		t.Fatalf("cascade from %v to %v", cascade.Start, cascade.End)
+	}
+
+	if cascades := DetectCascades(minutes[:24*60], CascadeWindow, CascadeMinimum, CascadeMultiple); len(cascades) != 0 {
+		t.Fatalf("a quiet day has no cascades, got %+v", cascades)
+	}
+}
+
+func TestEstimateHeatmap(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	interest := func(hour int, contracts, price float64) market.OpenInterest {
+		return market.OpenInterest{Time: start.Add(time.Duration(hour) * time.Hour), Contracts: contracts, Value: contracts * price}
+	}
+	tiers := []Tier{{Leverage: 10, Share: 1}}
+	ratios := []market.LongShortRatio{{Time: start, Long: 0.6, Short: 0.4}}
+
+	// 100 contracts opened at 100, 60% of them long
+	history := []market.OpenInterest{interest(0, 100, 100), interest(1, 200, 100), interest(2, 200, 95)}
+	heatmap := EstimateHeatmap(history, ratios, tiers, 1)
+	if heatmap.Price != 95 || len(heatmap.Levels) != 2 {
+		t.Fatalf("unexpected heatmap %+v", heatmap)
+	}
+	long, short := heatmap.Levels[0], heatmap.Levels[1]
+	if math.Abs(long.Price-90.25) > 1e-9 || math.Abs(long.Long-6000) > 1e-9 || long.Short != 0 {
+		t.Fatalf("unexpected long level %+v", long)
+	}
+	if math.Abs(short.Price-109.25) > 1e-9 || math.Abs(short.Short-4000) > 1e-9 {
+		t.Fatalf("unexpected short level %+v", short)
+	}
+
+	// the price reaches the level of the longs and half the rest closes
+	history = append(history, interest(3, 100, 89))
+	heatmap = EstimateHeatmap(history, ratios, tiers, 1)
+	if len(heatmap.Levels) != 1 || math.Abs(heatmap.Levels[0].Short-2000) > 1e-9 {
+		t.Fatalf("unexpected heatmap after the drop %+v", heatmap)
+	}
+}
+
+func TestParseForceOrder(t *testing.T) {
+	message := []byte(`{"stream":"btcusdt@forceOrder","data":{"e":"forceOrder","E":1568014460893,"o":{"s":"BTCUSDT","S":"SELL","o":"LIMIT","f":"IOC","q":"0.014","p":"9910","ap":"9920","X":"FILLED","l":"0.014","z":"0.014","T":1568014460893}}}`)
+	liquidation, err := ParseForceOrder(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if liquidation.Side != Long || liquidation.Symbol != "BTCUSDT" || liquidation.Price != 9920 || math.Abs(liquidation.Value()-138.88) > 1e-9 {
+		t.Fatalf("unexpected liquidation %+v", liquidation)
+	}
+	if _, err := ParseForceOrder([]byte(`{"data":{"o":{"S":"HOLD"}}}`)); err == nil {
+		t.Fatal("expected an error for an unknown side")
+	}
+}
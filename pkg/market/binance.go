@@ -1,28 +1,182 @@
 package market
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type BinanceService struct {
-	apiKey    string
-	apiSecret string
-	baseURL   string
+	apiKey     string
+	apiSecret  string
+	baseURL    string
+	futuresURL string
 }
 
 func NewBinanceService() *BinanceService {
 	return &BinanceService{
-		apiKey:    os.Getenv("BINANCE_API_KEY"),
-		apiSecret: os.Getenv("BINANCE_API_SECRET"),
-		baseURL:   "https://api.binance.com",
+		apiKey:     os.Getenv("BINANCE_API_KEY"),
+		apiSecret:  os.Getenv("BINANCE_API_SECRET"),
+		baseURL:    "https://api.binance.com",
+		futuresURL: "https://fapi.binance.com",
 	}
 }
 
+// NewBinanceServiceWithURLs creates a service against custom spot and
+// futures base URLs, for example a testnet or a stub server
+func NewBinanceServiceWithURLs(apiKey, apiSecret, baseURL, futuresURL string) *BinanceService {
+	return &BinanceService{
+		apiKey:     apiKey,
+		apiSecret:  apiSecret,
+		baseURL:    baseURL,
+		futuresURL: futuresURL,
+	}
+}
+
+// HasCredentials reports whether an API key and secret are configured
+func (s *BinanceService) HasCredentials() bool {
+	return s.apiKey != "" && s.apiSecret != ""
+}
+
+// signedGet calls a SIGNED Binance endpoint and decodes the response into
+// out. The query is signed with HMAC-SHA256 of the API secret.
+func (s *BinanceService) signedGet(ctx context.Context, baseURL, path string, params url.Values, out interface{}) error {
+	if !s.HasCredentials() {
+		return fmt.Errorf("BINANCE_API_KEY and BINANCE_API_SECRET are required")
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	params.Set("recvWindow", "5000")
+	query := params.Encode()
+	mac := hmac.New(sha256.New, []byte(s.apiSecret))
+	mac.Write([]byte(query))
+	query += "&signature=" + hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path+"?"+query, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("X-MBX-APIKEY", s.apiKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// AssetBalance is a Binance balance valued in USD
+type AssetBalance struct {
+	Asset    string  `json:"asset"`
+	Amount   float64 `json:"amount"`
+	PriceUSD float64 `json:"price_usd"`
+	ValueUSD float64 `json:"value_usd"`
+	// UnrealizedPnL is included in Amount for futures margin balances
+	UnrealizedPnL float64 `json:"unrealized_pnl,omitempty"`
+}
+
+// usdPrice returns the USDT price of asset and the asset it is priced as.
+// Simple Earn balances are reported as LD<asset> and priced like the
+// underlying asset, unless the name has a market of its own like LDO.
+func usdPrice(prices map[string]float64, asset string) (string, float64, bool) {
+	switch asset {
+	case "USDT":
+		return asset, 1, true
+	}
+	if price, ok := prices[asset+"USDT"]; ok {
+		return asset, price, true
+	}
+	if strings.HasPrefix(asset, "LD") {
+		if underlying, price, ok := usdPrice(prices, strings.TrimPrefix(asset, "LD")); ok {
+			return underlying, price, true
+		}
+	}
+	return asset, 0, false
+}
+
+// SpotBalances returns the non-zero spot balances valued in USD. Simple
+// Earn balances are returned as their underlying asset, assets without a
+// USDT market with a zero value.
+func (s *BinanceService) SpotBalances(ctx context.Context) ([]AssetBalance, error) {
+	var account AccountInfo
+	if err := s.signedGet(ctx, s.baseURL, "/api/v3/account", nil, &account); err != nil {
+		return nil, fmt.Errorf("failed to get account info: %v", err)
+	}
+	prices, err := s.getAllPrices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prices: %v", err)
+	}
+
+	balances := []AssetBalance{}
+	for _, balance := range account.Balances {
+		amount := balance.Free + balance.Locked
+		if amount == 0 {
+			continue
+		}
+		asset, price, _ := usdPrice(prices, balance.Asset)
+		balances = append(balances, AssetBalance{
+			Asset:    asset,
+			Amount:   amount,
+			PriceUSD: price,
+			ValueUSD: amount * price,
+		})
+	}
+	return balances, nil
+}
+
+// FuturesBalances returns the USD-M futures margin balances, including
+// unrealized PnL of open positions, valued in USD
+func (s *BinanceService) FuturesBalances(ctx context.Context) ([]AssetBalance, error) {
+	var account struct {
+		Assets []struct {
+			Asset            string  `json:"asset"`
+			MarginBalance    float64 `json:"marginBalance,string"`
+			UnrealizedProfit float64 `json:"unrealizedProfit,string"`
+		} `json:"assets"`
+	}
+	if err := s.signedGet(ctx, s.futuresURL, "/fapi/v2/account", nil, &account); err != nil {
+		return nil, fmt.Errorf("failed to get futures account: %v", err)
+	}
+	prices, err := s.getAllPrices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prices: %v", err)
+	}
+
+	balances := []AssetBalance{}
+	for _, asset := range account.Assets {
+		if asset.MarginBalance == 0 {
+			continue
+		}
+		_, price, _ := usdPrice(prices, asset.Asset)
+		balances = append(balances, AssetBalance{
+			Asset:         asset.Asset,
+			Amount:        asset.MarginBalance,
+			PriceUSD:      price,
+			ValueUSD:      asset.MarginBalance * price,
+			UnrealizedPnL: asset.UnrealizedProfit,
+		})
+	}
+	return balances, nil
+}
+
 type Asset struct {
 	Symbol       string       `json:"symbol"`
 	Amount       float64      `json:"amount"`
@@ -141,32 +295,10 @@ type Balance struct {
 }
 
 func (s *BinanceService) getAccountInfo() (*AccountInfo, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	req, err := http.NewRequest("GET", s.baseURL+"/api/v3/account", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("X-MBX-APIKEY", s.apiKey)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	var accountInfo AccountInfo
-	if err := json.NewDecoder(resp.Body).Decode(&accountInfo); err != nil {
+	if err := s.signedGet(context.Background(), s.baseURL, "/api/v3/account", nil, &accountInfo); err != nil {
 		return nil, err
 	}
-
 	return &accountInfo, nil
 }
 
@@ -309,3 +441,291 @@ func (s *BinanceService) getHistoricalPrices(symbol string) ([]PricePoint, error
 
 	return priceHistory, nil
 }
+
+// Candle is a parsed Binance kline
+type Candle struct {
+	OpenTime time.Time `json:"open_time"`
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Volume   float64   `json:"volume"`
+}
+
+// klinesPageLimit is the maximum number of klines Binance returns per call
+const klinesPageLimit = 1000
+
+// Klines returns the candles of symbol opened between start and end,
+// paging through /api/v3/klines
+func (s *BinanceService) Klines(ctx context.Context, symbol, interval string, start, end time.Time) ([]Candle, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	var candles []Candle
+	for start.Before(end) {
+		params := url.Values{}
+		params.Set("symbol", symbol)
+		params.Set("interval", interval)
+		params.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+		params.Set("endTime", strconv.FormatInt(end.UnixMilli()-1, 10))
+		params.Set("limit", strconv.Itoa(klinesPageLimit))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/api/v3/klines?"+params.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch klines: %v", err)
+		}
+		var raw [][]interface{}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to fetch klines: status code %d", resp.StatusCode)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&raw)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse klines: %v", err)
+		}
+
+		for _, kline := range raw {
+			candle, err := parseCandle(kline)
+			if err != nil {
+				return nil, err
+			}
+			candles = append(candles, candle)
+		}
+		if len(raw) < klinesPageLimit {
+			break
+		}
+		start = candles[len(candles)-1].OpenTime.Add(time.Millisecond)
+	}
+	return candles, nil
+}
+
+func parseCandle(kline []interface{}) (Candle, error) {
+	if len(kline) < 6 {
+		return Candle{}, fmt.Errorf("malformed kline: %v", kline)
+	}
+	openTime, ok := kline[0].(float64)
+	if !ok {
+		return Candle{}, fmt.Errorf("malformed kline open time: %v", kline[0])
+	}
+	candle := Candle{OpenTime: time.UnixMilli(int64(openTime)).UTC()}
+	for i, field := range []*float64{&candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume} {
+		text, _ := kline[i+1].(string)
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return Candle{}, fmt.Errorf("malformed kline value %v: %v", kline[i+1], err)
+		}
+		*field = value
+	}
+	return candle, nil
+}
+
+// publicGet decodes the JSON response of an unsigned GET request
+func publicGet(ctx context.Context, baseURL, path string, params url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: status code %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// FundingRate is one settled funding payment of a perpetual contract
+type FundingRate struct {
+	Time time.Time `json:"time"`
+	Rate float64   `json:"rate"`
+}
+
+// fundingPageLimit is the maximum number of funding rates per call
+const fundingPageLimit = 1000
+
+// FundingRates returns the funding rates of symbol settled between start
+// and end, paging through /fapi/v1/fundingRate
+func (s *BinanceService) FundingRates(ctx context.Context, symbol string, start, end time.Time) ([]FundingRate, error) {
+	var rates []FundingRate
+	for start.Before(end) {
+		params := url.Values{}
+		params.Set("symbol", symbol)
+		params.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+		params.Set("endTime", strconv.FormatInt(end.UnixMilli()-1, 10))
+		params.Set("limit", strconv.Itoa(fundingPageLimit))
+		var raw []struct {
+			FundingTime int64  `json:"fundingTime"`
+			FundingRate string `json:"fundingRate"`
+		}
+		if err := publicGet(ctx, s.futuresURL, "/fapi/v1/fundingRate", params, &raw); err != nil {
+			return nil, err
+		}
+		for _, r := range raw {
+			rate, err := strconv.ParseFloat(r.FundingRate, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed funding rate %q: %v", r.FundingRate, err)
+			}
+			rates = append(rates, FundingRate{Time: time.UnixMilli(r.FundingTime).UTC(), Rate: rate})
+		}
+		if len(raw) < fundingPageLimit {
+			break
+		}
+		start = rates[len(rates)-1].Time.Add(time.Millisecond)
+	}
+	return rates, nil
+}
+
+// OpenInterest is the open interest of a perpetual contract at one time
+type OpenInterest struct {
+	Time time.Time `json:"time"`
+	// Contracts is the open interest in the base asset and Value in USD
+	Contracts float64 `json:"contracts"`
+	Value     float64 `json:"value"`
+}
+
+// openInterestPageLimit is the maximum number of points per call
+const openInterestPageLimit = 500
+
+// OpenInterestRetention is how far back /futures/data/openInterestHist
+// serves data
+const OpenInterestRetention = 30 * 24 * time.Hour
+
+// OpenInterestHistory returns the open interest of symbol per period (5m,
+// 15m, 30m, 1h, 2h, 4h, 6h, 12h or 1d) between start and end, paging
+// through /futures/data/openInterestHist. Binance only keeps the last 30
+// days.
+func (s *BinanceService) OpenInterestHistory(ctx context.Context, symbol, period string, start, end time.Time) ([]OpenInterest, error) {
+	var history []OpenInterest
+	for start.Before(end) {
+		params := url.Values{}
+		params.Set("symbol", symbol)
+		params.Set("period", period)
+		params.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+		params.Set("endTime", strconv.FormatInt(end.UnixMilli()-1, 10))
+		params.Set("limit", strconv.Itoa(openInterestPageLimit))
+		var raw []struct {
+			Timestamp            int64  `json:"timestamp"`
+			SumOpenInterest      string `json:"sumOpenInterest"`
+			SumOpenInterestValue string `json:"sumOpenInterestValue"`
+		}
+		if err := publicGet(ctx, s.futuresURL, "/futures/data/openInterestHist", params, &raw); err != nil {
+			return nil, err
+		}
+		for _, r := range raw {
+			contracts, err := strconv.ParseFloat(r.SumOpenInterest, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed open interest %q: %v", r.SumOpenInterest, err)
+			}
+			value, err := strconv.ParseFloat(r.SumOpenInterestValue, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed open interest value %q: %v", r.SumOpenInterestValue, err)
+			}
+			history = append(history, OpenInterest{Time: time.UnixMilli(r.Timestamp).UTC(), Contracts: contracts, Value: value})
+		}
+		if len(raw) < openInterestPageLimit {
+			break
+		}
+		start = history[len(history)-1].Time.Add(time.Millisecond)
+	}
+	return history, nil
+}
+
+// PremiumIndex is the mark price and the funding rate a perpetual contract
+// will settle at next
+type PremiumIndex struct {
+	Symbol    string  `json:"symbol"`
+	MarkPrice float64 `json:"mark_price"`
+	// FundingRate is the predicted rate of the next settlement
+	FundingRate     float64   `json:"funding_rate"`
+	NextFundingTime time.Time `json:"next_funding_time"`
+}
+
+// PremiumIndex returns the mark price and predicted funding of symbol from
+// /fapi/v1/premiumIndex
+func (s *BinanceService) PremiumIndex(ctx context.Context, symbol string) (*PremiumIndex, error) {
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	var raw struct {
+		Symbol          string `json:"symbol"`
+		MarkPrice       string `json:"markPrice"`
+		LastFundingRate string `json:"lastFundingRate"`
+		NextFundingTime int64  `json:"nextFundingTime"`
+	}
+	if err := publicGet(ctx, s.futuresURL, "/fapi/v1/premiumIndex", params, &raw); err != nil {
+		return nil, err
+	}
+	markPrice, err := strconv.ParseFloat(raw.MarkPrice, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed mark price %q: %v", raw.MarkPrice, err)
+	}
+	rate, err := strconv.ParseFloat(raw.LastFundingRate, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed funding rate %q: %v", raw.LastFundingRate, err)
+	}
+	return &PremiumIndex{
+		Symbol:          raw.Symbol,
+		MarkPrice:       markPrice,
+		FundingRate:     rate,
+		NextFundingTime: time.UnixMilli(raw.NextFundingTime).UTC(),
+	}, nil
+}
+
+// LongShortRatio is the share of the accounts with a net long and a net
+// short position in a perpetual contract at one time
+type LongShortRatio struct {
+	Time  time.Time `json:"time"`
+	Long  float64   `json:"long"`
+	Short float64   `json:"short"`
+	// Ratio is Long divided by Short
+	Ratio float64 `json:"ratio"`
+}
+
+// LongShortRatios returns the long/short account ratio of symbol per
+// period between start and end, paging through
+// /futures/data/globalLongShortAccountRatio. Like the open interest
+// Binance only keeps the last 30 days.
+func (s *BinanceService) LongShortRatios(ctx context.Context, symbol, period string, start, end time.Time) ([]LongShortRatio, error) {
+	var ratios []LongShortRatio
+	for start.Before(end) {
+		params := url.Values{}
+		params.Set("symbol", symbol)
+		params.Set("period", period)
+		params.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+		params.Set("endTime", strconv.FormatInt(end.UnixMilli()-1, 10))
+		params.Set("limit", strconv.Itoa(openInterestPageLimit))
+		var raw []struct {
+			Timestamp      int64  `json:"timestamp"`
+			LongAccount    string `json:"longAccount"`
+			ShortAccount   string `json:"shortAccount"`
+			LongShortRatio string `json:"longShortRatio"`
+		}
+		if err := publicGet(ctx, s.futuresURL, "/futures/data/globalLongShortAccountRatio", params, &raw); err != nil {
+			return nil, err
+		}
+		for _, r := range raw {
+			ratio := LongShortRatio{Time: time.UnixMilli(r.Timestamp).UTC()}
+			texts := []string{r.LongAccount, r.ShortAccount, r.LongShortRatio}
+			for i, field := range []*float64{&ratio.Long, &ratio.Short, &ratio.Ratio} {
+				value, err := strconv.ParseFloat(texts[i], 64)
+				if err != nil {
+					return nil, fmt.Errorf("malformed long/short ratio %q: %v", texts[i], err)
+				}
+				*field = value
+			}
+			ratios = append(ratios, ratio)
+		}
+		if len(raw) < openInterestPageLimit {
+			break
+		}
+		start = ratios[len(ratios)-1].Time.Add(time.Millisecond)
+	}
+	return ratios, nil
+}
@@ -0,0 +1,180 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// PublicHistoryDays is how far back the public API without a key serves
+// market charts
+const PublicHistoryDays = 365
+
+// ErrRateLimited is returned when CoinGecko rejects a request for exceeding
+// the rate limit
+var ErrRateLimited = errors.New("rate limited by CoinGecko")
+
+// CoinGeckoService reads market history from CoinGecko
+type CoinGeckoService struct {
+	apiKey  string
+	baseURL string
+}
+
+// NewCoinGeckoService creates a CoinGecko client. With an API key it uses
+// the pro API, which also serves the global market cap history.
+func NewCoinGeckoService(apiKey string) *CoinGeckoService {
+	baseURL := "https://api.coingecko.com/api/v3"
+	if apiKey != "" {
+		baseURL = "https://pro-api.coingecko.com/api/v3"
+	}
+	return &CoinGeckoService{apiKey: apiKey, baseURL: baseURL}
+}
+
+// HasAPIKey reports whether a pro API key is configured
+func (s *CoinGeckoService) HasAPIKey() bool {
+	return s.apiKey != ""
+}
+
+func (s *CoinGeckoService) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	if s.apiKey != "" {
+		req.Header.Set("x-cg-pro-api-key", s.apiKey)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch from CoinGecko: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from CoinGecko %s: %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse CoinGecko response: %v", err)
+	}
+	return nil
+}
+
+// MarketCapChart returns the USD market cap of coin, a CoinGecko coin id
+// such as bitcoin, over the last days. Ranges above 90 days are daily.
+func (s *CoinGeckoService) MarketCapChart(ctx context.Context, coin string, days int) ([]HistoryPoint, error) {
+	params := url.Values{}
+	params.Set("vs_currency", "usd")
+	params.Set("days", strconv.Itoa(days))
+	var result struct {
+		MarketCaps [][2]float64 `json:"market_caps"`
+	}
+	if err := s.get(ctx, "/coins/"+url.PathEscape(coin)+"/market_chart", params, &result); err != nil {
+		return nil, err
+	}
+	return chartPoints(result.MarketCaps), nil
+}
+
+// GlobalMarketCapChart returns the total crypto market cap in USD over the
+// last days. CoinGecko only serves it with a pro API key.
+func (s *CoinGeckoService) GlobalMarketCapChart(ctx context.Context, days int) ([]HistoryPoint, error) {
+	if !s.HasAPIKey() {
+		return nil, fmt.Errorf("the global market cap history requires a CoinGecko API key")
+	}
+	params := url.Values{}
+	params.Set("vs_currency", "usd")
+	params.Set("days", strconv.Itoa(days))
+	var result struct {
+		MarketCapChart struct {
+			MarketCap [][2]float64 `json:"market_cap"`
+		} `json:"market_cap_chart"`
+	}
+	if err := s.get(ctx, "/global/market_cap_chart", params, &result); err != nil {
+		return nil, err
+	}
+	return chartPoints(result.MarketCapChart.MarketCap), nil
+}
+
+// chartPoints converts [milliseconds, value] pairs
+func chartPoints(pairs [][2]float64) []HistoryPoint {
+	points := make([]HistoryPoint, 0, len(pairs))
+	for _, pair := range pairs {
+		points = append(points, HistoryPoint{Time: time.UnixMilli(int64(pair[0])).UTC(), Value: pair[1]})
+	}
+	return points
+}
+
+// PriceChart returns the USD price of coin over the last days. Ranges above
+// 90 days are daily.
+func (s *CoinGeckoService) PriceChart(ctx context.Context, coin string, days int) ([]HistoryPoint, error) {
+	params := url.Values{}
+	params.Set("vs_currency", "usd")
+	params.Set("days", strconv.Itoa(days))
+	var result struct {
+		Prices [][2]float64 `json:"prices"`
+	}
+	if err := s.get(ctx, "/coins/"+url.PathEscape(coin)+"/market_chart", params, &result); err != nil {
+		return nil, err
+	}
+	return chartPoints(result.Prices), nil
+}
+
+// CoinMarket is a coin ranked by market cap
+type CoinMarket struct {
+	ID        string  `json:"id"`
+	Symbol    string  `json:"symbol"`
+	Name      string  `json:"name"`
+	Rank      int     `json:"market_cap_rank"`
+	MarketCap float64 `json:"market_cap"`
+	Price     float64 `json:"current_price"`
+}
+
+// coinsPageLimit is the maximum number of coins per call
+const coinsPageLimit = 250
+
+// TopCoins returns the n coins with the largest market cap, largest first
+func (s *CoinGeckoService) TopCoins(ctx context.Context, n int) ([]CoinMarket, error) {
+	var coins []CoinMarket
+	for page := 1; len(coins) < n; page++ {
+		params := url.Values{}
+		params.Set("vs_currency", "usd")
+		params.Set("order", "market_cap_desc")
+		params.Set("per_page", strconv.Itoa(coinsPageLimit))
+		params.Set("page", strconv.Itoa(page))
+		var result []CoinMarket
+		if err := s.get(ctx, "/coins/markets", params, &result); err != nil {
+			return nil, err
+		}
+		coins = append(coins, result...)
+		if len(result) < coinsPageLimit {
+			break
+		}
+	}
+	if len(coins) > n {
+		coins = coins[:n]
+	}
+	return coins, nil
+}
+
+// Dominance returns the share of the total market cap of every coin in
+// percent keyed by symbol, such as btc, from the global data
+func (s *CoinGeckoService) Dominance(ctx context.Context) (map[string]float64, error) {
+	var result struct {
+		Data struct {
+			MarketCapPercentage map[string]float64 `json:"market_cap_percentage"`
+		} `json:"data"`
+	}
+	if err := s.get(ctx, "/global", url.Values{}, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Data.MarketCapPercentage) == 0 {
+		return nil, fmt.Errorf("no market cap percentages in the CoinGecko global data")
+	}
+	return result.Data.MarketCapPercentage, nil
+}
@@ -2,11 +2,12 @@ package market
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math"
-	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"strconv"
@@ -260,107 +261,6 @@ func (s *MarketService) GetOpenInterest() (float64, error) {
 	return interest, nil
 }
 
-// Cache for Altcoin Season Index data
-type AltcoinSeasonCache struct {
-	Index      float64
-	Historical []float64
-	Timestamp  time.Time
-}
-
-var altcoinSeasonCache = &AltcoinSeasonCache{
-	Index:      0,
-	Historical: make([]float64, 0),
-	Timestamp:  time.Time{},
-}
-
-// GetAltcoinSeasonIndex returns the altcoin season index with enhanced calculation
-func (s *MarketService) GetAltcoinSeasonIndex() (float64, []float64, error) {
-	// Check cache first
-	if !altcoinSeasonCache.Timestamp.IsZero() && time.Since(altcoinSeasonCache.Timestamp) < 1*time.Hour {
-		if len(altcoinSeasonCache.Historical) > 0 {
-			return altcoinSeasonCache.Index, altcoinSeasonCache.Historical, nil
-		}
-	}
-
-	// Get prices for major cryptocurrencies
-	symbols := []string{"BTC", "ETH", "BNB", "SOL", "ADA", "XRP", "DOT", "DOGE"}
-	url := fmt.Sprintf("https://pro-api.coinmarketcap.com/v1/cryptocurrency/quotes/latest?symbol=%s&convert=USD", strings.Join(symbols, ","))
-
-	resp, err := s.makeRequest(url, 3)
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to fetch prices: %v", err)
-	}
-	defer resp.Body.Close()
-
-	var data struct {
-		Data map[string]struct {
-			Quote struct {
-				USD struct {
-					Price float64 `json:"price"`
-				} `json:"USD"`
-			} `json:"quote"`
-		} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return 0, nil, fmt.Errorf("failed to parse prices: %v", err)
-	}
-
-	// Calculate price changes relative to BTC
-	btcPrice := data.Data["BTC"].Quote.USD.Price
-	if btcPrice == 0 {
-		return 0, nil, fmt.Errorf("invalid BTC price")
-	}
-
-	// Calculate weighted average of altcoin performance
-	var totalWeight float64
-	var weightedSum float64
-	weights := map[string]float64{
-		"ETH":  0.4,
-		"BNB":  0.2,
-		"SOL":  0.15,
-		"ADA":  0.1,
-		"XRP":  0.05,
-		"DOT":  0.05,
-		"DOGE": 0.05,
-	}
-
-	for symbol, weight := range weights {
-		if coinData, ok := data.Data[symbol]; ok {
-			if coinData.Quote.USD.Price > 0 {
-				relativePerformance := (coinData.Quote.USD.Price / btcPrice) * 100
-				weightedSum += relativePerformance * weight
-				totalWeight += weight
-			}
-		}
-	}
-
-	if totalWeight == 0 {
-		return 0, nil, fmt.Errorf("no valid altcoin data available")
-	}
-
-	// Calculate season index (0-100)
-	seasonIndex := weightedSum / totalWeight
-	if seasonIndex > 100 {
-		seasonIndex = 100
-	}
-
-	// Generate historical data (last 5 days)
-	historical := make([]float64, 5)
-	for i := range historical {
-		// Add some random variation to historical data
-		variation := (rand.Float64() - 0.5) * 10
-		historical[i] = math.Max(0, math.Min(100, seasonIndex+variation))
-	}
-
-	// Update cache
-	altcoinSeasonCache.Index = seasonIndex
-	altcoinSeasonCache.Historical = historical
-	altcoinSeasonCache.Timestamp = time.Now()
-
-	return seasonIndex, historical, nil
-}
-
 // GetVolumeTrend returns the volume trend data
 func (s *MarketService) GetVolumeTrend() (float64, []float64, error) {
 	// Use Binance API to get historical klines (candlestick data)
@@ -579,7 +479,7 @@ func (s *MarketService) GetRSI() (float64, []float64, error) {
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			return 0, nil, fmt.Errorf("failed to fetch historical prices for %s timeframe: status code %d", resp.StatusCode)
+			return 0, nil, fmt.Errorf("failed to fetch historical prices for %s timeframe: status code %d", tf, resp.StatusCode)
 		}
 
 		var klines [][]interface{}
@@ -958,6 +858,70 @@ func (s *MarketService) GetFearGreed() (float64, []float64, error) {
 	return values[len(values)-1], values, nil
 }
 
+// HistoryPoint is one value of a historical market series
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// FearGreedHistory returns the last days of the daily Fear & Greed Index
+// in time order, the whole history when days is 0
+func FearGreedHistory(ctx context.Context, days int) ([]HistoryPoint, error) {
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(days))
+	params.Set("format", "json")
+	var result struct {
+		Data []struct {
+			Value     string `json:"value"`
+			Timestamp string `json:"timestamp"`
+		} `json:"data"`
+	}
+	if err := publicGet(ctx, "https://api.alternative.me", "/fng/", params, &result); err != nil {
+		return nil, err
+	}
+	history := make([]HistoryPoint, 0, len(result.Data))
+	for i := len(result.Data) - 1; i >= 0; i-- {
+		data := result.Data[i]
+		value, err := strconv.ParseFloat(data.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Fear & Greed Index value: %v", err)
+		}
+		seconds, err := strconv.ParseInt(data.Timestamp, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Fear & Greed Index timestamp: %v", err)
+		}
+		history = append(history, HistoryPoint{Time: time.Unix(seconds, 0).UTC(), Value: value})
+	}
+	return history, nil
+}
+
+// ActiveAddressHistory returns the last days of the daily number of unique
+// bitcoin addresses from blockchain.com in time order, the whole history
+// when days is 0
+func ActiveAddressHistory(ctx context.Context, days int) ([]HistoryPoint, error) {
+	params := url.Values{}
+	params.Set("timespan", "all")
+	if days > 0 {
+		params.Set("timespan", strconv.Itoa(days)+"days")
+	}
+	params.Set("sampled", "false")
+	params.Set("format", "json")
+	var result struct {
+		Values []struct {
+			X int64   `json:"x"`
+			Y float64 `json:"y"`
+		} `json:"values"`
+	}
+	if err := publicGet(ctx, "https://api.blockchain.info", "/charts/n-unique-addresses", params, &result); err != nil {
+		return nil, err
+	}
+	history := make([]HistoryPoint, 0, len(result.Values))
+	for _, value := range result.Values {
+		history = append(history, HistoryPoint{Time: time.Unix(value.X, 0).UTC(), Value: value.Y})
+	}
+	return history, nil
+}
+
 // Cache for Moving Averages data
 type MACache struct {
 	Values     map[string]map[string]float64
@@ -1013,7 +977,7 @@ func (s *MarketService) GetMovingAverages() (float64, []float64, error) {
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			return 0, nil, fmt.Errorf("failed to fetch historical prices for %s timeframe: status code %d", resp.StatusCode)
+			return 0, nil, fmt.Errorf("failed to fetch historical prices for %s timeframe: status code %d", tf, resp.StatusCode)
 		}
 
 		var klines [][]interface{}
@@ -0,0 +1,440 @@
+package onchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// Chains tracked for exchange flows, named after their native coin
+const (
+	BTC = "btc"
+	ETH = "eth"
+	SOL = "sol"
+)
+
+// maxPages bounds the pages of transfers read per address and poll, older
+// transfers of busier addresses are skipped
+const maxPages = 20
+
+// Chain reads the balance and transfers of addresses on one chain. Amounts
+// are in the native coin.
+type Chain interface {
+	Name() string
+	Balance(ctx context.Context, address string) (float64, error)
+	// Transfers returns the transfers of address after since, newest
+	// first, paging back to since for at most maxPages pages. A chain that
+	// reads transfers oldest first returns those read so far with its
+	// error, and transactions without a change of address with a zero
+	// Amount, so the caller can move since past them.
+	Transfers(ctx context.Context, address string, since time.Time) ([]Transfer, error)
+}
+
+// Transfer is the change of one address in one transaction
+type Transfer struct {
+	Chain   string    `json:"chain"`
+	Hash    string    `json:"hash"`
+	Time    time.Time `json:"time"`
+	Address string    `json:"address"`
+	// Amount is positive into and negative out of Address
+	Amount float64 `json:"amount"`
+}
+
+// Bitcoin reads addresses from an Esplora API such as mempool.space
+type Bitcoin struct {
+	BaseURL string
+}
+
+// NewBitcoin creates a reader of the mempool.space API
+func NewBitcoin() *Bitcoin {
+	return &Bitcoin{BaseURL: "https://mempool.space/api"}
+}
+
+func (*Bitcoin) Name() string { return BTC }
+
+const satoshis = 1e8
+
+func (b *Bitcoin) Balance(ctx context.Context, address string) (float64, error) {
+	var result struct {
+		ChainStats struct {
+			Funded int64 `json:"funded_txo_sum"`
+			Spent  int64 `json:"spent_txo_sum"`
+		} `json:"chain_stats"`
+	}
+	if err := getJSON(ctx, b.BaseURL+"/address/"+address, &result); err != nil {
+		return 0, fmt.Errorf("btc balance of %s: %v", address, err)
+	}
+	return float64(result.ChainStats.Funded-result.ChainStats.Spent) / satoshis, nil
+}
+
+// esploraPageSize is the number of confirmed transactions per page
+const esploraPageSize = 25
+
+func (b *Bitcoin) Transfers(ctx context.Context, address string, since time.Time) ([]Transfer, error) {
+	var transfers []Transfer
+	// the chain endpoint leaves out unconfirmed transactions, the next page
+	// follows the last txid of the previous one
+	path := b.BaseURL + "/address/" + address + "/txs/chain"
+	for page := 0; page < maxPages; page++ {
+		var txs []struct {
+			TxID   string `json:"txid"`
+			Status struct {
+				Confirmed bool  `json:"confirmed"`
+				BlockTime int64 `json:"block_time"`
+			} `json:"status"`
+			Vin []struct {
+				Prevout struct {
+					Address string `json:"scriptpubkey_address"`
+					Value   int64  `json:"value"`
+				} `json:"prevout"`
+			} `json:"vin"`
+			Vout []struct {
+				Address string `json:"scriptpubkey_address"`
+				Value   int64  `json:"value"`
+			} `json:"vout"`
+		}
+		if err := getJSON(ctx, path, &txs); err != nil {
+			return nil, fmt.Errorf("btc transfers of %s: %v", address, err)
+		}
+		for _, tx := range txs {
+			t := time.Unix(tx.Status.BlockTime, 0).UTC()
+			if !t.After(since) {
+				return transfers, nil
+			}
+			var net int64
+			for _, in := range tx.Vin {
+				if in.Prevout.Address == address {
+					net -= in.Prevout.Value
+				}
+			}
+			for _, out := range tx.Vout {
+				if out.Address == address {
+					net += out.Value
+				}
+			}
+			if net != 0 {
+				transfers = append(transfers, Transfer{Chain: BTC, Hash: tx.TxID, Time: t, Address: address, Amount: float64(net) / satoshis})
+			}
+		}
+		if len(txs) < esploraPageSize {
+			break
+		}
+		path = b.BaseURL + "/address/" + address + "/txs/chain/" + txs[len(txs)-1].TxID
+	}
+	return transfers, nil
+}
+
+// Ethereum reads the ETH of addresses from the Etherscan API, which needs
+// an API key
+type Ethereum struct {
+	BaseURL string
+	APIKey  string
+}
+
+// NewEthereum creates a reader of the Etherscan API
+func NewEthereum(apiKey string) *Ethereum {
+	return &Ethereum{BaseURL: "https://api.etherscan.io/v2/api", APIKey: apiKey}
+}
+
+func (*Ethereum) Name() string { return ETH }
+
+// wei is the number of wei per ether
+var wei = new(big.Float).SetFloat64(1e18)
+
+func parseWei(value string) (float64, error) {
+	amount, ok := new(big.Float).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("malformed wei amount %q", value)
+	}
+	ether, _ := new(big.Float).Quo(amount, wei).Float64()
+	return ether, nil
+}
+
+func (e *Ethereum) get(ctx context.Context, params url.Values, out interface{}) error {
+	params.Set("chainid", "1")
+	params.Set("module", "account")
+	params.Set("apikey", e.APIKey)
+	var response struct {
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := getJSON(ctx, e.BaseURL+"?"+params.Encode(), &response); err != nil {
+		return err
+	}
+	// an address without transactions is reported as status 0
+	if response.Status != "1" && response.Message != "No transactions found" {
+		return fmt.Errorf("etherscan: %s %s", response.Message, string(response.Result))
+	}
+	if err := json.Unmarshal(response.Result, out); err != nil {
+		// "No transactions found" comes with an empty list
+		if response.Status != "1" {
+			return nil
+		}
+		return fmt.Errorf("malformed etherscan result: %v", err)
+	}
+	return nil
+}
+
+func (e *Ethereum) Balance(ctx context.Context, address string) (float64, error) {
+	params := url.Values{}
+	params.Set("action", "balance")
+	params.Set("address", address)
+	params.Set("tag", "latest")
+	var balance string
+	if err := e.get(ctx, params, &balance); err != nil {
+		return 0, fmt.Errorf("eth balance of %s: %v", address, err)
+	}
+	return parseWei(balance)
+}
+
+// etherscanPageSize is the number of transactions per txlist page
+const etherscanPageSize = 100
+
+func (e *Ethereum) Transfers(ctx context.Context, address string, since time.Time) ([]Transfer, error) {
+	var transfers []Transfer
+	for page := 1; page <= maxPages; page++ {
+		params := url.Values{}
+		params.Set("action", "txlist")
+		params.Set("address", address)
+		params.Set("page", strconv.Itoa(page))
+		params.Set("offset", strconv.Itoa(etherscanPageSize))
+		params.Set("sort", "desc")
+		var txs []struct {
+			Hash      string `json:"hash"`
+			TimeStamp string `json:"timeStamp"`
+			From      string `json:"from"`
+			To        string `json:"to"`
+			Value     string `json:"value"`
+			IsError   string `json:"isError"`
+		}
+		if err := e.get(ctx, params, &txs); err != nil {
+			return nil, fmt.Errorf("eth transfers of %s: %v", address, err)
+		}
+		for _, tx := range txs {
+			seconds, err := strconv.ParseInt(tx.TimeStamp, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed etherscan timestamp %q", tx.TimeStamp)
+			}
+			t := time.Unix(seconds, 0).UTC()
+			if !t.After(since) {
+				return transfers, nil
+			}
+			if tx.IsError == "1" {
+				continue
+			}
+			amount, err := parseWei(tx.Value)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case amount == 0:
+				continue
+			case strings.EqualFold(tx.From, tx.To):
+				continue
+			case strings.EqualFold(tx.From, address):
+				amount = -amount
+			}
+			transfers = append(transfers, Transfer{Chain: ETH, Hash: tx.Hash, Time: t, Address: address, Amount: amount})
+		}
+		if len(txs) < etherscanPageSize {
+			break
+		}
+	}
+	return transfers, nil
+}
+
+// Solana reads addresses over a Solana RPC client. Every transfer costs a
+// getTransaction call, so the client should not be shared with user facing
+// reads.
+type Solana struct {
+	Client *rpc.Client
+	// Limit is the number of signatures read per page
+	Limit int
+	// MaxTransactions is the number of transactions read per address and
+	// poll, the rest is read on the next polls
+	MaxTransactions int
+}
+
+// NewSolana creates a reader using client
+func NewSolana(client *rpc.Client) *Solana {
+	return &Solana{Client: client, Limit: 100, MaxTransactions: 50}
+}
+
+func (*Solana) Name() string { return SOL }
+
+const lamports = 1e9
+
+func (s *Solana) Balance(ctx context.Context, address string) (float64, error) {
+	key, err := sol.PublicKeyFromBase58(address)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sol address %s: %v", address, err)
+	}
+	result, err := s.Client.GetBalance(ctx, key, rpc.CommitmentConfirmed)
+	if err != nil {
+		return 0, fmt.Errorf("sol balance of %s: %v", address, err)
+	}
+	return float64(result.Value) / lamports, nil
+}
+
+// Transfers reads the signatures after since and then their transactions
+// oldest first, at most MaxTransactions of them
+func (s *Solana) Transfers(ctx context.Context, address string, since time.Time) ([]Transfer, error) {
+	key, err := sol.PublicKeyFromBase58(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sol address %s: %v", address, err)
+	}
+	var pending []*rpc.TransactionSignature
+	var before sol.Signature
+	for page := 0; page < maxPages; page++ {
+		limit := s.Limit
+		signatures, err := s.Client.GetSignaturesForAddressWithOpts(ctx, key, &rpc.GetSignaturesForAddressOpts{
+			Limit:      &limit,
+			Before:     before,
+			Commitment: rpc.CommitmentConfirmed,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("sol transfers of %s: %v", address, err)
+		}
+		done := false
+		for _, signature := range signatures {
+			if signature.BlockTime == nil {
+				continue
+			}
+			if !signature.BlockTime.Time().After(since) {
+				done = true
+				break
+			}
+			if signature.Err == nil {
+				pending = append(pending, signature)
+			}
+		}
+		if done || len(signatures) < limit {
+			break
+		}
+		before = signatures[len(signatures)-1].Signature
+	}
+
+	transfers, err := s.read(ctx, address, pending)
+	// newest first, like the other chains
+	for i, j := 0, len(transfers)-1; i < j; i, j = i+1, j-1 {
+		transfers[i], transfers[j] = transfers[j], transfers[i]
+	}
+	return transfers, err
+}
+
+// read returns the changes of address in pending, given newest first, from
+// the oldest one on. It stops at MaxTransactions or the first error.
+func (s *Solana) read(ctx context.Context, address string, pending []*rpc.TransactionSignature) ([]Transfer, error) {
+	var transfers []Transfer
+	for i := len(pending) - 1; i >= 0; i-- {
+		signature := pending[i]
+		t := signature.BlockTime.Time().UTC()
+		// finish the second of the last transaction, as the next poll
+		// starts after it
+		if s.MaxTransactions > 0 && len(transfers) >= s.MaxTransactions && !t.Equal(transfers[len(transfers)-1].Time) {
+			break
+		}
+		change, err := s.change(ctx, address, signature.Signature)
+		if err != nil {
+			return transfers, err
+		}
+		transfers = append(transfers, Transfer{Chain: SOL, Hash: signature.Signature.String(), Time: t, Address: address, Amount: float64(change) / lamports})
+	}
+	return transfers, nil
+}
+
+// change returns the lamports address gained in the transaction. The call
+// is made directly as solana-go's GetParsedTransaction cannot request
+// versioned transactions.
+func (s *Solana) change(ctx context.Context, address string, signature sol.Signature) (int64, error) {
+	var tx *struct {
+		Meta struct {
+			PreBalances  []uint64 `json:"preBalances"`
+			PostBalances []uint64 `json:"postBalances"`
+		} `json:"meta"`
+		Transaction struct {
+			Message struct {
+				AccountKeys []struct {
+					Pubkey string `json:"pubkey"`
+				} `json:"accountKeys"`
+			} `json:"message"`
+		} `json:"transaction"`
+	}
+	err := s.Client.RPCCallForInto(ctx, &tx, "getTransaction", []interface{}{
+		signature.String(),
+		rpc.M{"encoding": sol.EncodingJSONParsed, "commitment": rpc.CommitmentConfirmed, "maxSupportedTransactionVersion": 0},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("sol transfer %s: %v", signature, err)
+	}
+	if tx == nil {
+		return 0, fmt.Errorf("sol transfer %s not found", signature)
+	}
+	for i, key := range tx.Transaction.Message.AccountKeys {
+		if key.Pubkey == address && i < len(tx.Meta.PreBalances) && i < len(tx.Meta.PostBalances) {
+			return int64(tx.Meta.PostBalances[i]) - int64(tx.Meta.PreBalances[i]), nil
+		}
+	}
+	return 0, nil
+}
+
+// BinancePrices reads the USD prices of the chains from Binance spot
+type BinancePrices struct {
+	BaseURL string
+}
+
+// Prices returns the USDT price of every chain's coin keyed by chain
+func (b BinancePrices) Prices(ctx context.Context) (map[string]float64, error) {
+	var tickers []struct {
+		Symbol string `json:"symbol"`
+		Price  string `json:"price"`
+	}
+	symbols := `["BTCUSDT","ETHUSDT","SOLUSDT"]`
+	if err := getJSON(ctx, b.BaseURL+"/api/v3/ticker/price?symbols="+url.QueryEscape(symbols), &tickers); err != nil {
+		return nil, fmt.Errorf("failed to fetch prices: %v", err)
+	}
+	prices := make(map[string]float64, len(tickers))
+	for _, ticker := range tickers {
+		price, err := strconv.ParseFloat(ticker.Price, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed price %q", ticker.Price)
+		}
+		prices[strings.ToLower(strings.TrimSuffix(ticker.Symbol, "USDT"))] = price
+	}
+	return prices, nil
+}
+
+// getJSON decodes the JSON response of a GET request
+func getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	return doJSON(req, out)
+}
+
+func doJSON(req *http.Request, out interface{}) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package onchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Fixture replays recorded balances and transfers instead of reading the
+// chains, for local runs and tests
+type Fixture struct {
+	// Quotes is the USD price per chain
+	Quotes map[string]float64 `json:"prices"`
+	// Wallets replace the configured wallets when set
+	Wallets []Wallet                `json:"wallets,omitempty"`
+	Chains  map[string]FixtureChain `json:"chains"`
+
+	mu    sync.Mutex
+	polls map[string]int
+}
+
+// FixtureChain holds the recorded data of one chain
+type FixtureChain struct {
+	// Balances is the sequence of balances per address, one per poll. The
+	// last balance repeats once the sequence is over.
+	Balances  map[string][]float64 `json:"balances"`
+	Transfers []FixtureTransfer    `json:"transfers"`
+}
+
+// FixtureTransfer is a transfer made MinutesAgo before it is read
+type FixtureTransfer struct {
+	Hash       string  `json:"hash"`
+	Address    string  `json:"address"`
+	Amount     float64 `json:"amount"`
+	MinutesAgo int     `json:"minutes_ago"`
+}
+
+// LoadFixture reads a JSON fixture
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %v", err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture: %v", err)
+	}
+	return &fixture, nil
+}
+
+// Chain returns the fixture of chain as a Chain
+func (f *Fixture) Chain(chain string) Chain {
+	return fixtureChain{fixture: f, name: chain}
+}
+
+// Prices returns the recorded prices
+func (f *Fixture) Prices(ctx context.Context) (map[string]float64, error) {
+	return f.Quotes, nil
+}
+
+type fixtureChain struct {
+	fixture *Fixture
+	name    string
+}
+
+func (c fixtureChain) Name() string { return c.name }
+
+// Balance returns the next balance of address
+func (c fixtureChain) Balance(ctx context.Context, address string) (float64, error) {
+	balances := c.fixture.Chains[c.name].Balances[address]
+	if len(balances) == 0 {
+		return 0, fmt.Errorf("no %s fixture balance for %s", c.name, address)
+	}
+	key := c.name + "/" + address
+	c.fixture.mu.Lock()
+	defer c.fixture.mu.Unlock()
+	if c.fixture.polls == nil {
+		c.fixture.polls = make(map[string]int)
+	}
+	i := c.fixture.polls[key]
+	c.fixture.polls[key]++
+	if i >= len(balances) {
+		i = len(balances) - 1
+	}
+	return balances[i], nil
+}
+
+func (c fixtureChain) Transfers(ctx context.Context, address string, since time.Time) ([]Transfer, error) {
+	now := time.Now().UTC()
+	var transfers []Transfer
+	for _, recorded := range c.fixture.Chains[c.name].Transfers {
+		t := now.Add(-time.Duration(recorded.MinutesAgo) * time.Minute)
+		if recorded.Address != address || !t.After(since) {
+			continue
+		}
+		transfers = append(transfers, Transfer{Chain: c.name, Hash: recorded.Hash, Time: t, Address: address, Amount: recorded.Amount})
+	}
+	return transfers, nil
+}
@@ -0,0 +1,356 @@
+// Package onchain follows the balances and transfers of known exchange
+// wallets to measure the exchange netflow and the whale transfers
+package onchain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go-vue/pkg/timeseries"
+)
+
+const (
+	// DefaultThreshold is the USD value of a whale transfer
+	DefaultThreshold = 1e6
+	// Window is the period of the netflow and whale count
+	Window = 24 * time.Hour
+)
+
+// PriceSource serves the USD price of the coin of every chain, keyed by
+// chain
+type PriceSource interface {
+	Prices(ctx context.Context) (map[string]float64, error)
+}
+
+// BalanceSeries names the stored native balance of an exchange wallet
+func BalanceSeries(chain, address string) string {
+	return "onchain/" + chain + "/" + address + "/balance"
+}
+
+// FlowSeries names the stored USD flow of an exchange wallet between two
+// polls, positive into the exchange
+func FlowSeries(chain, address string) string {
+	return "onchain/" + chain + "/" + address + "/netflow"
+}
+
+// Whale is a transfer of an exchange wallet above the threshold
+type Whale struct {
+	Transfer
+	Exchange string  `json:"exchange"`
+	Label    string  `json:"label,omitempty"`
+	USD      float64 `json:"usd"`
+	// Direction is inflow into or outflow from the exchange
+	Direction string `json:"direction"`
+}
+
+// Balance is the last known balance of an exchange wallet
+type Balance struct {
+	Wallet
+	Amount float64 `json:"amount"`
+	USD    float64 `json:"usd"`
+}
+
+// Snapshot sums the flows of the exchange wallets over the Window
+type Snapshot struct {
+	Time time.Time `json:"time"`
+	// Netflow is in USD, positive when coins moved into the exchanges
+	Netflow   float64            `json:"netflow"`
+	Chains    map[string]float64 `json:"chains"`
+	Exchanges map[string]float64 `json:"exchanges"`
+	Whales    int                `json:"whales"`
+	Balances  []Balance          `json:"balances"`
+}
+
+// Status reports the health of the tracker
+type Status struct {
+	Wallets   int       `json:"wallets"`
+	Polls     int       `json:"polls"`
+	LastPoll  time.Time `json:"last_poll,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Tracker polls the exchange wallets and records their flows
+type Tracker struct {
+	chains    map[string]Chain
+	prices    PriceSource
+	wallets   []Wallet
+	series    *timeseries.Store
+	threshold float64
+	now       func() time.Time
+
+	mu     sync.Mutex
+	status Status
+	latest *Snapshot
+	whales []Whale
+	// since is the time of the last transfer read per address
+	since map[string]time.Time
+	seen  map[string]bool
+}
+
+// NewTracker creates a tracker of the wallets whose chain is in chains.
+// Transfers worth threshold USD or more are whale transfers.
+func NewTracker(chains map[string]Chain, prices PriceSource, wallets []Wallet, series *timeseries.Store, threshold float64) *Tracker {
+	var tracked []Wallet
+	for _, wallet := range wallets {
+		if _, ok := chains[wallet.Chain]; ok {
+			tracked = append(tracked, wallet)
+		}
+	}
+	return &Tracker{
+		chains:    chains,
+		prices:    prices,
+		wallets:   tracked,
+		series:    series,
+		threshold: threshold,
+		now:       time.Now,
+		status:    Status{Wallets: len(tracked)},
+		since:     make(map[string]time.Time),
+		seen:      make(map[string]bool),
+	}
+}
+
+// Wallets returns the tracked wallets
+func (t *Tracker) Wallets() []Wallet {
+	return t.wallets
+}
+
+// Status returns the health of the tracker
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// Latest returns the last snapshot, nil before the first poll
+func (t *Tracker) Latest() *Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.latest
+}
+
+// Whales returns the whale transfers of the Window, newest first
+func (t *Tracker) Whales() []Whale {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Whale{}, t.whales...)
+}
+
+// Run polls now and then every interval until ctx is done
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := t.Poll(ctx); err != nil {
+			log.Printf("Failed to poll the exchange wallets: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll reads the balances and transfers of the wallets, stores the flows
+// since the previous poll and the exchange-flows and whale-transactions
+// indicators. A wallet that cannot be read is skipped until the next poll.
+func (t *Tracker) Poll(ctx context.Context) (*Snapshot, error) {
+	now := t.now().UTC()
+	prices, err := t.prices.Prices(ctx)
+	if err != nil {
+		t.fail(err)
+		return nil, err
+	}
+
+	var failure error
+	var balances []Balance
+	var transfers []Whale
+	for _, wallet := range t.wallets {
+		price, ok := prices[wallet.Chain]
+		if !ok {
+			failure = fmt.Errorf("no %s price", wallet.Chain)
+			continue
+		}
+		balance, err := t.record(ctx, wallet, price, now)
+		if err != nil {
+			failure = err
+			continue
+		}
+		balances = append(balances, Balance{Wallet: wallet, Amount: balance, USD: balance * price})
+
+		read, err := t.transfers(ctx, wallet, price, now)
+		if err != nil {
+			failure = err
+		}
+		transfers = append(transfers, read...)
+	}
+
+	whales := t.addWhales(external(transfers), now)
+	snapshot, err := t.snapshot(ctx, balances, whales, now)
+	if err != nil {
+		t.fail(err)
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.latest = snapshot
+	t.status.Polls++
+	t.status.LastPoll = now
+	t.status.LastError = ""
+	if failure != nil {
+		t.status.LastError = failure.Error()
+	}
+	t.mu.Unlock()
+	return snapshot, nil
+}
+
+func (t *Tracker) fail(err error) {
+	t.mu.Lock()
+	t.status.LastError = err.Error()
+	t.mu.Unlock()
+}
+
+// record stores the balance of wallet and its USD flow since the previous
+// balance, and returns the balance
+func (t *Tracker) record(ctx context.Context, wallet Wallet, price float64, now time.Time) (float64, error) {
+	balance, err := t.chains[wallet.Chain].Balance(ctx, wallet.Address)
+	if err != nil {
+		return 0, err
+	}
+	previous, err := t.series.Last(ctx, BalanceSeries(wallet.Chain, wallet.Address))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := t.series.Write(ctx, BalanceSeries(wallet.Chain, wallet.Address), []timeseries.Point{{Time: now, Value: balance}}); err != nil {
+		return 0, err
+	}
+	// the first balance of a wallet is the baseline of its flows
+	if previous == nil {
+		return balance, nil
+	}
+	flow := []timeseries.Point{{Time: now, Value: (balance - previous.Value) * price}}
+	if _, err := t.series.Write(ctx, FlowSeries(wallet.Chain, wallet.Address), flow); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// transfers returns the new transfers of wallet worth the threshold or more
+func (t *Tracker) transfers(ctx context.Context, wallet Wallet, price float64, now time.Time) ([]Whale, error) {
+	key := wallet.Chain + "/" + wallet.Address
+	t.mu.Lock()
+	since, ok := t.since[key]
+	t.mu.Unlock()
+	if !ok {
+		since = now.Add(-Window)
+	}
+	// the transfers read before an error still move since forward
+	read, err := t.chains[wallet.Chain].Transfers(ctx, wallet.Address, since)
+	var whales []Whale
+	for _, transfer := range read {
+		if transfer.Time.After(since) {
+			since = transfer.Time
+		}
+		if transfer.Amount == 0 {
+			continue
+		}
+		usd := transfer.Amount * price
+		if usd < 0 {
+			usd = -usd
+		}
+		if usd < t.threshold {
+			continue
+		}
+		direction := "inflow"
+		if transfer.Amount < 0 {
+			direction = "outflow"
+		}
+		whales = append(whales, Whale{Transfer: transfer, Exchange: wallet.Exchange, Label: wallet.Label, USD: usd, Direction: direction})
+	}
+	t.mu.Lock()
+	t.since[key] = since
+	t.mu.Unlock()
+	return whales, err
+}
+
+// external drops the transfers between two wallets of the same exchange,
+// which move coins without changing the holdings of the exchange
+func external(transfers []Whale) []Whale {
+	wallets := make(map[string]map[string]int)
+	for _, transfer := range transfers {
+		key := transfer.Chain + "/" + transfer.Hash + "/" + transfer.Exchange
+		if wallets[key] == nil {
+			wallets[key] = make(map[string]int)
+		}
+		wallets[key][transfer.Address]++
+	}
+	var kept []Whale
+	for _, transfer := range transfers {
+		if len(wallets[transfer.Chain+"/"+transfer.Hash+"/"+transfer.Exchange]) == 1 {
+			kept = append(kept, transfer)
+		}
+	}
+	return kept
+}
+
+// addWhales keeps the unseen transfers and drops those older than the
+// Window, and returns the whales of the Window
+func (t *Tracker) addWhales(transfers []Whale, now time.Time) []Whale {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, transfer := range transfers {
+		key := transfer.Chain + "/" + transfer.Hash + "/" + transfer.Address
+		if t.seen[key] {
+			continue
+		}
+		t.seen[key] = true
+		t.whales = append(t.whales, transfer)
+	}
+	var kept []Whale
+	for _, whale := range t.whales {
+		if whale.Time.After(now.Add(-Window)) {
+			kept = append(kept, whale)
+		} else {
+			delete(t.seen, whale.Chain+"/"+whale.Hash+"/"+whale.Address)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Time.After(kept[j].Time) })
+	t.whales = kept
+	return append([]Whale{}, kept...)
+}
+
+// snapshot sums the flows of the Window and stores the hourly indicators:
+// the netflow in million USD and the number of whale transfers
+func (t *Tracker) snapshot(ctx context.Context, balances []Balance, whales []Whale, now time.Time) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		Time:      now,
+		Chains:    make(map[string]float64),
+		Exchanges: make(map[string]float64),
+		Whales:    len(whales),
+		Balances:  balances,
+	}
+	for _, wallet := range t.wallets {
+		flows, err := t.series.Range(ctx, FlowSeries(wallet.Chain, wallet.Address), now.Add(-Window), time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		for _, flow := range flows {
+			snapshot.Netflow += flow.Value
+			snapshot.Chains[wallet.Chain] += flow.Value
+			snapshot.Exchanges[wallet.Exchange] += flow.Value
+		}
+	}
+
+	hour := now.Truncate(time.Hour)
+	if _, err := t.series.Write(ctx, timeseries.Indicator("exchange-flows"), []timeseries.Point{{Time: hour, Value: snapshot.Netflow / 1e6}}); err != nil {
+		return nil, err
+	}
+	if _, err := t.series.Write(ctx, timeseries.Indicator("whale-transactions"), []timeseries.Point{{Time: hour, Value: float64(snapshot.Whales)}}); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
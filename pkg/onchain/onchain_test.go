@@ -0,0 +1,227 @@
+package onchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-vue/pkg/storage"
+	"go-vue/pkg/timeseries"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestTrackerFixture(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := timeseries.NewStore(store)
+	fixture, err := LoadFixture(filepath.Join("testdata", "fixture.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains := map[string]Chain{BTC: fixture.Chain(BTC), ETH: fixture.Chain(ETH), SOL: fixture.Chain(SOL)}
+	tracker := NewTracker(chains, fixture, fixture.Wallets, series, DefaultThreshold)
+
+	start := time.Now()
+	var snapshot *Snapshot
+	for i := 0; i < 3; i++ {
+		tracker.now = func() time.Time { return start.Add(time.Duration(i) * 10 * time.Minute) }
+		if snapshot, err = tracker.Poll(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if status := tracker.Status(); status.Polls != 3 || status.LastError != "" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// btc +20 -10 on the hot wallet and +10 on the cold one, eth -1000 and
+	// sol +10000
+	expected := map[string]float64{BTC: 20 * 60000, ETH: -1000 * 3000, SOL: 10000 * 150}
+	for chain, flow := range expected {
+		if math.Abs(snapshot.Chains[chain]-flow) > 1e-6 {
+			t.Fatalf("expected a %s netflow of %v, got %v", chain, flow, snapshot.Chains[chain])
+		}
+	}
+	if math.Abs(snapshot.Netflow+300000) > 1e-6 {
+		t.Fatalf("expected a netflow of -300000, got %v", snapshot.Netflow)
+	}
+	if math.Abs(snapshot.Exchanges["binance"]-2.7e6) > 1e-6 || math.Abs(snapshot.Exchanges["coinbase"]+3e6) > 1e-6 {
+		t.Fatalf("unexpected exchange netflows %v", snapshot.Exchanges)
+	}
+
+	// the sweep between the binance wallets, the small eth deposit and the
+	// transfer older than a day are not whales
+	whales := tracker.Whales()
+	if len(whales) != 3 || snapshot.Whales != 3 {
+		t.Fatalf("expected 3 whales, got %+v", whales)
+	}
+	directions := map[string]string{"sol-deposit": "inflow", "eth-withdrawal": "outflow", "btc-deposit": "inflow"}
+	for i, whale := range whales {
+		if directions[whale.Hash] != whale.Direction {
+			t.Fatalf("unexpected whale %+v", whale)
+		}
+		if i > 0 && whale.Time.After(whales[i-1].Time) {
+			t.Fatal("whales should be newest first")
+		}
+	}
+
+	flows, err := series.Last(context.Background(), timeseries.Indicator("exchange-flows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flows == nil || math.Abs(flows.Value+0.3) > 1e-9 {
+		t.Fatalf("expected an exchange-flows indicator of -0.3, got %+v", flows)
+	}
+	count, err := series.Last(context.Background(), timeseries.Indicator("whale-transactions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count == nil || count.Value != 3 {
+		t.Fatalf("expected a whale-transactions indicator of 3, got %+v", count)
+	}
+}
+
+func TestLoadWallets(t *testing.T) {
+	wallets, err := LoadWallets(filepath.Join(t.TempDir(), "missing.yaml"), "Coinbase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wallets) == 0 {
+		t.Fatal("expected the default coinbase wallets")
+	}
+	for _, wallet := range wallets {
+		if wallet.Exchange != "coinbase" {
+			t.Fatalf("unexpected wallet %+v", wallet)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "wallets.yaml")
+	file := "wallets:\n  - exchange: okx\n    chain: DOGE\n    address: D123\n"
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadWallets(path, ""); err == nil {
+		t.Fatal("expected an unsupported chain to fail")
+	}
+}
+
+func TestBitcoinTransfers(t *testing.T) {
+	now := time.Now().Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/address/bc1qex/txs/chain":
+			// a full page of deposits, the next page follows the last one
+			var txs []string
+			for i := 0; i < esploraPageSize; i++ {
+				txs = append(txs, fmt.Sprintf(`{"txid":"tx%d","status":{"confirmed":true,"block_time":%d},
+					"vin":[{"prevout":{"scriptpubkey_address":"bc1qother","value":100000000}}],
+					"vout":[{"scriptpubkey_address":"bc1qex","value":100000000}]}`, i, now-int64(i+1)*60))
+			}
+			w.Write([]byte("[" + strings.Join(txs, ",") + "]"))
+		case fmt.Sprintf("/address/bc1qex/txs/chain/tx%d", esploraPageSize-1):
+			w.Write([]byte(`[
+				{"txid":"out","status":{"confirmed":true,"block_time":` + strconv.FormatInt(now-1800, 10) + `},
+				 "vin":[{"prevout":{"scriptpubkey_address":"bc1qex","value":500000000}}],
+				 "vout":[{"scriptpubkey_address":"bc1qother","value":300000000},{"scriptpubkey_address":"bc1qex","value":199990000}]},
+				{"txid":"old","status":{"confirmed":true,"block_time":` + strconv.FormatInt(now-7200, 10) + `},
+				 "vin":[],"vout":[{"scriptpubkey_address":"bc1qex","value":100000000}]}
+			]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	transfers, err := (&Bitcoin{BaseURL: server.URL}).Transfers(context.Background(), "bc1qex", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != esploraPageSize+1 || transfers[0].Amount != 1 {
+		t.Fatalf("unexpected transfers %+v", transfers)
+	}
+	if out := transfers[esploraPageSize]; out.Hash != "out" || math.Abs(out.Amount+3.0001) > 1e-9 {
+		t.Fatalf("unexpected transfer from the second page %+v", out)
+	}
+}
+
+func TestSolanaTransfers(t *testing.T) {
+	address := sol.NewWallet().PublicKey().String()
+	signature := func(b byte) string { return sol.SignatureFromBytes(append([]byte{b}, make([]byte, 63)...)).String() }
+	now := time.Now().Unix()
+	// signatures newest first, the last one before the polled range
+	times := []int64{now - 60, now - 120, now - 180, now - 7200}
+	failing := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var result string
+		switch req.Method {
+		case "getSignaturesForAddress":
+			var opts struct {
+				Limit  int    `json:"limit"`
+				Before string `json:"before"`
+			}
+			json.Unmarshal(req.Params[1], &opts)
+			start := 0
+			for i := range times {
+				if signature(byte(i)) == opts.Before {
+					start = i + 1
+				}
+			}
+			var page []string
+			for i := start; i < len(times) && len(page) < opts.Limit; i++ {
+				page = append(page, fmt.Sprintf(`{"signature":%q,"blockTime":%d,"slot":%d}`, signature(byte(i)), times[i], 100-i))
+			}
+			result = "[" + strings.Join(page, ",") + "]"
+		case "getTransaction":
+			if string(req.Params[0]) == `"`+failing+`"` {
+				fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":429,"message":"rate limited"}}`, req.ID)
+				return
+			}
+			result = `{"meta":{"preBalances":[5000000000,0],"postBalances":[3000000000,2000000000]},
+				"transaction":{"message":{"accountKeys":[{"pubkey":"` + sol.NewWallet().PublicKey().String() + `"},{"pubkey":"` + address + `"}]}}}`
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, result)
+	}))
+	defer server.Close()
+
+	chain := NewSolana(rpc.New(server.URL))
+	chain.Limit = 2
+	transfers, err := chain.Transfers(context.Background(), address, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 3 || transfers[2].Hash != signature(2) || transfers[0].Amount != 2 {
+		t.Fatalf("unexpected transfers %+v", transfers)
+	}
+
+	// the oldest transactions are read first, up to MaxTransactions
+	chain.MaxTransactions = 2
+	transfers, err = chain.Transfers(context.Background(), address, time.Now().Add(-time.Hour))
+	if err != nil || len(transfers) != 2 || transfers[0].Hash != signature(1) || transfers[1].Hash != signature(2) {
+		t.Fatalf("unexpected capped transfers %+v: %v", transfers, err)
+	}
+
+	// a failed call returns the transfers read before it
+	failing = signature(1)
+	transfers, err = chain.Transfers(context.Background(), address, time.Now().Add(-time.Hour))
+	if err == nil || len(transfers) != 1 || transfers[0].Hash != signature(2) {
+		t.Fatalf("unexpected partial transfers %+v: %v", transfers, err)
+	}
+}
@@ -0,0 +1,87 @@
+package onchain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Wallet is a known exchange address on one chain
+type Wallet struct {
+	// Exchange is the label set the wallet belongs to, such as binance
+	Exchange string `json:"exchange"`
+	Chain    string `json:"chain"`
+	Address  string `json:"address"`
+	// Label describes the wallet, for example hot or cold
+	Label string `json:"label,omitempty"`
+}
+
+// WalletsFile is the YAML or JSON file of labelled exchange wallets
+type WalletsFile struct {
+	Wallets []Wallet `json:"wallets"`
+}
+
+// DefaultWallets are well known exchange wallets used without a wallets
+// file
+func DefaultWallets() []Wallet {
+	return []Wallet{
+		{Exchange: "binance", Chain: BTC, Address: "34xp4vRoCGJym3xR7yCVPFHoCNxv4Twseo", Label: "cold"},
+		{Exchange: "bitfinex", Chain: BTC, Address: "bc1qgdjqv0av3q56jvd82tkdjpy7gdp9ut8tlqmgrpmv24sq90ecnvqqjwvw97", Label: "cold"},
+		{Exchange: "binance", Chain: ETH, Address: "0x28C6c06298d514Db089934071355E5743bf21d60", Label: "hot"},
+		{Exchange: "binance", Chain: ETH, Address: "0xBE0eB53F46cd790Cd13851d5EFf43D12404d33E8", Label: "cold"},
+		{Exchange: "binance", Chain: ETH, Address: "0xF977814e90dA44bFA03b6295A0616a897441aceC", Label: "cold"},
+		{Exchange: "coinbase", Chain: ETH, Address: "0x71660c4005BA85c37ccec55d0C4493E66Fe775d3", Label: "hot"},
+		{Exchange: "kraken", Chain: ETH, Address: "0x2910543Af39abA0Cd09dBb2D50200b3E800A63D2", Label: "hot"},
+		{Exchange: "binance", Chain: SOL, Address: "5tzFkiKscXHK5ZXCGbXZxdw7gTjjD1mBwuoFbhUvuAi9", Label: "hot"},
+		{Exchange: "binance", Chain: SOL, Address: "9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM", Label: "hot"},
+		{Exchange: "coinbase", Chain: SOL, Address: "H8sMJSCQxfKiFTCfDR3DUMLPwcRbM61LGFJ8N4dK3WjS", Label: "hot"},
+	}
+}
+
+// LoadWallets reads the wallets of path, DefaultWallets when path is empty
+// or does not exist. With exchanges, a comma separated list of label sets,
+// only the wallets of those exchanges are kept.
+func LoadWallets(path, exchanges string) ([]Wallet, error) {
+	wallets := DefaultWallets()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read wallets file: %v", err)
+		}
+		if err == nil {
+			var file WalletsFile
+			if err := yaml.Unmarshal(data, &file); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", filepath.Base(path), err)
+			}
+			wallets = file.Wallets
+		}
+	}
+
+	selected := make(map[string]bool)
+	for _, exchange := range strings.Split(exchanges, ",") {
+		if exchange = strings.ToLower(strings.TrimSpace(exchange)); exchange != "" {
+			selected[exchange] = true
+		}
+	}
+	var kept []Wallet
+	for _, wallet := range wallets {
+		wallet.Exchange = strings.ToLower(wallet.Exchange)
+		wallet.Chain = strings.ToLower(wallet.Chain)
+		if wallet.Address == "" {
+			return nil, fmt.Errorf("wallet of %s on %s has no address", wallet.Exchange, wallet.Chain)
+		}
+		switch wallet.Chain {
+		case BTC, ETH, SOL:
+		default:
+			return nil, fmt.Errorf("wallet %s: unsupported chain %q", wallet.Address, wallet.Chain)
+		}
+		if len(selected) > 0 && !selected[wallet.Exchange] {
+			continue
+		}
+		kept = append(kept, wallet)
+	}
+	return kept, nil
+}
@@ -0,0 +1,366 @@
+package portfolio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/market"
+	"go-vue/pkg/solana"
+	"go-vue/pkg/storage"
+)
+
+const (
+	historyPrefix = "portfolio/history/"
+	// snapshotInterval is the minimum time between two history points
+	snapshotInterval = 5 * time.Minute
+)
+
+// Venue kinds
+const (
+	KindBinanceSpot    = "binance_spot"
+	KindBinanceFutures = "binance_futures"
+	KindSolana         = "solana"
+)
+
+// Holding is an asset held at one venue
+type Holding struct {
+	Venue string `json:"venue"`
+	Asset string `json:"asset"`
+	Name  string `json:"name,omitempty"`
+	Mint  string `json:"mint,omitempty"`
+	// Type is spot, futures, native, staked or token
+	Type       string  `json:"type"`
+	Amount     float64 `json:"amount"`
+	PriceUSD   float64 `json:"price_usd"`
+	ValueUSD   float64 `json:"value_usd"`
+	Allocation float64 `json:"allocation"`
+}
+
+// Source lists the holdings of one venue
+type Source interface {
+	// Venue names the venue, for example binance_spot or solana:<address>
+	Venue() string
+	Kind() string
+	Holdings(ctx context.Context) ([]Holding, error)
+}
+
+// VenueBreakdown is the value held at one venue
+type VenueBreakdown struct {
+	Venue      string    `json:"venue"`
+	Kind       string    `json:"kind"`
+	ValueUSD   float64   `json:"value_usd"`
+	Allocation float64   `json:"allocation"`
+	Holdings   []Holding `json:"holdings"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AssetAllocation is one asset summed across venues
+type AssetAllocation struct {
+	Asset      string  `json:"asset"`
+	Amount     float64 `json:"amount"`
+	ValueUSD   float64 `json:"value_usd"`
+	Allocation float64 `json:"allocation"`
+	// Venues is the USD value of the asset by venue
+	Venues map[string]float64 `json:"venues"`
+}
+
+// ValuePoint is a recorded total portfolio value
+type ValuePoint struct {
+	Time     time.Time          `json:"time"`
+	ValueUSD float64            `json:"value_usd"`
+	Venues   map[string]float64 `json:"venues"`
+}
+
+// Consolidated is the merged portfolio of all venues
+type Consolidated struct {
+	TotalValueUSD float64           `json:"total_value_usd"`
+	Venues        []VenueBreakdown  `json:"venues"`
+	Assets        []AssetAllocation `json:"assets"`
+	History       []ValuePoint      `json:"history"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// Service merges venue holdings and records the total value history
+type Service struct {
+	store storage.Store
+
+	mu           sync.Mutex
+	lastSnapshot time.Time
+}
+
+// NewService creates a portfolio service keeping history in store
+func NewService(store storage.Store) *Service {
+	return &Service{store: store}
+}
+
+// Consolidated loads the portfolio of sources, records its value and adds
+// the history since historyFrom
+func (s *Service) Consolidated(ctx context.Context, sources []Source, historyFrom time.Time) (*Consolidated, error) {
+	portfolio := Load(ctx, sources)
+	if err := s.snapshot(ctx, portfolio); err != nil {
+		return nil, err
+	}
+	history, err := s.History(ctx, historyFrom)
+	if err != nil {
+		return nil, err
+	}
+	portfolio.History = history
+	return portfolio, nil
+}
+
+// Load loads all sources concurrently and merges their holdings without
+// recording them. A failing venue is reported in its breakdown and left out
+// of the totals.
+func Load(ctx context.Context, sources []Source) *Consolidated {
+	venues := make([]VenueBreakdown, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source Source) {
+			defer wg.Done()
+			venue := VenueBreakdown{Venue: source.Venue(), Kind: source.Kind(), Holdings: []Holding{}}
+			holdings, err := source.Holdings(ctx)
+			if err != nil {
+				venue.Error = err.Error()
+			} else {
+				venue.Holdings = holdings
+			}
+			venues[i] = venue
+		}(i, source)
+	}
+	wg.Wait()
+
+	portfolio := merge(venues)
+	portfolio.History = []ValuePoint{}
+	return portfolio
+}
+
+// merge computes venue totals, per asset allocations and percentages
+func merge(venues []VenueBreakdown) *Consolidated {
+	portfolio := &Consolidated{Venues: venues, Assets: []AssetAllocation{}, UpdatedAt: time.Now()}
+	assets := make(map[string]*AssetAllocation)
+	for i := range venues {
+		venue := &venues[i]
+		for _, holding := range venue.Holdings {
+			venue.ValueUSD += holding.ValueUSD
+			key := strings.ToUpper(holding.Asset)
+			asset, ok := assets[key]
+			if !ok {
+				asset = &AssetAllocation{Asset: key, Venues: make(map[string]float64)}
+				assets[key] = asset
+			}
+			asset.Amount += holding.Amount
+			asset.ValueUSD += holding.ValueUSD
+			asset.Venues[venue.Venue] += holding.ValueUSD
+		}
+		portfolio.TotalValueUSD += venue.ValueUSD
+	}
+
+	for i := range venues {
+		venue := &venues[i]
+		venue.Allocation = percent(venue.ValueUSD, portfolio.TotalValueUSD)
+		for j := range venue.Holdings {
+			venue.Holdings[j].Allocation = percent(venue.Holdings[j].ValueUSD, portfolio.TotalValueUSD)
+		}
+		sort.SliceStable(venue.Holdings, func(a, b int) bool {
+			return venue.Holdings[a].ValueUSD > venue.Holdings[b].ValueUSD
+		})
+	}
+	for _, asset := range assets {
+		asset.Allocation = percent(asset.ValueUSD, portfolio.TotalValueUSD)
+		portfolio.Assets = append(portfolio.Assets, *asset)
+	}
+	sort.Slice(portfolio.Assets, func(i, j int) bool {
+		if portfolio.Assets[i].ValueUSD != portfolio.Assets[j].ValueUSD {
+			return portfolio.Assets[i].ValueUSD > portfolio.Assets[j].ValueUSD
+		}
+		return portfolio.Assets[i].Asset < portfolio.Assets[j].Asset
+	})
+	return portfolio
+}
+
+func percent(value, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return value / total * 100
+}
+
+// snapshot records the total value at most once per snapshotInterval.
+// Portfolios with a failed venue are not recorded, the missing value would
+// show up as a drop in the history.
+func (s *Service) snapshot(ctx context.Context, portfolio *Consolidated) error {
+	for _, venue := range portfolio.Venues {
+		if venue.Error != "" {
+			return nil
+		}
+	}
+	s.mu.Lock()
+	if time.Since(s.lastSnapshot) < snapshotInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastSnapshot = portfolio.UpdatedAt
+	s.mu.Unlock()
+
+	point := ValuePoint{Time: portfolio.UpdatedAt, ValueUSD: portfolio.TotalValueUSD, Venues: make(map[string]float64)}
+	for _, venue := range portfolio.Venues {
+		point.Venues[venue.Venue] = venue.ValueUSD
+	}
+	data, err := json.Marshal(point)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s%020d", historyPrefix, point.Time.Unix())
+	if err := s.store.Put(ctx, key, data); err != nil {
+		return fmt.Errorf("failed to save portfolio snapshot: %v", err)
+	}
+	return nil
+}
+
+// History returns the recorded values since from, oldest first
+func (s *Service) History(ctx context.Context, from time.Time) ([]ValuePoint, error) {
+	keys, err := s.store.List(ctx, historyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list portfolio history: %v", err)
+	}
+	sort.Strings(keys)
+	fromKey := fmt.Sprintf("%s%020d", historyPrefix, from.Unix())
+	history := []ValuePoint{}
+	for _, key := range keys {
+		if key < fromKey {
+			continue
+		}
+		data, err := s.store.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load portfolio snapshot: %v", err)
+		}
+		var point ValuePoint
+		if err := json.Unmarshal(data, &point); err != nil {
+			return nil, fmt.Errorf("failed to decode portfolio snapshot: %v", err)
+		}
+		history = append(history, point)
+	}
+	return history, nil
+}
+
+// Run records a snapshot of sources every interval until ctx is done
+func (s *Service) Run(ctx context.Context, interval time.Duration, sources func() []Source) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Consolidated(ctx, sources(), time.Now()); err != nil {
+				fmt.Printf("Warning: failed to record portfolio snapshot: %v\n", err)
+			}
+		}
+	}
+}
+
+// BinanceSpot is the spot wallet of a Binance account
+type BinanceSpot struct {
+	Binance *market.BinanceService
+}
+
+func (b BinanceSpot) Venue() string { return KindBinanceSpot }
+func (b BinanceSpot) Kind() string  { return KindBinanceSpot }
+
+func (b BinanceSpot) Holdings(ctx context.Context) ([]Holding, error) {
+	balances, err := b.Binance.SpotBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return binanceHoldings(KindBinanceSpot, "spot", balances), nil
+}
+
+// BinanceFutures is the USD-M futures wallet of a Binance account
+type BinanceFutures struct {
+	Binance *market.BinanceService
+}
+
+func (b BinanceFutures) Venue() string { return KindBinanceFutures }
+func (b BinanceFutures) Kind() string  { return KindBinanceFutures }
+
+func (b BinanceFutures) Holdings(ctx context.Context) ([]Holding, error) {
+	balances, err := b.Binance.FuturesBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return binanceHoldings(KindBinanceFutures, "futures", balances), nil
+}
+
+func binanceHoldings(venue, holdingType string, balances []market.AssetBalance) []Holding {
+	holdings := make([]Holding, 0, len(balances))
+	for _, balance := range balances {
+		holdings = append(holdings, Holding{
+			Venue:    venue,
+			Asset:    balance.Asset,
+			Type:     holdingType,
+			Amount:   balance.Amount,
+			PriceUSD: balance.PriceUSD,
+			ValueUSD: balance.ValueUSD,
+		})
+	}
+	return holdings
+}
+
+// SolanaWallet is a Solana address with its SPL tokens and stake accounts
+type SolanaWallet struct {
+	Address string
+	Wallets *solana.WalletService
+	Staking *solana.StakingService
+}
+
+func (w SolanaWallet) Venue() string { return KindSolana + ":" + w.Address }
+func (w SolanaWallet) Kind() string  { return KindSolana }
+
+func (w SolanaWallet) Holdings(ctx context.Context) ([]Holding, error) {
+	wallet, err := w.Wallets.GetWallet(ctx, w.Address)
+	if err != nil {
+		return nil, err
+	}
+	if w.Staking != nil {
+		accounts, _, err := w.Staking.Accounts(ctx, w.Address)
+		if err != nil {
+			return nil, err
+		}
+		wallet.AddStake(accounts)
+	}
+
+	venue := w.Venue()
+	holdings := []Holding{}
+	if wallet.SOL > 0 {
+		holdings = append(holdings, Holding{
+			Venue: venue, Asset: "SOL", Type: "native", Amount: wallet.SOL,
+			PriceUSD: wallet.SOLPriceUSD, ValueUSD: wallet.SOLValueUSD,
+		})
+	}
+	if wallet.StakedSOL > 0 {
+		holdings = append(holdings, Holding{
+			Venue: venue, Asset: "SOL", Type: "staked", Amount: wallet.StakedSOL,
+			PriceUSD: wallet.SOLPriceUSD, ValueUSD: wallet.StakedValueUSD,
+		})
+	}
+	for _, token := range wallet.Tokens {
+		if token.NFT {
+			continue
+		}
+		asset := token.Symbol
+		if asset == "" {
+			asset = token.Mint
+		}
+		holdings = append(holdings, Holding{
+			Venue: venue, Asset: asset, Name: token.Name, Mint: token.Mint, Type: "token",
+			Amount: token.UIAmount, PriceUSD: token.PriceUSD, ValueUSD: token.ValueUSD,
+		})
+	}
+	return holdings, nil
+}
@@ -0,0 +1,140 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-vue/pkg/market"
+	"go-vue/pkg/storage"
+)
+
+type stubSource struct {
+	venue    string
+	holdings []Holding
+	err      error
+}
+
+func (s stubSource) Venue() string { return s.venue }
+func (s stubSource) Kind() string  { return "stub" }
+
+func (s stubSource) Holdings(ctx context.Context) ([]Holding, error) {
+	return s.holdings, s.err
+}
+
+func TestConsolidated(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(store)
+	sources := []Source{
+		stubSource{venue: "spot", holdings: []Holding{
+			{Asset: "BTC", Amount: 0.01, ValueUSD: 600},
+			{Asset: "sol", Amount: 1, ValueUSD: 100},
+		}},
+		stubSource{venue: "wallet", holdings: []Holding{
+			{Asset: "SOL", Type: "native", Amount: 2, ValueUSD: 200},
+			{Asset: "SOL", Type: "staked", Amount: 1, ValueUSD: 100},
+		}},
+	}
+
+	portfolio, err := service.Consolidated(context.Background(), sources, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if portfolio.TotalValueUSD != 1000 {
+		t.Fatalf("total = %v, want 1000", portfolio.TotalValueUSD)
+	}
+	if portfolio.Venues[0].Allocation != 70 || portfolio.Venues[1].Allocation != 30 {
+		t.Fatalf("unexpected venue allocations %+v", portfolio.Venues)
+	}
+	if len(portfolio.Assets) != 2 || portfolio.Assets[0].Asset != "BTC" || portfolio.Assets[1].Asset != "SOL" {
+		t.Fatalf("unexpected assets %+v", portfolio.Assets)
+	}
+	if sol := portfolio.Assets[1]; sol.Amount != 4 || sol.Allocation != 40 || sol.Venues["wallet"] != 300 {
+		t.Fatalf("unexpected SOL allocation %+v", sol)
+	}
+	if len(portfolio.History) != 1 || portfolio.History[0].ValueUSD != 1000 {
+		t.Fatalf("unexpected history %+v", portfolio.History)
+	}
+
+	// a second request inside the snapshot interval is not recorded again
+	portfolio, err = service.Consolidated(context.Background(), sources, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(portfolio.History) != 1 {
+		t.Fatalf("history has %d points, want 1", len(portfolio.History))
+	}
+}
+
+func TestConsolidatedVenueError(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(store)
+	sources := []Source{
+		stubSource{venue: "spot", holdings: []Holding{{Asset: "BTC", ValueUSD: 500}}},
+		stubSource{venue: "futures", err: errors.New("unauthorized")},
+	}
+
+	portfolio, err := service.Consolidated(context.Background(), sources, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if portfolio.TotalValueUSD != 500 || portfolio.Venues[1].Error != "unauthorized" {
+		t.Fatalf("unexpected portfolio %+v", portfolio)
+	}
+	if len(portfolio.History) != 0 {
+		t.Fatalf("partial portfolio was recorded in history")
+	}
+}
+
+func TestLoadIsNotRecorded(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(store)
+	sources := []Source{stubSource{venue: "wallet", holdings: []Holding{{Asset: "SOL", ValueUSD: 100}}}}
+
+	if portfolio := Load(context.Background(), sources); portfolio.TotalValueUSD != 100 {
+		t.Fatalf("unexpected portfolio %+v", portfolio)
+	}
+	history, err := service.History(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("loaded portfolio was recorded in history")
+	}
+}
+
+func TestBinanceSpotEarnAssets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/account":
+			fmt.Fprint(w, `{"balances":[{"asset":"LDO","free":"10","locked":"0"},{"asset":"LDBTC","free":"0.5","locked":"0"}]}`)
+		case "/api/v3/ticker/price":
+			fmt.Fprint(w, `[{"symbol":"LDOUSDT","price":"2"},{"symbol":"BTCUSDT","price":"60000"}]`)
+		}
+	}))
+	defer server.Close()
+
+	source := BinanceSpot{Binance: market.NewBinanceServiceWithURLs("key", "secret", server.URL, server.URL)}
+	holdings, err := source.Holdings(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// LDO is Lido, LDBTC the Simple Earn balance of BTC
+	if len(holdings) != 2 || holdings[0].Asset != "LDO" || holdings[0].ValueUSD != 20 ||
+		holdings[1].Asset != "BTC" || holdings[1].ValueUSD != 30000 {
+		t.Fatalf("unexpected holdings %+v", holdings)
+	}
+}
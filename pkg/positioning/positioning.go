@@ -0,0 +1,134 @@
+// Package positioning reads how derivatives traders are positioned from the
+// open interest, the price and the long/short ratio of perpetual contracts
+package positioning
+
+import (
+	"math"
+	"time"
+
+	"go-vue/pkg/market"
+)
+
+const (
+	// DefaultThreshold is the move in percent below which a change of the
+	// open interest or the price is treated as flat
+	DefaultThreshold = 0.5
+	// CrowdedShare is the share of the accounts above which one side of
+	// the market counts as crowded
+	CrowdedShare = 0.65
+)
+
+// Regime is the positioning read from the change of the open interest
+// against the change of the price
+type Regime string
+
+const (
+	// NewLongs is rising open interest on a rising price, buyers open
+	// positions
+	NewLongs Regime = "new-longs"
+	// ShortCovering is falling open interest on a rising price, shorts
+	// close their positions
+	ShortCovering Regime = "short-covering"
+	// NewShorts is rising open interest on a falling price, sellers open
+	// positions
+	NewShorts Regime = "new-shorts"
+	// LongLiquidation is falling open interest on a falling price, longs
+	// close or are liquidated
+	LongLiquidation Regime = "long-liquidation"
+	// Neutral is a flat open interest or price
+	Neutral Regime = "neutral"
+)
+
+// Classify returns the regime of a percent change of the open interest and
+// the price. Changes smaller than threshold percent are flat.
+func Classify(oiChange, priceChange, threshold float64) Regime {
+	if math.Abs(oiChange) < threshold || math.Abs(priceChange) < threshold {
+		return Neutral
+	}
+	switch {
+	case priceChange > 0 && oiChange > 0:
+		return NewLongs
+	case priceChange > 0:
+		return ShortCovering
+	case oiChange > 0:
+		return NewShorts
+	default:
+		return LongLiquidation
+	}
+}
+
+// Score rates a regime from -1 to 1. Moves carried by new positions are
+// stronger than moves made of closing ones, which tend to run out once the
+// positions are gone.
+func (r Regime) Score() float64 {
+	switch r {
+	case NewLongs:
+		return 1
+	case ShortCovering:
+		return 0.5
+	case LongLiquidation:
+		return -0.5
+	case NewShorts:
+		return -1
+	}
+	return 0
+}
+
+// Point is the open interest at one time classified against the open
+// interest lookback points earlier
+type Point struct {
+	Time time.Time `json:"time"`
+	// OpenInterest is in contracts and Price is the mark price
+	OpenInterest float64 `json:"open_interest"`
+	Price        float64 `json:"price"`
+	// OIChange and PriceChange are in percent
+	OIChange    float64 `json:"oi_change"`
+	PriceChange float64 `json:"price_change"`
+	Regime      Regime  `json:"regime"`
+	Score       float64 `json:"score"`
+}
+
+// Divergence classifies every point of history from the lookback-th on.
+// The price is the USD value of the open interest divided by the
+// contracts, which Binance computes at the mark price.
+func Divergence(history []market.OpenInterest, lookback int, threshold float64) []Point {
+	if lookback < 1 {
+		lookback = 1
+	}
+	price := func(interest market.OpenInterest) float64 {
+		if interest.Contracts == 0 {
+			return 0
+		}
+		return interest.Value / interest.Contracts
+	}
+	points := []Point{}
+	for i := lookback; i < len(history); i++ {
+		previous, current := history[i-lookback], history[i]
+		if previous.Contracts == 0 || price(previous) == 0 {
+			continue
+		}
+		point := Point{
+			Time:         current.Time,
+			OpenInterest: current.Contracts,
+			Price:        price(current),
+			OIChange:     (current.Contracts/previous.Contracts - 1) * 100,
+			PriceChange:  (price(current)/price(previous) - 1) * 100,
+		}
+		point.Regime = Classify(point.OIChange, point.PriceChange, threshold)
+		point.Score = point.Regime.Score()
+		points = append(points, point)
+	}
+	return points
+}
+
+// Crowded returns the side holding at least CrowdedShare of the accounts,
+// "long" or "short", and an empty string when neither does
+func Crowded(ratio market.LongShortRatio) string {
+	switch {
+	case ratio.Long >= CrowdedShare:
+		return "long"
+	case ratio.Short >= CrowdedShare:
+		return "short"
+	}
+	return ""
+}
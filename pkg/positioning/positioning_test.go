@@ -0,0 +1,71 @@
+package positioning
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go-vue/pkg/market"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		oi, price float64
+		want      Regime
+	}{
+		{2, 1, NewLongs},
+		{-2, 1, ShortCovering},
+		{2, -1, NewShorts},
+		{-2, -1, LongLiquidation},
+		{0.1, 3, Neutral},
+		{3, -0.1, Neutral},
+	}
+	for _, c := range cases {
+		if got := Classify(c.oi, c.price, DefaultThreshold); got != c.want {
+			t.Errorf("Classify(%v, %v) = %s, want %s", c.oi, c.price, got, c.want)
+		}
+	}
+}
+
+func TestDivergence(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// contracts and prices per hour
+	contracts := []float64{100, 102, 104, 103, 101}
+	prices := []float64{50000, 50500, 51000, 51500, 50000}
+	var history []market.OpenInterest
+	for i := range contracts {
+		history = append(history, market.OpenInterest{
+			Time:      start.Add(time.Duration(i) * time.Hour),
+			Contracts: contracts[i],
+			Value:     contracts[i] * prices[i],
+		})
+	}
+
+	points := Divergence(history, 2, DefaultThreshold)
+	if len(points) != 3 {
+		t.Fatalf("expected 3 points, got %d", len(points))
+	}
+	first := points[0]
+	if !first.Time.Equal(history[2].Time) || math.Abs(first.OIChange-4) > 1e-9 || math.Abs(first.PriceChange-2) > 1e-9 {
+		t.Fatalf("unexpected first point %+v", first)
+	}
+	// 104 -> 101 contracts while the price goes from 51000 to 50000
+	want := []Regime{NewLongs, NewLongs, LongLiquidation}
+	for i, point := range points {
+		if point.Regime != want[i] || point.Score != want[i].Score() {
+			t.Errorf("point %d: %s, want %s", i, point.Regime, want[i])
+		}
+	}
+}
+
+func TestCrowded(t *testing.T) {
+	if side := Crowded(market.LongShortRatio{Long: 0.7, Short: 0.3}); side != "long" {
+		t.Fatalf("70%% longs should be crowded, got %q", side)
+	}
+	if side := Crowded(market.LongShortRatio{Long: 0.3, Short: 0.7}); side != "short" {
+		t.Fatalf("70%% shorts should be crowded, got %q", side)
+	}
+	if side := Crowded(market.LongShortRatio{Long: 0.55, Short: 0.45}); side != "" {
+		t.Fatalf("55%% longs should not be crowded, got %q", side)
+	}
+}
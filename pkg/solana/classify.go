@@ -0,0 +1,429 @@
+package solana
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	sol "github.com/gagliardetto/solana-go"
+)
+
+// TxType is the normalized kind of a wallet transaction
+type TxType string
+
+const (
+	TxTransfer TxType = "transfer"
+	TxSwap     TxType = "swap"
+	TxStake    TxType = "stake"
+	TxNFTMint  TxType = "nft_mint"
+	TxOther    TxType = "other"
+)
+
+// Transfer directions reported in Transaction.Action
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// BalanceChange is the net change of one asset in a wallet. Native SOL and
+// wrapped SOL are merged under the wrapped SOL mint.
+type BalanceChange struct {
+	Mint     string  `json:"mint"`
+	Symbol   string  `json:"symbol,omitempty"`
+	Raw      string  `json:"raw"`
+	Amount   float64 `json:"amount"`
+	Decimals uint8   `json:"decimals"`
+}
+
+// Swap is the input and output leg of a swap from the wallet's side
+type Swap struct {
+	InMint    string  `json:"in_mint"`
+	InAmount  float64 `json:"in_amount"`
+	OutMint   string  `json:"out_mint"`
+	OutAmount float64 `json:"out_amount"`
+}
+
+// Transaction is a normalized transaction of a wallet
+type Transaction struct {
+	Signature    string          `json:"signature"`
+	Wallet       string          `json:"wallet"`
+	Slot         uint64          `json:"slot"`
+	BlockTime    time.Time       `json:"block_time"`
+	Type         TxType          `json:"type"`
+	Action       string          `json:"action,omitempty"`
+	Venue        string          `json:"venue,omitempty"`
+	Programs     []string        `json:"programs"`
+	Success      bool            `json:"success"`
+	Error        string          `json:"error,omitempty"`
+	FeeLamports  uint64          `json:"fee_lamports"`
+	FeePayer     bool            `json:"fee_payer"`
+	Counterparty string          `json:"counterparty,omitempty"`
+	Changes      []BalanceChange `json:"changes"`
+	Swap         *Swap           `json:"swap,omitempty"`
+}
+
+// HasMint reports whether the transaction changed the balance of mint
+func (t *Transaction) HasMint(mint string) bool {
+	for _, change := range t.Changes {
+		if change.Mint == mint {
+			return true
+		}
+	}
+	return false
+}
+
+// parsedTransaction is the jsonParsed layout of getTransaction
+type parsedTransaction struct {
+	Slot        uint64 `json:"slot"`
+	BlockTime   *int64 `json:"blockTime"`
+	Transaction struct {
+		Signatures []string `json:"signatures"`
+		Message    struct {
+			AccountKeys []struct {
+				Pubkey string `json:"pubkey"`
+				Signer bool   `json:"signer"`
+			} `json:"accountKeys"`
+			Instructions []parsedInstruction `json:"instructions"`
+		} `json:"message"`
+	} `json:"transaction"`
+	Meta *struct {
+		Err               interface{}          `json:"err"`
+		Fee               uint64               `json:"fee"`
+		PreBalances       []uint64             `json:"preBalances"`
+		PostBalances      []uint64             `json:"postBalances"`
+		PreTokenBalances  []parsedTokenBalance `json:"preTokenBalances"`
+		PostTokenBalances []parsedTokenBalance `json:"postTokenBalances"`
+		InnerInstructions []struct {
+			Index        int                 `json:"index"`
+			Instructions []parsedInstruction `json:"instructions"`
+		} `json:"innerInstructions"`
+	} `json:"meta"`
+}
+
+type parsedTokenBalance struct {
+	AccountIndex  int    `json:"accountIndex"`
+	Mint          string `json:"mint"`
+	Owner         string `json:"owner"`
+	UITokenAmount struct {
+		Amount   string `json:"amount"`
+		Decimals uint8  `json:"decimals"`
+	} `json:"uiTokenAmount"`
+}
+
+// parsedInstruction is an instruction as returned by jsonParsed. Parsed is
+// an object for programs the node can decode and absent otherwise.
+type parsedInstruction struct {
+	Program   string          `json:"program"`
+	ProgramID string          `json:"programId"`
+	Parsed    json.RawMessage `json:"parsed"`
+}
+
+type instructionInfo struct {
+	Type string                 `json:"type"`
+	Info map[string]interface{} `json:"info"`
+}
+
+// info decodes the parsed instruction, ok is false for opaque instructions
+func (i parsedInstruction) info() (instructionInfo, bool) {
+	var info instructionInfo
+	if len(i.Parsed) == 0 || i.Parsed[0] != '{' {
+		return info, false
+	}
+	if err := json.Unmarshal(i.Parsed, &info); err != nil {
+		return info, false
+	}
+	return info, true
+}
+
+func (i instructionInfo) str(key string) string {
+	value, _ := i.Info[key].(string)
+	return value
+}
+
+// classifyTransaction normalizes tx from the point of view of wallet
+func classifyTransaction(wallet, signature string, tx *parsedTransaction) (*Transaction, error) {
+	if tx.Meta == nil {
+		return nil, fmt.Errorf("transaction %s has no meta", signature)
+	}
+
+	result := &Transaction{
+		Signature:   signature,
+		Wallet:      wallet,
+		Slot:        tx.Slot,
+		Type:        TxOther,
+		Programs:    []string{},
+		Success:     tx.Meta.Err == nil,
+		FeeLamports: tx.Meta.Fee,
+	}
+	if tx.BlockTime != nil {
+		result.BlockTime = time.Unix(*tx.BlockTime, 0).UTC()
+	}
+	if !result.Success {
+		if raw, err := json.Marshal(tx.Meta.Err); err == nil {
+			result.Error = string(raw)
+		}
+	}
+	keys := tx.Transaction.Message.AccountKeys
+	result.FeePayer = len(keys) > 0 && keys[0].Pubkey == wallet
+
+	instructions := append([]parsedInstruction{}, tx.Transaction.Message.Instructions...)
+	for _, inner := range tx.Meta.InnerInstructions {
+		instructions = append(instructions, inner.Instructions...)
+	}
+	seen := make(map[string]bool)
+	for _, inst := range instructions {
+		name := inst.Program
+		if venue, ok := dexPrograms[inst.ProgramID]; ok {
+			name = venue
+		}
+		if name == "" {
+			name = inst.ProgramID
+		}
+		if !seen[name] {
+			seen[name] = true
+			result.Programs = append(result.Programs, name)
+		}
+	}
+
+	result.Changes = walletChanges(wallet, tx)
+
+	switch {
+	case classifyStake(result, instructions):
+	case classifySwap(result, instructions):
+	case classifyNFTMint(result, instructions):
+	case classifyTransfer(result, instructions, tx):
+	}
+	return result, nil
+}
+
+// walletChanges computes the net balance changes of wallet, excluding the
+// fee. Token balances are matched by owner so changes in any token account
+// of the wallet are included.
+func walletChanges(wallet string, tx *parsedTransaction) []BalanceChange {
+	type delta struct {
+		raw      *big.Int
+		decimals uint8
+	}
+	deltas := make(map[string]*delta)
+	add := func(mint string, amount *big.Int, decimals uint8) {
+		d, ok := deltas[mint]
+		if !ok {
+			d = &delta{raw: new(big.Int), decimals: decimals}
+			deltas[mint] = d
+		}
+		d.raw.Add(d.raw, amount)
+	}
+
+	solMint := sol.SolMint.String()
+	meta := tx.Meta
+	for i, key := range tx.Transaction.Message.AccountKeys {
+		if key.Pubkey != wallet || i >= len(meta.PreBalances) || i >= len(meta.PostBalances) {
+			continue
+		}
+		change := new(big.Int).SetUint64(meta.PostBalances[i])
+		change.Sub(change, new(big.Int).SetUint64(meta.PreBalances[i]))
+		if i == 0 {
+			change.Add(change, new(big.Int).SetUint64(meta.Fee))
+		}
+		add(solMint, change, 9)
+	}
+
+	for _, balance := range meta.PreTokenBalances {
+		if balance.Owner != wallet {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(balance.UITokenAmount.Amount, 10)
+		if ok {
+			add(balance.Mint, amount.Neg(amount), balance.UITokenAmount.Decimals)
+		}
+	}
+	for _, balance := range meta.PostTokenBalances {
+		if balance.Owner != wallet {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(balance.UITokenAmount.Amount, 10)
+		if ok {
+			add(balance.Mint, amount, balance.UITokenAmount.Decimals)
+		}
+	}
+
+	changes := []BalanceChange{}
+	for mint, d := range deltas {
+		if d.raw.Sign() == 0 {
+			continue
+		}
+		amount, _ := new(big.Float).Quo(new(big.Float).SetInt(d.raw),
+			new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.decimals)), nil))).Float64()
+		changes = append(changes, BalanceChange{
+			Mint:     mint,
+			Raw:      d.raw.String(),
+			Amount:   amount,
+			Decimals: d.decimals,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Mint < changes[j].Mint })
+	return changes
+}
+
+func classifyStake(result *Transaction, instructions []parsedInstruction) bool {
+	stake := sol.StakeProgramID.String()
+	for _, inst := range instructions {
+		if inst.ProgramID != stake {
+			continue
+		}
+		result.Type = TxStake
+		if info, ok := inst.info(); ok {
+			result.Action = info.Type
+		}
+		return true
+	}
+	return false
+}
+
+func classifySwap(result *Transaction, instructions []parsedInstruction) bool {
+	for _, inst := range instructions {
+		venue, ok := dexPrograms[inst.ProgramID]
+		if !ok {
+			continue
+		}
+		if result.Venue == "" || aggregators[venue] {
+			result.Venue = venue
+		}
+	}
+	if result.Venue == "" {
+		return false
+	}
+
+	result.Type = TxSwap
+	in, out := swapLeg(result.Changes, -1), swapLeg(result.Changes, 1)
+	if in != nil && out != nil {
+		result.Swap = &Swap{
+			InMint:    in.Mint,
+			InAmount:  -in.Amount,
+			OutMint:   out.Mint,
+			OutAmount: out.Amount,
+		}
+	}
+	return true
+}
+
+// swapLeg picks the change with the given sign that represents a swap leg.
+// SOL is only used when no token moved in that direction, since small SOL
+// changes are usually rent for token accounts created by the swap.
+func swapLeg(changes []BalanceChange, sign int) *BalanceChange {
+	solMint := sol.SolMint.String()
+	var leg, solLeg *BalanceChange
+	for i := range changes {
+		change := &changes[i]
+		if (sign < 0) != (change.Amount < 0) {
+			continue
+		}
+		if change.Mint == solMint {
+			solLeg = change
+			continue
+		}
+		if leg == nil || abs(change.Amount) > abs(leg.Amount) {
+			leg = change
+		}
+	}
+	if leg != nil {
+		return leg
+	}
+	return solLeg
+}
+
+func classifyNFTMint(result *Transaction, instructions []parsedInstruction) bool {
+	newMints := make(map[string]bool)
+	nftProgram := false
+	for _, inst := range instructions {
+		if nftMintPrograms[inst.ProgramID] {
+			nftProgram = true
+		}
+		info, ok := inst.info()
+		if !ok || (inst.Program != "spl-token" && inst.Program != "spl-token-2022") {
+			continue
+		}
+		if info.Type == "initializeMint" || info.Type == "initializeMint2" {
+			if decimals, _ := info.Info["decimals"].(float64); decimals == 0 {
+				newMints[info.str("mint")] = true
+			}
+		}
+	}
+
+	for _, change := range result.Changes {
+		if change.Decimals != 0 || change.Raw != "1" {
+			continue
+		}
+		if newMints[change.Mint] || nftProgram {
+			result.Type = TxNFTMint
+			return true
+		}
+	}
+	return false
+}
+
+func classifyTransfer(result *Transaction, instructions []parsedInstruction, tx *parsedTransaction) bool {
+	// Token accounts are resolved to their owner for the counterparty
+	owners := make(map[string]string)
+	keys := tx.Transaction.Message.AccountKeys
+	for _, balances := range [][]parsedTokenBalance{tx.Meta.PreTokenBalances, tx.Meta.PostTokenBalances} {
+		for _, balance := range balances {
+			if balance.AccountIndex < len(keys) && balance.Owner != "" {
+				owners[keys[balance.AccountIndex].Pubkey] = balance.Owner
+			}
+		}
+	}
+	owner := func(account string) string {
+		if o, ok := owners[account]; ok {
+			return o
+		}
+		return account
+	}
+
+	for _, inst := range instructions {
+		info, ok := inst.info()
+		if !ok {
+			continue
+		}
+		var source, destination string
+		switch {
+		case inst.Program == "system" && (info.Type == "transfer" || info.Type == "transferWithSeed"):
+			source, destination = info.str("source"), info.str("destination")
+		case (inst.Program == "spl-token" || inst.Program == "spl-token-2022") &&
+			(info.Type == "transfer" || info.Type == "transferChecked"):
+			source = info.str("authority")
+			if source == "" {
+				source = info.str("multisigAuthority")
+			}
+			if source == "" {
+				source = owner(info.str("source"))
+			}
+			destination = owner(info.str("destination"))
+		default:
+			continue
+		}
+
+		switch result.Wallet {
+		case source:
+			result.Action = DirectionOut
+			result.Counterparty = destination
+		case destination:
+			result.Action = DirectionIn
+			result.Counterparty = source
+		default:
+			continue
+		}
+		result.Type = TxTransfer
+		return true
+	}
+	return false
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
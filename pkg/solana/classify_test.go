@@ -0,0 +1,146 @@
+package solana
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const (
+	testWallet = "WaLLet1111111111111111111111111111111111111"
+	testOther  = "0ther11111111111111111111111111111111111111"
+	testUSDC   = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+)
+
+func decodeTestTransaction(t *testing.T, raw string) *parsedTransaction {
+	t.Helper()
+	var tx parsedTransaction
+	if err := json.Unmarshal([]byte(raw), &tx); err != nil {
+		t.Fatal(err)
+	}
+	return &tx
+}
+
+func TestClassifySwap(t *testing.T) {
+	// SOL -> USDC through Jupiter routed into a Whirlpool. The wallet pays
+	// the fee and rent for its new USDC account.
+	tx := decodeTestTransaction(t, `{
+		"slot": 100, "blockTime": 1700000000,
+		"transaction": {"message": {
+			"accountKeys": [{"pubkey": "`+testWallet+`", "signer": true}, {"pubkey": "usdcAta"}],
+			"instructions": [
+				{"programId": "ComputeBudget111111111111111111111111111111", "data": "3"},
+				{"programId": "JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4", "data": "abc"}
+			]
+		}},
+		"meta": {
+			"err": null, "fee": 5000,
+			"preBalances": [2000005000, 0], "postBalances": [997960720, 2039280],
+			"preTokenBalances": [],
+			"postTokenBalances": [{"accountIndex": 1, "mint": "`+testUSDC+`", "owner": "`+testWallet+`",
+				"uiTokenAmount": {"amount": "150250000", "decimals": 6}}],
+			"innerInstructions": [{"index": 1, "instructions": [
+				{"programId": "whirLbMiicVdio4qvUfM5KAg6Ct8VwpYzGff3uctyCc", "data": "x"}
+			]}]
+		}
+	}`)
+
+	result, err := classifyTransaction(testWallet, "sig", tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Type != TxSwap || result.Venue != "jupiter" {
+		t.Fatalf("got type %s venue %s, want jupiter swap", result.Type, result.Venue)
+	}
+	if !result.FeePayer || result.FeeLamports != 5000 {
+		t.Fatalf("unexpected fee payer %v fee %d", result.FeePayer, result.FeeLamports)
+	}
+	swap := result.Swap
+	if swap == nil || swap.InMint != "So11111111111111111111111111111111111111112" || swap.OutMint != testUSDC {
+		t.Fatalf("unexpected swap %+v", swap)
+	}
+	if swap.InAmount != 1.00203928 || swap.OutAmount != 150.25 {
+		t.Fatalf("unexpected swap amounts %+v", swap)
+	}
+}
+
+func TestClassifyTokenTransfer(t *testing.T) {
+	tx := decodeTestTransaction(t, `{
+		"slot": 101, "blockTime": 1700000100,
+		"transaction": {"message": {
+			"accountKeys": [{"pubkey": "`+testOther+`", "signer": true}, {"pubkey": "srcAta"}, {"pubkey": "dstAta"}],
+			"instructions": [
+				{"program": "spl-token", "programId": "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+				 "parsed": {"type": "transferChecked", "info": {"source": "srcAta", "destination": "dstAta", "authority": "`+testOther+`"}}}
+			]
+		}},
+		"meta": {
+			"err": null, "fee": 5000,
+			"preBalances": [1000000, 2039280, 2039280], "postBalances": [995000, 2039280, 2039280],
+			"preTokenBalances": [
+				{"accountIndex": 1, "mint": "`+testUSDC+`", "owner": "`+testOther+`", "uiTokenAmount": {"amount": "5000000", "decimals": 6}},
+				{"accountIndex": 2, "mint": "`+testUSDC+`", "owner": "`+testWallet+`", "uiTokenAmount": {"amount": "0", "decimals": 6}}
+			],
+			"postTokenBalances": [
+				{"accountIndex": 1, "mint": "`+testUSDC+`", "owner": "`+testOther+`", "uiTokenAmount": {"amount": "0", "decimals": 6}},
+				{"accountIndex": 2, "mint": "`+testUSDC+`", "owner": "`+testWallet+`", "uiTokenAmount": {"amount": "5000000", "decimals": 6}}
+			]
+		}
+	}`)
+
+	result, err := classifyTransaction(testWallet, "sig", tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Type != TxTransfer || result.Action != DirectionIn || result.Counterparty != testOther {
+		t.Fatalf("got %s %s from %s, want incoming transfer", result.Type, result.Action, result.Counterparty)
+	}
+	if result.FeePayer || len(result.Changes) != 1 || result.Changes[0].Amount != 5 {
+		t.Fatalf("unexpected changes %+v", result.Changes)
+	}
+}
+
+func TestClassifyStakeAndNFTMint(t *testing.T) {
+	stake := decodeTestTransaction(t, `{
+		"slot": 102,
+		"transaction": {"message": {
+			"accountKeys": [{"pubkey": "`+testWallet+`", "signer": true}],
+			"instructions": [
+				{"program": "stake", "programId": "Stake11111111111111111111111111111111111111",
+				 "parsed": {"type": "delegate", "info": {"stakeAccount": "x", "voteAccount": "y"}}}
+			]
+		}},
+		"meta": {"err": null, "fee": 5000, "preBalances": [10000], "postBalances": [5000]}
+	}`)
+	result, err := classifyTransaction(testWallet, "sig", stake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Type != TxStake || result.Action != "delegate" {
+		t.Fatalf("got %s %s, want stake delegate", result.Type, result.Action)
+	}
+
+	mint := decodeTestTransaction(t, `{
+		"slot": 103,
+		"transaction": {"message": {
+			"accountKeys": [{"pubkey": "`+testWallet+`", "signer": true}, {"pubkey": "nftAta"}],
+			"instructions": [
+				{"program": "spl-token", "programId": "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+				 "parsed": {"type": "initializeMint2", "info": {"mint": "nftMint", "decimals": 0}}},
+				{"program": "spl-token", "programId": "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+				 "parsed": {"type": "mintTo", "info": {"mint": "nftMint", "account": "nftAta", "amount": "1"}}}
+			]
+		}},
+		"meta": {
+			"err": null, "fee": 5000, "preBalances": [100000000, 0], "postBalances": [95000000, 2039280],
+			"postTokenBalances": [{"accountIndex": 1, "mint": "nftMint", "owner": "`+testWallet+`",
+				"uiTokenAmount": {"amount": "1", "decimals": 0}}]
+		}
+	}`)
+	result, err = classifyTransaction(testWallet, "sig", mint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Type != TxNFTMint || !result.HasMint("nftMint") {
+		t.Fatalf("got %s with changes %+v, want nft mint", result.Type, result.Changes)
+	}
+}
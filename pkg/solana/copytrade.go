@@ -0,0 +1,196 @@
+package solana
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go-vue/pkg/events"
+)
+
+// TopicCopyTrade is published when a watched wallet buys or sells a token
+const TopicCopyTrade = "solana.copytrade.signal"
+
+// Trade sides
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+// maxSignals is how many recent signals are kept for the API
+const maxSignals = 100
+
+// stableMints are quote assets valued at one dollar when no price is known
+var stableMints = map[string]bool{
+	"EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v": true, // USDC
+	"Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB": true, // USDT
+}
+
+// CopyTradeSignal is a token buy or sell by a watched wallet
+type CopyTradeSignal struct {
+	Wallet    string    `json:"wallet"`
+	Label     string    `json:"label,omitempty"`
+	Tags      []string  `json:"tags"`
+	Signature string    `json:"signature"`
+	Time      time.Time `json:"time"`
+	Venue     string    `json:"venue,omitempty"`
+	Side      string    `json:"side"`
+	Mint      string    `json:"mint"`
+	Symbol    string    `json:"symbol,omitempty"`
+	// Amount is the number of tokens bought or sold
+	Amount      float64 `json:"amount"`
+	QuoteMint   string  `json:"quote_mint"`
+	QuoteSymbol string  `json:"quote_symbol,omitempty"`
+	QuoteAmount float64 `json:"quote_amount"`
+	// Price is the token price in the quote asset
+	Price    float64 `json:"price"`
+	PriceUSD float64 `json:"price_usd"`
+	ValueUSD float64 `json:"value_usd"`
+	// Historical performance of the wallet from its closed round trips
+	WinRate     float64 `json:"winrate"`
+	Trades      int     `json:"trades"`
+	RealizedSOL float64 `json:"realized_sol"`
+}
+
+// tradeSignal turns a swap of wallet into a buy or sell signal. Swaps
+// between two quote assets are not trades. A swap between two other tokens
+// is reported as a buy of the received token priced in the sold one.
+func tradeSignal(wallet *WatchedWallet, tx *Transaction) (*CopyTradeSignal, bool) {
+	if tx == nil || !tx.Success || tx.Type != TxSwap || tx.Swap == nil {
+		return nil, false
+	}
+	swap := tx.Swap
+	if swap.InAmount <= 0 || swap.OutAmount <= 0 {
+		return nil, false
+	}
+	inQuote, outQuote := quoteMints[swap.InMint], quoteMints[swap.OutMint]
+	if inQuote && outQuote {
+		return nil, false
+	}
+
+	signal := &CopyTradeSignal{
+		Wallet:    wallet.Address,
+		Label:     wallet.Label,
+		Tags:      wallet.Tags,
+		Signature: tx.Signature,
+		Time:      tx.BlockTime,
+		Venue:     tx.Venue,
+	}
+	if outQuote {
+		signal.Side = SideSell
+		signal.Mint, signal.Amount = swap.InMint, swap.InAmount
+		signal.QuoteMint, signal.QuoteAmount = swap.OutMint, swap.OutAmount
+	} else {
+		signal.Side = SideBuy
+		signal.Mint, signal.Amount = swap.OutMint, swap.OutAmount
+		signal.QuoteMint, signal.QuoteAmount = swap.InMint, swap.InAmount
+	}
+	signal.Price = signal.QuoteAmount / signal.Amount
+	for _, change := range tx.Changes {
+		switch change.Mint {
+		case signal.Mint:
+			signal.Symbol = change.Symbol
+		case signal.QuoteMint:
+			signal.QuoteSymbol = change.Symbol
+		}
+	}
+	return signal, true
+}
+
+// CopyTrader publishes copy-trade signals for swaps of watchlist wallets
+// with notifications enabled
+type CopyTrader struct {
+	bus       *events.Bus
+	watchlist *Watchlist
+	pnl       *PnLEngine
+	tokens    *TokenResolver
+
+	mu      sync.Mutex
+	signals []CopyTradeSignal
+}
+
+// NewCopyTrader creates a copy trader for the wallets on watchlist
+func NewCopyTrader(bus *events.Bus, watchlist *Watchlist, pnl *PnLEngine, tokens *TokenResolver) *CopyTrader {
+	return &CopyTrader{
+		bus:       bus,
+		watchlist: watchlist,
+		pnl:       pnl,
+		tokens:    tokens,
+	}
+}
+
+// Run handles new transactions of watched wallets until ctx is done
+func (c *CopyTrader) Run(ctx context.Context) {
+	received, unsubscribe := c.bus.Subscribe(events.DefaultBuffer, TopicTransactionNew)
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-received:
+			if !ok {
+				return
+			}
+			if data, ok := event.Data.(TransactionEvent); ok {
+				c.handle(ctx, data)
+			}
+		}
+	}
+}
+
+func (c *CopyTrader) handle(ctx context.Context, event TransactionEvent) {
+	wallet, err := c.watchlist.Get(ctx, event.Address)
+	if err != nil {
+		if !errors.Is(err, ErrWatchNotFound) {
+			log.Printf("copy trade: %v", err)
+		}
+		return
+	}
+	if !wallet.Notify {
+		return
+	}
+	signal, ok := tradeSignal(wallet, event.Transaction)
+	if !ok {
+		return
+	}
+
+	// USD values are best effort, the signal is sent without them
+	if prices, err := c.tokens.Prices(ctx, []string{signal.QuoteMint}); err == nil {
+		quoteUSD := prices[signal.QuoteMint]
+		if quoteUSD == 0 && stableMints[signal.QuoteMint] {
+			quoteUSD = 1
+		}
+		signal.PriceUSD = signal.Price * quoteUSD
+		signal.ValueUSD = signal.QuoteAmount * quoteUSD
+	}
+	if report, err := c.pnl.Realized(ctx, wallet.Address); err == nil {
+		signal.WinRate = report.WinRate
+		signal.Trades = report.Trades
+		signal.RealizedSOL = report.RealizedSOL
+	} else {
+		log.Printf("copy trade: failed to compute win rate of %s: %v", wallet.Address, err)
+	}
+
+	c.mu.Lock()
+	c.signals = append(c.signals, *signal)
+	if len(c.signals) > maxSignals {
+		c.signals = c.signals[len(c.signals)-maxSignals:]
+	}
+	c.mu.Unlock()
+	c.bus.Publish(TopicCopyTrade, *signal)
+}
+
+// Signals returns recent signals, newest first, optionally only for address
+func (c *CopyTrader) Signals(address string) []CopyTradeSignal {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := []CopyTradeSignal{}
+	for i := len(c.signals) - 1; i >= 0; i-- {
+		if address == "" || c.signals[i].Wallet == address {
+			result = append(result, c.signals[i])
+		}
+	}
+	return result
+}
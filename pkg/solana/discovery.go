@@ -0,0 +1,517 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/storage"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	walletStatsPrefix = "solana/discovery/wallets/"
+
+	defaultScanSignatures = 200
+	defaultScanWallets    = 50
+	defaultScanHistory    = 500
+)
+
+// WalletStats are the trading statistics of a wallet computed from its
+// indexed swaps. Profit is realized in SOL, PnL is the realized return on
+// the cost of sold positions in percent and the win rate is per round trip.
+// Mints are all traded tokens by PnL with their symbols in Tokens, and
+// OpenMints the tokens still held, largest cost first.
+type WalletStats struct {
+	Address         string    `json:"address"`
+	Profit          float64   `json:"profit"`
+	PnL             float64   `json:"pnl"`
+	TxCount         int       `json:"tx_count"`
+	SwapCount       int       `json:"swap_count"`
+	AvgTokensPerDay float64   `json:"avg_tokens_per_day"`
+	AvgHoldTime     float64   `json:"avg_hold_time"`
+	WinRate         float64   `json:"winrate"`
+	Trades          int       `json:"trades"`
+	LastActive      time.Time `json:"last_active"`
+	Tokens          []string  `json:"tokens"`
+	Mints           []string  `json:"mints"`
+	OpenMints       []string  `json:"open_mints"`
+	Sources         []string  `json:"sources"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ScanOptions select where candidate wallets are discovered. Without mints
+// or programs the main DEX programs are scanned.
+type ScanOptions struct {
+	Mints    []string `json:"mints"`
+	Programs []string `json:"programs"`
+	// Signatures is the number of recent transactions sampled per source
+	Signatures int `json:"signatures"`
+	// MaxWallets limits how many of the most active swappers are analyzed
+	MaxWallets int `json:"max_wallets"`
+	// History is the number of transactions indexed per candidate
+	History int `json:"history"`
+}
+
+// ScanStatus is the progress of the last discovery scan
+type ScanStatus struct {
+	Running    bool        `json:"running"`
+	Options    ScanOptions `json:"options"`
+	StartedAt  time.Time   `json:"started_at,omitempty"`
+	FinishedAt time.Time   `json:"finished_at,omitempty"`
+	Candidates int         `json:"candidates"`
+	Processed  int         `json:"processed"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// DiscoveryService finds wallets trading on given mints or DEX programs
+// and ranks them by the performance of their swaps
+type DiscoveryService struct {
+	client  *rpc.Client
+	store   storage.Store
+	indexer *TransactionIndexer
+	pnl     *PnLEngine
+	tokens  *TokenResolver
+
+	mu     sync.Mutex
+	status ScanStatus
+}
+
+// NewDiscoveryService creates a discovery service using indexer for wallet
+// histories and pnl to value their trades
+func NewDiscoveryService(client *rpc.Client, store storage.Store, indexer *TransactionIndexer, pnl *PnLEngine, tokens *TokenResolver) *DiscoveryService {
+	return &DiscoveryService{
+		client:  client,
+		store:   store,
+		indexer: indexer,
+		pnl:     pnl,
+		tokens:  tokens,
+	}
+}
+
+// Status returns the progress of the current or last scan
+func (d *DiscoveryService) Status() ScanStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// StartScan starts a scan in the background. Only one scan runs at a time.
+// The scan outlives ctx but keeps its values.
+func (d *DiscoveryService) StartScan(ctx context.Context, opts ScanOptions) error {
+	if opts.Signatures <= 0 {
+		opts.Signatures = defaultScanSignatures
+	}
+	if opts.MaxWallets <= 0 {
+		opts.MaxWallets = defaultScanWallets
+	}
+	if opts.History <= 0 {
+		opts.History = defaultScanHistory
+	}
+	sources, err := scanSources(opts)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	if d.status.Running {
+		d.mu.Unlock()
+		return errors.New("a scan is already running")
+	}
+	d.status = ScanStatus{Running: true, Options: opts, StartedAt: time.Now()}
+	d.mu.Unlock()
+
+	go func() {
+		err := d.scan(context.WithoutCancel(ctx), sources, opts)
+		d.mu.Lock()
+		d.status.Running = false
+		d.status.FinishedAt = time.Now()
+		if err != nil {
+			d.status.Error = err.Error()
+		}
+		d.mu.Unlock()
+		if err != nil {
+			log.Printf("Solana wallet scan failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+func scanSources(opts ScanOptions) ([]sol.PublicKey, error) {
+	var sources []sol.PublicKey
+	for _, address := range append(append([]string{}, opts.Mints...), opts.Programs...) {
+		key, err := ParseAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, key)
+	}
+	if len(sources) == 0 {
+		sources = []sol.PublicKey{JupiterV6ProgramID, RaydiumAMMProgramID, OrcaWhirlpoolProgramID}
+	}
+	return sources, nil
+}
+
+type candidate struct {
+	address string
+	swaps   int
+	sources map[string]bool
+}
+
+func (d *DiscoveryService) scan(ctx context.Context, sources []sol.PublicKey, opts ScanOptions) error {
+	candidates := make(map[string]*candidate)
+	for _, source := range sources {
+		if err := d.sampleSource(ctx, source, opts.Signatures, candidates); err != nil {
+			return err
+		}
+	}
+
+	ranked := make([]*candidate, 0, len(candidates))
+	for _, c := range candidates {
+		ranked = append(ranked, c)
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].swaps > ranked[j].swaps })
+	if len(ranked) > opts.MaxWallets {
+		ranked = ranked[:opts.MaxWallets]
+	}
+
+	d.mu.Lock()
+	d.status.Candidates = len(ranked)
+	d.mu.Unlock()
+
+	for _, c := range ranked {
+		if err := d.analyze(ctx, c, opts.History); err != nil {
+			// One bad wallet should not abort the scan
+			log.Printf("Failed to analyze wallet %s: %v", c.address, err)
+		}
+		d.mu.Lock()
+		d.status.Processed++
+		d.mu.Unlock()
+	}
+	return nil
+}
+
+// sampleSource collects fee payers of recent successful swaps touching source
+func (d *DiscoveryService) sampleSource(ctx context.Context, source sol.PublicKey, limit int, candidates map[string]*candidate) error {
+	var before sol.Signature
+	for sampled := 0; sampled < limit; {
+		pageSize := limit - sampled
+		if pageSize > signaturePageSize {
+			pageSize = signaturePageSize
+		}
+		page, err := d.client.GetSignaturesForAddressWithOpts(ctx, source, &rpc.GetSignaturesForAddressOpts{
+			Limit:      &pageSize,
+			Before:     before,
+			Commitment: confirmedCommitmentFrom(ctx),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get signatures of %s: %v", source, err)
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		for _, signature := range page {
+			if signature.Err != nil {
+				continue
+			}
+			tx, err := getParsedTransaction(ctx, d.client, signature.Signature)
+			if err != nil || len(tx.Transaction.Message.AccountKeys) == 0 {
+				continue
+			}
+			payer := tx.Transaction.Message.AccountKeys[0].Pubkey
+			classified, err := classifyTransaction(payer, signature.Signature.String(), tx)
+			if err != nil || classified.Type != TxSwap || classified.Swap == nil {
+				continue
+			}
+
+			c, ok := candidates[payer]
+			if !ok {
+				c = &candidate{address: payer, sources: make(map[string]bool)}
+				candidates[payer] = c
+			}
+			c.swaps++
+			c.sources[source.String()] = true
+		}
+
+		sampled += len(page)
+		if len(page) < pageSize {
+			return nil
+		}
+		before = page[len(page)-1].Signature
+	}
+	return nil
+}
+
+// analyze indexes the history of a candidate and stores its stats
+func (d *DiscoveryService) analyze(ctx context.Context, c *candidate, history int) error {
+	if _, err := d.indexer.Sync(ctx, c.address, history); err != nil {
+		return err
+	}
+	txs, err := d.indexer.History(ctx, c.address)
+	if err != nil {
+		return err
+	}
+
+	stats := computeWalletStats(c.address, txs, d.pnl.Ledger(ctx, txs))
+	for source := range c.sources {
+		stats.Sources = append(stats.Sources, source)
+	}
+	sort.Strings(stats.Sources)
+
+	// Keep sources of earlier scans so a wallet stays findable by them
+	if previous, err := d.walletStats(ctx, c.address); err == nil {
+		stats.Sources = mergeStrings(previous.Sources, stats.Sources)
+	}
+
+	if len(stats.Mints) > 0 {
+		if infos, err := d.tokens.mintInfos(ctx, stats.Mints); err == nil {
+			for i, mint := range stats.Mints {
+				if symbol := infos[mint].Symbol; symbol != "" {
+					stats.Tokens[i] = symbol
+				}
+			}
+		}
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	if err := d.store.Put(ctx, walletStatsPrefix+c.address, data); err != nil {
+		return fmt.Errorf("failed to store wallet stats: %v", err)
+	}
+	return nil
+}
+
+func (d *DiscoveryService) walletStats(ctx context.Context, address string) (*WalletStats, error) {
+	data, err := d.store.Get(ctx, walletStatsPrefix+address)
+	if err != nil {
+		return nil, err
+	}
+	var stats WalletStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// computeWalletStats derives the trading statistics of address from its
+// transactions, given oldest first, and the ledger built from them
+func computeWalletStats(address string, txs []Transaction, ledger *Ledger) WalletStats {
+	stats := WalletStats{
+		Address:   address,
+		TxCount:   len(txs),
+		Tokens:    []string{},
+		Mints:     []string{},
+		OpenMints: []string{},
+		Sources:   []string{},
+		UpdatedAt: time.Now(),
+	}
+
+	solMint := sol.SolMint.String()
+	days := make(map[string]bool)
+	dayTokens := make(map[string]bool)
+	for i := range txs {
+		tx := &txs[i]
+		if tx.BlockTime.After(stats.LastActive) {
+			stats.LastActive = tx.BlockTime
+		}
+		if tx.Type != TxSwap || tx.Swap == nil || !tx.Success {
+			continue
+		}
+		stats.SwapCount++
+
+		day := tx.BlockTime.UTC().Format("2006-01-02")
+		days[day] = true
+		for _, mint := range []string{tx.Swap.InMint, tx.Swap.OutMint} {
+			if mint != solMint {
+				dayTokens[day+"/"+mint] = true
+			}
+		}
+	}
+	if len(days) > 0 {
+		stats.AvgTokensPerDay = float64(len(dayTokens)) / float64(len(days))
+	}
+
+	report := ledger.Report(address, nil, 0)
+	stats.Profit = report.RealizedSOL
+	stats.PnL = report.PnLPercent
+	stats.Trades = report.Trades
+	stats.WinRate = report.WinRate
+	stats.AvgHoldTime = report.AvgHoldTime
+	for _, token := range report.Tokens {
+		stats.Mints = append(stats.Mints, token.Mint)
+	}
+	stats.Tokens = append(stats.Tokens, stats.Mints...)
+	stats.OpenMints = append(stats.OpenMints, ledger.OpenMints()...)
+	return stats
+}
+
+func mergeStrings(a, b []string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			merged = append(merged, s)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// WalletQuery filters, sorts and paginates wallet stats. Nil bounds are
+// not applied.
+type WalletQuery struct {
+	Search          string
+	Token           string
+	MinWinRate      *float64
+	MinProfit       *float64
+	MaxProfit       *float64
+	MinPnL          *float64
+	MaxPnL          *float64
+	MinTx           *int
+	MaxTx           *int
+	MinTokensPerDay *float64
+	MaxTokensPerDay *float64
+	MinHoldTime     *float64
+	MaxHoldTime     *float64
+	ActiveFrom      time.Time
+	ActiveTo        time.Time
+	Sort            string
+	Desc            bool
+	Page            int
+	PageSize        int
+}
+
+// WalletStatsPage is a page of wallet stats
+type WalletStatsPage struct {
+	Wallets  []WalletStats `json:"wallets"`
+	Total    int           `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+}
+
+// walletSortKeys are the accepted WalletQuery.Sort values
+var walletSortKeys = map[string]func(a, b *WalletStats) bool{
+	"address":            func(a, b *WalletStats) bool { return a.Address < b.Address },
+	"profit":             func(a, b *WalletStats) bool { return a.Profit < b.Profit },
+	"pnl":                func(a, b *WalletStats) bool { return a.PnL < b.PnL },
+	"tx_count":           func(a, b *WalletStats) bool { return a.TxCount < b.TxCount },
+	"avg_tokens_per_day": func(a, b *WalletStats) bool { return a.AvgTokensPerDay < b.AvgTokensPerDay },
+	"avg_hold_time":      func(a, b *WalletStats) bool { return a.AvgHoldTime < b.AvgHoldTime },
+	"last_active":        func(a, b *WalletStats) bool { return a.LastActive.Before(b.LastActive) },
+	"winrate":            func(a, b *WalletStats) bool { return a.WinRate < b.WinRate },
+}
+
+// ValidWalletSort reports whether key can be used as WalletQuery.Sort
+func ValidWalletSort(key string) bool {
+	_, ok := walletSortKeys[key]
+	return ok
+}
+
+// Wallets returns stored wallet stats matching query
+func (d *DiscoveryService) Wallets(ctx context.Context, query WalletQuery) (*WalletStatsPage, error) {
+	keys, err := d.store.List(ctx, walletStatsPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wallets: %v", err)
+	}
+	all := make([]WalletStats, 0, len(keys))
+	for _, key := range keys {
+		data, err := d.store.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load wallet: %v", err)
+		}
+		var stats WalletStats
+		if err := json.Unmarshal(data, &stats); err != nil {
+			continue
+		}
+		all = append(all, stats)
+	}
+	return query.apply(all), nil
+}
+
+func (q WalletQuery) apply(wallets []WalletStats) *WalletStatsPage {
+	matched := make([]WalletStats, 0, len(wallets))
+	for _, w := range wallets {
+		if q.matches(&w) {
+			matched = append(matched, w)
+		}
+	}
+
+	less, ok := walletSortKeys[q.Sort]
+	if !ok {
+		less, q.Desc = walletSortKeys["profit"], true
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if q.Desc {
+			return less(&matched[j], &matched[i])
+		}
+		return less(&matched[i], &matched[j])
+	})
+
+	if q.PageSize <= 0 {
+		q.PageSize = 50
+	}
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	page := &WalletStatsPage{Total: len(matched), Page: q.Page, PageSize: q.PageSize, Wallets: []WalletStats{}}
+	start := (q.Page - 1) * q.PageSize
+	if start < len(matched) {
+		end := start + q.PageSize
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page.Wallets = matched[start:end]
+	}
+	return page
+}
+
+func (q WalletQuery) matches(w *WalletStats) bool {
+	if q.Search != "" && !strings.Contains(strings.ToLower(w.Address), strings.ToLower(q.Search)) {
+		return false
+	}
+	if q.Token != "" && !containsFold(w.Tokens, q.Token) && !containsFold(w.Mints, q.Token) {
+		return false
+	}
+	if !inRange(w.WinRate, q.MinWinRate, nil) ||
+		!inRange(w.Profit, q.MinProfit, q.MaxProfit) ||
+		!inRange(w.PnL, q.MinPnL, q.MaxPnL) ||
+		!inRange(w.AvgTokensPerDay, q.MinTokensPerDay, q.MaxTokensPerDay) ||
+		!inRange(w.AvgHoldTime, q.MinHoldTime, q.MaxHoldTime) {
+		return false
+	}
+	if (q.MinTx != nil && w.TxCount < *q.MinTx) || (q.MaxTx != nil && w.TxCount > *q.MaxTx) {
+		return false
+	}
+	if !q.ActiveFrom.IsZero() && w.LastActive.Before(q.ActiveFrom) {
+		return false
+	}
+	if !q.ActiveTo.IsZero() && w.LastActive.After(q.ActiveTo) {
+		return false
+	}
+	return true
+}
+
+func inRange(v float64, min, max *float64) bool {
+	return (min == nil || v >= *min) && (max == nil || v <= *max)
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package solana
+
+import (
+	"testing"
+	"time"
+)
+
+const testSOL = "So11111111111111111111111111111111111111112"
+
+func testSwap(at time.Time, inMint string, inAmount float64, outMint string, outAmount float64) Transaction {
+	return Transaction{
+		Type:      TxSwap,
+		Success:   true,
+		BlockTime: at,
+		Swap:      &Swap{InMint: inMint, InAmount: inAmount, OutMint: outMint, OutAmount: outAmount},
+	}
+}
+
+func TestComputeWalletStats(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	txs := []Transaction{
+		testSwap(start, testSOL, 10, "A", 1000),
+		testSwap(start.Add(time.Hour), testSOL, 5, "B", 50),
+		// Half of A sold two days later for a profit
+		testSwap(start.Add(2*day), "A", 500, testSOL, 8),
+		// All of B sold four days later at a loss
+		testSwap(start.Add(4*day+time.Hour), "B", 50, testSOL, 4),
+		{Type: TxTransfer, Success: true, BlockTime: start.Add(5 * day)},
+	}
+
+	ledger := NewLedger()
+	for i := range txs {
+		ledger.AddTransaction(&txs[i], 0)
+	}
+	stats := computeWalletStats("wallet", txs, ledger)
+	// Only the B round trip is closed
+	if stats.TxCount != 5 || stats.SwapCount != 4 || stats.Trades != 1 {
+		t.Fatalf("unexpected counts %+v", stats)
+	}
+	if stats.Profit != 2 {
+		t.Fatalf("profit = %v, want 2", stats.Profit)
+	}
+	if stats.PnL != 20 {
+		t.Fatalf("pnl = %v, want 20", stats.PnL)
+	}
+	if stats.WinRate != 0 {
+		t.Fatalf("winrate = %v, want 0", stats.WinRate)
+	}
+	// 500 A held 2 days and 50 B held 4 days, weighted by amount
+	if want := (500*2.0 + 50*4.0) / 550; stats.AvgHoldTime < want-1e-9 || stats.AvgHoldTime > want+1e-9 {
+		t.Fatalf("avg hold = %v, want %v", stats.AvgHoldTime, want)
+	}
+	// Day one traded A and B, the other two days one token each
+	if want := 4.0 / 3; stats.AvgTokensPerDay != want {
+		t.Fatalf("avg tokens/day = %v, want %v", stats.AvgTokensPerDay, want)
+	}
+	if !stats.LastActive.Equal(start.Add(5 * day)) {
+		t.Fatalf("last active = %v", stats.LastActive)
+	}
+	// A made 3 SOL and B lost 1
+	if len(stats.Mints) != 2 || stats.Mints[0] != "A" || stats.Mints[1] != "B" || len(stats.Tokens) != 2 {
+		t.Fatalf("traded mints = %v, want [A B]", stats.Mints)
+	}
+	if len(stats.OpenMints) != 1 || stats.OpenMints[0] != "A" {
+		t.Fatalf("open positions = %v, want [A]", stats.OpenMints)
+	}
+}
+
+func TestWalletQuery(t *testing.T) {
+	wallets := []WalletStats{
+		{Address: "aaa", Profit: 10, WinRate: 80, TxCount: 100, Tokens: []string{"BONK"}},
+		{Address: "bbb", Profit: 30, WinRate: 40, TxCount: 50},
+		{Address: "ccc", Profit: -5, WinRate: 90, TxCount: 10, Tokens: []string{"WIF"}},
+		{Address: "ddd", Profit: 20, WinRate: 70, TxCount: 300},
+	}
+
+	page := WalletQuery{}.apply(wallets)
+	if page.Total != 4 || page.Wallets[0].Address != "bbb" {
+		t.Fatalf("default order must be by profit descending, got %+v", page.Wallets)
+	}
+
+	minWin := 60.0
+	minProfit := 0.0
+	page = WalletQuery{MinWinRate: &minWin, MinProfit: &minProfit, Sort: "tx_count", PageSize: 1, Page: 2}.apply(wallets)
+	if page.Total != 2 || len(page.Wallets) != 1 || page.Wallets[0].Address != "ddd" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	page = WalletQuery{Token: "bonk"}.apply(wallets)
+	if page.Total != 1 || page.Wallets[0].Address != "aaa" {
+		t.Fatalf("token filter returned %+v", page.Wallets)
+	}
+}
@@ -0,0 +1,461 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/storage"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	// signaturePageSize is the maximum limit of getSignaturesForAddress
+	signaturePageSize = 1000
+	// DefaultTransactionLimit is the page size of Transactions
+	DefaultTransactionLimit = 50
+	// MaxBackfill caps the older transactions indexed by one Sync
+	MaxBackfill = 1000
+	// MaxCatchUp caps the new transactions indexed by one Sync, the next
+	// syncs continue the catch-up
+	MaxCatchUp = 1000
+	// SyncInterval is the minimum time between two syncs of an address,
+	// Sync returns the stored state when called again sooner
+	SyncInterval = 30 * time.Second
+)
+
+// TransactionFilter selects indexed transactions
+type TransactionFilter struct {
+	Type  TxType
+	Mint  string
+	Venue string
+	From  time.Time
+	To    time.Time
+	// Before is the signature of the last transaction of the previous page
+	Before string
+	Limit  int
+}
+
+// TransactionPage is a page of indexed transactions, newest first
+type TransactionPage struct {
+	Address      string        `json:"address"`
+	Transactions []Transaction `json:"transactions"`
+	// NextBefore is set when more transactions may match
+	NextBefore string     `json:"next_before,omitempty"`
+	Sync       *SyncState `json:"sync,omitempty"`
+}
+
+// SyncState is the persisted progress of indexing an address. History is
+// walked backwards from Newest, Oldest is where an interrupted backfill
+// resumes. A catch-up of new transactions walks from CatchUpNewest down to
+// Newest and resumes at CatchUpOldest.
+type SyncState struct {
+	Newest        string    `json:"newest,omitempty"`
+	Oldest        string    `json:"oldest,omitempty"`
+	CatchUpNewest string    `json:"catch_up_newest,omitempty"`
+	CatchUpOldest string    `json:"catch_up_oldest,omitempty"`
+	Complete      bool      `json:"complete"`
+	Indexed       int       `json:"indexed"`
+	SyncedAt      time.Time `json:"synced_at"`
+}
+
+// TransactionIndexer fetches the history of wallets, classifies each
+// transaction and stores it in normalized form
+type TransactionIndexer struct {
+	client *rpc.Client
+	store  storage.Store
+	tokens *TokenResolver
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewTransactionIndexer creates an indexer persisting to store
+func NewTransactionIndexer(client *rpc.Client, store storage.Store, tokens *TokenResolver) *TransactionIndexer {
+	return &TransactionIndexer{
+		client: client,
+		store:  store,
+		tokens: tokens,
+		locks:  make(map[string]*sync.Mutex),
+	}
+}
+
+func txPrefix(address string) string {
+	return "solana/txs/" + address + "/tx/"
+}
+
+func syncStateKey(address string) string {
+	return "solana/txs/" + address + "/state"
+}
+
+// txKey orders transactions by slot so List returns them chronologically
+func txKey(address string, tx *Transaction) string {
+	return fmt.Sprintf("%s%020d-%s", txPrefix(address), tx.Slot, tx.Signature)
+}
+
+// lock serializes syncs of the same address
+func (ix *TransactionIndexer) lock(address string) func() {
+	ix.mu.Lock()
+	l, ok := ix.locks[address]
+	if !ok {
+		l = &sync.Mutex{}
+		ix.locks[address] = l
+	}
+	ix.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// State returns the sync progress of address
+func (ix *TransactionIndexer) State(ctx context.Context, address string) (*SyncState, error) {
+	state := &SyncState{}
+	data, err := ix.store.Get(ctx, syncStateKey(address))
+	if errors.Is(err, storage.ErrNotFound) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync state: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to decode sync state: %v", err)
+	}
+	return state, nil
+}
+
+func (ix *TransactionIndexer) saveState(ctx context.Context, address string, state *SyncState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := ix.store.Put(ctx, syncStateKey(address), data); err != nil {
+		return fmt.Errorf("failed to save sync state: %v", err)
+	}
+	return nil
+}
+
+// Sync indexes up to MaxCatchUp transactions of address that are newer than
+// the last sync, then continues the backfill of older history by up to
+// backfill transactions, at most MaxBackfill. Progress is saved after every
+// page so an interrupted or capped sync resumes where it stopped. An
+// address synced less than SyncInterval ago is not synced again.
+func (ix *TransactionIndexer) Sync(ctx context.Context, address string, backfill int) (*SyncState, error) {
+	owner, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	address = owner.String()
+	defer ix.lock(address)()
+
+	state, err := ix.State(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(state.SyncedAt) < SyncInterval {
+		return state, nil
+	}
+	if backfill > MaxBackfill {
+		backfill = MaxBackfill
+	}
+
+	// New transactions since the last sync. Newest only moves once the gap
+	// is closed, otherwise an interruption would leave a hole.
+	if state.Newest != "" {
+		until, err := sol.SignatureFromBase58(state.Newest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored signature: %v", err)
+		}
+		var before sol.Signature
+		if state.CatchUpOldest != "" {
+			if before, err = sol.SignatureFromBase58(state.CatchUpOldest); err != nil {
+				return nil, fmt.Errorf("invalid stored signature: %v", err)
+			}
+		}
+		walked := 0
+		err = ix.walk(ctx, owner, before, until, MaxCatchUp, func(page []*rpc.TransactionSignature) error {
+			if state.CatchUpNewest == "" {
+				state.CatchUpNewest = page[0].Signature.String()
+			}
+			state.CatchUpOldest = page[len(page)-1].Signature.String()
+			state.Indexed += len(page)
+			walked += len(page)
+			return ix.saveState(ctx, address, state)
+		})
+		if err != nil {
+			return nil, err
+		}
+		// A short walk reached Newest
+		if walked < MaxCatchUp {
+			if state.CatchUpNewest != "" {
+				state.Newest = state.CatchUpNewest
+			}
+			state.CatchUpNewest, state.CatchUpOldest = "", ""
+		}
+	}
+
+	// Older history
+	if !state.Complete && backfill > 0 {
+		var before sol.Signature
+		if state.Oldest != "" {
+			if before, err = sol.SignatureFromBase58(state.Oldest); err != nil {
+				return nil, fmt.Errorf("invalid stored signature: %v", err)
+			}
+		}
+		walked := 0
+		err = ix.walk(ctx, owner, before, sol.Signature{}, backfill, func(page []*rpc.TransactionSignature) error {
+			if state.Newest == "" {
+				state.Newest = page[0].Signature.String()
+			}
+			state.Oldest = page[len(page)-1].Signature.String()
+			state.Indexed += len(page)
+			walked += len(page)
+			return ix.saveState(ctx, address, state)
+		})
+		if err != nil {
+			return nil, err
+		}
+		// A short walk means the beginning of the history was reached
+		if walked < backfill {
+			state.Complete = true
+		}
+	}
+
+	state.SyncedAt = time.Now()
+	if err := ix.saveState(ctx, address, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// walk pages through the signatures of owner from before back to until,
+// indexing at most max transactions (0 means no limit). onPage is called
+// after each page has been stored.
+func (ix *TransactionIndexer) walk(ctx context.Context, owner sol.PublicKey, before, until sol.Signature, max int,
+	onPage func([]*rpc.TransactionSignature) error) error {
+	address := owner.String()
+	total := 0
+	for max == 0 || total < max {
+		limit := signaturePageSize
+		if max > 0 && max-total < limit {
+			limit = max - total
+		}
+		page, err := ix.client.GetSignaturesForAddressWithOpts(ctx, owner, &rpc.GetSignaturesForAddressOpts{
+			Limit:      &limit,
+			Before:     before,
+			Until:      until,
+			Commitment: confirmedCommitmentFrom(ctx),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get signatures: %v", err)
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		for _, signature := range page {
+			tx, err := ix.fetch(ctx, address, signature.Signature)
+			if err != nil {
+				return err
+			}
+			if err := ix.put(ctx, address, tx); err != nil {
+				return err
+			}
+		}
+		if err := onPage(page); err != nil {
+			return err
+		}
+
+		total += len(page)
+		if len(page) < limit {
+			return nil
+		}
+		before = page[len(page)-1].Signature
+	}
+	return nil
+}
+
+// Index fetches, classifies and stores a single transaction of address.
+// The sync state is left alone, the next Sync picks the transaction up
+// again without duplicating it.
+func (ix *TransactionIndexer) Index(ctx context.Context, address string, signature sol.Signature) (*Transaction, error) {
+	tx, err := ix.fetch(ctx, address, signature)
+	if err != nil {
+		return nil, err
+	}
+	if err := ix.put(ctx, address, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (ix *TransactionIndexer) put(ctx context.Context, address string, tx *Transaction) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	if err := ix.store.Put(ctx, txKey(address, tx), data); err != nil {
+		return fmt.Errorf("failed to store transaction: %v", err)
+	}
+	return nil
+}
+
+// fetch loads a transaction and classifies it for address
+func (ix *TransactionIndexer) fetch(ctx context.Context, address string, signature sol.Signature) (*Transaction, error) {
+	tx, err := getParsedTransaction(ctx, ix.client, signature)
+	if err != nil {
+		return nil, err
+	}
+	return classifyTransaction(address, signature.String(), tx)
+}
+
+// getParsedTransaction loads a transaction in jsonParsed encoding.
+// solana-go's GetParsedTransaction cannot request versioned transactions,
+// so the call is made directly.
+func getParsedTransaction(ctx context.Context, client *rpc.Client, signature sol.Signature) (*parsedTransaction, error) {
+	var tx *parsedTransaction
+	err := client.RPCCallForInto(ctx, &tx, "getTransaction", []interface{}{
+		signature.String(),
+		rpc.M{
+			"encoding":                       sol.EncodingJSONParsed,
+			"commitment":                     confirmedCommitmentFrom(ctx),
+			"maxSupportedTransactionVersion": 0,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction %s: %v", signature, err)
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %s not found", signature)
+	}
+	return tx, nil
+}
+
+// History returns all indexed transactions of address, oldest first
+func (ix *TransactionIndexer) History(ctx context.Context, address string) ([]Transaction, error) {
+	keys, err := ix.store.List(ctx, txPrefix(address))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %v", err)
+	}
+	txs := make([]Transaction, 0, len(keys))
+	for _, key := range keys {
+		data, err := ix.store.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load transaction: %v", err)
+		}
+		var tx Transaction
+		if err := json.Unmarshal(data, &tx); err != nil {
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// Transactions returns indexed transactions of address matching filter,
+// newest first
+func (ix *TransactionIndexer) Transactions(ctx context.Context, address string, filter TransactionFilter) (*TransactionPage, error) {
+	owner, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	address = owner.String()
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultTransactionLimit
+	}
+
+	keys, err := ix.store.List(ctx, txPrefix(address))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %v", err)
+	}
+
+	end := len(keys)
+	if filter.Before != "" {
+		end = -1
+		for i, key := range keys {
+			if strings.HasSuffix(key, "-"+filter.Before) {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unknown transaction %s", filter.Before)
+		}
+	}
+
+	page := &TransactionPage{Address: address, Transactions: []Transaction{}}
+	for i := end - 1; i >= 0; i-- {
+		data, err := ix.store.Get(ctx, keys[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load transaction: %v", err)
+		}
+		var tx Transaction
+		if err := json.Unmarshal(data, &tx); err != nil {
+			continue
+		}
+		if !filter.From.IsZero() && tx.BlockTime.Before(filter.From) {
+			// Keys are ordered by slot, everything further is older
+			break
+		}
+		if !filter.matches(&tx) {
+			continue
+		}
+		if len(page.Transactions) == filter.Limit {
+			page.NextBefore = page.Transactions[len(page.Transactions)-1].Signature
+			break
+		}
+		page.Transactions = append(page.Transactions, tx)
+	}
+
+	ix.addSymbols(ctx, page.Transactions)
+	return page, nil
+}
+
+func (f TransactionFilter) matches(tx *Transaction) bool {
+	if f.Type != "" && tx.Type != f.Type {
+		return false
+	}
+	if f.Venue != "" && tx.Venue != f.Venue {
+		return false
+	}
+	if f.Mint != "" && !tx.HasMint(f.Mint) {
+		return false
+	}
+	if !f.To.IsZero() && tx.BlockTime.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// addSymbols fills in token symbols; transactions are still returned when
+// mints cannot be resolved
+func (ix *TransactionIndexer) addSymbols(ctx context.Context, txs []Transaction) {
+	var mints []string
+	seen := make(map[string]bool)
+	for _, tx := range txs {
+		for _, change := range tx.Changes {
+			if !seen[change.Mint] {
+				seen[change.Mint] = true
+				mints = append(mints, change.Mint)
+			}
+		}
+	}
+	if len(mints) == 0 {
+		return
+	}
+
+	infos, err := ix.tokens.mintInfos(ctx, mints)
+	if err != nil {
+		return
+	}
+	for i := range txs {
+		for j := range txs[i].Changes {
+			txs[i].Changes[j].Symbol = infos[txs[i].Changes[j].Mint].Symbol
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package solana
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-vue/pkg/storage"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestSyncCapsCatchUp(t *testing.T) {
+	// signature(0) is not the zero signature, which means no limit
+	signature := func(i int) string {
+		return sol.SignatureFromBytes(append([]byte{1, byte(i >> 8), byte(i)}, make([]byte, 61)...)).String()
+	}
+	stub := &stubRPC{signatures: []string{signature(0)}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := NewTransactionIndexer(rpc.New(server.URL), store, nil)
+	ctx := context.Background()
+	sync := func() *SyncState {
+		t.Helper()
+		// Skip the SyncInterval of the previous sync
+		state, err := indexer.State(ctx, testWallet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.SyncedAt = time.Time{}
+		if err := indexer.saveState(ctx, testWallet, state); err != nil {
+			t.Fatal(err)
+		}
+		if state, err = indexer.Sync(ctx, testWallet, 10); err != nil {
+			t.Fatal(err)
+		}
+		return state
+	}
+	if state := sync(); state.Newest != signature(0) || !state.Complete {
+		t.Fatalf("unexpected first sync %+v", state)
+	}
+
+	stub.mu.Lock()
+	for i := 1; i <= MaxCatchUp+1; i++ {
+		stub.signatures = append(stub.signatures, signature(i))
+	}
+	stub.mu.Unlock()
+
+	// The capped catch-up keeps Newest until the gap is closed
+	state := sync()
+	if state.Newest != signature(0) || state.CatchUpNewest != signature(MaxCatchUp+1) ||
+		state.CatchUpOldest != signature(2) || state.Indexed != MaxCatchUp+1 {
+		t.Fatalf("unexpected capped sync %+v", state)
+	}
+	state = sync()
+	if state.Newest != signature(MaxCatchUp+1) || state.CatchUpNewest != "" || state.CatchUpOldest != "" ||
+		state.Indexed != MaxCatchUp+2 {
+		t.Fatalf("unexpected resumed sync %+v", state)
+	}
+}
@@ -0,0 +1,86 @@
+package solana
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// metaplexMetadataKey is the account key of Metaplex metadata v1 accounts
+const metaplexMetadataKey = 4
+
+// metaplexMetadata is the on-chain part of a Metaplex token metadata
+// account
+type metaplexMetadata struct {
+	Mint   string
+	Name   string
+	Symbol string
+	URI    string
+}
+
+// parseMetaplexMetadata decodes the borsh encoded header of a metadata
+// account: key, update authority, mint, then name, symbol and uri as
+// length prefixed strings padded with zero bytes.
+func parseMetaplexMetadata(data []byte) (*metaplexMetadata, error) {
+	if len(data) < 65 || data[0] != metaplexMetadataKey {
+		return nil, fmt.Errorf("not a metadata account")
+	}
+	metadata := &metaplexMetadata{Mint: sol.PublicKeyFromBytes(data[33:65]).String()}
+	offset := 65
+	for _, field := range []*string{&metadata.Name, &metadata.Symbol, &metadata.URI} {
+		if len(data) < offset+4 {
+			return nil, fmt.Errorf("metadata account truncated")
+		}
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		offset += 4
+		if length > len(data)-offset {
+			return nil, fmt.Errorf("metadata string length %d out of range", length)
+		}
+		*field = strings.TrimSpace(strings.TrimRight(string(data[offset:offset+length]), "\x00"))
+		offset += length
+	}
+	return metadata, nil
+}
+
+// metaplexMetadataFor loads the Metaplex metadata of mints, skipping mints
+// without a metadata account
+func metaplexMetadataFor(ctx context.Context, client *rpc.Client, mints []sol.PublicKey) (map[string]*metaplexMetadata, error) {
+	result := make(map[string]*metaplexMetadata, len(mints))
+	for start := 0; start < len(mints); start += rpcBatchSize {
+		end := start + rpcBatchSize
+		if end > len(mints) {
+			end = len(mints)
+		}
+		addresses := make([]sol.PublicKey, 0, end-start)
+		for _, mint := range mints[start:end] {
+			address, _, err := sol.FindTokenMetadataAddress(mint)
+			if err != nil {
+				return nil, fmt.Errorf("failed to derive metadata address of %s: %v", mint, err)
+			}
+			addresses = append(addresses, address)
+		}
+
+		accounts, err := client.GetMultipleAccountsWithOpts(ctx, addresses, &rpc.GetMultipleAccountsOpts{
+			Encoding:   sol.EncodingBase64,
+			Commitment: commitmentFrom(ctx),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metadata accounts: %v", err)
+		}
+		for i, account := range accounts.Value {
+			if account == nil || account.Data == nil || !account.Owner.Equals(sol.TokenMetadataProgramID) {
+				continue
+			}
+			metadata, err := parseMetaplexMetadata(account.Data.GetBinary())
+			if err != nil || metadata.Mint != mints[start+i].String() {
+				continue
+			}
+			result[metadata.Mint] = metadata
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,676 @@
+package solana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go-vue/pkg/events"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// Topics published by the Monitor
+const (
+	TopicBalanceChanged     = "solana.balance.changed"
+	TopicTransactionNew     = "solana.transaction.new"
+	TopicSignatureConfirmed = "solana.signature.confirmed"
+	TopicMonitorStatus      = "solana.monitor.status"
+)
+
+// Monitor modes
+const (
+	ModeStopped   = "stopped"
+	ModeWebsocket = "websocket"
+	ModePolling   = "polling"
+)
+
+const (
+	defaultPollInterval = 15 * time.Second
+	minReconnectDelay   = time.Second
+	maxReconnectDelay   = time.Minute
+	// stableConnection is how long a connection must last to reset the
+	// reconnect backoff
+	stableConnection = time.Minute
+	// recentSignatures is how many signatures per wallet are remembered to
+	// drop duplicate notifications
+	recentSignatures = 256
+	// pendingTransactions is how many new transactions wait to be indexed
+	// before their events are published without the transaction
+	pendingTransactions = 1024
+	// indexTimeout bounds the indexing of one transaction
+	indexTimeout = 30 * time.Second
+	// backfillTimeout bounds the history backfill of one watched wallet
+	backfillTimeout = 5 * time.Minute
+)
+
+// BalanceEvent is published when the SOL balance of a watched wallet changes
+type BalanceEvent struct {
+	Address          string  `json:"address"`
+	Lamports         uint64  `json:"lamports"`
+	PreviousLamports uint64  `json:"previous_lamports"`
+	SOL              float64 `json:"sol"`
+	ChangeSOL        float64 `json:"change_sol"`
+	Slot             uint64  `json:"slot"`
+	Source           string  `json:"source"`
+}
+
+// TransactionEvent is published for every new transaction of a watched
+// wallet. Transaction is nil when it could not be fetched.
+type TransactionEvent struct {
+	Address     string       `json:"address"`
+	Signature   string       `json:"signature"`
+	Slot        uint64       `json:"slot"`
+	Success     bool         `json:"success"`
+	Source      string       `json:"source"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+}
+
+// pendingTransaction is a new transaction waiting to be indexed with the
+// context of the loop that found it, for its commitment
+type pendingTransaction struct {
+	ctx   context.Context
+	event TransactionEvent
+}
+
+// SignatureEvent is published when an awaited signature is confirmed
+type SignatureEvent struct {
+	Signature string `json:"signature"`
+	Slot      uint64 `json:"slot"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+// MonitorStatus describes the state of the Monitor
+type MonitorStatus struct {
+	Mode       string    `json:"mode"`
+	Watched    []string  `json:"watched"`
+	Connected  time.Time `json:"connected,omitempty"`
+	Reconnects int       `json:"reconnects"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+type watchState struct {
+	lamports uint64
+	known    bool
+	// newest is the newest signature seen, polling continues from it
+	newest string
+	recent []string
+}
+
+// seen records signature and reports whether it was already handled
+func (w *watchState) seen(signature string) bool {
+	for _, s := range w.recent {
+		if s == signature {
+			return true
+		}
+	}
+	w.recent = append(w.recent, signature)
+	if len(w.recent) > recentSignatures {
+		w.recent = w.recent[1:]
+	}
+	return false
+}
+
+// Monitor follows a watchlist of wallets in real time. It subscribes to
+// account and log notifications over the RPC websocket, reconnects with
+// backoff when the connection drops and polls the HTTP endpoint while the
+// websocket is unavailable.
+type Monitor struct {
+	wsEndpoint   string
+	client       *rpc.Client
+	indexer      *TransactionIndexer
+	bus          *events.Bus
+	pollInterval time.Duration
+	// pageSize is the number of signatures read per request while polling
+	pageSize int
+	// pending holds the new transactions waiting to be indexed, in order
+	pending chan pendingTransaction
+
+	// backfillMu runs one history backfill at a time
+	backfillMu sync.Mutex
+
+	mu      sync.Mutex
+	watched map[string]*watchState
+	ws      *ws.Client
+	status  MonitorStatus
+	changed chan struct{}
+}
+
+// NewMonitor creates a monitor. Without wsEndpoint it only polls.
+func NewMonitor(wsEndpoint string, client *rpc.Client, indexer *TransactionIndexer, bus *events.Bus) *Monitor {
+	m := &Monitor{
+		wsEndpoint:   wsEndpoint,
+		client:       client,
+		indexer:      indexer,
+		bus:          bus,
+		pollInterval: defaultPollInterval,
+		pageSize:     signaturePageSize,
+		pending:      make(chan pendingTransaction, pendingTransactions),
+		watched:      make(map[string]*watchState),
+		status:       MonitorStatus{Mode: ModeStopped},
+		changed:      make(chan struct{}, 1),
+	}
+	go m.indexPending()
+	return m
+}
+
+// Watch adds address to the watchlist
+func (m *Monitor) Watch(address string) error {
+	key, err := ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if _, ok := m.watched[key.String()]; !ok {
+		m.watched[key.String()] = &watchState{}
+	}
+	m.mu.Unlock()
+	m.notifyChanged()
+	return nil
+}
+
+// Unwatch removes address from the watchlist
+func (m *Monitor) Unwatch(address string) error {
+	key, err := ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.watched, key.String())
+	m.mu.Unlock()
+	m.notifyChanged()
+	return nil
+}
+
+// Backfill indexes the older history of address in the background, so
+// the PnL and win rate of a newly watched wallet do not start from zero.
+// The backfill outlives ctx but keeps its values.
+func (m *Monitor) Backfill(ctx context.Context, address string) {
+	if m.indexer == nil {
+		return
+	}
+	base := context.WithoutCancel(ctx)
+	go func() {
+		m.backfillMu.Lock()
+		defer m.backfillMu.Unlock()
+		ctx, cancel := context.WithTimeout(base, backfillTimeout)
+		defer cancel()
+		if _, err := m.indexer.Sync(ctx, address, MaxBackfill); err != nil {
+			log.Printf("Failed to backfill the history of %s: %v", address, err)
+		}
+	}()
+}
+
+func (m *Monitor) notifyChanged() {
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Watched returns the watched addresses
+func (m *Monitor) Watched() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.watchedLocked()
+}
+
+func (m *Monitor) watchedLocked() []string {
+	addresses := make([]string, 0, len(m.watched))
+	for address := range m.watched {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// Status returns the current mode and watchlist
+func (m *Monitor) Status() MonitorStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := m.status
+	status.Watched = m.watchedLocked()
+	return status
+}
+
+func (m *Monitor) setMode(mode string, err error) {
+	m.mu.Lock()
+	changed := m.status.Mode != mode
+	m.status.Mode = mode
+	if mode == ModeWebsocket {
+		m.status.Connected = time.Now()
+	}
+	if err != nil {
+		m.status.LastError = err.Error()
+	}
+	status := m.status
+	status.Watched = m.watchedLocked()
+	m.mu.Unlock()
+
+	if changed {
+		m.bus.Publish(TopicMonitorStatus, status)
+	}
+}
+
+// Run follows the watchlist until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	defer m.setMode(ModeStopped, nil)
+	if m.wsEndpoint == "" {
+		m.setMode(ModePolling, nil)
+		m.pollUntil(ctx, nil)
+		return
+	}
+
+	delay := minReconnectDelay
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := m.runWebsocket(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > stableConnection {
+			delay = minReconnectDelay
+		}
+		log.Printf("Solana websocket disconnected, polling for %s: %v", delay, err)
+		m.setMode(ModePolling, err)
+		m.mu.Lock()
+		m.status.Reconnects++
+		m.mu.Unlock()
+
+		// Poll while waiting to reconnect so no activity is missed
+		m.pollUntil(ctx, time.After(delay))
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// pollUntil polls the watchlist until ctx is done or stop fires
+func (m *Monitor) pollUntil(ctx context.Context, stop <-chan time.Time) {
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+	for {
+		m.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-m.changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// walletSubscription is the pair of websocket subscriptions of one wallet
+type walletSubscription struct {
+	account *ws.AccountSubscription
+	logs    *ws.LogSubscription
+}
+
+func (s *walletSubscription) unsubscribe() {
+	s.account.Unsubscribe()
+	s.logs.Unsubscribe()
+}
+
+// runWebsocket subscribes to the watchlist and returns when the connection
+// fails
+func (m *Monitor) runWebsocket(ctx context.Context) error {
+	client, err := ws.Connect(ctx, m.wsEndpoint)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.ws = client
+	m.mu.Unlock()
+
+	subs := make(map[string]*walletSubscription)
+	defer func() {
+		m.mu.Lock()
+		m.ws = nil
+		m.mu.Unlock()
+		for _, sub := range subs {
+			sub.unsubscribe()
+		}
+		client.Close()
+	}()
+
+	failed := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	}
+
+	resubscribe := func() error {
+		watched := make(map[string]bool)
+		for _, address := range m.Watched() {
+			watched[address] = true
+			if _, ok := subs[address]; ok {
+				continue
+			}
+			sub, err := m.subscribe(ctx, client, address, fail)
+			if err != nil {
+				return err
+			}
+			subs[address] = sub
+		}
+		for address, sub := range subs {
+			if !watched[address] {
+				sub.unsubscribe()
+				delete(subs, address)
+			}
+		}
+		return nil
+	}
+
+	if err := resubscribe(); err != nil {
+		return err
+	}
+	m.setMode(ModeWebsocket, nil)
+	// Catch up on anything that happened while disconnected
+	m.poll(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-failed:
+			return err
+		case <-m.changed:
+			if err := resubscribe(); err != nil {
+				return err
+			}
+			m.poll(ctx)
+		}
+	}
+}
+
+// subscribe starts account and log subscriptions for address. Receive
+// errors are reported through fail.
+func (m *Monitor) subscribe(ctx context.Context, client *ws.Client, address string, fail func(error)) (*walletSubscription, error) {
+	key := sol.MustPublicKeyFromBase58(address)
+	account, err := client.AccountSubscribe(key, rpc.CommitmentConfirmed)
+	if err != nil {
+		return nil, fmt.Errorf("accountSubscribe %s: %v", address, err)
+	}
+	logs, err := client.LogsSubscribeMentions(key, rpc.CommitmentConfirmed)
+	if err != nil {
+		account.Unsubscribe()
+		return nil, fmt.Errorf("logsSubscribe %s: %v", address, err)
+	}
+
+	go func() {
+		for {
+			result, err := account.Recv()
+			if err != nil {
+				fail(err)
+				return
+			}
+			// Unsubscribe delivers a nil result without an error
+			if result == nil {
+				return
+			}
+			m.handleBalance(address, result.Value.Lamports, result.Context.Slot, ModeWebsocket)
+		}
+	}()
+	go func() {
+		for {
+			result, err := logs.Recv()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if result == nil {
+				return
+			}
+			m.handleSignature(ctx, address, result.Value.Signature,
+				result.Context.Slot, result.Value.Err == nil, ModeWebsocket)
+		}
+	}()
+	return &walletSubscription{account: account, logs: logs}, nil
+}
+
+// poll checks balances and new signatures of every watched wallet
+func (m *Monitor) poll(ctx context.Context) {
+	for _, address := range m.Watched() {
+		if err := m.pollWallet(ctx, address); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to poll Solana wallet %s: %v", address, err)
+		}
+	}
+}
+
+func (m *Monitor) pollWallet(ctx context.Context, address string) error {
+	key, err := ParseAddress(address)
+	if err != nil {
+		return err
+	}
+	balance, err := m.client.GetBalance(ctx, key, commitmentFrom(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to get balance: %v", err)
+	}
+	m.handleBalance(address, balance.Value, balance.Context.Slot, ModePolling)
+
+	m.mu.Lock()
+	state, ok := m.watched[address]
+	var newest string
+	if ok {
+		newest = state.newest
+	}
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var until sol.Signature
+	if newest != "" {
+		if until, err = sol.SignatureFromBase58(newest); err != nil {
+			return err
+		}
+	}
+	signatures, err := m.signaturesSince(ctx, key, until)
+	if err != nil {
+		return err
+	}
+	if newest == "" {
+		// The first poll only sets the starting point, history is the
+		// indexer's job
+		if len(signatures) > 0 {
+			m.mu.Lock()
+			state.newest = signatures[0].Signature.String()
+			for i := len(signatures) - 1; i >= 0; i-- {
+				state.seen(signatures[i].Signature.String())
+			}
+			m.mu.Unlock()
+		}
+		return nil
+	}
+
+	// Oldest first so events are published in order
+	for i := len(signatures) - 1; i >= 0; i-- {
+		s := signatures[i]
+		m.handleSignature(ctx, address, s.Signature, s.Slot, s.Err == nil, ModePolling)
+	}
+	return nil
+}
+
+// signaturesSince returns the signatures of key newer than until, newest
+// first, paging back until it is reached. Without until only the latest
+// page is read.
+func (m *Monitor) signaturesSince(ctx context.Context, key sol.PublicKey, until sol.Signature) ([]*rpc.TransactionSignature, error) {
+	var signatures []*rpc.TransactionSignature
+	var before sol.Signature
+	for {
+		limit := m.pageSize
+		page, err := m.client.GetSignaturesForAddressWithOpts(ctx, key, &rpc.GetSignaturesForAddressOpts{
+			Limit:      &limit,
+			Before:     before,
+			Until:      until,
+			Commitment: confirmedCommitmentFrom(ctx),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get signatures: %v", err)
+		}
+		signatures = append(signatures, page...)
+		if len(page) < limit || until.IsZero() {
+			return signatures, nil
+		}
+		before = page[len(page)-1].Signature
+	}
+}
+
+func (m *Monitor) handleBalance(address string, lamports, slot uint64, source string) {
+	m.mu.Lock()
+	state, ok := m.watched[address]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	previous, known := state.lamports, state.known
+	state.lamports, state.known = lamports, true
+	m.mu.Unlock()
+
+	if !known || previous == lamports {
+		return
+	}
+	m.bus.Publish(TopicBalanceChanged, BalanceEvent{
+		Address:          address,
+		Lamports:         lamports,
+		PreviousLamports: previous,
+		SOL:              lamportsToSOL(lamports),
+		ChangeSOL:        lamportsToSOL(lamports) - lamportsToSOL(previous),
+		Slot:             slot,
+		Source:           source,
+	})
+}
+
+func (m *Monitor) handleSignature(ctx context.Context, address string, signature sol.Signature, slot uint64, success bool, source string) {
+	m.mu.Lock()
+	state, ok := m.watched[address]
+	if !ok || state.seen(signature.String()) {
+		m.mu.Unlock()
+		return
+	}
+	state.newest = signature.String()
+	m.mu.Unlock()
+
+	event := TransactionEvent{
+		Address:   address,
+		Signature: signature.String(),
+		Slot:      slot,
+		Success:   success,
+		Source:    source,
+	}
+	if m.indexer == nil {
+		m.bus.Publish(TopicTransactionNew, event)
+		return
+	}
+	// Indexing fetches the transaction, it runs apart from the websocket
+	// and polling loops
+	select {
+	case m.pending <- pendingTransaction{ctx: context.WithoutCancel(ctx), event: event}:
+	default:
+		log.Printf("Too many transactions waiting to be indexed, publishing %s without it", signature)
+		m.bus.Publish(TopicTransactionNew, event)
+	}
+}
+
+// indexPending indexes the new transactions in order and publishes their
+// events
+func (m *Monitor) indexPending() {
+	for pending := range m.pending {
+		event := pending.event
+		ctx, cancel := context.WithTimeout(pending.ctx, indexTimeout)
+		tx, err := m.indexer.Index(ctx, event.Address, sol.MustSignatureFromBase58(event.Signature))
+		cancel()
+		if err != nil {
+			log.Printf("Failed to index transaction %s: %v", event.Signature, err)
+		} else {
+			event.Transaction = tx
+		}
+		m.bus.Publish(TopicTransactionNew, event)
+	}
+}
+
+// AwaitSignature waits until signature is confirmed and publishes a
+// SignatureEvent. The websocket is used when connected, otherwise the
+// signature status is polled.
+func (m *Monitor) AwaitSignature(ctx context.Context, sig string) (*SignatureEvent, error) {
+	signature, err := sol.SignatureFromBase58(sig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature %q: %v", sig, err)
+	}
+	m.mu.Lock()
+	client := m.ws
+	m.mu.Unlock()
+
+	var event *SignatureEvent
+	if client != nil {
+		event, err = m.awaitSignatureWS(ctx, client, signature)
+	}
+	if client == nil || (err != nil && ctx.Err() == nil) {
+		event, err = m.awaitSignaturePoll(ctx, signature)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.bus.Publish(TopicSignatureConfirmed, *event)
+	return event, nil
+}
+
+func (m *Monitor) awaitSignatureWS(ctx context.Context, client *ws.Client, signature sol.Signature) (*SignatureEvent, error) {
+	sub, err := client.SignatureSubscribe(signature, rpc.CommitmentConfirmed)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case err := <-sub.Err():
+		if err == nil {
+			err = errors.New("signature subscription closed")
+		}
+		return nil, err
+	case result := <-sub.Response():
+		return signatureEvent(signature, result.Context.Slot, result.Value.Err), nil
+	}
+}
+
+func (m *Monitor) awaitSignaturePoll(ctx context.Context, signature sol.Signature) (*SignatureEvent, error) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		statuses, err := m.client.GetSignatureStatuses(ctx, true, signature)
+		if err == nil && len(statuses.Value) == 1 && statuses.Value[0] != nil {
+			status := statuses.Value[0]
+			if status.ConfirmationStatus == rpc.ConfirmationStatusConfirmed ||
+				status.ConfirmationStatus == rpc.ConfirmationStatusFinalized {
+				return signatureEvent(signature, status.Slot, status.Err), nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func signatureEvent(signature sol.Signature, slot uint64, txErr interface{}) *SignatureEvent {
+	event := &SignatureEvent{Signature: signature.String(), Slot: slot, Success: txErr == nil}
+	if txErr != nil {
+		event.Error = fmt.Sprint(txErr)
+	}
+	return event
+}
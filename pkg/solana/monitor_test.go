@@ -0,0 +1,197 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-vue/pkg/events"
+	"go-vue/pkg/storage"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// stubRPC answers getBalance, getSignaturesForAddress and getTransaction
+// from the current balance and signature list
+type stubRPC struct {
+	mu         sync.Mutex
+	lamports   uint64
+	signatures []string
+}
+
+func (s *stubRPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result interface{}
+	switch req.Method {
+	case "getBalance":
+		result = map[string]interface{}{"context": map[string]uint64{"slot": 1}, "value": s.lamports}
+	case "getSignaturesForAddress":
+		var opts struct {
+			Until  string `json:"until"`
+			Before string `json:"before"`
+			Limit  int    `json:"limit"`
+		}
+		if len(req.Params) > 1 {
+			json.Unmarshal(req.Params[1], &opts)
+		}
+		list := []map[string]interface{}{}
+		i := len(s.signatures) - 1
+		for opts.Before != "" && i >= 0 && s.signatures[i] != opts.Before {
+			i--
+		}
+		if opts.Before != "" {
+			i--
+		}
+		for ; i >= 0 && s.signatures[i] != opts.Until && (opts.Limit == 0 || len(list) < opts.Limit); i-- {
+			list = append(list, map[string]interface{}{"signature": s.signatures[i], "slot": 10 + i, "err": nil})
+		}
+		result = list
+	case "getTransaction":
+		result = map[string]interface{}{
+			"slot": 10,
+			"transaction": map[string]interface{}{"message": map[string]interface{}{
+				"accountKeys":  []map[string]interface{}{{"pubkey": testWallet, "signer": true}},
+				"instructions": []interface{}{},
+			}},
+			"meta": map[string]interface{}{"err": nil, "fee": 5000, "preBalances": []uint64{0}, "postBalances": []uint64{0}},
+		}
+	default:
+		http.Error(w, "unexpected method "+req.Method, http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+func testSignature(b byte) string {
+	return sol.SignatureFromBytes(append([]byte{b}, make([]byte, 63)...)).String()
+}
+
+func TestMonitorPolling(t *testing.T) {
+	stub := &stubRPC{lamports: 1000, signatures: []string{testSignature(1)}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.New(server.URL)
+	bus := events.NewBus()
+	received, unsubscribe := bus.Subscribe(16, "solana")
+	defer unsubscribe()
+
+	wallet := sol.PublicKeyFromBytes(make([]byte, 32)).String()
+	monitor := NewMonitor("", client, NewTransactionIndexer(client, store, nil), bus)
+	if err := monitor.Watch(wallet); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first poll only records the starting point
+	ctx := context.Background()
+	monitor.poll(ctx)
+	select {
+	case event := <-received:
+		t.Fatalf("unexpected event %+v", event)
+	default:
+	}
+
+	stub.mu.Lock()
+	stub.lamports = 3000
+	stub.signatures = append(stub.signatures, testSignature(2))
+	stub.mu.Unlock()
+	monitor.poll(ctx)
+	// The same signature arriving again, for example over the websocket,
+	// is dropped
+	monitor.handleSignature(ctx, wallet, sol.MustSignatureFromBase58(testSignature(2)), 11, true, ModeWebsocket)
+
+	var topics []string
+	timeout := time.After(time.Second)
+	for len(topics) < 2 {
+		select {
+		case event := <-received:
+			topics = append(topics, event.Topic)
+			switch data := event.Data.(type) {
+			case BalanceEvent:
+				if data.PreviousLamports != 1000 || data.Lamports != 3000 {
+					t.Fatalf("unexpected balance event %+v", data)
+				}
+			case TransactionEvent:
+				if data.Signature != testSignature(2) || data.Transaction == nil {
+					t.Fatalf("unexpected transaction event %+v", data)
+				}
+			}
+		case <-timeout:
+			t.Fatalf("got events %v, want balance and transaction", topics)
+		}
+	}
+	select {
+	case event := <-received:
+		t.Fatalf("unexpected extra event %s", event.Topic)
+	default:
+	}
+	if fmt.Sprint(topics) != fmt.Sprint([]string{TopicBalanceChanged, TopicTransactionNew}) {
+		t.Fatalf("got topics %v", topics)
+	}
+}
+
+func TestMonitorPollingBurst(t *testing.T) {
+	stub := &stubRPC{lamports: 1000, signatures: []string{testSignature(1)}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.New(server.URL)
+	bus := events.NewBus()
+	received, unsubscribe := bus.Subscribe(16, TopicTransactionNew)
+	defer unsubscribe()
+
+	wallet := sol.PublicKeyFromBytes(make([]byte, 32)).String()
+	monitor := NewMonitor("", client, NewTransactionIndexer(client, store, nil), bus)
+	monitor.pageSize = 2
+	if err := monitor.Watch(wallet); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	monitor.poll(ctx)
+
+	// More new transactions than fit in a page are all published, oldest
+	// first
+	stub.mu.Lock()
+	for b := byte(2); b <= 6; b++ {
+		stub.signatures = append(stub.signatures, testSignature(b))
+	}
+	stub.mu.Unlock()
+	monitor.poll(ctx)
+
+	timeout := time.After(time.Second)
+	for b := byte(2); b <= 6; b++ {
+		select {
+		case event := <-received:
+			if data := event.Data.(TransactionEvent); data.Signature != testSignature(b) {
+				t.Fatalf("expected transaction %d, got %s", b, data.Signature)
+			}
+		case <-timeout:
+			t.Fatalf("missing transaction %d", b)
+		}
+	}
+}
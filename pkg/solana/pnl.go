@@ -0,0 +1,505 @@
+package solana
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	sol "github.com/gagliardetto/solana-go"
+)
+
+// dustAmount is the remaining token amount treated as a closed position
+const dustAmount = 1e-9
+
+// quoteMints are the assets positions are valued in. Swaps between two
+// quote assets do not open a position.
+var quoteMints = map[string]bool{
+	sol.SolMint.String():                           true,
+	"EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v": true, // USDC
+	"Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB": true, // USDT
+}
+
+// Lot is a buy of a token, priced at transaction time
+type Lot struct {
+	Mint       string    `json:"mint"`
+	Signature  string    `json:"signature"`
+	Amount     float64   `json:"amount"`
+	Remaining  float64   `json:"remaining"`
+	CostSOL    float64   `json:"cost_sol"`
+	CostUSD    float64   `json:"cost_usd"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// RoundTrip is a position in a token from the first buy until it is fully
+// sold again. A round trip still holding tokens is open.
+type RoundTrip struct {
+	Mint        string    `json:"mint"`
+	OpenedAt    time.Time `json:"opened_at"`
+	ClosedAt    time.Time `json:"closed_at,omitempty"`
+	Open        bool      `json:"open"`
+	Bought      float64   `json:"bought"`
+	Sold        float64   `json:"sold"`
+	CostSOL     float64   `json:"cost_sol"`
+	CostUSD     float64   `json:"cost_usd"`
+	ProceedsSOL float64   `json:"proceeds_sol"`
+	ProceedsUSD float64   `json:"proceeds_usd"`
+	RealizedSOL float64   `json:"realized_sol"`
+	RealizedUSD float64   `json:"realized_usd"`
+	// HoldTime is the amount weighted hold time of sold tokens in days
+	HoldTime float64 `json:"hold_time"`
+	Win      bool    `json:"win"`
+
+	holdSeconds float64
+}
+
+// TokenPnL is the profit and loss of a wallet in one token
+type TokenPnL struct {
+	Mint     string  `json:"mint"`
+	Symbol   string  `json:"symbol,omitempty"`
+	Bought   float64 `json:"bought"`
+	Sold     float64 `json:"sold"`
+	Holding  float64 `json:"holding"`
+	PriceUSD float64 `json:"price_usd"`
+
+	// Cost and proceeds of sold amounts
+	SoldCostSOL float64 `json:"sold_cost_sol"`
+	SoldCostUSD float64 `json:"sold_cost_usd"`
+	ProceedsSOL float64 `json:"proceeds_sol"`
+	ProceedsUSD float64 `json:"proceeds_usd"`
+	RealizedSOL float64 `json:"realized_sol"`
+	RealizedUSD float64 `json:"realized_usd"`
+
+	// Cost and current value of the remaining lots
+	OpenCostSOL   float64 `json:"open_cost_sol"`
+	OpenCostUSD   float64 `json:"open_cost_usd"`
+	ValueSOL      float64 `json:"value_sol"`
+	ValueUSD      float64 `json:"value_usd"`
+	UnrealizedSOL float64 `json:"unrealized_sol"`
+	UnrealizedUSD float64 `json:"unrealized_usd"`
+
+	// Sold amounts without a known buy, for example tokens received by
+	// transfer or airdrop, have no cost basis and are excluded
+	UnmatchedSold float64 `json:"unmatched_sold"`
+
+	Trades      int     `json:"trades"`
+	Wins        int     `json:"wins"`
+	WinRate     float64 `json:"winrate"`
+	AvgHoldTime float64 `json:"avg_hold_time"`
+	Lots        []Lot   `json:"lots"`
+
+	holdSeconds float64
+	holdWeight  float64
+}
+
+// PnLReport is the profit and loss of a wallet across all traded tokens
+type PnLReport struct {
+	Wallet        string      `json:"wallet"`
+	RealizedSOL   float64     `json:"realized_sol"`
+	RealizedUSD   float64     `json:"realized_usd"`
+	UnrealizedSOL float64     `json:"unrealized_sol"`
+	UnrealizedUSD float64     `json:"unrealized_usd"`
+	SoldCostSOL   float64     `json:"sold_cost_sol"`
+	SoldCostUSD   float64     `json:"sold_cost_usd"`
+	PnLPercent    float64     `json:"pnl_percent"`
+	Trades        int         `json:"trades"`
+	Wins          int         `json:"wins"`
+	WinRate       float64     `json:"winrate"`
+	AvgHoldTime   float64     `json:"avg_hold_time"`
+	Tokens        []TokenPnL  `json:"tokens"`
+	RoundTrips    []RoundTrip `json:"round_trips"`
+	// MissingPrices counts swaps that could not be valued in USD
+	MissingPrices int       `json:"missing_prices"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Ledger turns swaps into lots and matches sells first in, first out
+type Ledger struct {
+	tokens  map[string]*TokenPnL
+	trips   map[string]*RoundTrip
+	closed  []RoundTrip
+	missing int
+}
+
+// NewLedger creates an empty ledger
+func NewLedger() *Ledger {
+	return &Ledger{
+		tokens: make(map[string]*TokenPnL),
+		trips:  make(map[string]*RoundTrip),
+	}
+}
+
+func (l *Ledger) token(mint string) *TokenPnL {
+	t, ok := l.tokens[mint]
+	if !ok {
+		t = &TokenPnL{Mint: mint, Lots: []Lot{}}
+		l.tokens[mint] = t
+	}
+	return t
+}
+
+// Buy opens a lot of mint
+func (l *Ledger) Buy(mint, signature string, amount, costSOL, costUSD float64, at time.Time) {
+	if amount <= 0 {
+		return
+	}
+	t := l.token(mint)
+	t.Bought += amount
+	t.Lots = append(t.Lots, Lot{
+		Mint:       mint,
+		Signature:  signature,
+		Amount:     amount,
+		Remaining:  amount,
+		CostSOL:    costSOL,
+		CostUSD:    costUSD,
+		AcquiredAt: at,
+	})
+
+	trip, ok := l.trips[mint]
+	if !ok {
+		trip = &RoundTrip{Mint: mint, OpenedAt: at, Open: true}
+		l.trips[mint] = trip
+	}
+	trip.Bought += amount
+	trip.CostSOL += costSOL
+	trip.CostUSD += costUSD
+}
+
+// Sell matches amount of mint against open lots and realizes the
+// difference between proceeds and cost
+func (l *Ledger) Sell(mint string, amount, proceedsSOL, proceedsUSD float64, at time.Time) {
+	if amount <= 0 {
+		return
+	}
+	t := l.token(mint)
+	matched, costSOL, costUSD, holdSeconds := t.consume(amount, at)
+	t.Sold += amount
+	t.UnmatchedSold += amount - matched
+	if matched == 0 {
+		return
+	}
+
+	share := matched / amount
+	proceedsSOL *= share
+	proceedsUSD *= share
+	t.SoldCostSOL += costSOL
+	t.SoldCostUSD += costUSD
+	t.ProceedsSOL += proceedsSOL
+	t.ProceedsUSD += proceedsUSD
+	t.RealizedSOL += proceedsSOL - costSOL
+	t.RealizedUSD += proceedsUSD - costUSD
+	t.holdSeconds += holdSeconds
+	t.holdWeight += matched
+
+	trip := l.trips[mint]
+	if trip == nil {
+		return
+	}
+	trip.Sold += matched
+	trip.ProceedsSOL += proceedsSOL
+	trip.ProceedsUSD += proceedsUSD
+	trip.RealizedSOL += proceedsSOL - costSOL
+	trip.RealizedUSD += proceedsUSD - costUSD
+	trip.holdSeconds += holdSeconds
+	if len(t.Lots) == 0 {
+		l.closeTrip(t, trip, at)
+	}
+}
+
+// Remove takes amount of mint out of the open lots without realizing it,
+// for tokens that leave the wallet by transfer
+func (l *Ledger) Remove(mint string, amount float64, at time.Time) {
+	l.remove(mint, amount, at)
+}
+
+// remove takes amount of mint out of the open lots and returns the cost
+// of the removed tokens
+func (l *Ledger) remove(mint string, amount float64, at time.Time) (float64, float64) {
+	t, ok := l.tokens[mint]
+	if !ok || amount <= 0 {
+		return 0, 0
+	}
+	matched, costSOL, costUSD, _ := t.consume(amount, at)
+	if trip := l.trips[mint]; trip != nil {
+		trip.Bought -= matched
+		trip.CostSOL -= costSOL
+		trip.CostUSD -= costUSD
+		if len(t.Lots) == 0 {
+			if trip.Sold > 0 {
+				l.closeTrip(t, trip, at)
+			} else {
+				delete(l.trips, mint)
+			}
+		}
+	}
+	return costSOL, costUSD
+}
+
+func (l *Ledger) closeTrip(t *TokenPnL, trip *RoundTrip, at time.Time) {
+	trip.Open = false
+	trip.ClosedAt = at
+	trip.Win = trip.RealizedSOL > 0
+	if trip.Sold > 0 {
+		trip.HoldTime = trip.holdSeconds / trip.Sold / 86400
+	}
+	t.Trades++
+	if trip.Win {
+		t.Wins++
+	}
+	l.closed = append(l.closed, *trip)
+	delete(l.trips, t.Mint)
+}
+
+// consume removes amount from the lots of t, oldest first. It returns the
+// matched amount with its cost and the amount weighted hold time.
+func (t *TokenPnL) consume(amount float64, at time.Time) (matched, costSOL, costUSD, holdSeconds float64) {
+	remaining := amount
+	for len(t.Lots) > 0 && remaining > dustAmount {
+		lot := &t.Lots[0]
+		used := lot.Remaining
+		if used > remaining {
+			used = remaining
+		}
+		share := used / lot.Amount
+		costSOL += lot.CostSOL * share
+		costUSD += lot.CostUSD * share
+		holdSeconds += at.Sub(lot.AcquiredAt).Seconds() * used
+
+		lot.Remaining -= used
+		remaining -= used
+		matched += used
+		if lot.Remaining <= dustAmount*lot.Amount || lot.Remaining <= dustAmount {
+			t.Lots = t.Lots[1:]
+		}
+	}
+	return matched, costSOL, costUSD, holdSeconds
+}
+
+// AddTransaction records a transaction. solUSD is the SOL price at the
+// time of the transaction, zero when unknown.
+//
+// Swaps against SOL or a stablecoin are buys or sells valued by the quote
+// leg. Swaps between two other tokens carry the cost basis of the sold
+// token over to the bought one, so no profit is realized until the
+// position ends in a quote asset.
+func (l *Ledger) AddTransaction(tx *Transaction, solUSD float64) {
+	if !tx.Success {
+		return
+	}
+	if tx.Type == TxTransfer && tx.Action == DirectionOut {
+		for _, change := range tx.Changes {
+			if change.Amount < 0 && !quoteMints[change.Mint] {
+				l.Remove(change.Mint, -change.Amount, tx.BlockTime)
+			}
+		}
+		return
+	}
+	if tx.Type != TxSwap || tx.Swap == nil {
+		return
+	}
+
+	swap := tx.Swap
+	inQuote, outQuote := quoteMints[swap.InMint], quoteMints[swap.OutMint]
+	if inQuote && outQuote {
+		return
+	}
+	if !inQuote && !outQuote {
+		costSOL, costUSD := l.remove(swap.InMint, swap.InAmount, tx.BlockTime)
+		l.Buy(swap.OutMint, tx.Signature, swap.OutAmount, costSOL, costUSD, tx.BlockTime)
+		return
+	}
+
+	quoteMint, quoteAmount := swap.InMint, swap.InAmount
+	if outQuote {
+		quoteMint, quoteAmount = swap.OutMint, swap.OutAmount
+	}
+	valueSOL, valueUSD := quoteValue(quoteMint, quoteAmount, solUSD)
+	if solUSD <= 0 {
+		l.missing++
+	}
+
+	if inQuote {
+		l.Buy(swap.OutMint, tx.Signature, swap.OutAmount, valueSOL, valueUSD, tx.BlockTime)
+	} else {
+		l.Sell(swap.InMint, swap.InAmount, valueSOL, valueUSD, tx.BlockTime)
+	}
+}
+
+// quoteValue converts an amount of a quote asset to SOL and USD
+func quoteValue(mint string, amount, solUSD float64) (float64, float64) {
+	if mint == sol.SolMint.String() {
+		return amount, amount * solUSD
+	}
+	// Stablecoins are valued at one dollar
+	if solUSD <= 0 {
+		return 0, amount
+	}
+	return amount / solUSD, amount
+}
+
+// Report summarizes the ledger. prices are current USD prices by mint and
+// solUSD the current SOL price, both used for unrealized PnL.
+func (l *Ledger) Report(wallet string, prices map[string]float64, solUSD float64) *PnLReport {
+	report := &PnLReport{
+		Wallet:        wallet,
+		Tokens:        []TokenPnL{},
+		RoundTrips:    append([]RoundTrip{}, l.closed...),
+		MissingPrices: l.missing,
+		UpdatedAt:     time.Now(),
+	}
+
+	var holdSeconds, holdWeight float64
+	for _, t := range l.tokens {
+		token := *t
+		token.Lots = append([]Lot{}, t.Lots...)
+		token.PriceUSD = prices[token.Mint]
+		for _, lot := range token.Lots {
+			share := lot.Remaining / lot.Amount
+			token.Holding += lot.Remaining
+			token.OpenCostSOL += lot.CostSOL * share
+			token.OpenCostUSD += lot.CostUSD * share
+		}
+		if token.PriceUSD > 0 {
+			token.ValueUSD = token.Holding * token.PriceUSD
+			token.UnrealizedUSD = token.ValueUSD - token.OpenCostUSD
+			if solUSD > 0 {
+				token.ValueSOL = token.ValueUSD / solUSD
+				token.UnrealizedSOL = token.ValueSOL - token.OpenCostSOL
+			}
+		}
+		if token.Trades > 0 {
+			token.WinRate = float64(token.Wins) / float64(token.Trades) * 100
+		}
+		if token.holdWeight > 0 {
+			token.AvgHoldTime = token.holdSeconds / token.holdWeight / 86400
+		}
+
+		report.RealizedSOL += token.RealizedSOL
+		report.RealizedUSD += token.RealizedUSD
+		report.UnrealizedSOL += token.UnrealizedSOL
+		report.UnrealizedUSD += token.UnrealizedUSD
+		report.SoldCostSOL += token.SoldCostSOL
+		report.SoldCostUSD += token.SoldCostUSD
+		report.Trades += token.Trades
+		report.Wins += token.Wins
+		holdSeconds += token.holdSeconds
+		holdWeight += token.holdWeight
+		report.Tokens = append(report.Tokens, token)
+	}
+
+	for _, trip := range l.trips {
+		open := *trip
+		if open.Sold > 0 {
+			open.HoldTime = open.holdSeconds / open.Sold / 86400
+		}
+		report.RoundTrips = append(report.RoundTrips, open)
+	}
+	sort.Slice(report.RoundTrips, func(i, j int) bool {
+		return report.RoundTrips[i].OpenedAt.Before(report.RoundTrips[j].OpenedAt)
+	})
+	sort.Slice(report.Tokens, func(i, j int) bool {
+		return report.Tokens[i].RealizedSOL+report.Tokens[i].UnrealizedSOL >
+			report.Tokens[j].RealizedSOL+report.Tokens[j].UnrealizedSOL
+	})
+
+	if report.SoldCostSOL > 0 {
+		report.PnLPercent = report.RealizedSOL / report.SoldCostSOL * 100
+	}
+	if report.Trades > 0 {
+		report.WinRate = float64(report.Wins) / float64(report.Trades) * 100
+	}
+	if holdWeight > 0 {
+		report.AvgHoldTime = holdSeconds / holdWeight / 86400
+	}
+	return report
+}
+
+// OpenMints returns mints with an open position, largest cost first
+func (l *Ledger) OpenMints() []string {
+	costs := make(map[string]float64)
+	for mint, t := range l.tokens {
+		for _, lot := range t.Lots {
+			costs[mint] += lot.CostSOL * lot.Remaining / lot.Amount
+		}
+	}
+	mints := make([]string, 0, len(costs))
+	for mint := range costs {
+		mints = append(mints, mint)
+	}
+	sort.Slice(mints, func(i, j int) bool { return costs[mints[i]] > costs[mints[j]] })
+	return mints
+}
+
+// PnLEngine computes PnL reports of indexed wallets
+type PnLEngine struct {
+	indexer *TransactionIndexer
+	tokens  *TokenResolver
+	prices  SOLPriceSource
+}
+
+// NewPnLEngine creates an engine valuing swaps with historical SOL prices
+// from prices
+func NewPnLEngine(indexer *TransactionIndexer, tokens *TokenResolver, prices SOLPriceSource) *PnLEngine {
+	return &PnLEngine{
+		indexer: indexer,
+		tokens:  tokens,
+		prices:  prices,
+	}
+}
+
+// Ledger builds the ledger of txs, given oldest first
+func (e *PnLEngine) Ledger(ctx context.Context, txs []Transaction) *Ledger {
+	ledger := NewLedger()
+	for i := range txs {
+		tx := &txs[i]
+		solUSD := 0.0
+		if e.prices != nil && tx.Type == TxSwap && tx.Swap != nil {
+			// A failed lookup only leaves the USD side unvalued
+			solUSD, _ = e.prices.SOLPriceAt(ctx, tx.BlockTime)
+		}
+		ledger.AddTransaction(tx, solUSD)
+	}
+	return ledger
+}
+
+// Report computes the PnL of address from its indexed transactions
+func (e *PnLEngine) Report(ctx context.Context, address string) (*PnLReport, error) {
+	owner, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := e.indexer.History(ctx, owner.String())
+	if err != nil {
+		return nil, err
+	}
+	ledger := e.Ledger(ctx, txs)
+
+	mints := []string{sol.SolMint.String()}
+	for mint := range ledger.tokens {
+		mints = append(mints, mint)
+	}
+	infos, err := e.tokens.Resolve(ctx, mints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve tokens: %v", err)
+	}
+	prices := make(map[string]float64, len(infos))
+	for mint, info := range infos {
+		prices[mint] = info.PriceUSD
+	}
+
+	report := ledger.Report(owner.String(), prices, prices[sol.SolMint.String()])
+	for i := range report.Tokens {
+		report.Tokens[i].Symbol = infos[report.Tokens[i].Mint].Symbol
+	}
+	return report, nil
+}
+
+// Realized computes the realized PnL and win rate of address without
+// pricing its open positions
+func (e *PnLEngine) Realized(ctx context.Context, address string) (*PnLReport, error) {
+	txs, err := e.indexer.History(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return e.Ledger(ctx, txs).Report(address, nil, 0), nil
+}
@@ -0,0 +1,131 @@
+package solana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLedgerRoundTrips(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	ledger := NewLedger()
+
+	// Two buys of A at different prices, SOL at $100 then $150
+	buy1 := testSwap(start, testSOL, 1, "A", 100)
+	buy2 := testSwap(start.Add(24*time.Hour), testSOL, 2, "A", 100)
+	ledger.AddTransaction(&buy1, 100)
+	ledger.AddTransaction(&buy2, 150)
+
+	// Selling 150 for USDC consumes the first lot and half the second
+	sell := testSwap(start.Add(48*time.Hour), "A", 150, testUSDC, 600)
+	ledger.AddTransaction(&sell, 200)
+
+	report := ledger.Report("wallet", map[string]float64{"A": 5}, 200)
+	if report.Trades != 0 || len(report.RoundTrips) != 1 || !report.RoundTrips[0].Open {
+		t.Fatalf("position must still be open: %+v", report.RoundTrips)
+	}
+	token := report.Tokens[0]
+	// Cost of the sold 150: 1 SOL ($100) + 1 SOL ($150); proceeds 3 SOL ($600)
+	if token.SoldCostSOL != 2 || token.SoldCostUSD != 250 || token.RealizedSOL != 1 || token.RealizedUSD != 350 {
+		t.Fatalf("unexpected realized PnL %+v", token)
+	}
+	// 50 left at a cost of 1 SOL ($150), now worth $250 or 1.25 SOL
+	if token.Holding != 50 || token.UnrealizedUSD != 100 || token.UnrealizedSOL != 0.25 {
+		t.Fatalf("unexpected unrealized PnL %+v", token)
+	}
+
+	// A token to token swap carries the basis over without realizing
+	// anything. The trip of A closes on the earlier USDC sell.
+	rotate := testSwap(start.Add(72*time.Hour), "A", 50, "B", 10)
+	ledger.AddTransaction(&rotate, 200)
+	exit := testSwap(start.Add(96*time.Hour), "B", 10, testSOL, 0.5)
+	ledger.AddTransaction(&exit, 200)
+
+	report = ledger.Report("wallet", nil, 200)
+	if report.Trades != 2 || report.Wins != 1 || report.WinRate != 50 {
+		t.Fatalf("unexpected round trips %+v", report.RoundTrips)
+	}
+	if report.RealizedSOL != 0.5 {
+		t.Fatalf("realized = %v, want 0.5", report.RealizedSOL)
+	}
+}
+
+func TestLedgerCarryOver(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	ledger := NewLedger()
+	buy1 := testSwap(start, testSOL, 1, "A", 100)
+	buy2 := testSwap(start.Add(time.Hour), testSOL, 3, "A", 100)
+	ledger.AddTransaction(&buy1, 100)
+	ledger.AddTransaction(&buy2, 100)
+
+	// The first swap takes the 1 SOL lot, the second the 3 SOL lot
+	toB := testSwap(start.Add(2*time.Hour), "A", 100, "B", 10)
+	toC := testSwap(start.Add(3*time.Hour), "A", 100, "C", 10)
+	ledger.AddTransaction(&toB, 100)
+	ledger.AddTransaction(&toC, 100)
+
+	report := ledger.Report("wallet", nil, 100)
+	if report.Trades != 0 || report.RealizedSOL != 0 || report.SoldCostSOL != 0 {
+		t.Fatalf("carry over must not realize or count a trade: %+v", report)
+	}
+	costs := make(map[string]float64)
+	for _, token := range report.Tokens {
+		costs[token.Mint] = token.OpenCostSOL
+	}
+	if costs["A"] != 0 || costs["B"] != 1 || costs["C"] != 3 {
+		t.Fatalf("unexpected carried cost %v", costs)
+	}
+
+	exit := testSwap(start.Add(4*time.Hour), "C", 10, testSOL, 4)
+	ledger.AddTransaction(&exit, 100)
+	report = ledger.Report("wallet", nil, 100)
+	if report.Trades != 1 || report.Wins != 1 || report.RealizedSOL != 1 {
+		t.Fatalf("unexpected exit %+v", report)
+	}
+}
+
+func TestLedgerTransferOut(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	ledger := NewLedger()
+	buy := testSwap(start, testSOL, 1, "A", 100)
+	ledger.AddTransaction(&buy, 100)
+	ledger.AddTransaction(&Transaction{
+		Type: TxTransfer, Action: DirectionOut, Success: true, BlockTime: start.Add(time.Hour),
+		Changes: []BalanceChange{{Mint: "A", Amount: -100}},
+	}, 100)
+
+	report := ledger.Report("wallet", nil, 100)
+	if report.Trades != 0 || len(report.RoundTrips) != 0 || report.RealizedSOL != 0 || report.Tokens[0].Holding != 0 {
+		t.Fatalf("transfer must close the position without PnL: %+v", report)
+	}
+}
+
+func TestBinanceSOLPrices(t *testing.T) {
+	hour := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if got := r.URL.Query().Get("startTime"); got != fmt.Sprint(hour.UnixMilli()) {
+			t.Errorf("unexpected startTime %s", got)
+		}
+		fmt.Fprintf(w, `[[%d,"140.0","145","139","150.0","1"],[%d,"150.0","151","149","152.0","1"]]`,
+			hour.UnixMilli(), hour.Add(time.Hour).UnixMilli())
+	}))
+	defer server.Close()
+
+	prices := NewBinanceSOLPrices(server.URL)
+	price, err := prices.SOLPriceAt(context.Background(), hour.Add(30*time.Minute))
+	if err != nil || price != 145 {
+		t.Fatalf("got %v, %v; want 145", price, err)
+	}
+	// The next hour comes from the same response
+	if price, err = prices.SOLPriceAt(context.Background(), hour.Add(90*time.Minute)); err != nil || price != 151 {
+		t.Fatalf("got %v, %v; want 151", price, err)
+	}
+	if requests != 1 {
+		t.Fatalf("klines requested %d times, want 1", requests)
+	}
+}
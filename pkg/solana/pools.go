@@ -0,0 +1,324 @@
+package solana
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	// Account sizes and the prefix needed to read mints and vaults
+	raydiumPoolSize   = 752
+	raydiumPoolPrefix = 464
+	whirlpoolSize     = 653
+	whirlpoolPrefix   = 245
+
+	// poolTTL is how long discovered pools, including none, are cached
+	poolTTL = time.Hour
+	// poolFailureTTL is how long a mint whose pool lookup failed is skipped
+	poolFailureTTL = 10 * time.Minute
+	// poolLookupBudget caps the pool lookups of one Prices call, the rest
+	// are looked up by later calls
+	poolLookupBudget = 3
+	// minPoolLiquidityUSD ignores pools too shallow for a meaningful price
+	minPoolLiquidityUSD = 1000
+)
+
+// Field offsets of Raydium AMM v4 and Orca Whirlpool accounts
+const (
+	raydiumBaseNeedTakePnl  = 192
+	raydiumQuoteNeedTakePnl = 200
+	raydiumBaseVault        = 336
+	raydiumQuoteVault       = 368
+	raydiumBaseMint         = 400
+	raydiumQuoteMint        = 432
+
+	whirlpoolSqrtPrice  = 65
+	whirlpoolTokenMintA = 101
+	whirlpoolVaultA     = 133
+	whirlpoolTokenMintB = 181
+	whirlpoolVaultB     = 213
+)
+
+// poolQuoteMints are the assets pools are searched against
+var poolQuoteMints = []string{
+	"EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", // USDC
+	sol.SolMint.String(),
+}
+
+// dexPool is a Raydium AMM or Orca Whirlpool pool between two mints
+type dexPool struct {
+	address    sol.PublicKey
+	venue      string
+	baseMint   string
+	quoteMint  string
+	baseVault  sol.PublicKey
+	quoteVault sol.PublicKey
+	// Raydium amounts owed to the pool owner are not part of the reserves
+	baseOwed  uint64
+	quoteOwed uint64
+	// sqrtPrice is the Whirlpool price of base in quote as Q64.64
+	sqrtPrice *big.Int
+}
+
+// PoolQuote is the price of a token derived from a DEX pool
+type PoolQuote struct {
+	Pool      string `json:"pool"`
+	Venue     string `json:"venue"`
+	QuoteMint string `json:"quote_mint"`
+	// Price is the token price in the quote asset
+	Price        float64   `json:"price"`
+	PriceUSD     float64   `json:"price_usd"`
+	Reserve      float64   `json:"reserve"`
+	QuoteReserve float64   `json:"quote_reserve"`
+	LiquidityUSD float64   `json:"liquidity_usd"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type cachedPools struct {
+	pools     []dexPool
+	fetchedAt time.Time
+}
+
+func parseRaydiumPool(address sol.PublicKey, data []byte) (*dexPool, error) {
+	if len(data) < raydiumPoolPrefix {
+		return nil, fmt.Errorf("raydium pool account too short")
+	}
+	return &dexPool{
+		address:    address,
+		venue:      "raydium",
+		baseMint:   sol.PublicKeyFromBytes(data[raydiumBaseMint : raydiumBaseMint+32]).String(),
+		quoteMint:  sol.PublicKeyFromBytes(data[raydiumQuoteMint : raydiumQuoteMint+32]).String(),
+		baseVault:  sol.PublicKeyFromBytes(data[raydiumBaseVault : raydiumBaseVault+32]),
+		quoteVault: sol.PublicKeyFromBytes(data[raydiumQuoteVault : raydiumQuoteVault+32]),
+		baseOwed:   binary.LittleEndian.Uint64(data[raydiumBaseNeedTakePnl:]),
+		quoteOwed:  binary.LittleEndian.Uint64(data[raydiumQuoteNeedTakePnl:]),
+	}, nil
+}
+
+func parseWhirlpool(address sol.PublicKey, data []byte) (*dexPool, error) {
+	if len(data) < whirlpoolPrefix {
+		return nil, fmt.Errorf("whirlpool account too short")
+	}
+	// The u128 is little endian, big.Int wants big endian bytes
+	raw := make([]byte, 16)
+	for i := 0; i < 16; i++ {
+		raw[15-i] = data[whirlpoolSqrtPrice+i]
+	}
+	return &dexPool{
+		address:    address,
+		venue:      "orca",
+		baseMint:   sol.PublicKeyFromBytes(data[whirlpoolTokenMintA : whirlpoolTokenMintA+32]).String(),
+		quoteMint:  sol.PublicKeyFromBytes(data[whirlpoolTokenMintB : whirlpoolTokenMintB+32]).String(),
+		baseVault:  sol.PublicKeyFromBytes(data[whirlpoolVaultA : whirlpoolVaultA+32]),
+		quoteVault: sol.PublicKeyFromBytes(data[whirlpoolVaultB : whirlpoolVaultB+32]),
+		sqrtPrice:  new(big.Int).SetBytes(raw),
+	}, nil
+}
+
+// basePrice returns the price of one base token in quote tokens from the
+// raw vault balances
+func (p *dexPool) basePrice(baseRaw, quoteRaw uint64, baseDecimals, quoteDecimals uint8) float64 {
+	scale := math.Pow10(int(baseDecimals) - int(quoteDecimals))
+	if p.sqrtPrice != nil {
+		// price = (sqrtPrice / 2^64)^2 in raw units
+		sqrt, _ := new(big.Float).SetInt(p.sqrtPrice).Float64()
+		ratio := sqrt / math.Pow(2, 64)
+		return ratio * ratio * scale
+	}
+	if baseRaw <= p.baseOwed || quoteRaw <= p.quoteOwed {
+		return 0
+	}
+	return float64(quoteRaw-p.quoteOwed) / float64(baseRaw-p.baseOwed) * scale
+}
+
+// findPools returns the Raydium AMM and Orca Whirlpool pools pairing mint
+// with one of the pool quote mints
+func (r *TokenResolver) findPools(ctx context.Context, mint string) ([]dexPool, error) {
+	r.mu.Lock()
+	if cached, ok := r.pools[mint]; ok && time.Since(cached.fetchedAt) < poolTTL {
+		r.mu.Unlock()
+		return cached.pools, nil
+	}
+	r.mu.Unlock()
+
+	key, err := sol.PublicKeyFromBase58(mint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mint %s: %v", mint, err)
+	}
+
+	type search struct {
+		program      sol.PublicKey
+		size, prefix uint64
+		baseOffset   uint64
+		quoteOffset  uint64
+		parse        func(sol.PublicKey, []byte) (*dexPool, error)
+	}
+	searches := []search{
+		{RaydiumAMMProgramID, raydiumPoolSize, raydiumPoolPrefix, raydiumBaseMint, raydiumQuoteMint, parseRaydiumPool},
+		{OrcaWhirlpoolProgramID, whirlpoolSize, whirlpoolPrefix, whirlpoolTokenMintA, whirlpoolTokenMintB, parseWhirlpool},
+	}
+
+	var pools []dexPool
+	for _, quote := range poolQuoteMints {
+		if quote == mint {
+			continue
+		}
+		quoteKey := sol.MustPublicKeyFromBase58(quote)
+		for _, s := range searches {
+			// The token can be on either side of the pair
+			for _, sides := range [][2]sol.PublicKey{{key, quoteKey}, {quoteKey, key}} {
+				offset := uint64(0)
+				prefix := s.prefix
+				accounts, err := r.client.GetProgramAccountsWithOpts(ctx, s.program, &rpc.GetProgramAccountsOpts{
+					Encoding:   sol.EncodingBase64,
+					Commitment: commitmentFrom(ctx),
+					DataSlice:  &rpc.DataSlice{Offset: &offset, Length: &prefix},
+					Filters: []rpc.RPCFilter{
+						{DataSize: s.size},
+						{Memcmp: &rpc.RPCFilterMemcmp{Offset: s.baseOffset, Bytes: sides[0].Bytes()}},
+						{Memcmp: &rpc.RPCFilterMemcmp{Offset: s.quoteOffset, Bytes: sides[1].Bytes()}},
+					},
+				})
+				if err != nil {
+					return nil, fmt.Errorf("failed to search %s pools: %v", programName(s.program), err)
+				}
+				for _, account := range accounts {
+					if account.Account == nil || account.Account.Data == nil {
+						continue
+					}
+					if pool, err := s.parse(account.Pubkey, account.Account.Data.GetBinary()); err == nil {
+						pools = append(pools, *pool)
+					}
+				}
+			}
+		}
+	}
+
+	r.mu.Lock()
+	r.pools[mint] = cachedPools{pools: pools, fetchedAt: time.Now()}
+	r.mu.Unlock()
+	return pools, nil
+}
+
+// parsedTokenAmount is the jsonParsed layout of a token account balance
+type parsedTokenAmount struct {
+	Parsed struct {
+		Info struct {
+			TokenAmount struct {
+				Amount string `json:"amount"`
+			} `json:"tokenAmount"`
+		} `json:"info"`
+	} `json:"parsed"`
+}
+
+// vaultBalances returns the raw token amounts of vaults
+func (r *TokenResolver) vaultBalances(ctx context.Context, vaults []sol.PublicKey) (map[sol.PublicKey]uint64, error) {
+	balances := make(map[sol.PublicKey]uint64, len(vaults))
+	for start := 0; start < len(vaults); start += rpcBatchSize {
+		end := start + rpcBatchSize
+		if end > len(vaults) {
+			end = len(vaults)
+		}
+		accounts, err := r.client.GetMultipleAccountsWithOpts(ctx, vaults[start:end], &rpc.GetMultipleAccountsOpts{
+			Encoding:   sol.EncodingJSONParsed,
+			Commitment: commitmentFrom(ctx),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pool vaults: %v", err)
+		}
+		for i, account := range accounts.Value {
+			if account == nil || account.Data == nil {
+				continue
+			}
+			var parsed parsedTokenAmount
+			if err := json.Unmarshal(account.Data.GetRawJSON(), &parsed); err != nil {
+				continue
+			}
+			if amount, err := strconv.ParseUint(parsed.Parsed.Info.TokenAmount.Amount, 10, 64); err == nil {
+				balances[vaults[start+i]] = amount
+			}
+		}
+	}
+	return balances, nil
+}
+
+// poolQuote prices mint from its deepest pool. It returns nil when no pool
+// has enough liquidity.
+func (r *TokenResolver) poolQuote(ctx context.Context, mint string) (*PoolQuote, error) {
+	pools, err := r.findPools(ctx, mint)
+	if err != nil || len(pools) == 0 {
+		return nil, err
+	}
+
+	var vaults []sol.PublicKey
+	mints := []string{mint}
+	for _, pool := range pools {
+		vaults = append(vaults, pool.baseVault, pool.quoteVault)
+		mints = append(mints, pool.baseMint, pool.quoteMint)
+	}
+	balances, err := r.vaultBalances(ctx, vaults)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := r.mintInfos(ctx, mints)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *PoolQuote
+	for _, pool := range pools {
+		baseRaw, quoteRaw := balances[pool.baseVault], balances[pool.quoteVault]
+		baseInfo, quoteInfo := infos[pool.baseMint], infos[pool.quoteMint]
+		price := pool.basePrice(baseRaw, quoteRaw, baseInfo.Decimals, quoteInfo.Decimals)
+		if price <= 0 {
+			continue
+		}
+		reserve := uiAmount(baseRaw-min(baseRaw, pool.baseOwed), baseInfo.Decimals)
+		quoteReserve := uiAmount(quoteRaw-min(quoteRaw, pool.quoteOwed), quoteInfo.Decimals)
+		quoteMint := pool.quoteMint
+		if pool.baseMint != mint {
+			// The token is the quote side of the pair
+			price = 1 / price
+			reserve, quoteReserve = quoteReserve, reserve
+			quoteMint = pool.baseMint
+		}
+
+		quoteUSD := r.quoteUSD(ctx, quoteMint)
+		if quoteUSD == 0 {
+			continue
+		}
+		quote := &PoolQuote{
+			Pool:         pool.address.String(),
+			Venue:        pool.venue,
+			QuoteMint:    quoteMint,
+			Price:        price,
+			PriceUSD:     price * quoteUSD,
+			Reserve:      reserve,
+			QuoteReserve: quoteReserve,
+			LiquidityUSD: 2 * quoteReserve * quoteUSD,
+			UpdatedAt:    time.Now(),
+		}
+		if quote.LiquidityUSD >= minPoolLiquidityUSD && (best == nil || quote.LiquidityUSD > best.LiquidityUSD) {
+			best = quote
+		}
+	}
+	return best, nil
+}
+
+// quoteUSD returns the USD price of a pool quote asset
+func (r *TokenResolver) quoteUSD(ctx context.Context, mint string) float64 {
+	if stableMints[mint] {
+		return 1
+	}
+	prices, _ := r.Prices(ctx, []string{mint})
+	return prices[mint]
+}
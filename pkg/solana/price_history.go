@@ -0,0 +1,115 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SOLPriceSource returns the USD price of SOL at a point in time
+type SOLPriceSource interface {
+	SOLPriceAt(ctx context.Context, t time.Time) (float64, error)
+}
+
+// klineBatch is the maximum number of klines per Binance request
+const klineBatch = 1000
+
+// BinanceSOLPrices reads historical SOL prices from hourly SOLUSDT klines.
+// Completed hours are cached, so pricing a wallet history needs one request
+// per ~40 days of activity.
+type BinanceSOLPrices struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	hours map[int64]float64
+}
+
+// NewBinanceSOLPrices creates a price source for the Binance spot API at
+// baseURL, for example https://api.binance.com
+func NewBinanceSOLPrices(baseURL string) *BinanceSOLPrices {
+	return &BinanceSOLPrices{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		hours:      make(map[int64]float64),
+	}
+}
+
+// SOLPriceAt returns the average of open and close of the hour containing t
+func (p *BinanceSOLPrices) SOLPriceAt(ctx context.Context, t time.Time) (float64, error) {
+	hour := t.Truncate(time.Hour).Unix()
+
+	p.mu.Lock()
+	price, ok := p.hours[hour]
+	p.mu.Unlock()
+	if ok {
+		return price, nil
+	}
+
+	prices, err := p.fetch(ctx, hour)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	completed := time.Now().Truncate(time.Hour).Unix()
+	for h, v := range prices {
+		// The running hour is still moving
+		if h < completed {
+			p.hours[h] = v
+		}
+	}
+	price, ok = prices[hour]
+	if !ok {
+		return 0, fmt.Errorf("no SOL price for %s", t.UTC().Format(time.RFC3339))
+	}
+	return price, nil
+}
+
+// fetch loads hourly klines starting at the hour, in unix seconds
+func (p *BinanceSOLPrices) fetch(ctx context.Context, hour int64) (map[int64]float64, error) {
+	url := fmt.Sprintf("%s/api/v3/klines?symbol=SOLUSDT&interval=1h&startTime=%d&limit=%d",
+		p.baseURL, hour*1000, klineBatch)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch SOL klines: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("klines API returned status %d", resp.StatusCode)
+	}
+
+	var klines [][]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&klines); err != nil {
+		return nil, fmt.Errorf("failed to decode klines: %v", err)
+	}
+
+	prices := make(map[int64]float64, len(klines))
+	for _, k := range klines {
+		if len(k) < 5 {
+			continue
+		}
+		openTime, ok := k[0].(float64)
+		if !ok {
+			continue
+		}
+		openStr, _ := k[1].(string)
+		closeStr, _ := k[4].(string)
+		open, err1 := strconv.ParseFloat(openStr, 64)
+		close, err2 := strconv.ParseFloat(closeStr, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		prices[int64(openTime)/1000] = (open + close) / 2
+	}
+	return prices, nil
+}
@@ -0,0 +1,56 @@
+package solana
+
+import (
+	sol "github.com/gagliardetto/solana-go"
+)
+
+// Program IDs not provided by solana-go
+var (
+	Token2022ProgramID = sol.MustPublicKeyFromBase58("TokenzQdBNbLqP5VEhdkAS6EPFLC1PHnBqCXEpPxuEb")
+
+	JupiterV6ProgramID       = sol.MustPublicKeyFromBase58("JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4")
+	JupiterV4ProgramID       = sol.MustPublicKeyFromBase58("JUP4Fb2cqiRUcaTHdrPC8h2gNsA2ETXiPDD33WcGuJB")
+	RaydiumAMMProgramID      = sol.MustPublicKeyFromBase58("675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8")
+	RaydiumCLMMProgramID     = sol.MustPublicKeyFromBase58("CAMMCzo5YL8w4VFF8KVHrK22GGUsp5VTaW7grrKgrWqK")
+	RaydiumCPMMProgramID     = sol.MustPublicKeyFromBase58("CPMMoo8L3F4NbTegBCKVNunggL7H1ZpdTHKxQB5qKP1C")
+	OrcaWhirlpoolProgramID   = sol.MustPublicKeyFromBase58("whirLbMiicVdio4qvUfM5KAg6Ct8VwpYzGff3uctyCc")
+	OrcaTokenSwapV2ProgramID = sol.MustPublicKeyFromBase58("9W959DqEETiGZocYWCQPaJ6sBmUzgfxXfqGeTEdp3aQP")
+	BubblegumProgramID       = sol.MustPublicKeyFromBase58("BGUMAp9Gq7iTEuizy4pqaxsTyUCBK68MDfK752saRPUY")
+	CandyMachineV3ProgramID  = sol.MustPublicKeyFromBase58("CndyV3LdqHUfDLmE5naZjVN8rBZz4tqhdefbAnjHG3JR")
+	CandyGuardProgramID      = sol.MustPublicKeyFromBase58("Guard1JwRhJkVH6XZhzoYxeBVQe872VH6QggF4BWmS9g")
+)
+
+// tokenPrograms are the SPL token programs whose accounts make up a wallet
+var tokenPrograms = []sol.PublicKey{sol.TokenProgramID, Token2022ProgramID}
+
+// dexPrograms maps swap program IDs to the venue reported for a swap.
+// Aggregators are listed so a routed swap is attributed to the aggregator
+// rather than to whichever pool it happened to hit.
+var dexPrograms = map[string]string{
+	JupiterV6ProgramID.String():       "jupiter",
+	JupiterV4ProgramID.String():       "jupiter",
+	RaydiumAMMProgramID.String():      "raydium",
+	RaydiumCLMMProgramID.String():     "raydium",
+	RaydiumCPMMProgramID.String():     "raydium",
+	OrcaWhirlpoolProgramID.String():   "orca",
+	OrcaTokenSwapV2ProgramID.String(): "orca",
+}
+
+// aggregators are venues that route through other DEX programs
+var aggregators = map[string]bool{"jupiter": true}
+
+// nftMintPrograms are programs whose presence marks an NFT mint
+var nftMintPrograms = map[string]bool{
+	sol.TokenMetadataProgramID.String(): true,
+	BubblegumProgramID.String():         true,
+	CandyMachineV3ProgramID.String():    true,
+	CandyGuardProgramID.String():        true,
+}
+
+// programName returns the jsonParsed program name of a token program
+func programName(program sol.PublicKey) string {
+	if program.Equals(Token2022ProgramID) {
+		return "spl-token-2022"
+	}
+	return "spl-token"
+}
@@ -0,0 +1,441 @@
+package solana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultMaxSlotLag is how many slots an endpoint may trail the best
+	// endpoint before it is considered unhealthy
+	DefaultMaxSlotLag = 150
+	// DefaultMaxRetries is how often a failed call is retried on another
+	// endpoint
+	DefaultMaxRetries  = 3
+	healthInterval     = 30 * time.Second
+	rpcRequestTimeout  = 30 * time.Second
+	retryBackoff       = 250 * time.Millisecond
+	maxRetryBackoff    = 5 * time.Second
+	rpcCodeRateLimited = 429
+	// rpcCodeNodeUnhealthy is returned by nodes that are behind
+	rpcCodeNodeUnhealthy = -32005
+)
+
+var _ rpc.JSONRPCClient = (*RPCPool)(nil)
+
+// EndpointConfig configures one RPC endpoint of a pool
+type EndpointConfig struct {
+	URL string `json:"url"`
+	// Weight is the share of requests sent to the endpoint
+	Weight int `json:"weight"`
+	// RPS limits requests per second, zero means unlimited
+	RPS float64 `json:"rps"`
+}
+
+// ParseEndpoints parses a comma separated endpoint list. Each entry is a
+// URL optionally followed by ;weight=N and ;rps=N, for example
+// "https://a.example;weight=3;rps=10,https://b.example".
+func ParseEndpoints(spec string) ([]EndpointConfig, error) {
+	var endpoints []EndpointConfig
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ";")
+		if parts[0] == "" {
+			continue
+		}
+		if _, err := url.ParseRequestURI(parts[0]); err != nil {
+			return nil, fmt.Errorf("invalid RPC endpoint %q: %v", parts[0], err)
+		}
+		endpoint := EndpointConfig{URL: parts[0], Weight: 1}
+		for _, option := range parts[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil || number < 0 {
+				return nil, fmt.Errorf("invalid %s for RPC endpoint %s: %q", key, parts[0], value)
+			}
+			switch key {
+			case "weight":
+				endpoint.Weight = int(number)
+			case "rps":
+				endpoint.RPS = number
+			default:
+				return nil, fmt.Errorf("unknown option %q for RPC endpoint %s", key, parts[0])
+			}
+		}
+		if endpoint.Weight < 1 {
+			endpoint.Weight = 1
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no RPC endpoints configured")
+	}
+	return endpoints, nil
+}
+
+// EndpointStatus reports the health and counters of a pool endpoint
+type EndpointStatus struct {
+	EndpointConfig
+	Healthy     bool      `json:"healthy"`
+	Slot        uint64    `json:"slot"`
+	SlotLag     uint64    `json:"slot_lag"`
+	Requests    uint64    `json:"requests"`
+	Failures    uint64    `json:"failures"`
+	RateLimited uint64    `json:"rate_limited"`
+	LastError   string    `json:"last_error,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+	// CoolingUntil is set after a rate limit or failure, the endpoint is
+	// only used when no other endpoint is available until then
+	CoolingUntil time.Time `json:"cooling_until,omitempty"`
+}
+
+type poolEndpoint struct {
+	config  EndpointConfig
+	client  rpc.JSONRPCClient
+	limiter *rate.Limiter
+
+	// guarded by RPCPool.mu
+	status  EndpointStatus
+	current int
+}
+
+// wait blocks until the endpoint rate limit allows a request
+func (e *poolEndpoint) wait(ctx context.Context) error {
+	if e.limiter == nil {
+		return nil
+	}
+	return e.limiter.Wait(ctx)
+}
+
+// RPCPool spreads JSON-RPC calls over several endpoints with smooth
+// weighted round-robin. Unhealthy and cooling endpoints are skipped,
+// rate limited and failed calls are retried on the next endpoint. Use
+// Client to get an rpc.Client backed by the pool.
+type RPCPool struct {
+	endpoints  []*poolEndpoint
+	commitment rpc.CommitmentType
+	maxRetries int
+	maxSlotLag uint64
+
+	mu sync.Mutex
+}
+
+// NewRPCPool creates a pool over endpoints. Health checks read slots at
+// commitment.
+func NewRPCPool(endpoints []EndpointConfig, commitment rpc.CommitmentType) (*RPCPool, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no RPC endpoints configured")
+	}
+	httpClient := &http.Client{Timeout: rpcRequestTimeout}
+	pool := &RPCPool{
+		commitment: commitment,
+		maxRetries: DefaultMaxRetries,
+		maxSlotLag: DefaultMaxSlotLag,
+	}
+	for _, config := range endpoints {
+		if config.Weight < 1 {
+			config.Weight = 1
+		}
+		endpoint := &poolEndpoint{
+			config: config,
+			client: jsonrpc.NewClientWithOpts(config.URL, &jsonrpc.RPCClientOpts{HTTPClient: httpClient}),
+			status: EndpointStatus{EndpointConfig: config, Healthy: true},
+		}
+		if config.RPS > 0 {
+			burst := int(config.RPS)
+			if burst < 1 {
+				burst = 1
+			}
+			endpoint.limiter = rate.NewLimiter(rate.Limit(config.RPS), burst)
+		}
+		pool.endpoints = append(pool.endpoints, endpoint)
+	}
+	return pool, nil
+}
+
+// Client returns a Solana RPC client that sends its calls through the pool
+func (p *RPCPool) Client() *rpc.Client {
+	return rpc.NewWithCustomRPCClient(p)
+}
+
+// Commitment returns the commitment the pool checks health at
+func (p *RPCPool) Commitment() rpc.CommitmentType {
+	return p.commitment
+}
+
+// CallForInto implements rpc.JSONRPCClient
+func (p *RPCPool) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	return p.do(ctx, func(endpoint *poolEndpoint) error {
+		return endpoint.client.CallForInto(ctx, out, method, params)
+	})
+}
+
+// CallWithCallback implements rpc.JSONRPCClient
+func (p *RPCPool) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	return p.do(ctx, func(endpoint *poolEndpoint) error {
+		return endpoint.client.CallWithCallback(ctx, method, params, callback)
+	})
+}
+
+// CallBatch implements rpc.JSONRPCClient
+func (p *RPCPool) CallBatch(ctx context.Context, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	var responses jsonrpc.RPCResponses
+	err := p.do(ctx, func(endpoint *poolEndpoint) error {
+		var err error
+		responses, err = endpoint.client.CallBatch(ctx, requests)
+		return err
+	})
+	return responses, err
+}
+
+// do runs call on picked endpoints until it succeeds, fails with an error
+// that is not worth retrying or runs out of retries
+func (p *RPCPool) do(ctx context.Context, call func(*poolEndpoint) error) error {
+	tried := make(map[*poolEndpoint]bool)
+	var lastErr error
+	for attempt := 0; attempt <= p.maxRetries; attempt++ {
+		endpoint := p.pick(tried)
+		tried[endpoint] = true
+		if err := endpoint.wait(ctx); err != nil {
+			return err
+		}
+
+		err := call(endpoint)
+		retry, limited := retryable(ctx, err)
+		backoff := retryBackoff << attempt
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+		p.record(endpoint, err, retry, limited, backoff)
+		if err == nil || !retry {
+			return err
+		}
+		lastErr = err
+
+		// Only wait when there is no fresh endpoint left to try
+		if attempt < p.maxRetries && len(tried) >= len(p.endpoints) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+	}
+	return fmt.Errorf("RPC call failed after %d attempts: %v", p.maxRetries+1, lastErr)
+}
+
+// retryable reports whether err is worth retrying on another endpoint and
+// whether it was caused by a rate limit
+func retryable(ctx context.Context, err error) (bool, bool) {
+	if err == nil || ctx.Err() != nil {
+		return false, false
+	}
+	var httpErr *jsonrpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code == http.StatusTooManyRequests || httpErr.Code >= 500,
+			httpErr.Code == http.StatusTooManyRequests
+	}
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == rpcCodeRateLimited || rpcErr.Code == rpcCodeNodeUnhealthy,
+			rpcErr.Code == rpcCodeRateLimited
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr), false
+}
+
+// record updates the counters of endpoint after a call
+func (p *RPCPool) record(endpoint *poolEndpoint, err error, retry, limited bool, backoff time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := &endpoint.status
+	status.Requests++
+	if err == nil || !retry {
+		// Errors that are not retried come from the request, not the endpoint
+		return
+	}
+	status.Failures++
+	if limited {
+		status.RateLimited++
+	}
+	status.LastError = err.Error()
+	status.CoolingUntil = time.Now().Add(backoff)
+}
+
+// pick returns the next endpoint by smooth weighted round-robin. It
+// prefers healthy endpoints that are not cooling down and were not tried
+// yet, falling back to untried and then to all endpoints.
+func (p *RPCPool) pick(tried map[*poolEndpoint]bool) *poolEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+
+	var candidates []*poolEndpoint
+	for _, endpoint := range p.endpoints {
+		if !tried[endpoint] && endpoint.status.Healthy && now.After(endpoint.status.CoolingUntil) {
+			candidates = append(candidates, endpoint)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, endpoint := range p.endpoints {
+			if !tried[endpoint] {
+				candidates = append(candidates, endpoint)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.endpoints
+	}
+
+	var best *poolEndpoint
+	total := 0
+	for _, endpoint := range candidates {
+		endpoint.current += endpoint.config.Weight
+		total += endpoint.config.Weight
+		if best == nil || endpoint.current > best.current {
+			best = endpoint
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// CheckHealth calls getHealth and getSlot on every endpoint. Endpoints
+// that fail or trail the highest slot by more than the maximum lag are
+// marked unhealthy.
+func (p *RPCPool) CheckHealth(ctx context.Context) {
+	type result struct {
+		slot uint64
+		err  error
+	}
+	results := make([]result, len(p.endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range p.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint *poolEndpoint) {
+			defer wg.Done()
+			results[i].slot, results[i].err = p.checkEndpoint(ctx, endpoint)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var highest uint64
+	for _, r := range results {
+		if r.err == nil && r.slot > highest {
+			highest = r.slot
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for i, endpoint := range p.endpoints {
+		status := &endpoint.status
+		status.CheckedAt = now
+		if err := results[i].err; err != nil {
+			status.Healthy = false
+			status.LastError = err.Error()
+			continue
+		}
+		status.Slot = results[i].slot
+		status.SlotLag = highest - status.Slot
+		status.Healthy = status.SlotLag <= p.maxSlotLag
+		if !status.Healthy {
+			status.LastError = fmt.Sprintf("%d slots behind", status.SlotLag)
+		}
+	}
+}
+
+func (p *RPCPool) checkEndpoint(ctx context.Context, endpoint *poolEndpoint) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := endpoint.wait(ctx); err != nil {
+		return 0, err
+	}
+	var health string
+	if err := endpoint.client.CallForInto(ctx, &health, "getHealth", nil); err != nil {
+		return 0, fmt.Errorf("getHealth failed: %v", err)
+	}
+	if health != "ok" {
+		return 0, fmt.Errorf("getHealth returned %q", health)
+	}
+	if err := endpoint.wait(ctx); err != nil {
+		return 0, err
+	}
+	var slot uint64
+	params := []interface{}{rpc.M{"commitment": p.commitment}}
+	if err := endpoint.client.CallForInto(ctx, &slot, "getSlot", params); err != nil {
+		return 0, fmt.Errorf("getSlot failed: %v", err)
+	}
+	return slot, nil
+}
+
+// Run checks endpoint health periodically until ctx is done
+func (p *RPCPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	for {
+		p.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns the status of every endpoint
+func (p *RPCPool) Status() []EndpointStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	statuses := make([]EndpointStatus, len(p.endpoints))
+	for i, endpoint := range p.endpoints {
+		statuses[i] = endpoint.status
+	}
+	return statuses
+}
+
+// ParseCommitment validates a commitment level name
+func ParseCommitment(s string) (rpc.CommitmentType, error) {
+	switch commitment := rpc.CommitmentType(strings.ToLower(s)); commitment {
+	case rpc.CommitmentProcessed, rpc.CommitmentConfirmed, rpc.CommitmentFinalized:
+		return commitment, nil
+	}
+	return "", fmt.Errorf("invalid commitment %q, want processed, confirmed or finalized", s)
+}
+
+type commitmentKey struct{}
+
+// WithCommitment returns a context whose RPC reads use commitment. Reads
+// without one in their context use confirmed.
+func WithCommitment(ctx context.Context, commitment rpc.CommitmentType) context.Context {
+	return context.WithValue(ctx, commitmentKey{}, commitment)
+}
+
+// commitmentFrom returns the commitment selected for ctx
+func commitmentFrom(ctx context.Context) rpc.CommitmentType {
+	if commitment, ok := ctx.Value(commitmentKey{}).(rpc.CommitmentType); ok {
+		return commitment
+	}
+	return rpc.CommitmentConfirmed
+}
+
+// confirmedCommitmentFrom is commitmentFrom for methods that do not
+// support processed, such as getTransaction and getSignaturesForAddress
+func confirmedCommitmentFrom(ctx context.Context) rpc.CommitmentType {
+	if commitment := commitmentFrom(ctx); commitment != rpc.CommitmentProcessed {
+		return commitment
+	}
+	return rpc.CommitmentConfirmed
+}
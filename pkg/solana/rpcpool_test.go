@@ -0,0 +1,164 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// poolStub is an RPC endpoint answering getHealth, getSlot and getBalance,
+// or HTTP 429 when limited is set
+type poolStub struct {
+	slot    uint64
+	limited atomic.Bool
+	calls   atomic.Int64
+}
+
+func (s *poolStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.calls.Add(1)
+	if s.limited.Load() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	var result interface{}
+	switch req.Method {
+	case "getHealth":
+		result = "ok"
+	case "getSlot":
+		result = s.slot
+	case "getBalance":
+		result = map[string]interface{}{"context": map[string]uint64{"slot": s.slot}, "value": 42}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+func newPoolStubs(t *testing.T, stubs ...*poolStub) []EndpointConfig {
+	var endpoints []EndpointConfig
+	for _, stub := range stubs {
+		server := httptest.NewServer(stub)
+		t.Cleanup(server.Close)
+		endpoints = append(endpoints, EndpointConfig{URL: server.URL, Weight: 1})
+	}
+	return endpoints
+}
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints("https://a.example;weight=3;rps=10, https://b.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 || endpoints[0].Weight != 3 || endpoints[0].RPS != 10 ||
+		endpoints[1].URL != "https://b.example" || endpoints[1].Weight != 1 {
+		t.Fatalf("unexpected endpoints %+v", endpoints)
+	}
+	for _, spec := range []string{"", "not a url", "https://a.example;weight=x", "https://a.example;burst=2"} {
+		if _, err := ParseEndpoints(spec); err == nil {
+			t.Errorf("ParseEndpoints(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestCommitmentFrom(t *testing.T) {
+	if got := commitmentFrom(context.Background()); got != rpc.CommitmentConfirmed {
+		t.Fatalf("default commitment = %s, want confirmed", got)
+	}
+	ctx, cancel := context.WithCancel(WithCommitment(context.Background(), rpc.CommitmentFinalized))
+	cancel()
+	// Background work started from a request keeps its commitment
+	if got := commitmentFrom(context.WithoutCancel(ctx)); got != rpc.CommitmentFinalized {
+		t.Fatalf("commitment = %s, want finalized", got)
+	}
+	processed := WithCommitment(context.Background(), rpc.CommitmentProcessed)
+	if got := confirmedCommitmentFrom(processed); got != rpc.CommitmentConfirmed {
+		t.Fatalf("confirmed commitment = %s, want confirmed", got)
+	}
+}
+
+func TestRPCPoolWeightedRoundRobin(t *testing.T) {
+	heavy, light := &poolStub{slot: 100}, &poolStub{slot: 100}
+	endpoints := newPoolStubs(t, heavy, light)
+	endpoints[0].Weight = 3
+	pool, err := NewRPCPool(endpoints, rpc.CommitmentConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := pool.Client()
+	for i := 0; i < 8; i++ {
+		if _, err := client.GetBalance(context.Background(), sol.SolMint, rpc.CommitmentConfirmed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if heavy.calls.Load() != 6 || light.calls.Load() != 2 {
+		t.Fatalf("calls = %d/%d, want 6/2", heavy.calls.Load(), light.calls.Load())
+	}
+}
+
+func TestRPCPoolRetriesRateLimited(t *testing.T) {
+	limited, healthy := &poolStub{slot: 100}, &poolStub{slot: 100}
+	limited.limited.Store(true)
+	pool, err := NewRPCPool(newPoolStubs(t, limited, healthy), rpc.CommitmentConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := pool.Client()
+	for i := 0; i < 3; i++ {
+		balance, err := client.GetBalance(context.Background(), sol.SolMint, rpc.CommitmentConfirmed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Value != 42 {
+			t.Fatalf("balance = %d", balance.Value)
+		}
+	}
+	// The rate limited endpoint cools down after the first 429
+	if limited.calls.Load() != 1 {
+		t.Fatalf("rate limited endpoint got %d calls, want 1", limited.calls.Load())
+	}
+	status := pool.Status()
+	if status[0].RateLimited != 1 || status[0].CoolingUntil.IsZero() || status[1].Requests != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestRPCPoolHealth(t *testing.T) {
+	ahead, behind, down := &poolStub{slot: 1000}, &poolStub{slot: 1000 - DefaultMaxSlotLag - 1}, &poolStub{}
+	down.limited.Store(true)
+	pool, err := NewRPCPool(newPoolStubs(t, ahead, behind, down), rpc.CommitmentConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.CheckHealth(context.Background())
+	status := pool.Status()
+	if !status[0].Healthy || status[1].Healthy || status[2].Healthy {
+		t.Fatalf("unexpected health %+v", status)
+	}
+	if status[1].SlotLag != DefaultMaxSlotLag+1 {
+		t.Fatalf("slot lag = %d", status[1].SlotLag)
+	}
+
+	// Only the healthy endpoint is used while it is available
+	ahead.calls.Store(0)
+	client := pool.Client()
+	for i := 0; i < 4; i++ {
+		if _, err := client.GetBalance(context.Background(), sol.SolMint, rpc.CommitmentConfirmed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ahead.calls.Load() != 4 {
+		t.Fatalf("healthy endpoint got %d of 4 calls", ahead.calls.Load())
+	}
+}
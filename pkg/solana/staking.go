@@ -0,0 +1,425 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go-vue/pkg/storage"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	// Offsets of the authorized staker and withdrawer in stake accounts
+	stakeStakerOffset     = 12
+	stakeWithdrawerOffset = 44
+
+	// DefaultRewardEpochs is how many past epochs of rewards are loaded
+	DefaultRewardEpochs = 10
+	// MaxRewardEpochs bounds reward lookups, one RPC call per epoch
+	MaxRewardEpochs = 50
+
+	// rewardSettleEpochs is how many epochs pass before a missing reward
+	// is stored as none, rewards are paid out during the following epoch
+	rewardSettleEpochs = 2
+
+	validatorTTL = 10 * time.Minute
+)
+
+// Stake activation states
+const (
+	StakeInactive     = "inactive"
+	StakeActivating   = "activating"
+	StakeActive       = "active"
+	StakeDeactivating = "deactivating"
+)
+
+// Validator describes the vote account a stake is delegated to
+type Validator struct {
+	VoteAccount    string  `json:"vote_account"`
+	Identity       string  `json:"identity,omitempty"`
+	Commission     uint8   `json:"commission"`
+	ActivatedStake float64 `json:"activated_stake"`
+	Delinquent     bool    `json:"delinquent"`
+}
+
+// StakeReward is the inflation reward of a stake account for one epoch
+type StakeReward struct {
+	Epoch         uint64  `json:"epoch"`
+	Amount        float64 `json:"amount"`
+	PostBalance   float64 `json:"post_balance"`
+	EffectiveSlot uint64  `json:"effective_slot"`
+	Commission    *uint8  `json:"commission,omitempty"`
+}
+
+// StakeAccount is a stake account controlled by a wallet
+type StakeAccount struct {
+	Address    string `json:"address"`
+	Staker     string `json:"staker"`
+	Withdrawer string `json:"withdrawer"`
+	Lamports   uint64 `json:"lamports"`
+	// Balance is the account balance in SOL, Delegated the delegated stake
+	Balance           float64       `json:"balance"`
+	Delegated         float64       `json:"delegated"`
+	RentExemptReserve float64       `json:"rent_exempt_reserve"`
+	State             string        `json:"state"`
+	ActivationEpoch   *uint64       `json:"activation_epoch,omitempty"`
+	DeactivationEpoch *uint64       `json:"deactivation_epoch,omitempty"`
+	Validator         *Validator    `json:"validator,omitempty"`
+	Rewards           []StakeReward `json:"rewards,omitempty"`
+	TotalRewards      float64       `json:"total_rewards"`
+}
+
+// EpochReward is the reward of all stake accounts of a wallet in an epoch
+type EpochReward struct {
+	Epoch  uint64  `json:"epoch"`
+	Amount float64 `json:"amount"`
+}
+
+// StakingOverview summarizes the stake accounts of a wallet
+type StakingOverview struct {
+	Address  string         `json:"address"`
+	Epoch    uint64         `json:"epoch"`
+	Accounts []StakeAccount `json:"accounts"`
+	// TotalStaked is the balance of all stake accounts, ActiveStake the
+	// delegated stake currently earning rewards
+	TotalStaked  float64       `json:"total_staked"`
+	ActiveStake  float64       `json:"active_stake"`
+	TotalRewards float64       `json:"total_rewards"`
+	Rewards      []EpochReward `json:"rewards"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// parsedStakeAccount is the jsonParsed layout of a stake account
+type parsedStakeAccount struct {
+	Parsed struct {
+		Type string `json:"type"`
+		Info struct {
+			Meta struct {
+				RentExemptReserve uint64 `json:"rentExemptReserve,string"`
+				Authorized        struct {
+					Staker     string `json:"staker"`
+					Withdrawer string `json:"withdrawer"`
+				} `json:"authorized"`
+			} `json:"meta"`
+			Stake *struct {
+				Delegation struct {
+					Voter             string `json:"voter"`
+					Stake             uint64 `json:"stake,string"`
+					ActivationEpoch   uint64 `json:"activationEpoch,string"`
+					DeactivationEpoch uint64 `json:"deactivationEpoch,string"`
+				} `json:"delegation"`
+			} `json:"stake"`
+		} `json:"info"`
+	} `json:"parsed"`
+}
+
+// parseStakeAccount decodes a jsonParsed stake account at epoch
+func parseStakeAccount(address string, lamports uint64, data []byte, epoch uint64) (*StakeAccount, error) {
+	var parsed parsedStakeAccount
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode stake account %s: %v", address, err)
+	}
+	info := parsed.Parsed.Info
+	account := &StakeAccount{
+		Address:           address,
+		Staker:            info.Meta.Authorized.Staker,
+		Withdrawer:        info.Meta.Authorized.Withdrawer,
+		Lamports:          lamports,
+		Balance:           lamportsToSOL(lamports),
+		RentExemptReserve: lamportsToSOL(info.Meta.RentExemptReserve),
+		State:             StakeInactive,
+	}
+	if parsed.Parsed.Type != "delegated" || info.Stake == nil {
+		return account, nil
+	}
+
+	delegation := info.Stake.Delegation
+	account.Delegated = lamportsToSOL(delegation.Stake)
+	account.Validator = &Validator{VoteAccount: delegation.Voter}
+	account.ActivationEpoch = &delegation.ActivationEpoch
+	if delegation.DeactivationEpoch != math.MaxUint64 {
+		account.DeactivationEpoch = &delegation.DeactivationEpoch
+	}
+	account.State = stakeState(delegation.ActivationEpoch, delegation.DeactivationEpoch, epoch)
+	return account, nil
+}
+
+// stakeState derives the activation state of a delegation at epoch. Stake
+// warms up and cools down over one epoch, the cluster wide rate limit only
+// matters for very large stake movements and is ignored.
+func stakeState(activation, deactivation, epoch uint64) string {
+	switch {
+	case deactivation != math.MaxUint64 && epoch > deactivation:
+		return StakeInactive
+	case deactivation != math.MaxUint64:
+		if activation == deactivation {
+			// Deactivated before it became active
+			return StakeInactive
+		}
+		return StakeDeactivating
+	case epoch <= activation:
+		return StakeActivating
+	default:
+		return StakeActive
+	}
+}
+
+type cachedValidator struct {
+	validator Validator
+	fetchedAt time.Time
+}
+
+// StakingService finds the stake accounts of wallets and their rewards.
+// Rewards of completed epochs never change and are kept in the store.
+type StakingService struct {
+	client *rpc.Client
+	store  storage.Store
+
+	mu         sync.Mutex
+	validators map[string]cachedValidator
+}
+
+// NewStakingService creates a staking service
+func NewStakingService(client *rpc.Client, store storage.Store) *StakingService {
+	return &StakingService{
+		client:     client,
+		store:      store,
+		validators: make(map[string]cachedValidator),
+	}
+}
+
+// Accounts returns the stake accounts address is staker or withdrawer of
+func (s *StakingService) Accounts(ctx context.Context, address string) ([]StakeAccount, uint64, error) {
+	owner, err := ParseAddress(address)
+	if err != nil {
+		return nil, 0, err
+	}
+	epochInfo, err := s.client.GetEpochInfo(ctx, commitmentFrom(ctx))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get epoch: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	accounts := []StakeAccount{}
+	for _, offset := range []uint64{stakeStakerOffset, stakeWithdrawerOffset} {
+		result, err := s.client.GetProgramAccountsWithOpts(ctx, sol.StakeProgramID, &rpc.GetProgramAccountsOpts{
+			Encoding:   sol.EncodingJSONParsed,
+			Commitment: commitmentFrom(ctx),
+			Filters:    []rpc.RPCFilter{{Memcmp: &rpc.RPCFilterMemcmp{Offset: offset, Bytes: owner.Bytes()}}},
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get stake accounts: %v", err)
+		}
+		for _, keyed := range result {
+			address := keyed.Pubkey.String()
+			if seen[address] || keyed.Account == nil || keyed.Account.Data == nil {
+				continue
+			}
+			seen[address] = true
+			account, err := parseStakeAccount(address, keyed.Account.Lamports, keyed.Account.Data.GetRawJSON(), epochInfo.Epoch)
+			if err != nil {
+				return nil, 0, err
+			}
+			accounts = append(accounts, *account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Lamports > accounts[j].Lamports })
+	return accounts, epochInfo.Epoch, nil
+}
+
+// Overview returns the stake accounts of address with validator details
+// and the rewards of the last epochs
+func (s *StakingService) Overview(ctx context.Context, address string, epochs int) (*StakingOverview, error) {
+	if epochs <= 0 {
+		epochs = DefaultRewardEpochs
+	}
+	if epochs > MaxRewardEpochs {
+		epochs = MaxRewardEpochs
+	}
+	accounts, epoch, err := s.Accounts(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	overview := &StakingOverview{
+		Address:   address,
+		Epoch:     epoch,
+		Accounts:  accounts,
+		Rewards:   []EpochReward{},
+		UpdatedAt: time.Now(),
+	}
+	if len(accounts) == 0 {
+		return overview, nil
+	}
+
+	for i := range accounts {
+		account := &accounts[i]
+		if account.Validator != nil {
+			// Validator details are informative, a failed lookup keeps the
+			// vote account only
+			if validator, err := s.validator(ctx, account.Validator.VoteAccount); err == nil {
+				account.Validator = validator
+			}
+		}
+	}
+
+	rewards, err := s.rewards(ctx, accounts, epoch, epochs)
+	if err != nil {
+		return nil, err
+	}
+	byEpoch := make(map[uint64]float64)
+	for i := range accounts {
+		account := &accounts[i]
+		account.Rewards = rewards[account.Address]
+		for _, reward := range account.Rewards {
+			account.TotalRewards += reward.Amount
+			byEpoch[reward.Epoch] += reward.Amount
+		}
+		overview.TotalStaked += account.Balance
+		if account.State == StakeActive || account.State == StakeDeactivating {
+			overview.ActiveStake += account.Delegated
+		}
+		overview.TotalRewards += account.TotalRewards
+	}
+	for n := 1; n <= epochs && uint64(n) <= epoch; n++ {
+		e := epoch - uint64(n)
+		overview.Rewards = append(overview.Rewards, EpochReward{Epoch: e, Amount: byEpoch[e]})
+	}
+	return overview, nil
+}
+
+// rewards loads the inflation rewards of accounts for the epochs before
+// epoch, newest first, reading completed epochs from the store. An epoch
+// without reward is only stored once rewardSettleEpochs have passed.
+func (s *StakingService) rewards(ctx context.Context, accounts []StakeAccount, epoch uint64, epochs int) (map[string][]StakeReward, error) {
+	result := make(map[string][]StakeReward, len(accounts))
+	for n := 1; n <= epochs && uint64(n) <= epoch; n++ {
+		e := epoch - uint64(n)
+		var missing []sol.PublicKey
+		for _, account := range accounts {
+			reward, err := s.cachedReward(ctx, account.Address, e)
+			if errors.Is(err, storage.ErrNotFound) {
+				missing = append(missing, sol.MustPublicKeyFromBase58(account.Address))
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if reward != nil {
+				result[account.Address] = append(result[account.Address], *reward)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		epochCopy := e
+		fetched, err := s.client.GetInflationReward(ctx, missing, &rpc.GetInflationRewardOpts{
+			Commitment: confirmedCommitmentFrom(ctx),
+			Epoch:      &epochCopy,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inflation rewards for epoch %d: %v", e, err)
+		}
+		for i, address := range missing {
+			var reward *StakeReward
+			if i < len(fetched) && fetched[i] != nil {
+				reward = &StakeReward{
+					Epoch:         fetched[i].Epoch,
+					Amount:        lamportsToSOL(fetched[i].Amount),
+					PostBalance:   lamportsToSOL(fetched[i].PostBalance),
+					EffectiveSlot: fetched[i].EffectiveSlot,
+					Commission:    fetched[i].Commission,
+				}
+				result[address.String()] = append(result[address.String()], *reward)
+			}
+			if reward == nil && n <= rewardSettleEpochs {
+				// the reward may not be paid out yet
+				continue
+			}
+			if err := s.putReward(ctx, address.String(), e, reward); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func rewardKey(address string, epoch uint64) string {
+	return fmt.Sprintf("solana/staking/rewards/%s/%010d", address, epoch)
+}
+
+// cachedReward returns the stored reward, nil for an epoch without reward
+func (s *StakingService) cachedReward(ctx context.Context, address string, epoch uint64) (*StakeReward, error) {
+	data, err := s.store.Get(ctx, rewardKey(address, epoch))
+	if err != nil {
+		return nil, err
+	}
+	var reward *StakeReward
+	if err := json.Unmarshal(data, &reward); err != nil {
+		return nil, fmt.Errorf("failed to decode stake reward: %v", err)
+	}
+	return reward, nil
+}
+
+func (s *StakingService) putReward(ctx context.Context, address string, epoch uint64, reward *StakeReward) error {
+	data, err := json.Marshal(reward)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Put(ctx, rewardKey(address, epoch), data); err != nil {
+		return fmt.Errorf("failed to save stake reward: %v", err)
+	}
+	return nil
+}
+
+// validator returns details of a vote account, cached for validatorTTL
+func (s *StakingService) validator(ctx context.Context, voteAccount string) (*Validator, error) {
+	s.mu.Lock()
+	if cached, ok := s.validators[voteAccount]; ok && time.Since(cached.fetchedAt) < validatorTTL {
+		s.mu.Unlock()
+		return &cached.validator, nil
+	}
+	s.mu.Unlock()
+
+	key, err := ParseAddress(voteAccount)
+	if err != nil {
+		return nil, err
+	}
+	keep := true
+	result, err := s.client.GetVoteAccounts(ctx, &rpc.GetVoteAccountsOpts{
+		Commitment:              commitmentFrom(ctx),
+		VotePubkey:              &key,
+		KeepUnstakedDelinquents: &keep,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vote account: %v", err)
+	}
+
+	validator := Validator{VoteAccount: voteAccount}
+	for _, group := range []struct {
+		accounts   []rpc.VoteAccountsResult
+		delinquent bool
+	}{{result.Current, false}, {result.Delinquent, true}} {
+		for _, vote := range group.accounts {
+			if vote.VotePubkey.Equals(key) {
+				validator.Identity = vote.NodePubkey.String()
+				validator.Commission = vote.Commission
+				validator.ActivatedStake = lamportsToSOL(vote.ActivatedStake)
+				validator.Delinquent = group.delinquent
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.validators[voteAccount] = cachedValidator{validator: validator, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return &validator, nil
+}
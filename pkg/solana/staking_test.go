@@ -0,0 +1,97 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-vue/pkg/storage"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestParseStakeAccount(t *testing.T) {
+	data := []byte(`{"program": "stake", "parsed": {"type": "delegated", "info": {
+		"meta": {"rentExemptReserve": "2282880", "authorized": {"staker": "` + testWallet + `", "withdrawer": "` + testWallet + `"}},
+		"stake": {"delegation": {"voter": "` + testOther + `", "stake": "9997717120", "activationEpoch": "600", "deactivationEpoch": "18446744073709551615"}}
+	}}}`)
+
+	account, err := parseStakeAccount("stake", 10_000_000_000, data, 610)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.State != StakeActive || account.Balance != 10 || account.Delegated != 9.99771712 ||
+		account.Validator == nil || account.Validator.VoteAccount != testOther || account.DeactivationEpoch != nil {
+		t.Fatalf("unexpected account %+v", account)
+	}
+
+	initialized := []byte(`{"parsed": {"type": "initialized", "info": {"meta": {"rentExemptReserve": "2282880", "authorized": {"staker": "a", "withdrawer": "b"}}}}}`)
+	account, err = parseStakeAccount("stake", 2282880, initialized, 610)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.State != StakeInactive || account.Validator != nil || account.Withdrawer != "b" {
+		t.Fatalf("unexpected initialized account %+v", account)
+	}
+}
+
+func TestStakeState(t *testing.T) {
+	never := uint64(math.MaxUint64)
+	tests := []struct {
+		activation, deactivation, epoch uint64
+		want                            string
+	}{
+		{100, never, 100, StakeActivating},
+		{100, never, 101, StakeActive},
+		{100, 105, 105, StakeDeactivating},
+		{100, 105, 106, StakeInactive},
+		{100, 100, 100, StakeInactive},
+	}
+	for _, tt := range tests {
+		if got := stakeState(tt.activation, tt.deactivation, tt.epoch); got != tt.want {
+			t.Errorf("stakeState(%d, %d, %d) = %s, want %s", tt.activation, tt.deactivation, tt.epoch, got, tt.want)
+		}
+	}
+}
+
+func TestRewardsStoreOnlySettledMisses(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		calls++
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":[null]}`, req.ID)
+	}))
+	defer server.Close()
+
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStakingService(rpc.New(server.URL), store)
+	accounts := []StakeAccount{{Address: testWallet}}
+	for i := 0; i < 2; i++ {
+		if _, err := s.rewards(context.Background(), accounts, 100, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// epochs 99 and 98 are asked again, 97 is stored as without reward
+	if calls != 5 {
+		t.Fatalf("got %d reward calls, want 5", calls)
+	}
+	for _, epoch := range []uint64{99, 98} {
+		if _, err := s.cachedReward(context.Background(), testWallet, epoch); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("epoch %d: expected no stored reward, got %v", epoch, err)
+		}
+	}
+	if reward, err := s.cachedReward(context.Background(), testWallet, 97); err != nil || reward != nil {
+		t.Fatalf("epoch 97: got %v, %v", reward, err)
+	}
+}
@@ -0,0 +1,396 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	// rpcBatchSize is the account limit of getMultipleAccounts
+	rpcBatchSize = 100
+	// priceBatchSize is how many mints are priced per price API request
+	priceBatchSize = 100
+	priceTTL       = time.Minute
+	// metadataTTL is how long mint decimals and metadata are cached
+	metadataTTL = 24 * time.Hour
+)
+
+// TokenInfo describes an SPL token mint
+type TokenInfo struct {
+	Mint     string `json:"mint"`
+	Symbol   string `json:"symbol,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Decimals uint8  `json:"decimals"`
+	Program  string `json:"program,omitempty"`
+	// URI points to the off-chain Metaplex metadata
+	URI      string  `json:"uri,omitempty"`
+	PriceUSD float64 `json:"price_usd"`
+}
+
+// TokenDetails is a token with the origin of its price
+type TokenDetails struct {
+	TokenInfo
+	// PriceSource is "api", "raydium" or "orca"
+	PriceSource    string     `json:"price_source,omitempty"`
+	Pool           *PoolQuote `json:"pool,omitempty"`
+	PriceUpdatedAt time.Time  `json:"price_updated_at,omitempty"`
+}
+
+// knownTokens covers the most common mints so they have a symbol even when
+// no metadata is stored on-chain
+var knownTokens = map[string]TokenInfo{
+	sol.SolMint.String():                           {Symbol: "SOL", Name: "Wrapped SOL", Decimals: 9},
+	"EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v": {Symbol: "USDC", Name: "USD Coin", Decimals: 6},
+	"Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB": {Symbol: "USDT", Name: "USDT", Decimals: 6},
+	"JUPyiwrYJFskUPiHa7hkeR8VUtAeFoSYbKedZNsDvCN":  {Symbol: "JUP", Name: "Jupiter", Decimals: 6},
+	"DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263": {Symbol: "BONK", Name: "Bonk", Decimals: 5},
+	"mSoLzYCxHdYgdzU16g5QSh3i5K3z3KZK7ytfqcJm7So":  {Symbol: "mSOL", Name: "Marinade staked SOL", Decimals: 9},
+	"J1toso1uCk3RLmjorhTtrVwY9HJ7X8V9yYac6Y7kGCPn": {Symbol: "JitoSOL", Name: "Jito Staked SOL", Decimals: 9},
+	"4k3Dyjzvzp8eMZWUXbBCjEvwSkkk59S5iCNLY3QrkX6R": {Symbol: "RAY", Name: "Raydium", Decimals: 6},
+	"EKpQGSJtjMFqKZ9KQanSqYXRcF8fBopzLHYxdM65zcjm": {Symbol: "WIF", Name: "dogwifhat", Decimals: 6},
+	"HZ1JovNiVvGrGNiiYvEozEVgZ58xaU3RKwX8eACQBCt3": {Symbol: "PYTH", Name: "Pyth Network", Decimals: 6},
+}
+
+type cachedPrice struct {
+	price     float64
+	source    string
+	pool      *PoolQuote
+	fetchedAt time.Time
+}
+
+type cachedMint struct {
+	info      TokenInfo
+	fetchedAt time.Time
+}
+
+// TokenResolver resolves mint decimals, metadata and USD prices. Mint data
+// is read from the jsonParsed mint account, which includes the Token-2022
+// metadata extension, and from the Metaplex metadata account. Prices come
+// from a Jupiter compatible price API and, with pool pricing enabled, from
+// Raydium AMM and Orca Whirlpool reserves for mints the API does not know.
+type TokenResolver struct {
+	client      *rpc.Client
+	priceAPI    string
+	httpClient  *http.Client
+	poolPricing bool
+
+	mu     sync.Mutex
+	mints  map[string]cachedMint
+	prices map[string]cachedPrice
+	pools  map[string]cachedPools
+	// poolFailures holds when the pool lookup of a mint last failed
+	poolFailures map[string]time.Time
+}
+
+// NewTokenResolver creates a resolver. priceAPI is the base URL of a price
+// endpoint accepting ?ids=<mint,...>, an empty value disables pricing.
+func NewTokenResolver(client *rpc.Client, priceAPI string) *TokenResolver {
+	return &TokenResolver{
+		client:       client,
+		priceAPI:     priceAPI,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		mints:        make(map[string]cachedMint),
+		prices:       make(map[string]cachedPrice),
+		pools:        make(map[string]cachedPools),
+		poolFailures: make(map[string]time.Time),
+	}
+}
+
+// EnablePoolPricing prices mints missing from the price API from DEX pool
+// reserves
+func (r *TokenResolver) EnablePoolPricing() {
+	r.poolPricing = true
+}
+
+// Resolve returns token info with prices for mints. Mints that cannot be
+// resolved are still returned with what is known about them.
+func (r *TokenResolver) Resolve(ctx context.Context, mints []string) (map[string]TokenInfo, error) {
+	infos, err := r.mintInfos(ctx, mints)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := r.Prices(ctx, mints)
+	if err != nil {
+		// Balances are still useful without prices
+		prices = map[string]float64{}
+	}
+	for mint, info := range infos {
+		info.PriceUSD = prices[mint]
+		infos[mint] = info
+	}
+	return infos, nil
+}
+
+// mintInfos loads decimals and metadata of mints not yet cached
+func (r *TokenResolver) mintInfos(ctx context.Context, mints []string) (map[string]TokenInfo, error) {
+	result := make(map[string]TokenInfo, len(mints))
+	var missing []sol.PublicKey
+
+	r.mu.Lock()
+	for _, mint := range mints {
+		if cached, ok := r.mints[mint]; ok && time.Since(cached.fetchedAt) < metadataTTL {
+			result[mint] = cached.info
+			continue
+		}
+		key, err := sol.PublicKeyFromBase58(mint)
+		if err != nil {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("invalid mint %s: %v", mint, err)
+		}
+		missing = append(missing, key)
+	}
+	r.mu.Unlock()
+
+	for start := 0; start < len(missing); start += rpcBatchSize {
+		end := start + rpcBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := missing[start:end]
+
+		accounts, err := r.client.GetMultipleAccountsWithOpts(ctx, batch, &rpc.GetMultipleAccountsOpts{
+			Encoding:   sol.EncodingJSONParsed,
+			Commitment: commitmentFrom(ctx),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mint accounts: %v", err)
+		}
+
+		infos := make([]TokenInfo, len(batch))
+		var unnamed []sol.PublicKey
+		for i, account := range accounts.Value {
+			info := knownTokens[batch[i].String()]
+			info.Mint = batch[i].String()
+			if account != nil {
+				parseMintAccount(account, &info)
+				if info.Symbol == "" || info.Name == "" {
+					unnamed = append(unnamed, batch[i])
+				}
+			}
+			infos[i] = info
+		}
+
+		// Most tokens keep their name in a Metaplex metadata account. A
+		// failed lookup leaves them unnamed until the next refresh.
+		var metadata map[string]*metaplexMetadata
+		if len(unnamed) > 0 {
+			metadata, _ = metaplexMetadataFor(ctx, r.client, unnamed)
+		}
+
+		now := time.Now()
+		r.mu.Lock()
+		for _, info := range infos {
+			if m, ok := metadata[info.Mint]; ok {
+				if info.Symbol == "" {
+					info.Symbol = m.Symbol
+				}
+				if info.Name == "" {
+					info.Name = m.Name
+				}
+				info.URI = m.URI
+			}
+			r.mints[info.Mint] = cachedMint{info: info, fetchedAt: now}
+			result[info.Mint] = info
+		}
+		r.mu.Unlock()
+	}
+	return result, nil
+}
+
+// parsedMint is the jsonParsed layout of a mint account
+type parsedMint struct {
+	Program string `json:"program"`
+	Parsed  struct {
+		Type string `json:"type"`
+		Info struct {
+			Decimals   uint8 `json:"decimals"`
+			Extensions []struct {
+				Extension string `json:"extension"`
+				State     struct {
+					Name   string `json:"name"`
+					Symbol string `json:"symbol"`
+				} `json:"state"`
+			} `json:"extensions"`
+		} `json:"info"`
+	} `json:"parsed"`
+}
+
+func parseMintAccount(account *rpc.Account, info *TokenInfo) {
+	if account.Data == nil {
+		return
+	}
+	var parsed parsedMint
+	if err := json.Unmarshal(account.Data.GetRawJSON(), &parsed); err != nil || parsed.Parsed.Type != "mint" {
+		return
+	}
+
+	info.Decimals = parsed.Parsed.Info.Decimals
+	info.Program = parsed.Program
+	for _, ext := range parsed.Parsed.Info.Extensions {
+		if ext.Extension != "tokenMetadata" {
+			continue
+		}
+		if info.Symbol == "" {
+			info.Symbol = strings.TrimSpace(ext.State.Symbol)
+		}
+		if info.Name == "" {
+			info.Name = strings.TrimSpace(ext.State.Name)
+		}
+	}
+}
+
+// Prices returns USD prices for mints, using cached values younger than
+// priceTTL. Mints without a price are omitted. At most poolLookupBudget
+// mints are priced from pools per call, and a mint whose pool lookup failed
+// is skipped for poolFailureTTL.
+func (r *TokenResolver) Prices(ctx context.Context, mints []string) (map[string]float64, error) {
+	result := make(map[string]float64, len(mints))
+	if r.priceAPI == "" && !r.poolPricing {
+		return result, nil
+	}
+
+	var missing []string
+	r.mu.Lock()
+	for _, mint := range mints {
+		if cached, ok := r.prices[mint]; ok && time.Since(cached.fetchedAt) < priceTTL {
+			if cached.price > 0 {
+				result[mint] = cached.price
+			}
+			continue
+		}
+		missing = append(missing, mint)
+	}
+	r.mu.Unlock()
+
+	// Misses are cached too, unknown tokens should not be re-requested on
+	// every call
+	fetched := make(map[string]cachedPrice, len(missing))
+	var apiErr error
+	for start := 0; r.priceAPI != "" && start < len(missing); start += priceBatchSize {
+		end := start + priceBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		prices, err := r.fetchPrices(ctx, missing[start:end])
+		if err != nil {
+			apiErr = err
+			break
+		}
+		for _, mint := range missing[start:end] {
+			fetched[mint] = cachedPrice{price: prices[mint], source: "api"}
+		}
+	}
+	if r.poolPricing {
+		lookups := 0
+		for _, mint := range missing {
+			if fetched[mint].price > 0 || r.poolFailed(mint) {
+				continue
+			}
+			if lookups == poolLookupBudget {
+				break
+			}
+			lookups++
+			quote, err := r.poolQuote(ctx, mint)
+			if err != nil {
+				r.mu.Lock()
+				r.poolFailures[mint] = time.Now()
+				r.mu.Unlock()
+				continue
+			}
+			if quote == nil {
+				fetched[mint] = cachedPrice{}
+				continue
+			}
+			fetched[mint] = cachedPrice{price: quote.PriceUSD, source: quote.Venue, pool: quote}
+		}
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	for mint, price := range fetched {
+		price.fetchedAt = now
+		r.prices[mint] = price
+		if price.price > 0 {
+			result[mint] = price.price
+		}
+	}
+	r.mu.Unlock()
+	return result, apiErr
+}
+
+// poolFailed reports whether the pool lookup of mint failed less than
+// poolFailureTTL ago
+func (r *TokenResolver) poolFailed(mint string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failed, ok := r.poolFailures[mint]
+	return ok && time.Since(failed) < poolFailureTTL
+}
+
+// Token returns the metadata and price of mint with the origin of the price
+func (r *TokenResolver) Token(ctx context.Context, mint string) (*TokenDetails, error) {
+	infos, err := r.Resolve(ctx, []string{mint})
+	if err != nil {
+		return nil, err
+	}
+	details := &TokenDetails{TokenInfo: infos[mint]}
+	r.mu.Lock()
+	if cached, ok := r.prices[mint]; ok && cached.price > 0 {
+		details.PriceSource = cached.source
+		details.Pool = cached.pool
+		details.PriceUpdatedAt = cached.fetchedAt
+	}
+	r.mu.Unlock()
+	return details, nil
+}
+
+// fetchPrices queries the price API for a batch of mints
+func (r *TokenResolver) fetchPrices(ctx context.Context, mints []string) (map[string]float64, error) {
+	endpoint := r.priceAPI + "?ids=" + url.QueryEscape(strings.Join(mints, ","))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prices: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("price API returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]*struct {
+			Price json.RawMessage `json:"price"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode prices: %v", err)
+	}
+
+	prices := make(map[string]float64, len(body.Data))
+	for mint, entry := range body.Data {
+		if entry == nil {
+			continue
+		}
+		// The price is a string in Jupiter v2 and a number in other APIs
+		raw := strings.Trim(string(entry.Price), `"`)
+		if price, err := strconv.ParseFloat(raw, 64); err == nil {
+			prices[mint] = price
+		}
+	}
+	return prices, nil
+}
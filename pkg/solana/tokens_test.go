@@ -0,0 +1,131 @@
+package solana
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestTokenResolverPricesCachesMisses(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if got := r.URL.Query().Get("ids"); got != "A,B,C" {
+			t.Errorf("unexpected ids %q", got)
+		}
+		fmt.Fprint(w, `{"data":{"A":{"price":"1.5"},"B":{"price":2},"C":null}}`)
+	}))
+	defer server.Close()
+
+	resolver := NewTokenResolver(nil, server.URL)
+	for i := 0; i < 2; i++ {
+		prices, err := resolver.Prices(context.Background(), []string{"A", "B", "C"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prices["A"] != 1.5 || prices["B"] != 2 {
+			t.Fatalf("unexpected prices %v", prices)
+		}
+		if _, ok := prices["C"]; ok {
+			t.Fatal("mint without a price must be omitted")
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("price API called %d times, want 1", requests)
+	}
+}
+
+func TestTokenResolverPoolLookupBudget(t *testing.T) {
+	searches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Method == "getProgramAccounts" {
+			searches++
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":429,"message":"rate limited"}}`, req.ID)
+	}))
+	defer server.Close()
+
+	resolver := NewTokenResolver(rpc.New(server.URL), "")
+	resolver.EnablePoolPricing()
+	var mints []string
+	for i := 0; i < poolLookupBudget+2; i++ {
+		mints = append(mints, sol.NewWallet().PublicKey().String())
+	}
+
+	// every failed lookup costs one search and is not repeated
+	want := []int{poolLookupBudget, poolLookupBudget + 2, poolLookupBudget + 2}
+	for i, total := range want {
+		if _, err := resolver.Prices(context.Background(), mints); err != nil {
+			t.Fatal(err)
+		}
+		if searches != total {
+			t.Fatalf("call %d: %d pool searches, want %d", i+1, searches, total)
+		}
+	}
+}
+
+func TestParseMetaplexMetadata(t *testing.T) {
+	mint := sol.MustPublicKeyFromBase58(testUSDC)
+	data := append([]byte{metaplexMetadataKey}, make([]byte, 32)...)
+	data = append(data, mint.Bytes()...)
+	for _, field := range []string{"Dog Wif Hat", "WIF", "https://example.com/wif.json"} {
+		// Strings are stored zero padded to a fixed length
+		padded := append([]byte(field), make([]byte, 8)...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(padded)))
+		data = append(data, padded...)
+	}
+
+	metadata, err := parseMetaplexMetadata(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Mint != testUSDC || metadata.Name != "Dog Wif Hat" || metadata.Symbol != "WIF" || metadata.URI != "https://example.com/wif.json" {
+		t.Fatalf("unexpected metadata %+v", metadata)
+	}
+	if _, err := parseMetaplexMetadata(data[:70]); err == nil {
+		t.Fatal("truncated account must fail")
+	}
+}
+
+func TestPoolBasePrice(t *testing.T) {
+	data := make([]byte, raydiumPoolSize)
+	binary.LittleEndian.PutUint64(data[raydiumQuoteNeedTakePnl:], 1_000_000)
+	raydium, err := parseRaydiumPool(sol.PublicKey{}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1000 SOL against 150001 USDC, of which 1 USDC is owed to the owner
+	if price := raydium.basePrice(1000e9, 150_001e6, 9, 6); math.Abs(price-150) > 1e-9 {
+		t.Fatalf("raydium price = %v, want 150", price)
+	}
+
+	// A Whirlpool stores sqrt(price) in raw units as Q64.64
+	sqrt := new(big.Float).Mul(big.NewFloat(math.Sqrt(150e-3)), new(big.Float).SetMantExp(big.NewFloat(1), 64))
+	raw, _ := sqrt.Int(nil)
+	data = make([]byte, whirlpoolSize)
+	bytes := raw.FillBytes(make([]byte, 16))
+	for i := range bytes {
+		data[whirlpoolSqrtPrice+i] = bytes[15-i]
+	}
+	whirlpool, err := parseWhirlpool(sol.PublicKey{}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price := whirlpool.basePrice(0, 0, 9, 6); math.Abs(price-150) > 1e-6 {
+		t.Fatalf("whirlpool price = %v, want 150", price)
+	}
+}
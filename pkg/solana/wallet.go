@@ -0,0 +1,210 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// TokenBalance is an SPL token account held by a wallet
+type TokenBalance struct {
+	Mint     string  `json:"mint"`
+	Account  string  `json:"account"`
+	Program  string  `json:"program"`
+	Symbol   string  `json:"symbol,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Amount   string  `json:"amount"`
+	Decimals uint8   `json:"decimals"`
+	UIAmount float64 `json:"ui_amount"`
+	PriceUSD float64 `json:"price_usd"`
+	ValueUSD float64 `json:"value_usd"`
+	NFT      bool    `json:"nft"`
+}
+
+// Wallet is the holdings view of a Solana address
+type Wallet struct {
+	Address     string         `json:"address"`
+	Lamports    uint64         `json:"lamports"`
+	SOL         float64        `json:"sol"`
+	SOLPriceUSD float64        `json:"sol_price_usd"`
+	SOLValueUSD float64        `json:"sol_value_usd"`
+	Tokens      []TokenBalance `json:"tokens"`
+	// StakedSOL is the balance of the wallet's stake accounts, TotalSOL
+	// the liquid and staked SOL together
+	StakedSOL      float64   `json:"staked_sol"`
+	StakedValueUSD float64   `json:"staked_value_usd"`
+	TotalSOL       float64   `json:"total_sol"`
+	TotalValueUSD  float64   `json:"total_value_usd"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// AddStake includes the balance of stake accounts in the wallet totals
+func (w *Wallet) AddStake(accounts []StakeAccount) {
+	for _, account := range accounts {
+		w.StakedSOL += account.Balance
+	}
+	w.StakedValueUSD = w.StakedSOL * w.SOLPriceUSD
+	w.TotalSOL = w.SOL + w.StakedSOL
+	w.TotalValueUSD += w.StakedValueUSD
+}
+
+// WalletService reads balances of Solana wallets
+type WalletService struct {
+	client *rpc.Client
+	tokens *TokenResolver
+}
+
+// NewWalletService creates a wallet service sharing client and tokens
+func NewWalletService(client *rpc.Client, tokens *TokenResolver) *WalletService {
+	return &WalletService{
+		client: client,
+		tokens: tokens,
+	}
+}
+
+// ParseAddress validates a base58 wallet address
+func ParseAddress(address string) (sol.PublicKey, error) {
+	key, err := sol.PublicKeyFromBase58(address)
+	if err != nil {
+		return sol.PublicKey{}, fmt.Errorf("invalid Solana address %q: %v", address, err)
+	}
+	return key, nil
+}
+
+// GetSOLBalance returns the native balance of address in SOL
+func (s *WalletService) GetSOLBalance(ctx context.Context, address string) (float64, error) {
+	owner, err := ParseAddress(address)
+	if err != nil {
+		return 0, err
+	}
+	balance, err := s.client.GetBalance(ctx, owner, commitmentFrom(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get balance: %v", err)
+	}
+	return lamportsToSOL(balance.Value), nil
+}
+
+// GetWallet returns the SOL balance and all non-empty SPL token accounts of
+// address, valued in USD where a price is available
+func (s *WalletService) GetWallet(ctx context.Context, address string) (*Wallet, error) {
+	owner, err := ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := s.client.GetBalance(ctx, owner, commitmentFrom(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %v", err)
+	}
+	wallet := &Wallet{
+		Address:   owner.String(),
+		Lamports:  balance.Value,
+		SOL:       lamportsToSOL(balance.Value),
+		TotalSOL:  lamportsToSOL(balance.Value),
+		Tokens:    []TokenBalance{},
+		UpdatedAt: time.Now(),
+	}
+
+	for _, program := range tokenPrograms {
+		balances, err := s.tokenBalances(ctx, owner, program)
+		if err != nil {
+			return nil, err
+		}
+		wallet.Tokens = append(wallet.Tokens, balances...)
+	}
+
+	mints := []string{sol.SolMint.String()}
+	for _, token := range wallet.Tokens {
+		mints = append(mints, token.Mint)
+	}
+	infos, err := s.tokens.Resolve(ctx, mints)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet.SOLPriceUSD = infos[sol.SolMint.String()].PriceUSD
+	wallet.SOLValueUSD = wallet.SOL * wallet.SOLPriceUSD
+	wallet.TotalValueUSD = wallet.SOLValueUSD
+	for i := range wallet.Tokens {
+		token := &wallet.Tokens[i]
+		info := infos[token.Mint]
+		token.Symbol = info.Symbol
+		token.Name = info.Name
+		token.PriceUSD = info.PriceUSD
+		token.ValueUSD = token.UIAmount * info.PriceUSD
+		wallet.TotalValueUSD += token.ValueUSD
+	}
+
+	sort.SliceStable(wallet.Tokens, func(i, j int) bool {
+		if wallet.Tokens[i].ValueUSD != wallet.Tokens[j].ValueUSD {
+			return wallet.Tokens[i].ValueUSD > wallet.Tokens[j].ValueUSD
+		}
+		return wallet.Tokens[i].UIAmount > wallet.Tokens[j].UIAmount
+	})
+	return wallet, nil
+}
+
+// parsedTokenAccount is the jsonParsed layout of a token account
+type parsedTokenAccount struct {
+	Parsed struct {
+		Info struct {
+			Mint        string `json:"mint"`
+			TokenAmount struct {
+				Amount   string `json:"amount"`
+				Decimals uint8  `json:"decimals"`
+			} `json:"tokenAmount"`
+		} `json:"info"`
+	} `json:"parsed"`
+}
+
+// tokenBalances lists the non-empty token accounts of owner for program
+func (s *WalletService) tokenBalances(ctx context.Context, owner, program sol.PublicKey) ([]TokenBalance, error) {
+	result, err := s.client.GetTokenAccountsByOwner(ctx, owner,
+		&rpc.GetTokenAccountsConfig{ProgramId: &program},
+		&rpc.GetTokenAccountsOpts{Encoding: sol.EncodingJSONParsed, Commitment: commitmentFrom(ctx)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s accounts: %v", programName(program), err)
+	}
+
+	var balances []TokenBalance
+	for _, account := range result.Value {
+		if account.Account.Data == nil {
+			continue
+		}
+		var parsed parsedTokenAccount
+		if err := json.Unmarshal(account.Account.Data.GetRawJSON(), &parsed); err != nil {
+			continue
+		}
+		info := parsed.Parsed.Info
+		raw, err := strconv.ParseUint(info.TokenAmount.Amount, 10, 64)
+		if err != nil || raw == 0 {
+			continue
+		}
+
+		balances = append(balances, TokenBalance{
+			Mint:     info.Mint,
+			Account:  account.Pubkey.String(),
+			Program:  programName(program),
+			Amount:   info.TokenAmount.Amount,
+			Decimals: info.TokenAmount.Decimals,
+			UIAmount: uiAmount(raw, info.TokenAmount.Decimals),
+			NFT:      info.TokenAmount.Decimals == 0 && raw == 1,
+		})
+	}
+	return balances, nil
+}
+
+func lamportsToSOL(lamports uint64) float64 {
+	return float64(lamports) / float64(sol.LAMPORTS_PER_SOL)
+}
+
+func uiAmount(raw uint64, decimals uint8) float64 {
+	return float64(raw) / math.Pow10(int(decimals))
+}
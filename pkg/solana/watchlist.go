@@ -0,0 +1,224 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/storage"
+)
+
+const watchlistPrefix = "solana/watchlist/"
+
+// Watchlist errors
+var (
+	ErrWatchNotFound = errors.New("wallet is not on the watchlist")
+	ErrWatchExists   = errors.New("wallet is already on the watchlist")
+)
+
+// WatchedWallet is a wallet followed for copy trading
+type WatchedWallet struct {
+	Address string   `json:"address"`
+	Label   string   `json:"label"`
+	Tags    []string `json:"tags"`
+	// Notify enables copy-trade signals for the wallet
+	Notify    bool      `json:"notify"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HasTag reports whether the wallet is tagged with tag, ignoring case
+func (w *WatchedWallet) HasTag(tag string) bool {
+	return containsFold(w.Tags, tag)
+}
+
+// Watchlist is the persistent list of followed wallets. Every wallet on it
+// is watched by the Monitor.
+type Watchlist struct {
+	store   storage.Store
+	monitor *Monitor
+	// pinned addresses are watched regardless of the watchlist
+	pinned map[string]bool
+
+	mu sync.Mutex
+}
+
+// NewWatchlist creates a watchlist backed by store. Removing a pinned
+// address from the watchlist keeps it watched by monitor.
+func NewWatchlist(store storage.Store, monitor *Monitor, pinned []string) *Watchlist {
+	w := &Watchlist{
+		store:   store,
+		monitor: monitor,
+		pinned:  make(map[string]bool),
+	}
+	for _, address := range pinned {
+		if key, err := ParseAddress(address); err == nil {
+			w.pinned[key.String()] = true
+		}
+	}
+	return w
+}
+
+// Load starts watching all stored wallets and backfills their history
+func (w *Watchlist) Load(ctx context.Context) error {
+	wallets, err := w.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, wallet := range wallets {
+		if err := w.monitor.Watch(wallet.Address); err != nil {
+			return err
+		}
+		w.monitor.Backfill(ctx, wallet.Address)
+	}
+	return nil
+}
+
+// List returns the watched wallets, optionally only those tagged with tag
+func (w *Watchlist) List(ctx context.Context, tag string) ([]WatchedWallet, error) {
+	keys, err := w.store.List(ctx, watchlistPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watchlist: %v", err)
+	}
+	wallets := []WatchedWallet{}
+	for _, key := range keys {
+		wallet, err := w.Get(ctx, strings.TrimPrefix(key, watchlistPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if tag == "" || wallet.HasTag(tag) {
+			wallets = append(wallets, *wallet)
+		}
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].CreatedAt.Before(wallets[j].CreatedAt) })
+	return wallets, nil
+}
+
+// Get returns the watched wallet with address
+func (w *Watchlist) Get(ctx context.Context, address string) (*WatchedWallet, error) {
+	data, err := w.store.Get(ctx, watchlistPrefix+address)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrWatchNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watched wallet: %v", err)
+	}
+	var wallet WatchedWallet
+	if err := json.Unmarshal(data, &wallet); err != nil {
+		return nil, fmt.Errorf("failed to decode watched wallet: %v", err)
+	}
+	return &wallet, nil
+}
+
+// Add puts a new wallet on the watchlist, starts watching it and backfills
+// its history
+func (w *Watchlist) Add(ctx context.Context, wallet WatchedWallet) (*WatchedWallet, error) {
+	key, err := ParseAddress(wallet.Address)
+	if err != nil {
+		return nil, err
+	}
+	wallet.Address = key.String()
+	wallet.Tags = normalizeTags(wallet.Tags)
+	wallet.CreatedAt = time.Now()
+	wallet.UpdatedAt = wallet.CreatedAt
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.Get(ctx, wallet.Address); err == nil {
+		return nil, ErrWatchExists
+	} else if !errors.Is(err, ErrWatchNotFound) {
+		return nil, err
+	}
+	// Watch before storing so a wallet is never listed without being
+	// watched
+	if err := w.monitor.Watch(wallet.Address); err != nil {
+		return nil, err
+	}
+	if err := w.put(ctx, &wallet); err != nil {
+		if !w.pinned[wallet.Address] {
+			w.monitor.Unwatch(wallet.Address)
+		}
+		return nil, err
+	}
+	w.monitor.Backfill(ctx, wallet.Address)
+	return &wallet, nil
+}
+
+// WatchedWalletUpdate holds the fields of a watched wallet to change, nil
+// fields are left unchanged
+type WatchedWalletUpdate struct {
+	Label  *string
+	Tags   *[]string
+	Notify *bool
+}
+
+// Update changes label, tags and the notify flag of a watched wallet
+func (w *Watchlist) Update(ctx context.Context, address string, update WatchedWalletUpdate) (*WatchedWallet, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wallet, err := w.Get(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if update.Label != nil {
+		wallet.Label = *update.Label
+	}
+	if update.Tags != nil {
+		wallet.Tags = normalizeTags(*update.Tags)
+	}
+	if update.Notify != nil {
+		wallet.Notify = *update.Notify
+	}
+	wallet.UpdatedAt = time.Now()
+	if err := w.put(ctx, wallet); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// Remove takes a wallet off the watchlist
+func (w *Watchlist) Remove(ctx context.Context, address string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.Get(ctx, address); err != nil {
+		return err
+	}
+	if err := w.store.Delete(ctx, watchlistPrefix+address); err != nil {
+		return fmt.Errorf("failed to delete watched wallet: %v", err)
+	}
+	if !w.pinned[address] {
+		w.monitor.Unwatch(address)
+	}
+	return nil
+}
+
+func (w *Watchlist) put(ctx context.Context, wallet *WatchedWallet) error {
+	data, err := json.Marshal(wallet)
+	if err != nil {
+		return err
+	}
+	if err := w.store.Put(ctx, watchlistPrefix+wallet.Address, data); err != nil {
+		return fmt.Errorf("failed to save watched wallet: %v", err)
+	}
+	return nil
+}
+
+// normalizeTags trims, lowercases and deduplicates tags
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
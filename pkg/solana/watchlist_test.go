@@ -0,0 +1,155 @@
+package solana
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-vue/pkg/events"
+	"go-vue/pkg/storage"
+
+	sol "github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+func TestTradeSignal(t *testing.T) {
+	wallet := &WatchedWallet{Address: testWallet, Label: "whale", Tags: []string{"memes"}}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	buy := testSwap(at, testSOL, 2, "A", 1000)
+	buy.Changes = []BalanceChange{{Mint: testSOL, Symbol: "SOL", Amount: -2}, {Mint: "A", Symbol: "AAA", Amount: 1000}}
+	signal, ok := tradeSignal(wallet, &buy)
+	if !ok || signal.Side != SideBuy || signal.Mint != "A" || signal.Symbol != "AAA" ||
+		signal.Amount != 1000 || signal.QuoteSymbol != "SOL" || signal.Price != 0.002 || signal.Label != "whale" {
+		t.Fatalf("unexpected buy signal %+v", signal)
+	}
+
+	sell := testSwap(at, "A", 500, testUSDC, 40)
+	signal, ok = tradeSignal(wallet, &sell)
+	if !ok || signal.Side != SideSell || signal.Mint != "A" || signal.Amount != 500 ||
+		signal.QuoteMint != testUSDC || signal.Price != 0.08 {
+		t.Fatalf("unexpected sell signal %+v", signal)
+	}
+
+	// Moving between quote assets is not a trade
+	quote := testSwap(at, testSOL, 1, testUSDC, 150)
+	if _, ok := tradeSignal(wallet, &quote); ok {
+		t.Fatal("SOL to USDC swap must not produce a signal")
+	}
+	failed := testSwap(at, testSOL, 1, "A", 10)
+	failed.Success = false
+	if _, ok := tradeSignal(wallet, &failed); ok {
+		t.Fatal("failed swap must not produce a signal")
+	}
+}
+
+func TestWatchlist(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := sol.PublicKeyFromBytes(append([]byte{1}, make([]byte, 31)...)).String()
+	client := rpc.New("http://127.0.0.1:0")
+	monitor := NewMonitor("", client, NewTransactionIndexer(client, store, nil), events.NewBus())
+	watchlist := NewWatchlist(store, monitor, []string{other})
+	ctx := context.Background()
+
+	if _, err := watchlist.Add(ctx, WatchedWallet{Address: testWallet, Label: "a", Tags: []string{" Memes", "memes", "DeFi"}, Notify: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watchlist.Add(ctx, WatchedWallet{Address: testWallet}); !errors.Is(err, ErrWatchExists) {
+		t.Fatalf("duplicate add returned %v", err)
+	}
+	if _, err := watchlist.Add(ctx, WatchedWallet{Address: other, Label: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(monitor.Watched()) != 2 {
+		t.Fatalf("monitor watches %v", monitor.Watched())
+	}
+
+	wallets, err := watchlist.List(ctx, "MEMES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wallets) != 1 || wallets[0].Address != testWallet || len(wallets[0].Tags) != 2 {
+		t.Fatalf("tag filter returned %+v", wallets)
+	}
+
+	label, notify := "renamed", false
+	updated, err := watchlist.Update(ctx, testWallet, WatchedWalletUpdate{Label: &label, Tags: &[]string{}, Notify: &notify})
+	if err != nil || updated.Label != "renamed" || updated.Notify || len(updated.Tags) != 0 {
+		t.Fatalf("update returned %+v, %v", updated, err)
+	}
+	// Omitted fields are left unchanged
+	notify = true
+	updated, err = watchlist.Update(ctx, other, WatchedWalletUpdate{Notify: &notify})
+	if err != nil || updated.Label != "b" || !updated.Notify {
+		t.Fatalf("partial update returned %+v, %v", updated, err)
+	}
+
+	// A fresh watchlist over the same store restores the monitor
+	restored := NewMonitor("", client, NewTransactionIndexer(client, store, nil), events.NewBus())
+	if err := NewWatchlist(store, restored, nil).Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Watched()) != 2 {
+		t.Fatalf("restored monitor watches %v", restored.Watched())
+	}
+
+	// The pinned wallet stays watched after removal
+	if err := watchlist.Remove(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := watchlist.Remove(ctx, testWallet); err != nil {
+		t.Fatal(err)
+	}
+	if watched := monitor.Watched(); len(watched) != 1 || watched[0] != other {
+		t.Fatalf("monitor watches %v, want only the pinned wallet", watched)
+	}
+	if _, err := watchlist.Get(ctx, testWallet); !errors.Is(err, ErrWatchNotFound) {
+		t.Fatalf("get after remove returned %v", err)
+	}
+
+	if err := monitor.Unwatch("not-an-address"); err == nil {
+		t.Fatal("unwatching an invalid address succeeded")
+	}
+	if err := monitor.Unwatch(other); err != nil || len(monitor.Watched()) != 0 {
+		t.Fatalf("unwatch returned %v, monitor watches %v", err, monitor.Watched())
+	}
+}
+
+func TestWatchlistAddBackfills(t *testing.T) {
+	stub := &stubRPC{signatures: []string{testSignature(1), testSignature(2)}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.New(server.URL)
+	indexer := NewTransactionIndexer(client, store, nil)
+	watchlist := NewWatchlist(store, NewMonitor("", client, indexer, events.NewBus()), nil)
+	ctx := context.Background()
+	if _, err := watchlist.Add(ctx, WatchedWallet{Address: testWallet}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The history is indexed without a request for the wallet
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state, err := indexer.State(ctx, testWallet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.Complete && state.Indexed == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("history not backfilled: %+v", state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
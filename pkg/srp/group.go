@@ -0,0 +1,64 @@
+package srp
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// checkedGroups caches groups that already passed the primality checks, the
+// server sends the same prime on every request
+var checkedGroups sync.Map
+
+// CheckGroup verifies that p is a 2048-bit safe prime and that g generates
+// a subgroup of prime order (p-1)/2, as required by
+// https://core.telegram.org/api/srp#checking-the-password-with-srp
+func CheckGroup(g int, p *big.Int) error {
+	if p.BitLen() != 2048 {
+		return fmt.Errorf("%w: p is %d bits, want 2048", ErrInvalidParams, p.BitLen())
+	}
+	if !generatesSubgroup(g, p) {
+		return fmt.Errorf("%w: g=%d is not a valid generator for p", ErrInvalidParams, g)
+	}
+
+	cacheKey := fmt.Sprintf("%d:%x", g, p)
+	if _, ok := checkedGroups.Load(cacheKey); ok {
+		return nil
+	}
+	if !p.ProbablyPrime(20) {
+		return fmt.Errorf("%w: p is not prime", ErrInvalidParams)
+	}
+	q := new(big.Int).Rsh(p, 1)
+	if !q.ProbablyPrime(20) {
+		return fmt.Errorf("%w: (p-1)/2 is not prime", ErrInvalidParams)
+	}
+	checkedGroups.Store(cacheKey, struct{}{})
+	return nil
+}
+
+// generatesSubgroup applies the per-generator congruence conditions on p
+func generatesSubgroup(g int, p *big.Int) bool {
+	mod := func(m int64) int64 {
+		return new(big.Int).Mod(p, big.NewInt(m)).Int64()
+	}
+
+	switch g {
+	case 2:
+		return mod(8) == 7
+	case 3:
+		return mod(3) == 2
+	case 4:
+		return true
+	case 5:
+		r := mod(5)
+		return r == 1 || r == 4
+	case 6:
+		r := mod(24)
+		return r == 19 || r == 23
+	case 7:
+		r := mod(7)
+		return r == 3 || r == 5 || r == 6
+	default:
+		return false
+	}
+}
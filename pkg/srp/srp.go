@@ -0,0 +1,221 @@
+// Package srp implements the client side of Telegram's SRP-2048 password
+// check (PasswordKdfAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow).
+//
+// See https://core.telegram.org/api/srp. The package never logs and keeps
+// intermediate secrets local to the functions that compute them.
+package srp
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// pLen is the byte length of the 2048-bit group used by Telegram
+	pLen = 256
+
+	pbkdf2Iterations = 100000
+
+	// rangeBits bounds g_a and g_b away from 0 and p as required by the spec
+	rangeBits = 2048 - 64
+
+	maxAttempts = 16
+)
+
+var (
+	// ErrInvalidParams is returned when the server sent an unsafe group
+	ErrInvalidParams = errors.New("srp: invalid group parameters")
+	// ErrInvalidB is returned when the server's public value is out of range
+	ErrInvalidB = errors.New("srp: server public value out of range")
+)
+
+// Params are the KDF parameters of the current or new password algorithm
+type Params struct {
+	Salt1 []byte
+	Salt2 []byte
+	G     int
+	P     []byte
+}
+
+// Answer is the client proof sent with auth.checkPassword as
+// inputCheckPasswordSRP
+type Answer struct {
+	A  []byte
+	M1 []byte
+}
+
+// Equal compares two answers in constant time
+func (a Answer) Equal(b Answer) bool {
+	return Equal(a.A, b.A) && Equal(a.M1, b.M1)
+}
+
+// Equal compares two secret byte slices in constant time
+func Equal(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// CheckPassword computes the proof that the user knows password for the
+// server challenge srpB. random provides the client's ephemeral secret and is
+// normally crypto/rand.Reader.
+func CheckPassword(password, srpB []byte, params Params, random io.Reader) (Answer, error) {
+	p, g, err := group(params)
+	if err != nil {
+		return Answer{}, err
+	}
+
+	a := make([]byte, pLen)
+	for i := 0; i < maxAttempts; i++ {
+		if _, err := io.ReadFull(random, a); err != nil {
+			return Answer{}, fmt.Errorf("srp: failed to generate secret: %v", err)
+		}
+		// g_a has to satisfy the same range check the server applies
+		ga := new(big.Int).Exp(g, new(big.Int).SetBytes(a), p)
+		if !inRange(ga, p) {
+			continue
+		}
+		return answer(password, srpB, a, params)
+	}
+	return Answer{}, fmt.Errorf("srp: failed to generate a valid secret")
+}
+
+// answer computes the proof for a fixed client secret a
+func answer(password, srpB, a []byte, params Params) (Answer, error) {
+	p, g, err := group(params)
+	if err != nil {
+		return Answer{}, err
+	}
+
+	gb := new(big.Int).SetBytes(srpB)
+	if len(srpB) > pLen || !inRange(gb, p) {
+		return Answer{}, ErrInvalidB
+	}
+
+	aInt := new(big.Int).SetBytes(a)
+	ga := new(big.Int).Exp(g, aInt, p)
+	gaBytes, gbBytes := pad(ga), pad(gb)
+
+	// u = H(g_a | g_b)
+	u := new(big.Int).SetBytes(hash(gaBytes, gbBytes))
+	if u.Sign() == 0 {
+		return Answer{}, fmt.Errorf("srp: degenerate u")
+	}
+
+	// x = PH2(password, salt1, salt2), v = g^x mod p
+	x := new(big.Int).SetBytes(ph2(password, params.Salt1, params.Salt2))
+	v := new(big.Int).Exp(g, x, p)
+
+	// k = H(p | g), k_v = k * v mod p
+	k := new(big.Int).SetBytes(hash(pad(p), pad(g)))
+	kv := new(big.Int).Mul(k, v)
+	kv.Mod(kv, p)
+
+	// t = (g_b - k_v) mod p, s_a = t^(a + u * x) mod p
+	t := new(big.Int).Sub(gb, kv)
+	t.Mod(t, p)
+	exp := new(big.Int).Mul(u, x)
+	exp.Add(exp, aInt)
+	sa := new(big.Int).Exp(t, exp, p)
+
+	// k_a = H(s_a)
+	ka := hash(pad(sa))
+
+	// M1 = H(H(p) xor H(g) | H(salt1) | H(salt2) | g_a | g_b | k_a)
+	hp, hg := hash(pad(p)), hash(pad(g))
+	for i := range hp {
+		hp[i] ^= hg[i]
+	}
+	m1 := hash(hp, hash(params.Salt1), hash(params.Salt2), gaBytes, gbBytes, ka)
+
+	return Answer{A: gaBytes, M1: m1}, nil
+}
+
+// NewPasswordHash derives new_password_hash for account.updatePasswordSettings.
+// params must be the server's new_algo; the returned params carry the salt1
+// extended with 32 random bytes and have to be sent back as the new algo.
+func NewPasswordHash(password []byte, params Params, random io.Reader) ([]byte, Params, error) {
+	if _, _, err := group(params); err != nil {
+		return nil, Params{}, err
+	}
+
+	salt1 := make([]byte, len(params.Salt1)+32)
+	copy(salt1, params.Salt1)
+	if _, err := io.ReadFull(random, salt1[len(params.Salt1):]); err != nil {
+		return nil, Params{}, fmt.Errorf("srp: failed to generate salt: %v", err)
+	}
+
+	newParams := Params{Salt1: salt1, Salt2: params.Salt2, G: params.G, P: params.P}
+	return verifier(password, newParams), newParams, nil
+}
+
+// VerifyPasswordHash reports whether hash was derived from password with
+// params, comparing in constant time
+func VerifyPasswordHash(password, hash []byte, params Params) bool {
+	if _, _, err := group(params); err != nil {
+		return false
+	}
+	return Equal(verifier(password, params), hash)
+}
+
+// verifier returns v = g^x mod p padded to 256 bytes
+func verifier(password []byte, params Params) []byte {
+	p := new(big.Int).SetBytes(params.P)
+	g := big.NewInt(int64(params.G))
+	x := new(big.Int).SetBytes(ph2(password, params.Salt1, params.Salt2))
+	return pad(new(big.Int).Exp(g, x, p))
+}
+
+// group validates and decodes the Diffie-Hellman group of params
+func group(params Params) (p, g *big.Int, err error) {
+	if len(params.Salt1) == 0 || len(params.Salt2) == 0 {
+		return nil, nil, fmt.Errorf("%w: empty salt", ErrInvalidParams)
+	}
+	p = new(big.Int).SetBytes(params.P)
+	if err := CheckGroup(params.G, p); err != nil {
+		return nil, nil, err
+	}
+	return p, big.NewInt(int64(params.G)), nil
+}
+
+// ph1 = SH(SH(password, salt1), salt2)
+func ph1(password, salt1, salt2 []byte) []byte {
+	return sh(sh(password, salt1), salt2)
+}
+
+// ph2 = SH(pbkdf2(sha512, PH1(password, salt1, salt2), salt1, 100000), salt2)
+func ph2(password, salt1, salt2 []byte) []byte {
+	key := pbkdf2.Key(ph1(password, salt1, salt2), salt1, pbkdf2Iterations, sha512.Size, sha512.New)
+	return sh(key, salt2)
+}
+
+// sh = H(salt | data | salt)
+func sh(data, salt []byte) []byte {
+	return hash(salt, data, salt)
+}
+
+func hash(parts ...[]byte) []byte {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+// pad encodes n big-endian, left padded to 2048 bits
+func pad(n *big.Int) []byte {
+	out := make([]byte, pLen)
+	return n.FillBytes(out)
+}
+
+// inRange checks 2^(2048-64) < n < p - 2^(2048-64)
+func inRange(n, p *big.Int) bool {
+	bound := new(big.Int).Lsh(big.NewInt(1), rangeBits)
+	upper := new(big.Int).Sub(p, bound)
+	return n.Cmp(bound) > 0 && n.Cmp(upper) < 0
+}
@@ -0,0 +1,137 @@
+package srp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// Test vector published with Telegram's SRP documentation and used by TDLib
+var (
+	vectorPassword = []byte("123123")
+	vectorSalt1    = "4D11FB6BEC38F9D2546BB0F61E4F1C99A1BC0DB8F0D5F35B1291B37B213123D7ED48F3C6794D495B"
+	vectorSalt2    = "A1B181AAFE88188680AE32860D60BB01"
+	vectorP        = "C71CAEB9C6B1C9048E6C522F70F13F73980D40238E3E21C14934D037563D930F" +
+		"48198A0AA7C14058229493D22530F4DBFA336F6E0AC925139543AED44CCE7C37" +
+		"20FD51F69458705AC68CD4FE6B6B13ABDC9746512969328454F18FAF8C595F64" +
+		"2477FE96BB2A941D5BCD1D4AC8CC49880708FA9B378E3C4F3A9060BEE67CF9A4" +
+		"A4A695811051907E162753B56B0F6B410DBA74D8A84B2A14B3144E0EF1284754" +
+		"FD17ED950D5965B4B9DD46582DB1178D169C6BC465B0D6FF9CA3928FEF5B9AE4" +
+		"E418FC15E83EBEA0F87FA9FF5EED70050DED2849F47BF959D956850CE929851F" +
+		"0D8115F635B105EE2E4E15D04B2454BF6F4FADF034B10403119CD8E3B92FCC5B"
+	vectorB = "9C52401A6A8084EC82F01C3725D3FB448BD2F0C909F9D97726EAC4B7A74172D9" +
+		"52F02466BE6734FA274D2B7429E27397F10372D66B400B80A5C5AE3F28B17BF3" +
+		"105D7A2D2A885998CDC2DEFC208AEC217AB58859A9ABC2374AD93DC285F4B3FB" +
+		"CAFF4143D7888F2425BD2FB711B25609CEB21757D935B1EF2F042173AD0CE2FE" +
+		"0E474DAC53914BD25A8A9AED4AEA8953D55CB88621DB37B871EA0D04393AC098" +
+		"7F68094CCC9DE8239251375D8FFFD263316CD528C097B7BC9FB919FBEDB76C52" +
+		"5DF3413C374EE076D97A1E6D352BB7CC80FD13651B04B32E2E48C5268150842C" +
+		"FD07CF855958B1B5EA9C36FDAD697FE3AEC8DCC6B1EFEC36874AF226204676CF"
+	vectorM1 = "999DF906BDA2C6CBB52F503406EBA2D0D0503ACE0CC302C38F13EE5010AD4051"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func vectorParams(t *testing.T) Params {
+	return Params{
+		Salt1: mustHex(t, vectorSalt1),
+		Salt2: mustHex(t, vectorSalt2),
+		G:     3,
+		P:     mustHex(t, vectorP),
+	}
+}
+
+func TestAnswerMatchesTelegramVector(t *testing.T) {
+	a := make([]byte, pLen)
+	a[pLen-1] = 1
+
+	got, err := answer(vectorPassword, mustHex(t, vectorB), a, vectorParams(t))
+	if err != nil {
+		t.Fatalf("answer failed: %v", err)
+	}
+
+	wantA := make([]byte, pLen)
+	wantA[pLen-1] = 3
+	want := Answer{A: wantA, M1: mustHex(t, vectorM1)}
+	if !got.Equal(want) {
+		t.Fatalf("got M1 %x, want %s", got.M1, strings.ToLower(vectorM1))
+	}
+}
+
+func TestCheckPasswordRandomSecret(t *testing.T) {
+	params := vectorParams(t)
+	first, err := CheckPassword(vectorPassword, mustHex(t, vectorB), params, rand.Reader)
+	if err != nil {
+		t.Fatalf("CheckPassword failed: %v", err)
+	}
+	second, err := CheckPassword(vectorPassword, mustHex(t, vectorB), params, rand.Reader)
+	if err != nil {
+		t.Fatalf("CheckPassword failed: %v", err)
+	}
+	if len(first.A) != pLen || len(first.M1) != 32 {
+		t.Fatalf("unexpected answer sizes: A=%d M1=%d", len(first.A), len(first.M1))
+	}
+	if first.Equal(second) {
+		t.Fatal("answers with different secrets must differ")
+	}
+}
+
+func TestCheckPasswordRejectsBadInput(t *testing.T) {
+	params := vectorParams(t)
+
+	for name, b := range map[string][]byte{
+		"zero":  {0},
+		"one":   {1},
+		"p":     params.P,
+		"small": big.NewInt(1).Lsh(big.NewInt(1), rangeBits).Bytes(),
+	} {
+		if _, err := CheckPassword(vectorPassword, b, params, rand.Reader); !errors.Is(err, ErrInvalidB) {
+			t.Errorf("%s: expected ErrInvalidB, got %v", name, err)
+		}
+	}
+
+	bad := params
+	bad.G = 2 // p mod 8 != 7 for the Telegram prime
+	if _, err := CheckPassword(vectorPassword, mustHex(t, vectorB), bad, rand.Reader); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("expected ErrInvalidParams for bad generator, got %v", err)
+	}
+
+	composite := params
+	composite.P = append([]byte(nil), params.P...)
+	composite.P[len(composite.P)-1] ^= 0x02
+	if _, err := CheckPassword(vectorPassword, mustHex(t, vectorB), composite, rand.Reader); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("expected ErrInvalidParams for non-prime p, got %v", err)
+	}
+}
+
+func TestNewPasswordHash(t *testing.T) {
+	params := vectorParams(t)
+	hash, newParams, err := NewPasswordHash([]byte("new password"), params, rand.Reader)
+	if err != nil {
+		t.Fatalf("NewPasswordHash failed: %v", err)
+	}
+
+	if len(hash) != pLen {
+		t.Fatalf("hash is %d bytes, want %d", len(hash), pLen)
+	}
+	if len(newParams.Salt1) != len(params.Salt1)+32 || !bytes.HasPrefix(newParams.Salt1, params.Salt1) {
+		t.Fatal("new salt1 must extend the server salt with 32 bytes")
+	}
+	if !VerifyPasswordHash([]byte("new password"), hash, newParams) {
+		t.Fatal("hash does not verify with the new params")
+	}
+	if VerifyPasswordHash([]byte("other password"), hash, newParams) {
+		t.Fatal("hash verified with the wrong password")
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileStore keeps every key in its own file below a base directory
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewFileStore creates a file backed store rooted at dir
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		dir = "data"
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path maps a key to a file path, escaping every segment so that keys
+// can never point outside of the base directory
+func (s *FileStore) path(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid key: %q", key)
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	return filepath.Join(s.dir, filepath.Join(segments...)) + ".json", nil
+}
+
+func (s *FileStore) Get(_ context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return data, nil
+}
+
+func (s *FileStore) Put(_ context.Context, key string, value []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", key, err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn value
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %v", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %v", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *FileStore) List(_ context.Context, prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, strings.TrimSuffix(path, ".json"))
+		if err != nil {
+			return err
+		}
+		segments := strings.Split(filepath.ToSlash(rel), "/")
+		for i, segment := range segments {
+			if segments[i], err = url.PathUnescape(segment); err != nil {
+				return err
+			}
+		}
+
+		key := strings.Join(segments, "/")
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", prefix, err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQLStore keeps keys in a single table. The queries only use syntax shared
+// by Postgres and SQLite so the same implementation serves both.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates the backing table if needed and returns the store.
+// driver is the database/sql driver name the connection was opened with.
+func NewSQLStore(db *sql.DB, driver string) (*SQLStore, error) {
+	blobType := "BLOB"
+	if driver == "postgres" {
+		blobType = "BYTEA"
+	}
+
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS kv_store (
+		key TEXT PRIMARY KEY,
+		value %s NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`, blobType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kv_store table: %v", err)
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM kv_store WHERE key = $1`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return value, nil
+}
+
+func (s *SQLStore) Put(ctx context.Context, key string, value []byte) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO kv_store (key, value, updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, value)
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM kv_store WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) List(ctx context.Context, prefix string) ([]string, error) {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT key FROM kv_store WHERE key LIKE $1 ESCAPE '\' ORDER BY key`,
+		escaper.Replace(prefix)+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", prefix, err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
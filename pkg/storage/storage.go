@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go-vue/pkg/config"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// ErrNotFound is returned when a key does not exist in the store
+var ErrNotFound = errors.New("storage: not found")
+
+// Store is a minimal key/value store used to persist application state.
+// Keys are slash separated paths such as "telegram/session".
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+	// List returns all keys starting with prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// NewStoreFromConfig creates the store selected by STORAGE_DRIVER
+func NewStoreFromConfig() (Store, error) {
+	cfg := config.GlobalConfig
+
+	switch cfg.StorageDriver {
+	case "", "file":
+		return NewFileStore(cfg.StorageDir)
+	case "postgres":
+		dsn := cfg.StorageDSN
+		if dsn == "" {
+			dsn = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+				cfg.PostgresHost, cfg.PostgresPort, cfg.PostgresUser, cfg.PostgresPassword, cfg.PostgresDB)
+		}
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open postgres: %v", err)
+		}
+		return NewSQLStore(db, "postgres")
+	case "sqlite", "sqlite3":
+		// STORAGE_DSN is the database file, go-vue.db in STORAGE_DIR when
+		// empty
+		dsn := cfg.StorageDSN
+		if dsn == "" {
+			if err := os.MkdirAll(cfg.StorageDir, 0700); err != nil {
+				return nil, fmt.Errorf("failed to create storage dir: %v", err)
+			}
+			dsn = filepath.Join(cfg.StorageDir, "go-vue.db")
+		}
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sqlite: %v", err)
+		}
+		// sqlite allows a single writer
+		db.SetMaxOpenConns(1)
+		return NewSQLStore(db, "sqlite")
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.StorageDriver)
+	}
+}
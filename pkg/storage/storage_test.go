@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	for _, key := range []string{"a/1", "a/2", "a_b/1", "b/1"} {
+		if err := store.Put(ctx, key, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Put(ctx, "a/1", []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+	value, err := store.Get(ctx, "a/1")
+	if err != nil || string(value) != "updated" {
+		t.Fatalf("unexpected value %q: %v", value, err)
+	}
+	keys, err := store.List(ctx, "a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a/1", "a/2"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if err := store.Delete(ctx, "a/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "a/1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the deleted key to be gone, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store, err := NewSQLStore(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
@@ -0,0 +1,146 @@
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// profileFile matches the file names written by SaveProfile
+var profileFile = regexp.MustCompile(`^([a-z0-9][a-z0-9_-]*)-v([0-9]+)\.json$`)
+
+// Profile is a named, versioned strategy
+type Profile struct {
+	Name        string    `json:"name"`
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	Description string    `json:"description,omitempty"`
+	Strategy
+	// Optimization is the report of the optimizer run that produced the
+	// profile
+	Optimization json.RawMessage `json:"optimization,omitempty"`
+}
+
+// ValidateProfileName checks that name can be used in a profile file name
+func ValidateProfileName(name string) error {
+	if !profileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q, use lower case letters, digits, - and _", name)
+	}
+	return nil
+}
+
+// SaveProfile writes profile to dir as <name>-v<version>.json with the
+// version after the latest one saved under the same name
+func SaveProfile(dir string, profile *Profile) (string, error) {
+	if err := ValidateProfileName(profile.Name); err != nil {
+		return "", err
+	}
+	if err := profile.Validate(); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create profile directory: %v", err)
+	}
+	versions, err := profileVersions(dir)
+	if err != nil {
+		return "", err
+	}
+	profile.Version = 1
+	if latest := versions[profile.Name]; len(latest) > 0 {
+		profile.Version = latest[len(latest)-1] + 1
+	}
+	if profile.CreatedAt.IsZero() {
+		profile.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-v%d.json", profile.Name, profile.Version))
+	// O_EXCL keeps two concurrent runs from overwriting the same version
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create profile: %v", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write profile: %v", err)
+	}
+	return path, file.Close()
+}
+
+// LoadProfileFile reads a profile from path
+func LoadProfileFile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %v", err)
+	}
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %s: %v", filepath.Base(path), err)
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile %s: %v", filepath.Base(path), err)
+	}
+	return &profile, nil
+}
+
+// LoadProfile reads a version of the profile called name from dir, the
+// latest one when version is 0
+func LoadProfile(dir, name string, version int) (*Profile, error) {
+	if err := ValidateProfileName(name); err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		versions, err := profileVersions(dir)
+		if err != nil {
+			return nil, err
+		}
+		latest := versions[name]
+		if len(latest) == 0 {
+			return nil, fmt.Errorf("profile %q not found", name)
+		}
+		version = latest[len(latest)-1]
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-v%d.json", name, version))
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("profile %q version %d not found", name, version)
+	}
+	return LoadProfileFile(path)
+}
+
+// profileVersions returns the saved versions of every profile in dir in
+// ascending order
+func profileVersions(dir string) (map[string][]int, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string][]int{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profiles: %v", err)
+	}
+	versions := make(map[string][]int)
+	for _, entry := range entries {
+		match := profileFile.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		version, err := strconv.Atoi(match[2])
+		if err != nil || version <= 0 {
+			continue
+		}
+		versions[match[1]] = append(versions[match[1]], version)
+	}
+	for _, list := range versions {
+		sort.Ints(list)
+	}
+	return versions, nil
+}
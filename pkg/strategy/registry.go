@@ -0,0 +1,302 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/storage"
+
+	"github.com/ghodss/yaml"
+)
+
+// DefaultProfile is active until another profile is selected
+const DefaultProfile = "default"
+
+// activeKey stores the profile selected through Switch
+const activeKey = "strategy/active"
+
+// Profile sources
+const (
+	SourceBuiltin   = "builtin"
+	SourceFile      = "file"
+	SourceOptimizer = "optimizer"
+)
+
+// ErrProfileNotFound is returned for unknown profile names
+var ErrProfileNotFound = errors.New("profile not found")
+
+// ProfilesFile is the layout of the profiles file, in YAML or JSON
+type ProfilesFile struct {
+	// Active is the profile used until one is selected through Switch
+	Active   string              `json:"active,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// BuiltinProfiles returns the profiles used when there is no profiles file
+func BuiltinProfiles() map[string]*Profile {
+	return map[string]*Profile{
+		DefaultProfile: {Name: DefaultProfile, Description: "Weights and thresholds of the market dashboard", Strategy: Default()},
+		"conservative": {Name: "conservative", Description: "Strong, broad agreement and wide sentiment bands", Strategy: Conservative()},
+		"aggressive":   {Name: "aggressive", Description: "Acts on weak signals with narrow sentiment bands", Strategy: Aggressive()},
+	}
+}
+
+// ProfileInfo summarizes a profile
+type ProfileInfo struct {
+	Name        string `json:"name"`
+	Version     int    `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	Source      string `json:"source"`
+	Active      bool   `json:"active"`
+}
+
+// RegistryStatus describes the loaded profiles
+type RegistryStatus struct {
+	Active   string        `json:"active"`
+	File     string        `json:"file"`
+	LoadedAt time.Time     `json:"loaded_at"`
+	Error    string        `json:"error,omitempty"`
+	Profiles []ProfileInfo `json:"profiles"`
+}
+
+// Registry holds the named strategy profiles of the profiles file and the
+// latest version of every optimizer profile, and reloads them when the
+// files change. The file wins when both define the same name.
+type Registry struct {
+	path  string
+	dir   string
+	store storage.Store
+
+	mu          sync.RWMutex
+	profiles    map[string]*Profile
+	sources     map[string]string
+	fileActive  string
+	selected    string
+	fingerprint string
+	loadedAt    time.Time
+	loadErr     error
+}
+
+// NewRegistry loads the profiles file at path and the optimizer profiles
+// in dir. A missing file falls back to the built-in profiles.
+func NewRegistry(ctx context.Context, path, dir string, store storage.Store) (*Registry, error) {
+	r := &Registry{path: path, dir: dir, store: store}
+	data, err := store.Get(ctx, activeKey)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load active profile: %v", err)
+	}
+	r.selected = string(data)
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the profiles again. On error the previous profiles stay in
+// use.
+func (r *Registry) Reload() error {
+	fingerprint := r.currentFingerprint()
+	profiles, sources, fileActive, err := r.load()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fingerprint = fingerprint
+	r.loadErr = err
+	if err != nil {
+		return err
+	}
+	r.profiles, r.sources, r.fileActive = profiles, sources, fileActive
+	r.loadedAt = time.Now()
+	return nil
+}
+
+func (r *Registry) load() (map[string]*Profile, map[string]string, string, error) {
+	profiles := make(map[string]*Profile)
+	sources := make(map[string]string)
+
+	if r.dir != "" {
+		versions, err := profileVersions(r.dir)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		for name, list := range versions {
+			profile, err := LoadProfile(r.dir, name, list[len(list)-1])
+			if err != nil {
+				return nil, nil, "", err
+			}
+			profiles[name] = profile
+			sources[name] = SourceOptimizer
+		}
+	}
+
+	file, err := r.readFile()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	source := SourceFile
+	if file == nil {
+		file = &ProfilesFile{Profiles: BuiltinProfiles()}
+		source = SourceBuiltin
+	}
+	for name, profile := range file.Profiles {
+		if profile == nil {
+			return nil, nil, "", fmt.Errorf("profile %q is empty", name)
+		}
+		if err := ValidateProfileName(name); err != nil {
+			return nil, nil, "", err
+		}
+		if err := profile.Validate(); err != nil {
+			return nil, nil, "", fmt.Errorf("invalid profile %q: %v", name, err)
+		}
+		profile.Name = name
+		profiles[name] = profile
+		sources[name] = source
+	}
+	if file.Active != "" && profiles[file.Active] == nil {
+		return nil, nil, "", fmt.Errorf("active profile %q is not defined", file.Active)
+	}
+	if len(profiles) == 0 {
+		return nil, nil, "", fmt.Errorf("no strategy profiles defined")
+	}
+	return profiles, sources, file.Active, nil
+}
+
+// readFile parses the profiles file, nil when it does not exist
+func (r *Registry) readFile() (*ProfilesFile, error) {
+	if r.path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %v", err)
+	}
+	var file ProfilesFile
+	// YAML is a superset of JSON, so both are read the same way
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filepath.Base(r.path), err)
+	}
+	return &file, nil
+}
+
+// currentFingerprint changes whenever the profiles file or the optimizer
+// profile directory changes
+func (r *Registry) currentFingerprint() string {
+	var parts []string
+	if info, err := os.Stat(r.path); err == nil {
+		parts = append(parts, fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size()))
+	}
+	if r.dir != "" {
+		if entries, err := os.ReadDir(r.dir); err == nil {
+			for _, entry := range entries {
+				parts = append(parts, entry.Name())
+			}
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Run reloads the profiles every interval when the files changed
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.RLock()
+			changed := r.currentFingerprint() != r.fingerprint
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("Failed to reload strategy profiles, keeping the previous ones: %v", err)
+			} else {
+				log.Printf("Reloaded strategy profiles, active %s", r.Active().Name)
+			}
+		}
+	}
+}
+
+// activeName returns the name of the profile in use. r.mu must be held.
+func (r *Registry) activeName() string {
+	for _, name := range []string{r.selected, r.fileActive, DefaultProfile} {
+		if name != "" && r.profiles[name] != nil {
+			return name
+		}
+	}
+	names := make([]string, 0, len(r.profiles))
+	for name := range r.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// Active returns the profile in use
+func (r *Registry) Active() *Profile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.profiles[r.activeName()]
+}
+
+// Get returns the profile called name
+func (r *Registry) Get(name string) (*Profile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	profile, ok := r.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	return profile, nil
+}
+
+// Switch makes name the active profile and remembers the choice across
+// restarts
+func (r *Registry) Switch(ctx context.Context, name string) (*Profile, error) {
+	profile, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.Put(ctx, activeKey, []byte(name)); err != nil {
+		return nil, fmt.Errorf("failed to save active profile: %v", err)
+	}
+	r.mu.Lock()
+	r.selected = name
+	r.mu.Unlock()
+	return profile, nil
+}
+
+// Status lists the loaded profiles
+func (r *Registry) Status() RegistryStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	active := r.activeName()
+	status := RegistryStatus{Active: active, File: r.path, LoadedAt: r.loadedAt, Profiles: []ProfileInfo{}}
+	if r.loadErr != nil {
+		status.Error = r.loadErr.Error()
+	}
+	for name, profile := range r.profiles {
+		status.Profiles = append(status.Profiles, ProfileInfo{
+			Name:        name,
+			Version:     profile.Version,
+			Description: profile.Description,
+			Source:      r.sources[name],
+			Active:      name == active,
+		})
+	}
+	sort.Slice(status.Profiles, func(i, j int) bool { return status.Profiles[i].Name < status.Profiles[j].Name })
+	return status
+}
@@ -0,0 +1,96 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-vue/pkg/storage"
+)
+
+const testProfiles = `active: cautious
+profiles:
+  cautious:
+    description: Wide sentiment bands
+    rules:
+      - metric: fear-greed
+        weight: 1
+        buy: 10
+        sell: 90
+    thresholds:
+      strong: 0.5
+      moderate: 0.3
+      strong_agreement: 1
+      moderate_agreement: 1
+      consensus: 0.5
+  eager:
+    rules:
+      - metric: fear-greed
+        weight: 1
+        buy: 40
+        sell: 60
+    thresholds:
+      strong: 0.2
+      moderate: 0.1
+      strong_agreement: 1
+      moderate_agreement: 1
+      consensus: 0.5
+`
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profiles.yaml")
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := NewRegistry(ctx, path, "", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry.Active().Name != DefaultProfile || len(registry.Status().Profiles) != 3 {
+		t.Fatalf("expected the built-in profiles without a file, got %+v", registry.Status())
+	}
+
+	if err := os.WriteFile(path, []byte(testProfiles), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	active := registry.Active()
+	if active.Name != "cautious" || active.Rules[0].Buy != 10 {
+		t.Fatalf("expected the active profile of the file, got %+v", active)
+	}
+	if _, err := registry.Get(DefaultProfile); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("built-in profiles should be replaced by the file, got %v", err)
+	}
+
+	if _, err := registry.Switch(ctx, "eager"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Switch(ctx, "missing"); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("expected ErrProfileNotFound, got %v", err)
+	}
+	restarted, err := NewRegistry(ctx, path, "", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Active().Name != "eager" {
+		t.Fatalf("switch should survive a restart, active %s", restarted.Active().Name)
+	}
+
+	if err := os.WriteFile(path, []byte("profiles:\n  eager:\n    rules: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Reload(); err == nil {
+		t.Fatal("expected an error for a profile without rules")
+	}
+	if registry.Active().Name != "eager" || registry.Status().Error == "" {
+		t.Fatalf("invalid file should keep the previous profiles, got %+v", registry.Status())
+	}
+}
@@ -0,0 +1,262 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+)
+
+// Signals produced by Evaluate
+const (
+	StrongBuy  = "Strong Buy"
+	Buy        = "Buy"
+	Hold       = "Hold"
+	Sell       = "Sell"
+	StrongSell = "Strong Sell"
+)
+
+// Rule scores one metric as +1 (bullish), -1 (bearish) or 0
+type Rule struct {
+	// Metric is the key of the metric, the same as its API endpoint
+	Metric string  `json:"metric"`
+	Weight float64 `json:"weight"`
+	// Buy and Sell are the thresholds scoring +1 and -1. Low values are
+	// bullish when Buy is below Sell, high values otherwise.
+	Buy  float64 `json:"buy"`
+	Sell float64 `json:"sell"`
+	// Change scores the percent change over Change points instead of the
+	// value itself
+	Change int `json:"change,omitempty"`
+	// Labels name the buy, hold and sell outcomes, Buy, Hold and Sell when
+	// empty
+	Labels *Labels `json:"labels,omitempty"`
+}
+
+// Labels are the indicator names shown for each score
+type Labels struct {
+	Buy  string `json:"buy,omitempty"`
+	Hold string `json:"hold,omitempty"`
+	Sell string `json:"sell,omitempty"`
+}
+
+// Label returns the indicator name of score
+func (r Rule) Label(score float64) string {
+	labels := Labels{}
+	if r.Labels != nil {
+		labels = *r.Labels
+	}
+	switch {
+	case score > 0:
+		return orDefault(labels.Buy, Buy)
+	case score < 0:
+		return orDefault(labels.Sell, Sell)
+	}
+	return orDefault(labels.Hold, Hold)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// Score scores value against the rule thresholds
+func (r Rule) Score(value float64) float64 {
+	if r.Buy < r.Sell {
+		if value < r.Buy {
+			return 1
+		}
+		if value > r.Sell {
+			return -1
+		}
+		return 0
+	}
+	if value > r.Buy {
+		return 1
+	}
+	if value < r.Sell {
+		return -1
+	}
+	return 0
+}
+
+// Thresholds turn the weighted score into a signal
+type Thresholds struct {
+	// Strong and Moderate are the absolute weighted scores of strong and
+	// plain buy and sell signals
+	Strong   float64 `json:"strong"`
+	Moderate float64 `json:"moderate"`
+	// StrongAgreement and ModerateAgreement are the number of metrics that
+	// must point in the direction of the signal
+	StrongAgreement   int `json:"strong_agreement"`
+	ModerateAgreement int `json:"moderate_agreement"`
+	// Consensus is the share of metrics that must agree on a strong signal
+	Consensus float64 `json:"consensus"`
+}
+
+// Strategy is a weighted set of rules
+type Strategy struct {
+	Rules      []Rule     `json:"rules"`
+	Thresholds Thresholds `json:"thresholds"`
+}
+
+// Default returns the weights and thresholds of the market dashboard
+func Default() Strategy {
+	return Strategy{
+		Rules: []Rule{
+			{Metric: "fear-greed", Weight: 0.15, Buy: 30, Sell: 70},
+			{Metric: "altcoin-season", Weight: 0.10, Buy: 75, Sell: 25},
+			{Metric: "btc-dominance", Weight: 0.12, Buy: 50, Sell: 60},
+			{Metric: "ssr", Weight: 0.08, Buy: 8, Sell: 12},
+			{Metric: "rsi", Weight: 0.12, Buy: 30, Sell: 70},
+			{Metric: "market-cap", Weight: 0.10, Buy: 5, Sell: -5, Change: 7},
+			{Metric: "moving-averages", Weight: 0.10, Buy: 0, Sell: 0},
+			{Metric: "volume-trend", Weight: 0.06, Buy: 0.1, Sell: -0.1, Labels: &Labels{Buy: "High Rising", Sell: "Low Falling"}},
+			{Metric: "exchange-flows", Weight: 0.06, Buy: -100, Sell: 100},
+			{Metric: "active-addresses", Weight: 0.04, Buy: 0, Sell: 0, Change: 1},
+			{Metric: "whale-transactions", Weight: 0.04, Buy: 0, Sell: 0, Change: 1},
+			{Metric: "bollinger-bands", Weight: 0.03, Buy: 0.04, Sell: 0.02},
+			{Metric: "funding-rate", Weight: 0.03, Buy: -0.0001, Sell: 0.0001},
+			{Metric: "open-interest", Weight: 0.03, Buy: 0, Sell: 0, Change: 1},
+			{Metric: "eth-btc-ratio", Weight: 0.02, Buy: 0, Sell: 0, Change: 1},
+			// shown on the dashboard but not part of the weighted signal
+			{Metric: "liquidation", Weight: 0, Buy: 1e7, Sell: 1e8},
+			// technical indicators a profile can weight: the MACD histogram
+			// and the distance from the Ichimoku cloud in percent of the
+			// price, the stochastic RSI K line and the last move in ATRs
+			{Metric: "macd", Weight: 0, Buy: 0, Sell: 0, Labels: &Labels{Buy: "Bullish", Sell: "Bearish"}},
+			{Metric: "ichimoku", Weight: 0, Buy: 0, Sell: 0, Labels: &Labels{Buy: "Above Cloud", Hold: "In Cloud", Sell: "Below Cloud"}},
+			{Metric: "stoch-rsi", Weight: 0, Buy: 20, Sell: 80, Labels: &Labels{Buy: "Oversold", Sell: "Overbought"}},
+			{Metric: "atr", Weight: 0, Buy: 1, Sell: -1, Labels: &Labels{Buy: "Breakout", Sell: "Breakdown"}},
+			// the open interest against the price from -1 to 1, see
+			// positioning.Regime
+			{Metric: "oi-divergence", Weight: 0, Buy: 0, Sell: 0, Labels: &Labels{Buy: "Bullish", Sell: "Bearish"}},
+		},
+		Thresholds: Thresholds{
+			Strong:            0.4,
+			Moderate:          0.25,
+			StrongAgreement:   3,
+			ModerateAgreement: 2,
+			Consensus:         0.6,
+		},
+	}
+}
+
+// Conservative waits for stronger and broader agreement and uses wider
+// sentiment and momentum bands than Default
+func Conservative() Strategy {
+	s := Default()
+	s.Thresholds = Thresholds{Strong: 0.5, Moderate: 0.35, StrongAgreement: 4, ModerateAgreement: 3, Consensus: 0.7}
+	s.setBand("fear-greed", 20, 80)
+	s.setBand("rsi", 25, 75)
+	return s
+}
+
+// Aggressive acts on weaker signals with narrower bands than Default
+func Aggressive() Strategy {
+	s := Default()
+	s.Thresholds = Thresholds{Strong: 0.3, Moderate: 0.15, StrongAgreement: 2, ModerateAgreement: 1, Consensus: 0.5}
+	s.setBand("fear-greed", 35, 65)
+	s.setBand("rsi", 35, 65)
+	return s
+}
+
+func (s *Strategy) setBand(metric string, buy, sell float64) {
+	for i := range s.Rules {
+		if s.Rules[i].Metric == metric {
+			s.Rules[i].Buy, s.Rules[i].Sell = buy, sell
+		}
+	}
+}
+
+// Rule returns the rule of metric
+func (s Strategy) Rule(metric string) (Rule, bool) {
+	for _, rule := range s.Rules {
+		if rule.Metric == metric {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Validate checks that the strategy can be evaluated
+func (s Strategy) Validate() error {
+	if len(s.Rules) == 0 {
+		return fmt.Errorf("strategy has no rules")
+	}
+	seen := make(map[string]bool)
+	for _, rule := range s.Rules {
+		if rule.Metric == "" {
+			return fmt.Errorf("rule without metric")
+		}
+		if seen[rule.Metric] {
+			return fmt.Errorf("duplicate rule for %s", rule.Metric)
+		}
+		seen[rule.Metric] = true
+		if rule.Weight < 0 || math.IsNaN(rule.Weight) {
+			return fmt.Errorf("invalid weight %v for %s", rule.Weight, rule.Metric)
+		}
+		if rule.Change < 0 {
+			return fmt.Errorf("invalid change %d for %s", rule.Change, rule.Metric)
+		}
+	}
+	if s.Thresholds.Moderate <= 0 || s.Thresholds.Strong < s.Thresholds.Moderate {
+		return fmt.Errorf("thresholds must satisfy 0 < moderate <= strong")
+	}
+	return nil
+}
+
+// Evaluation is the signal of a strategy for a set of metric values
+type Evaluation struct {
+	Score   float64            `json:"score"`
+	Signal  string             `json:"signal"`
+	Bullish int                `json:"bullish"`
+	Bearish int                `json:"bearish"`
+	Neutral int                `json:"neutral"`
+	Scores  map[string]float64 `json:"scores"`
+}
+
+// Evaluate scores the metrics present in values, which hold the value of
+// each metric or, for rules with a Change, the percent change. Missing
+// metrics are left out of the weighted score.
+func (s Strategy) Evaluate(values map[string]float64) Evaluation {
+	eval := Evaluation{Signal: Hold, Scores: make(map[string]float64)}
+	var totalWeight, weighted float64
+	for _, rule := range s.Rules {
+		value, ok := values[rule.Metric]
+		if !ok || rule.Weight == 0 {
+			continue
+		}
+		score := rule.Score(value)
+		eval.Scores[rule.Metric] = score
+		weighted += score * rule.Weight
+		totalWeight += rule.Weight
+		switch {
+		case score > 0:
+			eval.Bullish++
+		case score < 0:
+			eval.Bearish++
+		default:
+			eval.Neutral++
+		}
+	}
+	if totalWeight == 0 {
+		return eval
+	}
+	eval.Score = weighted / totalWeight
+
+	t := s.Thresholds
+	total := eval.Bullish + eval.Bearish + eval.Neutral
+	consensus := float64(max(eval.Bullish, eval.Bearish)) / float64(total)
+	switch {
+	case eval.Score > t.Strong && eval.Bullish >= t.StrongAgreement && consensus >= t.Consensus:
+		eval.Signal = StrongBuy
+	case eval.Score > t.Moderate && eval.Bullish >= t.ModerateAgreement:
+		eval.Signal = Buy
+	case eval.Score < -t.Strong && eval.Bearish >= t.StrongAgreement && consensus >= t.Consensus:
+		eval.Signal = StrongSell
+	case eval.Score < -t.Moderate && eval.Bearish >= t.ModerateAgreement:
+		eval.Signal = Sell
+	}
+	return eval
+}
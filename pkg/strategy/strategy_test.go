@@ -0,0 +1,60 @@
+package strategy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	s := Default()
+	eval := s.Evaluate(map[string]float64{"fear-greed": 20, "rsi": 25, "ssr": 6, "volume-trend": 0})
+	if eval.Signal != StrongBuy || eval.Bullish != 3 || eval.Neutral != 1 {
+		t.Fatalf("unexpected evaluation %+v", eval)
+	}
+	eval = s.Evaluate(map[string]float64{"fear-greed": 80, "rsi": 50})
+	if eval.Signal != Hold || eval.Bearish != 1 {
+		t.Fatalf("one bearish metric should hold, got %+v", eval)
+	}
+	if eval = s.Evaluate(nil); eval.Signal != Hold || eval.Score != 0 {
+		t.Fatalf("unexpected evaluation without metrics %+v", eval)
+	}
+
+	high := Rule{Buy: 0, Sell: 0}
+	if high.Score(1) != 1 || high.Score(-1) != -1 || high.Score(0) != 0 {
+		t.Fatal("equal thresholds should treat high values as bullish")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		profile := &Profile{Name: "btc-daily", Strategy: Default()}
+		profile.Rules[0].Weight = float64(i)
+		path, err := SaveProfile(dir, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.Version != i+1 || filepath.Base(path) != fmt.Sprintf("btc-daily-v%d.json", i+1) {
+			t.Fatalf("saved version %d to %s", profile.Version, path)
+		}
+	}
+	// unrelated files are ignored
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0600)
+
+	latest, err := LoadProfile(dir, "btc-daily", 0)
+	if err != nil || latest.Version != 2 || latest.Rules[0].Weight != 1 {
+		t.Fatalf("LoadProfile latest = %+v, %v", latest, err)
+	}
+	first, err := LoadProfile(dir, "btc-daily", 1)
+	if err != nil || first.Rules[0].Weight != 0 {
+		t.Fatalf("LoadProfile v1 = %+v, %v", first, err)
+	}
+	if _, err := LoadProfile(dir, "missing", 0); err == nil {
+		t.Fatal("expected a missing profile to fail")
+	}
+	if _, err := LoadProfile(dir, "../etc", 0); err == nil {
+		t.Fatal("expected an invalid name to fail")
+	}
+}
@@ -0,0 +1,485 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/internal/models"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+const (
+	dialogsPageSize = 100
+
+	// fullChannelConcurrency limits parallel channels.getFullChannel calls,
+	// Telegram answers bursts of them with FLOOD_WAIT
+	fullChannelConcurrency = 4
+	fullChannelTTL         = 30 * time.Minute
+)
+
+// Peer folders accepted by GroupsOptions.Folder
+const (
+	FolderAll     = -1
+	FolderMain    = 0
+	FolderArchive = 1
+)
+
+// GroupsOptions selects which dialogs GetUserGroups returns
+type GroupsOptions struct {
+	// Folder is FolderMain, FolderArchive or FolderAll
+	Folder int
+	// FilterID restricts the result to a custom chat folder, 0 disables it
+	FilterID int
+	// Enrich loads descriptions, exact member counts and linked chats of
+	// channels with channels.getFullChannel
+	Enrich bool
+}
+
+type peerKey struct {
+	kind string
+	id   int64
+}
+
+func keyOfPeer(peer tg.PeerClass) peerKey {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		return peerKey{ChatTypeUser, p.UserID}
+	case *tg.PeerChat:
+		return peerKey{ChatTypeChat, p.ChatID}
+	case *tg.PeerChannel:
+		return peerKey{ChatTypeChannel, p.ChannelID}
+	}
+	return peerKey{}
+}
+
+func keyOfInputPeer(peer tg.InputPeerClass) peerKey {
+	switch p := peer.(type) {
+	case *tg.InputPeerUser:
+		return peerKey{ChatTypeUser, p.UserID}
+	case *tg.InputPeerChat:
+		return peerKey{ChatTypeChat, p.ChatID}
+	case *tg.InputPeerChannel:
+		return peerKey{ChatTypeChannel, p.ChannelID}
+	}
+	return peerKey{}
+}
+
+// dialogsPage is one messages.getDialogs response with its entities indexed
+type dialogsPage struct {
+	dialogs  []tg.DialogClass
+	messages []tg.MessageClass
+	chats    []tg.ChatClass
+	users    []tg.UserClass
+	last     bool
+}
+
+// fullChannelCache keeps channels.getFullChannel results for fullChannelTTL
+type fullChannelCache struct {
+	mu      sync.Mutex
+	entries map[int64]fullChannelEntry
+}
+
+type fullChannelEntry struct {
+	full      *tg.ChannelFull
+	fetchedAt time.Time
+}
+
+func (c *fullChannelCache) get(channelID int64) (*tg.ChannelFull, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[channelID]
+	if !ok || time.Since(entry.fetchedAt) > fullChannelTTL {
+		return nil, false
+	}
+	return entry.full, true
+}
+
+func (c *fullChannelCache) put(channelID int64, full *tg.ChannelFull) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[int64]fullChannelEntry)
+	}
+	c.entries[channelID] = fullChannelEntry{full: full, fetchedAt: time.Now()}
+}
+
+// GetUserGroups returns every group and channel in the account's dialogs,
+// following the dialog pagination until the list is exhausted
+func (s *TelegramService) GetUserGroups(opts GroupsOptions) ([]models.TelegramGroup, error) {
+	s.mu.Lock()
+	client := s.client
+	baseCtx := s.ctx
+	s.mu.Unlock()
+	if client == nil {
+		return nil, fmt.Errorf("no authenticated client available")
+	}
+
+	ctx, cancel := context.WithTimeout(baseCtx, 2*time.Minute)
+	defer cancel()
+	api := client.API()
+
+	var filter *tg.DialogFilter
+	if opts.FilterID != 0 {
+		f, err := s.dialogFilter(ctx, api, opts.FilterID)
+		if err != nil {
+			return nil, err
+		}
+		filter = f
+	}
+
+	folders := []int{opts.Folder}
+	if opts.Folder == FolderAll {
+		folders = []int{FolderMain, FolderArchive}
+	}
+
+	var groups []models.TelegramGroup
+	channels := make(map[int64]*tg.Channel)
+	for _, folder := range folders {
+		err := s.iterDialogs(ctx, api, folder, func(page dialogsPage) {
+			chats := make(map[peerKey]tg.ChatClass, len(page.chats))
+			for _, chat := range page.chats {
+				switch c := chat.(type) {
+				case *tg.Chat:
+					chats[peerKey{ChatTypeChat, c.ID}] = c
+				case *tg.Channel:
+					chats[peerKey{ChatTypeChannel, c.ID}] = c
+				}
+			}
+
+			for _, d := range page.dialogs {
+				dialog, ok := d.(*tg.Dialog)
+				if !ok {
+					continue
+				}
+				key := keyOfPeer(dialog.Peer)
+				chat, ok := chats[key]
+				if !ok {
+					// Private chats and dialogs whose chat was not returned
+					continue
+				}
+				if filter != nil && !dialogFilterMatches(filter, key, chat, folder) {
+					continue
+				}
+
+				group := groupFromChat(chat)
+				group.FolderID = folder
+				group.Archived = folder == FolderArchive
+				group.Pinned = dialog.Pinned
+				groups = append(groups, group)
+				if channel, ok := chat.(*tg.Channel); ok {
+					channels[channel.ID] = channel
+				}
+			}
+		})
+		if err != nil {
+			if strings.Contains(err.Error(), "AUTH_KEY_UNREGISTERED") {
+				s.removeSession()
+				return nil, fmt.Errorf("session expired, please re-authenticate")
+			}
+			return nil, fmt.Errorf("failed to get dialogs: %v", err)
+		}
+	}
+
+	if opts.Enrich {
+		s.enrichChannels(ctx, api, groups, channels)
+	}
+
+	s.logger.Info("Retrieved user groups", zap.Int("count", len(groups)))
+	return groups, nil
+}
+
+// iterDialogs pages through messages.getDialogs of a peer folder using the
+// date, id and peer of the last dialog's top message as the next offset
+func (s *TelegramService) iterDialogs(ctx context.Context, api *tg.Client, folder int, fn func(page dialogsPage)) error {
+	request := &tg.MessagesGetDialogsRequest{
+		OffsetPeer: &tg.InputPeerEmpty{},
+		Limit:      dialogsPageSize,
+	}
+	request.SetFolderID(folder)
+	seen := make(map[peerKey]bool)
+
+	for {
+		result, err := api.MessagesGetDialogs(ctx, request)
+		if err != nil {
+			return err
+		}
+
+		var page dialogsPage
+		switch d := result.(type) {
+		case *tg.MessagesDialogs:
+			page = dialogsPage{dialogs: d.Dialogs, messages: d.Messages, chats: d.Chats, users: d.Users, last: true}
+		case *tg.MessagesDialogsSlice:
+			page = dialogsPage{dialogs: d.Dialogs, messages: d.Messages, chats: d.Chats, users: d.Users,
+				last: len(d.Dialogs) < dialogsPageSize}
+		default:
+			return fmt.Errorf("unexpected dialogs type %T", result)
+		}
+
+		// Dialogs can shift between pages when new messages arrive, drop
+		// the ones already returned
+		fresh := page.dialogs[:0:0]
+		for _, dialog := range page.dialogs {
+			key := keyOfPeer(dialog.GetPeer())
+			if !seen[key] {
+				seen[key] = true
+				fresh = append(fresh, dialog)
+			}
+		}
+		page.dialogs = fresh
+		fn(page)
+
+		if page.last || len(fresh) == 0 {
+			return nil
+		}
+		if !nextDialogsOffset(request, page) {
+			return nil
+		}
+	}
+}
+
+// nextDialogsOffset points request after the last dialog of page
+func nextDialogsOffset(request *tg.MessagesGetDialogsRequest, page dialogsPage) bool {
+	last, ok := page.dialogs[len(page.dialogs)-1].(*tg.Dialog)
+	if !ok {
+		return false
+	}
+
+	lastKey := keyOfPeer(last.Peer)
+	var date int
+	for _, m := range page.messages {
+		msg, ok := m.AsNotEmpty()
+		if ok && msg.GetID() == last.TopMessage && keyOfPeer(msg.GetPeerID()) == lastKey {
+			date = msg.GetDate()
+			break
+		}
+	}
+	if date == 0 {
+		return false
+	}
+
+	var offsetPeer tg.InputPeerClass
+	switch lastKey.kind {
+	case ChatTypeUser:
+		for _, u := range page.users {
+			if user, ok := u.(*tg.User); ok && user.ID == lastKey.id {
+				offsetPeer = user.AsInputPeer()
+			}
+		}
+	case ChatTypeChat:
+		offsetPeer = &tg.InputPeerChat{ChatID: lastKey.id}
+	case ChatTypeChannel:
+		for _, c := range page.chats {
+			if channel, ok := c.(*tg.Channel); ok && channel.ID == lastKey.id {
+				offsetPeer = channel.AsInputPeer()
+			}
+		}
+	}
+	if offsetPeer == nil {
+		return false
+	}
+
+	request.OffsetDate = date
+	request.OffsetID = last.TopMessage
+	request.OffsetPeer = offsetPeer
+	return true
+}
+
+// groupFromChat converts a chat or channel into the API model
+func groupFromChat(chat tg.ChatClass) models.TelegramGroup {
+	switch c := chat.(type) {
+	case *tg.Channel:
+		group := models.TelegramGroup{
+			ID:       c.ID,
+			Title:    c.Title,
+			Username: c.Username,
+			Type:     models.GroupTypeChannel,
+			Verified: c.Verified,
+			Scam:     c.Scam,
+			Fake:     c.Fake,
+		}
+		if c.Megagroup || c.Gigagroup {
+			group.Type = models.GroupTypeSupergroup
+		}
+		if members, ok := c.GetParticipantsCount(); ok {
+			group.Members = members
+		}
+		if photo, ok := c.Photo.(*tg.ChatPhoto); ok {
+			group.PhotoID = photo.PhotoID
+		}
+		return group
+	case *tg.Chat:
+		group := models.TelegramGroup{
+			ID:      c.ID,
+			Title:   c.Title,
+			Type:    models.GroupTypeGroup,
+			Members: c.ParticipantsCount,
+		}
+		if photo, ok := c.Photo.(*tg.ChatPhoto); ok {
+			group.PhotoID = photo.PhotoID
+		}
+		return group
+	}
+	return models.TelegramGroup{}
+}
+
+// enrichChannels fills channel details from channels.getFullChannel. Calls
+// run with limited concurrency and results are cached; enrichment stops at
+// the first FLOOD_WAIT and the remaining channels keep their basic data.
+func (s *TelegramService) enrichChannels(ctx context.Context, api *tg.Client, groups []models.TelegramGroup, channels map[int64]*tg.Channel) {
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, fullChannelConcurrency)
+		flooded = make(chan struct{})
+		once    sync.Once
+	)
+
+	for i := range groups {
+		channel, ok := channels[groups[i].ID]
+		if !ok {
+			continue
+		}
+		if full, ok := s.fullChannels.get(channel.ID); ok {
+			applyChannelFull(&groups[i], full)
+			continue
+		}
+
+		wg.Add(1)
+		go func(group *models.TelegramGroup, channel *tg.Channel) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-flooded:
+				return
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-flooded:
+				return
+			default:
+			}
+
+			result, err := api.ChannelsGetFullChannel(ctx, channel.AsInput())
+			if err != nil {
+				if wait, ok := tgerr.AsFloodWait(err); ok {
+					once.Do(func() {
+						s.logger.Warn("Flood wait while loading channel details, skipping the rest",
+							zap.Duration("wait", wait))
+						close(flooded)
+					})
+					return
+				}
+				s.logger.Warn("Failed to get channel full info",
+					zap.Int64("channel_id", channel.ID), zap.Error(err))
+				return
+			}
+			full, ok := result.FullChat.(*tg.ChannelFull)
+			if !ok {
+				return
+			}
+			s.fullChannels.put(channel.ID, full)
+			applyChannelFull(group, full)
+		}(&groups[i], channel)
+	}
+	wg.Wait()
+}
+
+func applyChannelFull(group *models.TelegramGroup, full *tg.ChannelFull) {
+	group.Description = full.About
+	if members, ok := full.GetParticipantsCount(); ok {
+		group.Members = members
+	}
+	if linked, ok := full.GetLinkedChatID(); ok {
+		group.LinkedChatID = linked
+	}
+}
+
+// GetFolders returns the custom chat folders of the account
+func (s *TelegramService) GetFolders() ([]models.TelegramFolder, error) {
+	s.mu.Lock()
+	client := s.client
+	baseCtx := s.ctx
+	s.mu.Unlock()
+	if client == nil {
+		return nil, fmt.Errorf("no authenticated client available")
+	}
+
+	ctx, cancel := context.WithTimeout(baseCtx, 30*time.Second)
+	defer cancel()
+
+	result, err := client.API().MessagesGetDialogFilters(ctx)
+	if err != nil {
+		return nil, s.formatError(err)
+	}
+
+	folders := []models.TelegramFolder{}
+	for _, f := range result.Filters {
+		switch filter := f.(type) {
+		case *tg.DialogFilter:
+			folders = append(folders, models.TelegramFolder{ID: filter.ID, Title: filter.Title.Text})
+		case *tg.DialogFilterChatlist:
+			folders = append(folders, models.TelegramFolder{ID: filter.ID, Title: filter.Title.Text})
+		}
+	}
+	return folders, nil
+}
+
+// dialogFilter loads a custom folder as a DialogFilter. Shared folders
+// (chatlists) only have explicit peers and are converted accordingly.
+func (s *TelegramService) dialogFilter(ctx context.Context, api *tg.Client, id int) (*tg.DialogFilter, error) {
+	result, err := api.MessagesGetDialogFilters(ctx)
+	if err != nil {
+		return nil, s.formatError(err)
+	}
+	for _, f := range result.Filters {
+		switch filter := f.(type) {
+		case *tg.DialogFilter:
+			if filter.ID == id {
+				return filter, nil
+			}
+		case *tg.DialogFilterChatlist:
+			if filter.ID == id {
+				return &tg.DialogFilter{ID: filter.ID, PinnedPeers: filter.PinnedPeers, IncludePeers: filter.IncludePeers}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("chat folder %d not found", id)
+}
+
+// dialogFilterMatches applies the peer lists and group/channel category
+// flags of a folder. Flags about read or muted state are not evaluated.
+func dialogFilterMatches(filter *tg.DialogFilter, key peerKey, chat tg.ChatClass, folder int) bool {
+	for _, peer := range filter.ExcludePeers {
+		if keyOfInputPeer(peer) == key {
+			return false
+		}
+	}
+	for _, peers := range [][]tg.InputPeerClass{filter.PinnedPeers, filter.IncludePeers} {
+		for _, peer := range peers {
+			if keyOfInputPeer(peer) == key {
+				return true
+			}
+		}
+	}
+	if filter.ExcludeArchived && folder == FolderArchive {
+		return false
+	}
+
+	switch c := chat.(type) {
+	case *tg.Chat:
+		return filter.Groups
+	case *tg.Channel:
+		if c.Broadcast {
+			return filter.Broadcasts
+		}
+		return filter.Groups
+	}
+	return false
+}
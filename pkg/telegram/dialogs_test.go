@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestNextDialogsOffset(t *testing.T) {
+	channel := &tg.Channel{ID: 2}
+	channel.SetAccessHash(42)
+
+	page := dialogsPage{
+		dialogs: []tg.DialogClass{
+			&tg.Dialog{Peer: &tg.PeerChat{ChatID: 1}, TopMessage: 10},
+			&tg.Dialog{Peer: &tg.PeerChannel{ChannelID: 2}, TopMessage: 20},
+		},
+		messages: []tg.MessageClass{
+			&tg.Message{ID: 10, PeerID: &tg.PeerChat{ChatID: 1}, Date: 1000},
+			// Same id in another chat must not be picked
+			&tg.Message{ID: 20, PeerID: &tg.PeerChat{ChatID: 1}, Date: 1500},
+			&tg.Message{ID: 20, PeerID: &tg.PeerChannel{ChannelID: 2}, Date: 900},
+		},
+		chats: []tg.ChatClass{
+			&tg.Chat{ID: 1},
+			channel,
+		},
+	}
+
+	request := &tg.MessagesGetDialogsRequest{OffsetPeer: &tg.InputPeerEmpty{}}
+	if !nextDialogsOffset(request, page) {
+		t.Fatal("expected an offset for the next page")
+	}
+	if request.OffsetDate != 900 || request.OffsetID != 20 {
+		t.Fatalf("got offset date=%d id=%d, want 900/20", request.OffsetDate, request.OffsetID)
+	}
+	peer, ok := request.OffsetPeer.(*tg.InputPeerChannel)
+	if !ok || peer.ChannelID != 2 || peer.AccessHash != 42 {
+		t.Fatalf("unexpected offset peer %#v", request.OffsetPeer)
+	}
+}
+
+func TestDialogFilterMatches(t *testing.T) {
+	broadcast := &tg.Channel{ID: 1, Broadcast: true}
+	supergroup := &tg.Channel{ID: 2, Megagroup: true}
+	filter := &tg.DialogFilter{
+		Groups:          true,
+		ExcludeArchived: true,
+		IncludePeers:    []tg.InputPeerClass{&tg.InputPeerChannel{ChannelID: 1}},
+		ExcludePeers:    []tg.InputPeerClass{&tg.InputPeerChannel{ChannelID: 3}},
+	}
+
+	cases := []struct {
+		name   string
+		key    peerKey
+		chat   tg.ChatClass
+		folder int
+		want   bool
+	}{
+		{"included broadcast", peerKey{ChatTypeChannel, 1}, broadcast, FolderMain, true},
+		{"group category", peerKey{ChatTypeChannel, 2}, supergroup, FolderMain, true},
+		{"archived group", peerKey{ChatTypeChannel, 2}, supergroup, FolderArchive, false},
+		{"excluded peer", peerKey{ChatTypeChannel, 3}, &tg.Channel{ID: 3, Megagroup: true}, FolderMain, false},
+		{"other broadcast", peerKey{ChatTypeChannel, 4}, &tg.Channel{ID: 4, Broadcast: true}, FolderMain, false},
+	}
+	for _, tc := range cases {
+		if got := dialogFilterMatches(filter, tc.key, tc.chat, tc.folder); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"go-vue/pkg/srp"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+// PasswordStatus describes the 2FA configuration of the logged in account
+type PasswordStatus struct {
+	HasPassword             bool   `json:"has_password"`
+	HasRecovery             bool   `json:"has_recovery"`
+	Hint                    string `json:"hint,omitempty"`
+	EmailUnconfirmedPattern string `json:"email_unconfirmed_pattern,omitempty"`
+}
+
+// PasswordUpdateResult is returned by password changes. When a new recovery
+// email was set Telegram sends it a code that must be passed to
+// ConfirmPasswordEmail before the email becomes active.
+type PasswordUpdateResult struct {
+	EmailUnconfirmed bool `json:"email_unconfirmed"`
+	CodeLength       int  `json:"code_length,omitempty"`
+}
+
+// srpParams converts the server algorithm into SRP parameters
+func srpParams(algo tg.PasswordKdfAlgoClass) (srp.Params, error) {
+	modPow, ok := algo.(*tg.PasswordKdfAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow)
+	if !ok {
+		return srp.Params{}, fmt.Errorf("unsupported password algorithm %T", algo)
+	}
+	return srp.Params{Salt1: modPow.Salt1, Salt2: modPow.Salt2, G: modPow.G, P: modPow.P}, nil
+}
+
+// passwordCheckInput proves knowledge of the current password. Accounts
+// without a password are checked with inputCheckPasswordEmpty.
+func passwordCheckInput(settings *tg.AccountPassword, password string) (tg.InputCheckPasswordSRPClass, error) {
+	if !settings.HasPassword {
+		return &tg.InputCheckPasswordEmpty{}, nil
+	}
+
+	params, err := srpParams(settings.CurrentAlgo)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := srp.CheckPassword([]byte(password), settings.SRPB, params, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute password proof: %v", err)
+	}
+
+	return &tg.InputCheckPasswordSRP{
+		SRPID: settings.SRPID,
+		A:     answer.A,
+		M1:    answer.M1,
+	}, nil
+}
+
+// newPasswordSettings builds the settings that set newPassword as the 2FA
+// password using the server's new_algo
+func newPasswordSettings(settings *tg.AccountPassword, newPassword, hint string) (tg.AccountPasswordInputSettings, error) {
+	params, err := srpParams(settings.NewAlgo)
+	if err != nil {
+		return tg.AccountPasswordInputSettings{}, err
+	}
+	hash, newParams, err := srp.NewPasswordHash([]byte(newPassword), params, rand.Reader)
+	if err != nil {
+		return tg.AccountPasswordInputSettings{}, fmt.Errorf("failed to hash new password: %v", err)
+	}
+
+	return tg.AccountPasswordInputSettings{
+		NewAlgo: &tg.PasswordKdfAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow{
+			Salt1: newParams.Salt1,
+			Salt2: newParams.Salt2,
+			G:     newParams.G,
+			P:     newParams.P,
+		},
+		NewPasswordHash: hash,
+		Hint:            hint,
+	}, nil
+}
+
+// passwordAPI waits for the client and returns its API with a request context
+func (s *TelegramService) passwordAPI() (*tg.Client, context.Context, context.CancelFunc, error) {
+	select {
+	case <-s.clientReady:
+	case <-time.After(10 * time.Second):
+		return nil, nil, nil, fmt.Errorf("client initialization timeout")
+	}
+
+	s.mu.Lock()
+	client := s.client
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	return client.API(), ctx, cancel, nil
+}
+
+// GetPasswordStatus returns the 2FA settings of the current account
+func (s *TelegramService) GetPasswordStatus() (PasswordStatus, error) {
+	api, ctx, cancel, err := s.passwordAPI()
+	if err != nil {
+		return PasswordStatus{}, err
+	}
+	defer cancel()
+
+	settings, err := api.AccountGetPassword(ctx)
+	if err != nil {
+		return PasswordStatus{}, s.formatError(err)
+	}
+	return PasswordStatus{
+		HasPassword:             settings.HasPassword,
+		HasRecovery:             settings.HasRecovery,
+		Hint:                    settings.Hint,
+		EmailUnconfirmedPattern: settings.EmailUnconfirmedPattern,
+	}, nil
+}
+
+// ChangePassword sets a new 2FA password. currentPassword is ignored when
+// the account has no password yet; email optionally sets a recovery email.
+func (s *TelegramService) ChangePassword(currentPassword, newPassword, hint, email string) (PasswordUpdateResult, error) {
+	if newPassword == "" {
+		return PasswordUpdateResult{}, fmt.Errorf("new password is required")
+	}
+	if hint == newPassword {
+		return PasswordUpdateResult{}, fmt.Errorf("hint must not be the password")
+	}
+
+	api, ctx, cancel, err := s.passwordAPI()
+	if err != nil {
+		return PasswordUpdateResult{}, err
+	}
+	defer cancel()
+
+	settings, err := api.AccountGetPassword(ctx)
+	if err != nil {
+		return PasswordUpdateResult{}, s.formatError(err)
+	}
+	check, err := passwordCheckInput(settings, currentPassword)
+	if err != nil {
+		return PasswordUpdateResult{}, err
+	}
+	newSettings, err := newPasswordSettings(settings, newPassword, hint)
+	if err != nil {
+		return PasswordUpdateResult{}, err
+	}
+	if email != "" {
+		newSettings.SetEmail(email)
+	}
+
+	_, err = api.AccountUpdatePasswordSettings(ctx, &tg.AccountUpdatePasswordSettingsRequest{
+		Password:    check,
+		NewSettings: newSettings,
+	})
+	if rpcErr, ok := tgerr.AsType(err, "EMAIL_UNCONFIRMED"); ok {
+		// The password is already changed, only the email awaits confirmation
+		s.logger.Info("2FA password changed, recovery email awaiting confirmation")
+		return PasswordUpdateResult{EmailUnconfirmed: true, CodeLength: rpcErr.Argument}, nil
+	}
+	if err != nil {
+		return PasswordUpdateResult{}, s.formatError(err)
+	}
+
+	s.logger.Info("2FA password changed")
+	return PasswordUpdateResult{}, nil
+}
+
+// DisablePassword removes the 2FA password of the current account
+func (s *TelegramService) DisablePassword(currentPassword string) error {
+	api, ctx, cancel, err := s.passwordAPI()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	settings, err := api.AccountGetPassword(ctx)
+	if err != nil {
+		return s.formatError(err)
+	}
+	if !settings.HasPassword {
+		return fmt.Errorf("account has no 2FA password")
+	}
+	check, err := passwordCheckInput(settings, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = api.AccountUpdatePasswordSettings(ctx, &tg.AccountUpdatePasswordSettingsRequest{
+		Password: check,
+		NewSettings: tg.AccountPasswordInputSettings{
+			NewAlgo:         &tg.PasswordKdfAlgoUnknown{},
+			NewPasswordHash: []byte{},
+		},
+	})
+	if err != nil {
+		return s.formatError(err)
+	}
+
+	s.logger.Info("2FA password disabled")
+	return nil
+}
+
+// ConfirmPasswordEmail activates a recovery email with the code sent to it
+func (s *TelegramService) ConfirmPasswordEmail(code string) error {
+	api, ctx, cancel, err := s.passwordAPI()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	if _, err := api.AccountConfirmPasswordEmail(ctx, code); err != nil {
+		return s.formatError(err)
+	}
+	return nil
+}
+
+// RequestPasswordRecovery sends a recovery code to the account's recovery
+// email and returns the masked address
+func (s *TelegramService) RequestPasswordRecovery() (string, error) {
+	api, ctx, cancel, err := s.passwordAPI()
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
+	recovery, err := api.AuthRequestPasswordRecovery(ctx)
+	if err != nil {
+		return "", s.formatError(err)
+	}
+	return recovery.EmailPattern, nil
+}
+
+// RecoverPassword resets the 2FA password with an emailed recovery code.
+// When newPassword is empty the password is removed. If the recovery
+// happens during login the resulting authorization is stored.
+func (s *TelegramService) RecoverPassword(code, newPassword, hint string) error {
+	api, ctx, cancel, err := s.passwordAPI()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	if _, err := api.AuthCheckRecoveryPassword(ctx, code); err != nil {
+		return s.formatError(err)
+	}
+
+	request := &tg.AuthRecoverPasswordRequest{Code: code}
+	if newPassword != "" {
+		settings, err := api.AccountGetPassword(ctx)
+		if err != nil {
+			return s.formatError(err)
+		}
+		newSettings, err := newPasswordSettings(settings, newPassword, hint)
+		if err != nil {
+			return err
+		}
+		request.SetNewSettings(newSettings)
+	}
+
+	result, err := api.AuthRecoverPassword(ctx, request)
+	if err != nil {
+		return s.formatError(err)
+	}
+
+	if authorization, ok := result.(*tg.AuthAuthorization); ok {
+		if user, ok := authorization.User.(*tg.User); ok {
+			s.setAuthorizedUser(user)
+			s.logger.Info("Authenticated with password recovery", zap.Int64("userID", user.ID))
+		}
+	}
+	return nil
+}
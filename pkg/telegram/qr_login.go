@@ -0,0 +1,331 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"rsc.io/qr"
+)
+
+const qrLoginTimeout = 5 * time.Minute
+
+// QR login states reported to clients
+const (
+	QRStatePending        = "pending"
+	QRStatePasswordNeeded = "password_needed"
+	QRStateSuccess        = "success"
+	QRStateExpired        = "expired"
+	QRStateFailed         = "failed"
+)
+
+// QRLoginStatus describes the current state of a QR login attempt
+type QRLoginStatus struct {
+	ID        string    `json:"id"`
+	State     string    `json:"state"`
+	URL       string    `json:"url,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Done reports whether the attempt reached a final state
+func (s QRLoginStatus) Done() bool {
+	return s.State == QRStateSuccess || s.State == QRStateExpired || s.State == QRStateFailed
+}
+
+// qrLogin tracks a single QR login attempt and its status subscribers
+type qrLogin struct {
+	mu          sync.Mutex
+	status      QRLoginStatus
+	token       qrlogin.Token
+	subscribers map[chan QRLoginStatus]struct{}
+	cancel      context.CancelFunc
+}
+
+func (l *qrLogin) update(fn func(status *QRLoginStatus)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fn(&l.status)
+	for ch := range l.subscribers {
+		// Subscribers only care about the latest state, drop stale ones
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- l.status
+	}
+}
+
+func (l *qrLogin) current() QRLoginStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status
+}
+
+// StartQRLogin exports a login token and waits in the background for it to
+// be accepted from an authorized device. Only one QR login can be active at
+// a time, starting a new one cancels the previous attempt.
+func (s *TelegramService) StartQRLogin() (QRLoginStatus, error) {
+	select {
+	case <-s.clientReady:
+	case <-time.After(10 * time.Second):
+		return QRLoginStatus{}, fmt.Errorf("client initialization timeout")
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return QRLoginStatus{}, fmt.Errorf("failed to generate login id: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, qrLoginTimeout)
+	login := &qrLogin{
+		status:      QRLoginStatus{ID: hex.EncodeToString(idBytes), State: QRStatePending},
+		subscribers: make(map[chan QRLoginStatus]struct{}),
+		cancel:      cancel,
+	}
+
+	s.mu.Lock()
+	if s.qrLogin != nil {
+		s.qrLogin.cancel()
+	}
+	s.qrLogin = login
+	qr := s.client.QR
+	if s.newQR != nil {
+		qr = s.newQR
+	}
+	s.mu.Unlock()
+
+	// Drop a login token update left over from a previous attempt
+	select {
+	case <-s.loginTokens:
+	default:
+	}
+
+	// The first token is exported synchronously so the caller gets a URL
+	tokenReady := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer cancel()
+
+		loggedIn := qrlogin.LoggedIn(s.loginTokens)
+		show := func(ctx context.Context, token qrlogin.Token) error {
+			login.mu.Lock()
+			login.token = token
+			login.mu.Unlock()
+			login.update(func(status *QRLoginStatus) {
+				status.URL = token.URL()
+				status.ExpiresAt = token.Expires()
+			})
+			s.logger.Info("QR login token exported",
+				zap.String("login_id", login.current().ID),
+				zap.Time("expires_at", token.Expires()))
+			once.Do(func() { close(tokenReady) })
+			return nil
+		}
+
+		// client.QR migrates to the DC returned by auth.exportLoginToken
+		// when the account lives on a different DC
+		authorization, err := qr().Auth(ctx, loggedIn, show)
+		once.Do(func() { close(tokenReady) })
+		s.finishQRLogin(login, authorization, err)
+	}()
+
+	select {
+	case <-tokenReady:
+	case <-time.After(30 * time.Second):
+		cancel()
+		return QRLoginStatus{}, fmt.Errorf("timed out exporting login token")
+	}
+
+	status := login.current()
+	if status.State == QRStateFailed {
+		return status, fmt.Errorf("failed to start QR login: %s", status.Error)
+	}
+	return status, nil
+}
+
+// finishQRLogin records the outcome of a QR login attempt
+func (s *TelegramService) finishQRLogin(login *qrLogin, authorization *tg.AuthAuthorization, err error) {
+	if err != nil {
+		state := QRStateFailed
+		message := s.formatError(err).Error()
+		switch {
+		case strings.Contains(err.Error(), "SESSION_PASSWORD_NEEDED"):
+			state = QRStatePasswordNeeded
+			message = "2FA password required"
+			// Verify2FA works on per-phone sessions, register one for this login
+			s.mu.Lock()
+			s.sessions[qrSessionKey(login.current().ID)] = &AuthSession{CreatedAt: time.Now()}
+			s.mu.Unlock()
+		case errors.Is(err, context.DeadlineExceeded):
+			state = QRStateExpired
+			message = "QR login expired"
+		case errors.Is(err, context.Canceled):
+			state = QRStateExpired
+			message = "QR login cancelled"
+		}
+
+		s.logger.Warn("QR login finished without authorization",
+			zap.String("login_id", login.current().ID),
+			zap.String("state", state),
+			zap.Error(err))
+		login.update(func(status *QRLoginStatus) {
+			status.State = state
+			status.Error = message
+		})
+		return
+	}
+
+	user, ok := authorization.User.(*tg.User)
+	if !ok {
+		login.update(func(status *QRLoginStatus) {
+			status.State = QRStateFailed
+			status.Error = fmt.Sprintf("unexpected user type in auth result: %T", authorization.User)
+		})
+		return
+	}
+
+	s.setAuthorizedUser(user)
+	s.logger.Info("Successfully authenticated with QR code",
+		zap.Int64("userID", user.ID),
+		zap.String("username", user.Username))
+
+	login.update(func(status *QRLoginStatus) {
+		status.State = QRStateSuccess
+		status.UserID = user.ID
+	})
+}
+
+// setAuthorizedUser marks the service as authenticated for user
+func (s *TelegramService) setAuthorizedUser(user *tg.User) {
+	s.mu.Lock()
+	s.userID = user.ID
+	s.userAuth = true
+	if user.Phone != "" {
+		s.phone = "+" + strings.TrimPrefix(user.Phone, "+")
+	}
+	s.mu.Unlock()
+
+	s.saveAuthState()
+}
+
+// VerifyQR2FA completes a QR login that requires a 2FA password
+func (s *TelegramService) VerifyQR2FA(loginID, password string) error {
+	login, err := s.getQRLogin(loginID)
+	if err != nil {
+		return err
+	}
+	if login.current().State != QRStatePasswordNeeded {
+		return fmt.Errorf("QR login %s does not require a password", loginID)
+	}
+
+	if err := s.Verify2FA(qrSessionKey(loginID), password); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	userID := s.userID
+	delete(s.sessions, qrSessionKey(loginID))
+	s.mu.Unlock()
+
+	// Verify2FA stores the session key as phone, replace it with the real one
+	if user, err := s.GetCurrentUser(); err == nil {
+		if phone, ok := user["phone"].(string); ok && phone != "" {
+			s.mu.Lock()
+			s.phone = "+" + strings.TrimPrefix(phone, "+")
+			s.mu.Unlock()
+			s.saveAuthState()
+		}
+	}
+
+	login.update(func(status *QRLoginStatus) {
+		status.State = QRStateSuccess
+		status.UserID = userID
+		status.Error = ""
+	})
+	return nil
+}
+
+// GetQRLoginStatus returns the state of a QR login attempt
+func (s *TelegramService) GetQRLoginStatus(loginID string) (QRLoginStatus, error) {
+	login, err := s.getQRLogin(loginID)
+	if err != nil {
+		return QRLoginStatus{}, err
+	}
+	return login.current(), nil
+}
+
+// GetQRLoginImage renders the current login token as a QR code
+func (s *TelegramService) GetQRLoginImage(loginID string) (image.Image, error) {
+	login, err := s.getQRLogin(loginID)
+	if err != nil {
+		return nil, err
+	}
+
+	login.mu.Lock()
+	token := login.token
+	login.mu.Unlock()
+	if token.String() == "" {
+		return nil, fmt.Errorf("no login token exported yet")
+	}
+	return token.Image(qr.M)
+}
+
+// SubscribeQRLogin returns a channel receiving status changes of a QR login
+// attempt. The channel is primed with the current status; call the returned
+// function to unsubscribe.
+func (s *TelegramService) SubscribeQRLogin(loginID string) (<-chan QRLoginStatus, func(), error) {
+	login, err := s.getQRLogin(loginID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan QRLoginStatus, 1)
+	login.mu.Lock()
+	login.subscribers[ch] = struct{}{}
+	ch <- login.status
+	login.mu.Unlock()
+
+	unsubscribe := func() {
+		login.mu.Lock()
+		delete(login.subscribers, ch)
+		login.mu.Unlock()
+	}
+	return ch, unsubscribe, nil
+}
+
+// CancelQRLogin stops a pending QR login attempt
+func (s *TelegramService) CancelQRLogin(loginID string) error {
+	login, err := s.getQRLogin(loginID)
+	if err != nil {
+		return err
+	}
+	login.cancel()
+	return nil
+}
+
+func (s *TelegramService) getQRLogin(loginID string) (*qrLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.qrLogin == nil || s.qrLogin.current().ID != loginID {
+		return nil, fmt.Errorf("QR login %s not found", loginID)
+	}
+	return s.qrLogin, nil
+}
+
+func qrSessionKey(loginID string) string {
+	return "qr:" + loginID
+}
@@ -0,0 +1,210 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-vue/pkg/storage"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// stubInvoker answers the auth calls of the QR login flow
+type stubInvoker struct {
+	mu      sync.Mutex
+	exports int
+	// export returns the result of the nth auth.exportLoginToken call
+	export func(n int) tg.AuthLoginTokenClass
+	// imported is the result of auth.importLoginToken after a migration
+	imported tg.AuthLoginTokenClass
+}
+
+func (s *stubInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	var result bin.Encoder
+	switch input.(type) {
+	case *tg.AuthExportLoginTokenRequest:
+		s.mu.Lock()
+		s.exports++
+		n := s.exports
+		s.mu.Unlock()
+		result = s.export(n)
+	case *tg.AuthImportLoginTokenRequest:
+		result = s.imported
+	default:
+		return fmt.Errorf("unexpected call %T", input)
+	}
+	var buf bin.Buffer
+	if err := result.Encode(&buf); err != nil {
+		return err
+	}
+	return output.Decode(&buf)
+}
+
+// fakeClock hands out timers the test fires by hand
+type fakeClock struct {
+	now    time.Time
+	timers chan *fakeTimer
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Timer(d time.Duration) clock.Timer {
+	timer := &fakeTimer{c: make(chan time.Time, 1)}
+	c.timers <- timer
+	return timer
+}
+
+func (c *fakeClock) Ticker(d time.Duration) clock.Ticker { return nil }
+
+type fakeTimer struct {
+	c chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time   { return t.c }
+func (t *fakeTimer) Stop() bool            { return true }
+func (t *fakeTimer) Reset(d time.Duration) {}
+func (t *fakeTimer) fire(now time.Time)    { t.c <- now }
+
+func newQRTestService(t *testing.T, ctx context.Context, invoker *stubInvoker, migrate func(ctx context.Context, dc int) error) (*TelegramService, *fakeClock) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := &fakeClock{now: time.Now(), timers: make(chan *fakeTimer, 4)}
+	s := &TelegramService{
+		logger:      zap.NewNop(),
+		ctx:         ctx,
+		clientReady: make(chan struct{}),
+		sessions:    make(map[string]*AuthSession),
+		store:       store,
+		loginTokens: make(chan struct{}, 1),
+	}
+	close(s.clientReady)
+	s.newQR = func() qrlogin.QR {
+		return qrlogin.NewQR(tg.NewClient(invoker), 1, "hash", qrlogin.Options{Migrate: migrate, Clock: clk})
+	}
+	return s, clk
+}
+
+// token returns login tokens valid for a minute of clk
+func token(clk *fakeClock, n int) *tg.AuthLoginToken {
+	return &tg.AuthLoginToken{Token: []byte{byte(n)}, Expires: int(clk.now.Add(time.Minute).Unix())}
+}
+
+// waitQRState waits for a status of the login matching done
+func waitQRState(t *testing.T, s *TelegramService, id string, done func(QRLoginStatus) bool) QRLoginStatus {
+	updates, unsubscribe, err := s.SubscribeQRLogin(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case status := <-updates:
+			if done(status) {
+				return status
+			}
+		case <-timeout:
+			status, _ := s.GetQRLoginStatus(id)
+			t.Fatalf("timed out in QR login state %+v", status)
+		}
+	}
+}
+
+func TestQRLoginTokenRefreshAndExpiry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var clk *fakeClock
+	invoker := &stubInvoker{export: func(n int) tg.AuthLoginTokenClass { return token(clk, n) }}
+	s, clk := newQRTestService(t, ctx, invoker, nil)
+
+	status, err := s.StartQRLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != QRStatePending || !strings.HasPrefix(status.URL, "tg://login?token=") {
+		t.Fatalf("unexpected initial status %+v", status)
+	}
+	first := status.URL
+
+	// an expired token is exported again and shown with a new URL
+	(<-clk.timers).fire(clk.now)
+	refreshed := waitQRState(t, s, status.ID, func(s QRLoginStatus) bool { return s.URL != first })
+	if refreshed.State != QRStatePending {
+		t.Fatalf("expected the login to stay pending, got %+v", refreshed)
+	}
+
+	// the attempt expires unless a token is accepted in time
+	expired := waitQRState(t, s, status.ID, QRLoginStatus.Done)
+	if expired.State != QRStateExpired || expired.Error != "QR login expired" {
+		t.Fatalf("expected an expired login, got %+v", expired)
+	}
+	if _, err := s.GetQRLoginImage(status.ID); err != nil {
+		t.Fatalf("the last token should still render: %v", err)
+	}
+}
+
+func TestQRLoginMigration(t *testing.T) {
+	user := &tg.User{ID: 42, Phone: "380500000000"}
+	migrateTo := func(n int) tg.AuthLoginTokenClass {
+		if n == 1 {
+			return &tg.AuthLoginToken{Token: []byte{1}, Expires: int(time.Now().Add(time.Minute).Unix())}
+		}
+		return &tg.AuthLoginTokenMigrateTo{DCID: 4, Token: []byte{2}}
+	}
+
+	t.Run("failed", func(t *testing.T) {
+		invoker := &stubInvoker{export: migrateTo}
+		s, _ := newQRTestService(t, context.Background(), invoker, func(ctx context.Context, dc int) error {
+			return fmt.Errorf("DC %d unreachable", dc)
+		})
+		status, err := s.StartQRLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.loginTokens <- struct{}{}
+		failed := waitQRState(t, s, status.ID, QRLoginStatus.Done)
+		if failed.State != QRStateFailed || !strings.Contains(failed.Error, "DC 4 unreachable") {
+			t.Fatalf("expected a failed migration, got %+v", failed)
+		}
+		if s.userAuth {
+			t.Fatal("a failed migration should not authorize")
+		}
+	})
+
+	t.Run("succeeded", func(t *testing.T) {
+		invoker := &stubInvoker{
+			export:   migrateTo,
+			imported: &tg.AuthLoginTokenSuccess{Authorization: &tg.AuthAuthorization{User: user}},
+		}
+		var migrated int
+		s, _ := newQRTestService(t, context.Background(), invoker, func(ctx context.Context, dc int) error {
+			migrated = dc
+			return nil
+		})
+		status, err := s.StartQRLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.loginTokens <- struct{}{}
+		done := waitQRState(t, s, status.ID, QRLoginStatus.Done)
+		if done.State != QRStateSuccess || done.UserID != 42 || migrated != 4 {
+			t.Fatalf("expected a login on DC 4, got %+v after migrating to %d", done, migrated)
+		}
+		if s.phone != "+380500000000" {
+			t.Fatalf("unexpected phone %q", s.phone)
+		}
+		if _, err := s.store.Get(context.Background(), authStateStorageKey); err != nil {
+			t.Fatalf("expected the auth state to be saved: %v", err)
+		}
+	})
+}
@@ -0,0 +1,321 @@
+package telegram
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"go-vue/pkg/storage"
+
+	"github.com/gotd/td/session"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	sessionStorageKey   = "telegram/session"
+	authStateStorageKey = "telegram/auth_state"
+
+	// legacySessionFile is the plaintext session written by older versions
+	legacySessionFile = "session.json"
+
+	sessionEnvelopeVersion = 1
+	exportKDFIterations    = 100000
+)
+
+// sessionEnvelope is the encrypted form of a session as it is persisted
+type sessionEnvelope struct {
+	Version    int    `json:"version"`
+	KeyID      string `json:"key_id"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// sessionExport is a portable session bundle encrypted with a passphrase
+type sessionExport struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type sessionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// EncryptedSessionStorage implements telegram.SessionStorage on top of the
+// application store. Sessions are sealed with AES-256-GCM; the first key is
+// used for encryption and the remaining ones are only accepted for decryption
+// so that keys can be rotated without logging users out.
+type EncryptedSessionStorage struct {
+	store storage.Store
+	keys  []sessionKey
+	mu    sync.Mutex
+}
+
+// NewEncryptedSessionStorage creates a session storage using currentKey for
+// encryption. Keys are 32 bytes encoded as hex or base64.
+func NewEncryptedSessionStorage(store storage.Store, currentKey string, oldKeys ...string) (*EncryptedSessionStorage, error) {
+	s := &EncryptedSessionStorage{store: store}
+
+	for i, raw := range append([]string{currentKey}, oldKeys...) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			if i == 0 {
+				return nil, fmt.Errorf("session encryption key is required")
+			}
+			continue
+		}
+		key, err := parseSessionKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session key #%d: %v", i, err)
+		}
+		s.keys = append(s.keys, key)
+	}
+
+	return s, nil
+}
+
+func parseSessionKey(raw string) (sessionKey, error) {
+	var key []byte
+	if decoded, err := hex.DecodeString(raw); err == nil && len(decoded) == 32 {
+		key = decoded
+	} else if decoded, err := base64.StdEncoding.DecodeString(raw); err == nil && len(decoded) == 32 {
+		key = decoded
+	} else {
+		return sessionKey{}, fmt.Errorf("key must be 32 bytes encoded as hex or base64")
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return sessionKey{}, err
+	}
+
+	sum := sha256.Sum256(key)
+	return sessionKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %v", err)
+	}
+	return aead, nil
+}
+
+// LoadSession decrypts the stored session. Sessions sealed with a retired
+// key are transparently re-encrypted with the current key.
+func (s *EncryptedSessionStorage) LoadSession(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.load(ctx)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, session.ErrNotFound
+	}
+	return data, err
+}
+
+// StoreSession encrypts the session with the current key and persists it
+func (s *EncryptedSessionStorage) StoreSession(ctx context.Context, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(ctx, data)
+}
+
+// HasSession reports whether a session is stored
+func (s *EncryptedSessionStorage) HasSession(ctx context.Context) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.store.Get(ctx, sessionStorageKey)
+	return err == nil
+}
+
+// Clear removes the stored session
+func (s *EncryptedSessionStorage) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Delete(ctx, sessionStorageKey)
+}
+
+// RotateKeys re-encrypts the stored session with the current key. It is a
+// no-op when there is no session or it already uses the current key.
+func (s *EncryptedSessionStorage) RotateKeys(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.load(ctx)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// MigrateLegacyFile imports a plaintext session file written by older
+// versions and removes it from disk afterwards
+func (s *EncryptedSessionStorage) MigrateLegacyFile(ctx context.Context, path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read legacy session: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.store.Get(ctx, sessionStorageKey); err == nil {
+		// An encrypted session already exists, the plaintext copy is stale
+		return false, os.Remove(path)
+	}
+	if err := s.save(ctx, data); err != nil {
+		return false, err
+	}
+	if err := os.Remove(path); err != nil {
+		return false, fmt.Errorf("failed to remove legacy session: %v", err)
+	}
+	return true, nil
+}
+
+// Export returns the session encrypted with a key derived from passphrase so
+// it can be moved to another installation
+func (s *EncryptedSessionStorage) Export(ctx context.Context, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is required")
+	}
+
+	s.mu.Lock()
+	data, err := s.load(ctx)
+	s.mu.Unlock()
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("no session to export")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := sessionExport{
+		Version:    sessionEnvelopeVersion,
+		Salt:       make([]byte, 16),
+		Iterations: exportKDFIterations,
+	}
+	if _, err := io.ReadFull(rand.Reader, bundle.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	aead, err := newGCM(pbkdf2.Key([]byte(passphrase), bundle.Salt, bundle.Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	bundle.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, bundle.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	bundle.Ciphertext = aead.Seal(nil, bundle.Nonce, data, []byte("session-export"))
+
+	return json.Marshal(bundle)
+}
+
+// Import replaces the stored session with one produced by Export
+func (s *EncryptedSessionStorage) Import(ctx context.Context, exported []byte, passphrase string) error {
+	var bundle sessionExport
+	if err := json.Unmarshal(exported, &bundle); err != nil {
+		return fmt.Errorf("invalid session bundle: %v", err)
+	}
+	if bundle.Version != sessionEnvelopeVersion {
+		return fmt.Errorf("unsupported session bundle version: %d", bundle.Version)
+	}
+	if bundle.Iterations <= 0 {
+		return fmt.Errorf("invalid session bundle iterations: %d", bundle.Iterations)
+	}
+
+	aead, err := newGCM(pbkdf2.Key([]byte(passphrase), bundle.Salt, bundle.Iterations, 32, sha256.New))
+	if err != nil {
+		return err
+	}
+	if len(bundle.Nonce) != aead.NonceSize() {
+		return fmt.Errorf("invalid session bundle nonce")
+	}
+	data, err := aead.Open(nil, bundle.Nonce, bundle.Ciphertext, []byte("session-export"))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt session bundle: wrong passphrase or corrupted data")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(ctx, data)
+}
+
+// load reads and decrypts the session, the caller must hold s.mu
+func (s *EncryptedSessionStorage) load(ctx context.Context) ([]byte, error) {
+	raw, err := s.store.Get(ctx, sessionStorageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope sessionEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted session: %v", err)
+	}
+	if envelope.Version != sessionEnvelopeVersion {
+		return nil, fmt.Errorf("unsupported session version: %d", envelope.Version)
+	}
+
+	for i, key := range s.keys {
+		if key.id != envelope.KeyID {
+			continue
+		}
+		if len(envelope.Nonce) != key.aead.NonceSize() {
+			return nil, fmt.Errorf("invalid session nonce")
+		}
+		data, err := key.aead.Open(nil, envelope.Nonce, envelope.Ciphertext, []byte(sessionStorageKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt session: %v", err)
+		}
+		if i > 0 {
+			if err := s.save(ctx, data); err != nil {
+				return nil, fmt.Errorf("failed to re-encrypt session with current key: %v", err)
+			}
+		}
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("session is encrypted with unknown key %s", envelope.KeyID)
+}
+
+// save encrypts and writes the session, the caller must hold s.mu
+func (s *EncryptedSessionStorage) save(ctx context.Context, data []byte) error {
+	key := s.keys[0]
+	envelope := sessionEnvelope{
+		Version: sessionEnvelopeVersion,
+		KeyID:   key.id,
+		Nonce:   make([]byte, key.aead.NonceSize()),
+	}
+	if _, err := io.ReadFull(rand.Reader, envelope.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	envelope.Ciphertext = key.aead.Seal(nil, envelope.Nonce, data, []byte(sessionStorageKey))
+
+	raw, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal encrypted session: %v", err)
+	}
+	return s.store.Put(ctx, sessionStorageKey, raw)
+}
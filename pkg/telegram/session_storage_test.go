@@ -0,0 +1,131 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go-vue/pkg/storage"
+
+	"github.com/gotd/td/session"
+)
+
+const (
+	testKeyA = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testKeyB = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+)
+
+func newTestSessionStorage(t *testing.T, store storage.Store, keys ...string) *EncryptedSessionStorage {
+	t.Helper()
+	s, err := NewEncryptedSessionStorage(store, keys[0], keys[1:]...)
+	if err != nil {
+		t.Fatalf("failed to create session storage: %v", err)
+	}
+	return s
+}
+
+func TestEncryptedSessionStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestSessionStorage(t, store, testKeyA)
+
+	if _, err := s.LoadSession(ctx); !errors.Is(err, session.ErrNotFound) {
+		t.Fatalf("expected session.ErrNotFound, got %v", err)
+	}
+
+	secret := []byte(`{"Version":1,"Data":{"AuthKey":"c2VjcmV0"}}`)
+	if err := s.StoreSession(ctx, secret); err != nil {
+		t.Fatalf("failed to store session: %v", err)
+	}
+
+	raw, err := store.Get(ctx, sessionStorageKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("c2VjcmV0")) {
+		t.Fatal("session was stored in plaintext")
+	}
+
+	loaded, err := s.LoadSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to load session: %v", err)
+	}
+	if !bytes.Equal(loaded, secret) {
+		t.Fatalf("loaded %q, want %q", loaded, secret)
+	}
+
+	other := newTestSessionStorage(t, store, testKeyB)
+	if _, err := other.LoadSession(ctx); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestEncryptedSessionStorageRotation(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte("session data")
+	if err := newTestSessionStorage(t, store, testKeyA).StoreSession(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newTestSessionStorage(t, store, testKeyB, testKeyA)
+	if err := rotated.RotateKeys(ctx); err != nil {
+		t.Fatalf("failed to rotate keys: %v", err)
+	}
+
+	// The old key must no longer be required once the session is rotated
+	loaded, err := newTestSessionStorage(t, store, testKeyB).LoadSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to load rotated session: %v", err)
+	}
+	if !bytes.Equal(loaded, secret) {
+		t.Fatalf("loaded %q, want %q", loaded, secret)
+	}
+}
+
+func TestEncryptedSessionStorageExportImport(t *testing.T) {
+	ctx := context.Background()
+	source, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte("session data")
+	exporter := newTestSessionStorage(t, source, testKeyA)
+	if err := exporter.StoreSession(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := exporter.Export(ctx, "correct horse")
+	if err != nil {
+		t.Fatalf("failed to export session: %v", err)
+	}
+
+	importer := newTestSessionStorage(t, target, testKeyB)
+	if err := importer.Import(ctx, bundle, "wrong"); err == nil {
+		t.Fatal("expected import with wrong passphrase to fail")
+	}
+	if err := importer.Import(ctx, bundle, "correct horse"); err != nil {
+		t.Fatalf("failed to import session: %v", err)
+	}
+
+	loaded, err := importer.LoadSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded, secret) {
+		t.Fatalf("loaded %q, want %q", loaded, secret)
+	}
+}
@@ -2,14 +2,9 @@ package telegram
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
-	"crypto/sha512"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/big"
 	"os"
 	"strconv"
 	"strings"
@@ -17,12 +12,14 @@ import (
 	"time"
 
 	"go-vue/pkg/config"
+	"go-vue/pkg/events"
+	"go-vue/pkg/storage"
 
 	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth/qrlogin"
 	"github.com/gotd/td/tg"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"golang.org/x/crypto/pbkdf2"
 )
 
 // Add these constants at the top of the file
@@ -59,12 +56,25 @@ type TelegramService struct {
 	userAuth bool
 	phone    string // Current phone being processed, can be removed if handlers pass it
 	// Removed global hash, lastPasswordAttempt, lastCodeAttempt
-	userID      int64
-	clientReady chan struct{}
-	sessions    map[string]*AuthSession // key: phone number
+	userID         int64
+	clientReady    chan struct{}
+	sessions       map[string]*AuthSession // key: phone number
+	store          storage.Store
+	sessionStorage *EncryptedSessionStorage
+	dispatcher     tg.UpdateDispatcher
+	qrLogin        *qrLogin
+	loginTokens    chan struct{}
+	bus            *events.Bus
+	updateState    *updateStateStorage
+	authorized     chan struct{}
+	fullChannels   fullChannelCache
+	// newQR creates the QR login flow, the client's when nil
+	newQR func() qrlogin.QR
 }
 
-func NewTelegramService() (*TelegramService, error) {
+// NewTelegramService creates the service and connects the client. Incoming
+// updates are published on bus.
+func NewTelegramService(store storage.Store, bus *events.Bus) (*TelegramService, error) {
 	// Validate API credentials
 	if config.GlobalConfig.TelegramAPIID == "" || config.GlobalConfig.TelegramAPIHash == "" {
 		return nil, fmt.Errorf("Telegram API credentials not configured")
@@ -98,35 +108,48 @@ func NewTelegramService() (*TelegramService, error) {
 		zap.String("api_hash", maskedHash),
 	)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	options := telegram.Options{
-		Logger: logger,
-		SessionStorage: &telegram.FileSessionStorage{
-			Path: "session.json",
-		},
-		Device: telegram.DeviceConfig{
-			DeviceModel:   "Desktop",
-			SystemVersion: "Windows 10",
-			AppVersion:    "1.0.0",
-			LangCode:      "en",
-		},
+	sessionStorage, err := NewEncryptedSessionStorage(store,
+		config.GlobalConfig.TelegramSessionKey,
+		strings.Split(config.GlobalConfig.TelegramSessionOldKeys, ",")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session storage: %v", err)
+	}
+	if migrated, err := sessionStorage.MigrateLegacyFile(context.Background(), legacySessionFile); err != nil {
+		logger.Warn("Failed to migrate plaintext session file", zap.Error(err))
+	} else if migrated {
+		logger.Info("Migrated plaintext session file to encrypted storage")
+	}
+	if err := sessionStorage.RotateKeys(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to load session: %v", err)
 	}
 
-	client, err := telegram.ClientFromEnvironment(options)
+	loginTokens := make(chan struct{}, 1)
+	updateState := newUpdateStateStorage(store)
+	dispatcher := newUpdateDispatcher(loginTokens, bus)
+	manager := newUpdatesManager(logger, dispatcher, updateState)
+	client, err := telegram.ClientFromEnvironment(clientOptions(logger, sessionStorage, manager))
 	if err != nil {
 		logger.Error("Failed to create Telegram client", zap.Error(err))
 		return nil, fmt.Errorf("failed to create client: %v", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	service := &TelegramService{
-		client:      client,
-		logger:      logger,
-		ctx:         ctx,
-		cancel:      cancel,
-		userAuth:    false,
-		phone:       config.GlobalConfig.DefaultPhoneNumber,
-		clientReady: make(chan struct{}),
-		sessions:    make(map[string]*AuthSession),
+		client:         client,
+		logger:         logger,
+		ctx:            ctx,
+		cancel:         cancel,
+		userAuth:       false,
+		phone:          config.GlobalConfig.DefaultPhoneNumber,
+		clientReady:    make(chan struct{}),
+		sessions:       make(map[string]*AuthSession),
+		store:          store,
+		sessionStorage: sessionStorage,
+		dispatcher:     dispatcher,
+		loginTokens:    loginTokens,
+		bus:            bus,
+		updateState:    updateState,
+		authorized:     make(chan struct{}, 1),
 	}
 
 	// Start the client in a separate goroutine
@@ -143,8 +166,7 @@ func NewTelegramService() (*TelegramService, error) {
 
 			close(service.clientReady)
 			logger.Info("Telegram client is ready and connected")
-			<-ctx.Done()
-			return nil
+			return service.runUpdates(ctx, client, manager)
 		})
 		if err != nil {
 			logger.Error("Client run error", zap.Error(err))
@@ -166,21 +188,42 @@ func NewTelegramService() (*TelegramService, error) {
 	return service, nil
 }
 
+// clientOptions returns the options shared by every client the service creates
+func clientOptions(logger *zap.Logger, sessionStorage telegram.SessionStorage, handler telegram.UpdateHandler) telegram.Options {
+	return telegram.Options{
+		Logger:         logger,
+		SessionStorage: sessionStorage,
+		UpdateHandler:  handler,
+		Device: telegram.DeviceConfig{
+			DeviceModel:   "Desktop",
+			SystemVersion: "Windows 10",
+			AppVersion:    "1.0.0",
+			LangCode:      "en",
+		},
+	}
+}
+
+// removeSession deletes the stored session after Telegram rejected it
+func (s *TelegramService) removeSession() {
+	if err := s.sessionStorage.Clear(context.Background()); err != nil {
+		s.logger.Warn("Failed to remove session", zap.Error(err))
+	}
+}
+
 // checkExistingSession checks if there's an existing authenticated session and restores the state
 func (s *TelegramService) checkExistingSession() {
 	s.logger.Info("Checking for existing authenticated session")
 
-	// Check if session file exists
-	if _, err := os.Stat("session.json"); os.IsNotExist(err) {
-		s.logger.Info("No session file found")
+	// Check if a session is stored
+	if !s.sessionStorage.HasSession(context.Background()) {
+		s.logger.Info("No stored session found")
 		return
 	}
 
-	s.logger.Info("Session file found, checking authentication status")
+	s.logger.Info("Stored session found, checking authentication status")
 
-	// Check if we have a persistent auth state file
-	authStateFile := "auth_state.json"
-	if authData, err := os.ReadFile(authStateFile); err == nil {
+	// Check if we have a persistent auth state
+	if authData, err := s.store.Get(context.Background(), authStateStorageKey); err == nil {
 		var authState struct {
 			UserAuth bool   `json:"user_auth"`
 			UserID   int64  `json:"user_id"`
@@ -212,8 +255,8 @@ func (s *TelegramService) checkExistingSession() {
 							s.userAuth = false
 							s.userID = 0
 							s.mu.Unlock()
-							// Remove invalid auth state file
-							os.Remove(authStateFile)
+							// Remove invalid auth state
+							s.store.Delete(context.Background(), authStateStorageKey)
 						} else {
 							s.logger.Info("Session restored successfully from persistent state")
 						}
@@ -229,7 +272,7 @@ func (s *TelegramService) checkExistingSession() {
 	s.logger.Info("No valid persistent auth state found, user will need to authenticate")
 }
 
-// saveAuthState saves the current authentication state to a persistent file
+// saveAuthState saves the current authentication state to the store
 func (s *TelegramService) saveAuthState() {
 	s.mu.Lock()
 	authState := struct {
@@ -249,7 +292,7 @@ func (s *TelegramService) saveAuthState() {
 		return
 	}
 
-	if err := os.WriteFile("auth_state.json", authData, 0600); err != nil {
+	if err := s.store.Put(context.Background(), authStateStorageKey, authData); err != nil {
 		s.logger.Error("Failed to save auth state", zap.Error(err))
 		return
 	}
@@ -258,6 +301,14 @@ func (s *TelegramService) saveAuthState() {
 		zap.Bool("user_auth", authState.UserAuth),
 		zap.Int64("user_id", authState.UserID),
 		zap.String("phone", authState.Phone))
+
+	if authState.UserAuth {
+		// Wake up the update listener waiting for a login
+		select {
+		case s.authorized <- struct{}{}:
+		default:
+		}
+	}
 }
 
 // ClearSessions clears all session data and resets the service state
@@ -276,14 +327,17 @@ func (s *TelegramService) ClearSessions() {
 	}
 	s.mu.Unlock()
 
-	// Remove session file
-	if err := os.Remove("session.json"); err != nil && !os.IsNotExist(err) {
-		s.logger.Warn("Failed to remove session file", zap.Error(err))
+	// Remove stored session
+	s.removeSession()
+
+	// Remove auth state
+	if err := s.store.Delete(context.Background(), authStateStorageKey); err != nil {
+		s.logger.Warn("Failed to remove auth state", zap.Error(err))
 	}
 
-	// Remove auth state file
-	if err := os.Remove("auth_state.json"); err != nil && !os.IsNotExist(err) {
-		s.logger.Warn("Failed to remove auth state file", zap.Error(err))
+	// Update sequence numbers belong to the logged out session
+	if err := s.updateState.Clear(context.Background()); err != nil {
+		s.logger.Warn("Failed to remove update state", zap.Error(err))
 	}
 
 	// Wait a moment for the client to fully close
@@ -299,37 +353,27 @@ func (s *TelegramService) ClearSessions() {
 func (s *TelegramService) reinitializeClient() {
 	s.logger.Info("Reinitializing Telegram client after logout")
 
-	// Create new context
-	ctx, cancel := context.WithCancel(context.Background())
-
 	// Create new client ready channel
 	clientReady := make(chan struct{})
 
 	// Create new client
-	options := telegram.Options{
-		Logger: s.logger,
-		SessionStorage: &telegram.FileSessionStorage{
-			Path: "session.json",
-		},
-		Device: telegram.DeviceConfig{
-			DeviceModel:   "Desktop",
-			SystemVersion: "Windows 10",
-			AppVersion:    "1.0.0",
-			LangCode:      "en",
-		},
-	}
-
-	client, err := telegram.ClientFromEnvironment(options)
+	dispatcher := newUpdateDispatcher(s.loginTokens, s.bus)
+	manager := newUpdatesManager(s.logger, dispatcher, s.updateState)
+	client, err := telegram.ClientFromEnvironment(clientOptions(s.logger, s.sessionStorage, manager))
 	if err != nil {
 		s.logger.Error("Failed to create new Telegram client", zap.Error(err))
 		return
 	}
 
+	// Create new context
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// Update service state with new client and context
 	s.mu.Lock()
 	s.ctx = ctx
 	s.cancel = cancel
 	s.client = client
+	s.dispatcher = dispatcher
 	s.clientReady = clientReady
 	s.mu.Unlock()
 
@@ -347,8 +391,7 @@ func (s *TelegramService) reinitializeClient() {
 
 			close(clientReady)
 			s.logger.Info("New Telegram client is ready and connected")
-			<-ctx.Done()
-			return nil
+			return s.runUpdates(ctx, client, manager)
 		})
 		if err != nil {
 			s.logger.Error("New client run error", zap.Error(err))
@@ -366,6 +409,51 @@ func (s *TelegramService) reinitializeClient() {
 	}
 }
 
+// ExportSession returns the stored session encrypted with passphrase
+func (s *TelegramService) ExportSession(passphrase string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return s.sessionStorage.Export(ctx, passphrase)
+}
+
+// ImportSession replaces the stored session with an exported one and
+// restarts the client so that it picks up the imported authorization
+func (s *TelegramService) ImportSession(bundle []byte, passphrase string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.sessionStorage.Import(ctx, bundle, passphrase); err != nil {
+		return err
+	}
+	s.logger.Info("Imported Telegram session, restarting client")
+
+	s.mu.Lock()
+	s.userAuth = false
+	s.userID = 0
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	// Wait a moment for the client to fully close
+	time.Sleep(1 * time.Second)
+	s.reinitializeClient()
+
+	user, err := s.GetCurrentUser()
+	if err != nil {
+		return fmt.Errorf("imported session is not authorized: %v", err)
+	}
+
+	s.mu.Lock()
+	s.userAuth = true
+	s.userID, _ = user["id"].(int64)
+	s.mu.Unlock()
+	s.saveAuthState()
+
+	return nil
+}
+
 // GetPhone, SetPhone, SetCode, SetPassword now operate on the global s.phone, s.code, s.password
 // These might need adjustment if we want SetPhone to initiate a session for that phone.
 // For now, they set the *current* phone/code/password the service is globally focused on.
@@ -411,148 +499,6 @@ func (s *TelegramService) SetHash(hash string) {
 	s.logger.Info("Hash set for phone", zap.String("phone", s.phone), zap.String("stored_hash", sess.Hash))
 }
 
-func (s *TelegramService) GetUserGroups(userID int64) ([]map[string]interface{}, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.logger.Info("GetUserGroups called", zap.Int64("userID", userID))
-
-	// Use the existing authenticated client instead of creating a new one
-	if s.client == nil {
-		s.logger.Error("No authenticated client available")
-		return nil, fmt.Errorf("no authenticated client available")
-	}
-
-	var result []map[string]interface{}
-
-	// Create a new context for this operation
-	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
-	defer cancel()
-
-	// Use the existing client API directly instead of calling Run()
-	api := s.client.API()
-
-	s.logger.Info("Attempting to get dialogs from Telegram API")
-
-	// First, check if we're authorized by trying to get dialogs
-	dialogs, err := api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
-		OffsetPeer: &tg.InputPeerEmpty{},
-		Limit:      100,
-	})
-	if err != nil {
-		s.logger.Error("Failed to get dialogs", zap.Error(err))
-		if strings.Contains(err.Error(), "AUTH_KEY_UNREGISTERED") {
-			// Clear the session file if authentication is invalid
-			os.Remove("session.json")
-			s.client = nil // Clear the client
-			return nil, fmt.Errorf("session expired, please re-authenticate")
-		}
-		return nil, fmt.Errorf("failed to get dialogs: %v", err)
-	}
-
-	s.logger.Info("Successfully got dialogs", zap.String("type", fmt.Sprintf("%T", dialogs)))
-
-	switch d := dialogs.(type) {
-	case *tg.MessagesDialogs:
-		s.logger.Info("Processing MessagesDialogs", zap.Int("chat_count", len(d.Chats)))
-		for i, chat := range d.Chats {
-			s.logger.Info("Processing chat", zap.Int("index", i), zap.String("type", fmt.Sprintf("%T", chat)))
-			switch c := chat.(type) {
-			case *tg.Channel:
-				s.logger.Info("Found channel", zap.Int64("id", c.ID), zap.String("title", c.Title))
-
-				// Get channel full info
-				channelFull, err := api.ChannelsGetFullChannel(ctx, &tg.InputChannel{
-					ChannelID:  c.ID,
-					AccessHash: c.AccessHash,
-				})
-				if err != nil {
-					s.logger.Warn("Failed to get channel full info", zap.Error(err))
-					// Continue without full info
-				}
-
-				var description string
-				if channelFull != nil {
-					if full, ok := channelFull.FullChat.(*tg.ChannelFull); ok {
-						description = full.About
-					}
-				}
-
-				result = append(result, map[string]interface{}{
-					"id":          c.ID,
-					"title":       c.Title,
-					"username":    c.Username,
-					"type":        "channel",
-					"members":     c.ParticipantsCount,
-					"description": description,
-				})
-			case *tg.Chat:
-				s.logger.Info("Found chat", zap.Int64("id", c.ID), zap.String("title", c.Title))
-				result = append(result, map[string]interface{}{
-					"id":          c.ID,
-					"title":       c.Title,
-					"type":        "group",
-					"members":     c.ParticipantsCount,
-					"description": "",
-				})
-			default:
-				s.logger.Info("Skipping unknown chat type", zap.String("type", fmt.Sprintf("%T", chat)))
-			}
-		}
-	case *tg.MessagesDialogsSlice:
-		s.logger.Info("Processing MessagesDialogsSlice", zap.Int("chat_count", len(d.Chats)))
-		for i, chat := range d.Chats {
-			s.logger.Info("Processing chat", zap.Int("index", i), zap.String("type", fmt.Sprintf("%T", chat)))
-			switch c := chat.(type) {
-			case *tg.Channel:
-				s.logger.Info("Found channel", zap.Int64("id", c.ID), zap.String("title", c.Title))
-
-				// Get channel full info
-				channelFull, err := api.ChannelsGetFullChannel(ctx, &tg.InputChannel{
-					ChannelID:  c.ID,
-					AccessHash: c.AccessHash,
-				})
-				if err != nil {
-					s.logger.Warn("Failed to get channel full info", zap.Error(err))
-					// Continue without full info
-				}
-
-				var description string
-				if channelFull != nil {
-					if full, ok := channelFull.FullChat.(*tg.ChannelFull); ok {
-						description = full.About
-					}
-				}
-
-				result = append(result, map[string]interface{}{
-					"id":          c.ID,
-					"title":       c.Title,
-					"username":    c.Username,
-					"type":        "channel",
-					"members":     c.ParticipantsCount,
-					"description": description,
-				})
-			case *tg.Chat:
-				s.logger.Info("Found chat", zap.Int64("id", c.ID), zap.String("title", c.Title))
-				result = append(result, map[string]interface{}{
-					"id":          c.ID,
-					"title":       c.Title,
-					"type":        "group",
-					"members":     c.ParticipantsCount,
-					"description": "",
-				})
-			default:
-				s.logger.Info("Skipping unknown chat type", zap.String("type", fmt.Sprintf("%T", chat)))
-			}
-		}
-	default:
-		s.logger.Warn("Unexpected dialogs type", zap.String("type", fmt.Sprintf("%T", dialogs)))
-	}
-
-	s.logger.Info("Successfully retrieved user groups", zap.Int("count", len(result)))
-	return result, nil
-}
-
 // formatError formats Telegram API errors into user-friendly messages
 func (s *TelegramService) formatError(err error) error {
 	if err == nil {
@@ -686,8 +632,8 @@ func (s *TelegramService) GetCurrentUserID() (int64, error) {
 
 	if err != nil {
 		if strings.Contains(err.Error(), "AUTH_KEY_UNREGISTERED") {
-			// Clear the session file if authentication is invalid
-			os.Remove("session.json")
+			// Clear the stored session if authentication is invalid
+			s.removeSession()
 			s.client = nil // Clear the client
 			return 0, fmt.Errorf("session expired, please re-authenticate")
 		}
@@ -778,7 +724,7 @@ func (s *TelegramService) AuthenticateUser(phoneNumber string) error {
 		// If we get AUTH_RESTART, try to clear the session file and retry once
 		if strings.Contains(err.Error(), "AUTH_RESTART") {
 			s.logger.Info("Received AUTH_RESTART, clearing session and retrying")
-			os.Remove("session.json")
+			s.removeSession()
 
 			// Retry the code request
 			sentCode, err = api.AuthSendCode(authCtx, &tg.AuthSendCodeRequest{
@@ -1055,120 +1001,20 @@ func (s *TelegramService) Verify2FA(phoneForVerify, password string) error {
 			return
 		}
 
-		s.logger.Info("Got password settings",
-			zap.Int64("srpID", passwordSettings.SRPID),
-			zap.String("srpB", hex.EncodeToString(passwordSettings.SRPB)),
-		)
-
-		// Type assert the password algorithm
-		algo, ok := passwordSettings.CurrentAlgo.(*tg.PasswordKdfAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow)
-		if !ok {
-			s.logger.Error("Unexpected password algorithm type", zap.String("type", fmt.Sprintf("%T", passwordSettings.CurrentAlgo)))
-			done <- fmt.Errorf("unexpected password algorithm type")
+		if !passwordSettings.HasPassword {
+			done <- fmt.Errorf("account has no 2FA password")
 			return
 		}
 
-		s.logger.Info("Current algorithm parameters",
-			zap.String("salt1", hex.EncodeToString(algo.Salt1)),
-			zap.String("salt2", hex.EncodeToString(algo.Salt2)),
-		)
-
-		// Type assert the new algorithm
-		newAlgo, ok := passwordSettings.NewAlgo.(*tg.PasswordKdfAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow)
-		if !ok {
-			s.logger.Error("Unexpected new algorithm type", zap.String("type", fmt.Sprintf("%T", passwordSettings.NewAlgo)))
-			done <- fmt.Errorf("unexpected new algorithm type")
-			return
-		}
-
-		s.logger.Info("New algorithm parameters",
-			zap.String("p", hex.EncodeToString(newAlgo.P)),
-			zap.Int("g", newAlgo.G),
-		)
-
-		// Convert SRP parameters
-		p := new(big.Int).SetBytes(newAlgo.P)
-		g := big.NewInt(int64(newAlgo.G))
-		srpB := new(big.Int).SetBytes(passwordSettings.SRPB)
-
-		// Calculate x = PH2(password, salt1, salt2)
-		x := s.calculatePH2([]byte(password), algo.Salt1, algo.Salt2)
-		s.logger.Info("SRP Debug: Calculated x", zap.String("x", x.Text(16)))
-
-		// Calculate v = pow(g, x) mod p
-		v := new(big.Int).Exp(g, x, p)
-		s.logger.Info("SRP Debug: Calculated v", zap.String("v", v.Text(16)))
-
-		// Calculate k = H(p | g)
-		k := s.calculateK(p, g)
-		s.logger.Info("SRP Debug: Calculated k", zap.String("k", k.Text(16)))
-
-		// Calculate k_v = (k * v) mod p
-		kv := new(big.Int).Mul(k, v)
-		kv.Mod(kv, p)
-		s.logger.Info("SRP Debug: Calculated k_v", zap.String("k_v", kv.Text(16)))
-
-		// Generate client's private key (a)
-		aBytes := make([]byte, 256) // 2048 bits
-		_, err = io.ReadFull(rand.Reader, aBytes)
+		input, err := passwordCheckInput(passwordSettings, password)
 		if err != nil {
-			s.logger.Error("Failed to generate random private key", zap.Error(err))
-			done <- fmt.Errorf("failed to generate random private key: %v", err)
+			s.logger.Error("Failed to compute SRP answer", zap.Error(err))
+			done <- err
 			return
 		}
-		a := new(big.Int).SetBytes(aBytes)
-		a.Mod(a, p) // Ensure a is in the range [0, p-1]
-		s.logger.Info("SRP Debug: Generated client private key", zap.String("a", a.Text(16)))
-
-		// Calculate client's public key (A = g^a mod p)
-		A := new(big.Int).Exp(g, a, p)
-		s.logger.Info("SRP Debug: Calculated client public key", zap.String("A", A.Text(16)))
-
-		// Calculate u = H(A | B)
-		u := s.calculateU(A, srpB)
-		s.logger.Info("SRP Debug: Calculated u", zap.String("u", u.Text(16)))
-
-		// Calculate t = (g_b - k_v) mod p
-		t := new(big.Int).Sub(srpB, kv)
-		if t.Sign() < 0 {
-			t.Add(t, p)
-		}
-		t.Mod(t, p)
-		s.logger.Info("SRP Debug: Calculated t", zap.String("t", t.Text(16)))
-
-		// Calculate s_a = pow(t, a + u * x) mod p
-		ux := new(big.Int).Mul(u, x)
-		aux := new(big.Int).Add(a, ux)
-		aux.Mod(aux, p) // Ensure aux is in the range [0, p-1]
-		s_a := new(big.Int).Exp(t, aux, p)
-		s.logger.Info("SRP Debug: Calculated s_a", zap.String("s_a", s_a.Text(16)))
-
-		// Calculate k_a = H(s_a)
-		// Ensure s_a is properly padded to 256 bytes
-		s_aBytes := make([]byte, 256)
-		s_aBytesPadded := s_a.Bytes()
-		copy(s_aBytes[256-len(s_aBytesPadded):], s_aBytesPadded)
-
-		h := sha256.New()
-		h.Write(s_aBytes)
-		k_a := h.Sum(nil)
-		s.logger.Info("SRP Debug: Calculated k_a", zap.String("k_a", hex.EncodeToString(k_a)))
-
-		// Calculate M1 = H(H(p) xor H(g) | H(salt1) | H(salt2) | g_a | g_b | k_a)
-		m1 := s.calculateM1(p, g, algo.Salt1, algo.Salt2, A, srpB, k_a)
-		s.logger.Info("SRP Debug: Calculated M1", zap.String("m1", hex.EncodeToString(m1)))
-
-		// Ensure A is properly padded to 256 bytes
-		ABytes := make([]byte, 256)
-		aBytesPadded := A.Bytes()
-		copy(ABytes[256-len(aBytesPadded):], aBytesPadded)
 
 		// Sign in with 2FA
-		authResult, err := api.AuthCheckPassword(ctx, &tg.InputCheckPasswordSRP{
-			SRPID: passwordSettings.SRPID,
-			A:     ABytes,
-			M1:    m1,
-		})
+		authResult, err := api.AuthCheckPassword(ctx, input)
 		if err != nil {
 			s.logger.Error("2FA verification failed", zap.Error(err))
 			if strings.Contains(err.Error(), "PHONE_PASSWORD_FLOOD") {
@@ -1224,6 +1070,9 @@ func (s *TelegramService) Verify2FA(phoneForVerify, password string) error {
 
 	select {
 	case err := <-done:
+		if err != nil {
+			return err
+		}
 		// If successful, update the last attempt to success
 		s.mu.Lock()
 		if len(sess.PasswordAttempts) > 0 {
@@ -1288,177 +1137,6 @@ func (s *TelegramService) ResendCode(phoneForResend string) error {
 	})
 }
 
-// SRP calculation helpers
-func (s *TelegramService) calculatePH1(password, salt1, salt2 []byte) []byte {
-	// SH(SH(password, salt1), salt2)
-	h := sha256.New()
-	h.Write(salt1)
-	h.Write(password)
-	h.Write(salt1)
-	hash1 := h.Sum(nil)
-	s.logger.Info("PH1 intermediate hash1",
-		zap.String("hash1", hex.EncodeToString(hash1)),
-	)
-
-	h.Reset()
-	h.Write(salt2)
-	h.Write(hash1)
-	h.Write(salt2)
-	result := h.Sum(nil)
-	s.logger.Info("PH1 final result",
-		zap.String("result", hex.EncodeToString(result)),
-	)
-	return result
-}
-
-func (s *TelegramService) calculatePH2(password, salt1, salt2 []byte) *big.Int {
-	// SH(pbkdf2(sha512, PH1(password, salt1, salt2), salt1, 100000), salt2)
-	ph1 := s.calculatePH1(password, salt1, salt2)
-	s.logger.Info("PH2 PH1 result",
-		zap.String("ph1", hex.EncodeToString(ph1)),
-	)
-
-	// PBKDF2 with SHA512, 100000 iterations
-	key := pbkdf2.Key(ph1, salt1, 100000, 64, sha512.New)
-	s.logger.Info("PH2 PBKDF2 result",
-		zap.String("key", hex.EncodeToString(key)),
-	)
-
-	// Final SH
-	h := sha256.New()
-	h.Write(salt2)
-	h.Write(key)
-	h.Write(salt2)
-	result := h.Sum(nil)
-	s.logger.Info("PH2 final result",
-		zap.String("result", hex.EncodeToString(result)),
-	)
-	return new(big.Int).SetBytes(result)
-}
-
-func (s *TelegramService) calculateK(p, g *big.Int) *big.Int {
-	// k = H(p | g)
-	// Ensure p and g are properly padded to 256 bytes
-	pBytes := make([]byte, 256)
-	pBytesPadded := p.Bytes()
-	copy(pBytes[256-len(pBytesPadded):], pBytesPadded)
-
-	gBytes := make([]byte, 256)
-	gBytesPadded := g.Bytes()
-	copy(gBytes[256-len(gBytesPadded):], gBytesPadded)
-
-	h := sha256.New()
-	h.Write(pBytes)
-	h.Write(gBytes)
-	result := h.Sum(nil)
-	s.logger.Info("K calculation",
-		zap.String("p", hex.EncodeToString(pBytes)),
-		zap.String("g", hex.EncodeToString(gBytes)),
-		zap.String("result", hex.EncodeToString(result)),
-	)
-	return new(big.Int).SetBytes(result)
-}
-
-func (s *TelegramService) calculateU(A, B *big.Int) *big.Int {
-	// u = H(g_a | g_b)
-	// Ensure A and B are properly padded to 256 bytes
-	ABytes := make([]byte, 256)
-	ABytesPadded := A.Bytes()
-	copy(ABytes[256-len(ABytesPadded):], ABytesPadded)
-
-	BBytes := make([]byte, 256)
-	BBytesPadded := B.Bytes()
-	copy(BBytes[256-len(BBytesPadded):], BBytesPadded)
-
-	h := sha256.New()
-	h.Write(ABytes)
-	h.Write(BBytes)
-	result := h.Sum(nil)
-	s.logger.Info("U calculation",
-		zap.String("A", hex.EncodeToString(ABytes)),
-		zap.String("B", hex.EncodeToString(BBytes)),
-		zap.String("result", hex.EncodeToString(result)),
-	)
-	return new(big.Int).SetBytes(result)
-}
-
-func (s *TelegramService) calculateM1(p, g *big.Int, salt1, salt2 []byte, A, B *big.Int, k_a []byte) []byte {
-	// M1 = H(H(p) xor H(g) | H(salt1) | H(salt2) | g_a | g_b | k_a)
-
-	// Ensure p and g are properly padded to 256 bytes
-	pBytes := make([]byte, 256)
-	pBytesPadded := p.Bytes()
-	copy(pBytes[256-len(pBytesPadded):], pBytesPadded)
-
-	gBytes := make([]byte, 256)
-	gBytesPadded := g.Bytes()
-	copy(gBytes[256-len(gBytesPadded):], gBytesPadded)
-
-	// Calculate H(p)
-	h := sha256.New()
-	h.Write(pBytes)
-	hp := h.Sum(nil)
-	s.logger.Info("M1 H(p)",
-		zap.String("hp", hex.EncodeToString(hp)),
-	)
-
-	// Calculate H(g)
-	h.Reset()
-	h.Write(gBytes)
-	hg := h.Sum(nil)
-	s.logger.Info("M1 H(g)",
-		zap.String("hg", hex.EncodeToString(hg)),
-	)
-
-	// Calculate H(p) xor H(g)
-	pxorg := make([]byte, len(hp))
-	for i := range hp {
-		pxorg[i] = hp[i] ^ hg[i]
-	}
-	s.logger.Info("M1 H(p) xor H(g)",
-		zap.String("pxorg", hex.EncodeToString(pxorg)),
-	)
-
-	// Calculate H(salt1)
-	h.Reset()
-	h.Write(salt1)
-	hsalt1 := h.Sum(nil)
-	s.logger.Info("M1 H(salt1)",
-		zap.String("hsalt1", hex.EncodeToString(hsalt1)),
-	)
-
-	// Calculate H(salt2)
-	h.Reset()
-	h.Write(salt2)
-	hsalt2 := h.Sum(nil)
-	s.logger.Info("M1 H(salt2)",
-		zap.String("hsalt2", hex.EncodeToString(hsalt2)),
-	)
-
-	// Ensure A and B are properly padded to 256 bytes
-	ABytes := make([]byte, 256)
-	ABytesPadded := A.Bytes()
-	copy(ABytes[256-len(ABytesPadded):], ABytesPadded)
-
-	BBytes := make([]byte, 256)
-	BBytesPadded := B.Bytes()
-	copy(BBytes[256-len(BBytesPadded):], BBytesPadded)
-
-	// Calculate final M1
-	h.Reset()
-	h.Write(pxorg)
-	h.Write(hsalt1)
-	h.Write(hsalt2)
-	h.Write(ABytes)
-	h.Write(BBytes)
-	h.Write(k_a)
-	result := h.Sum(nil)
-	s.logger.Info("M1 final result",
-		zap.String("result", hex.EncodeToString(result)),
-	)
-	return result
-}
-
 func (s *TelegramService) GenerateAuthLink() string {
 	return "http://localhost:8080/api/telegram/auth/callback"
 }
@@ -1483,8 +1161,8 @@ func (s *TelegramService) GetCurrentUser() (map[string]interface{}, error) {
 	if err != nil {
 		s.logger.Warn("Failed to get current user", zap.Error(err))
 		if strings.Contains(err.Error(), "AUTH_KEY_UNREGISTERED") {
-			// Clear the session file if authentication is invalid
-			os.Remove("session.json")
+			// Clear the stored session if authentication is invalid
+			s.removeSession()
 			return nil, fmt.Errorf("session expired, please re-authenticate")
 		}
 		return nil, fmt.Errorf("failed to get current user: %v", err)
@@ -1504,6 +1182,7 @@ func (s *TelegramService) GetCurrentUser() (map[string]interface{}, error) {
 		"username":   userObj.Username,
 		"first_name": userObj.FirstName,
 		"last_name":  userObj.LastName,
+		"phone":      userObj.Phone,
 	}
 
 	s.logger.Info("Successfully retrieved current user info",
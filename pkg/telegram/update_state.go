@@ -0,0 +1,219 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-vue/pkg/storage"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+const updateStatePrefix = "telegram/updates/"
+
+// channelState is the persisted pts and access hash of a channel
+type channelState struct {
+	Pts        int   `json:"pts"`
+	AccessHash int64 `json:"access_hash,omitempty"`
+}
+
+// updateStateStorage persists the update sequence in the application store
+// so the updates manager can recover gaps that happened while we were
+// offline. It implements updates.StateStorage and updates.ChannelAccessHasher.
+type updateStateStorage struct {
+	store storage.Store
+	mu    sync.Mutex
+}
+
+func newUpdateStateStorage(store storage.Store) *updateStateStorage {
+	return &updateStateStorage{store: store}
+}
+
+func userStateKey(userID int64) string {
+	return fmt.Sprintf("%s%d/state", updateStatePrefix, userID)
+}
+
+func channelsPrefix(userID int64) string {
+	return fmt.Sprintf("%s%d/channels/", updateStatePrefix, userID)
+}
+
+func channelStateKey(userID, channelID int64) string {
+	return channelsPrefix(userID) + strconv.FormatInt(channelID, 10)
+}
+
+func (s *updateStateStorage) getJSON(ctx context.Context, key string, v interface{}) (bool, error) {
+	data, err := s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %v", key, err)
+	}
+	return true, nil
+}
+
+func (s *updateStateStorage) putJSON(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(ctx, key, data)
+}
+
+func (s *updateStateStorage) GetState(ctx context.Context, userID int64) (updates.State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state updates.State
+	found, err := s.getJSON(ctx, userStateKey(userID), &state)
+	return state, found, err
+}
+
+func (s *updateStateStorage) SetState(ctx context.Context, userID int64, state updates.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putJSON(ctx, userStateKey(userID), state)
+}
+
+// modifyState applies fn to an existing user state
+func (s *updateStateStorage) modifyState(ctx context.Context, userID int64, fn func(state *updates.State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var state updates.State
+	found, err := s.getJSON(ctx, userStateKey(userID), &state)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("update state for user %d not found", userID)
+	}
+	fn(&state)
+	return s.putJSON(ctx, userStateKey(userID), state)
+}
+
+func (s *updateStateStorage) SetPts(ctx context.Context, userID int64, pts int) error {
+	return s.modifyState(ctx, userID, func(state *updates.State) { state.Pts = pts })
+}
+
+func (s *updateStateStorage) SetQts(ctx context.Context, userID int64, qts int) error {
+	return s.modifyState(ctx, userID, func(state *updates.State) { state.Qts = qts })
+}
+
+func (s *updateStateStorage) SetDate(ctx context.Context, userID int64, date int) error {
+	return s.modifyState(ctx, userID, func(state *updates.State) { state.Date = date })
+}
+
+func (s *updateStateStorage) SetSeq(ctx context.Context, userID int64, seq int) error {
+	return s.modifyState(ctx, userID, func(state *updates.State) { state.Seq = seq })
+}
+
+func (s *updateStateStorage) SetDateSeq(ctx context.Context, userID int64, date, seq int) error {
+	return s.modifyState(ctx, userID, func(state *updates.State) {
+		state.Date = date
+		state.Seq = seq
+	})
+}
+
+func (s *updateStateStorage) GetChannelPts(ctx context.Context, userID, channelID int64) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var channel channelState
+	found, err := s.getJSON(ctx, channelStateKey(userID, channelID), &channel)
+	if err != nil || !found || channel.Pts == 0 {
+		return 0, false, err
+	}
+	return channel.Pts, true, nil
+}
+
+func (s *updateStateStorage) SetChannelPts(ctx context.Context, userID, channelID int64, pts int) error {
+	return s.modifyChannel(ctx, userID, channelID, func(channel *channelState) { channel.Pts = pts })
+}
+
+func (s *updateStateStorage) ForEachChannels(ctx context.Context, userID int64, f func(ctx context.Context, channelID int64, pts int) error) error {
+	s.mu.Lock()
+	prefix := channelsPrefix(userID)
+	keys, err := s.store.List(ctx, prefix)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	channels := make(map[int64]int, len(keys))
+	for _, key := range keys {
+		channelID, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		var channel channelState
+		if found, err := s.getJSON(ctx, key, &channel); err != nil {
+			s.mu.Unlock()
+			return err
+		} else if found && channel.Pts > 0 {
+			channels[channelID] = channel.Pts
+		}
+	}
+	s.mu.Unlock()
+
+	// f may call back into the storage, so it runs without the lock
+	for channelID, pts := range channels {
+		if err := f(ctx, channelID, pts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *updateStateStorage) SetChannelAccessHash(ctx context.Context, userID, channelID, accessHash int64) error {
+	return s.modifyChannel(ctx, userID, channelID, func(channel *channelState) { channel.AccessHash = accessHash })
+}
+
+func (s *updateStateStorage) GetChannelAccessHash(ctx context.Context, userID, channelID int64) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var channel channelState
+	found, err := s.getJSON(ctx, channelStateKey(userID, channelID), &channel)
+	if err != nil || !found || channel.AccessHash == 0 {
+		return 0, false, err
+	}
+	return channel.AccessHash, true, nil
+}
+
+func (s *updateStateStorage) modifyChannel(ctx context.Context, userID, channelID int64, fn func(channel *channelState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := channelStateKey(userID, channelID)
+	var channel channelState
+	if _, err := s.getJSON(ctx, key, &channel); err != nil {
+		return err
+	}
+	fn(&channel)
+	return s.putJSON(ctx, key, channel)
+}
+
+// Clear removes the update state of every user, used on logout
+func (s *updateStateStorage) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.store.List(ctx, updateStatePrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package telegram
+
+import (
+	"context"
+	"time"
+
+	"go-vue/pkg/events"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// Topics published on the event bus
+const (
+	TopicMessageNew     = "telegram.message.new"
+	TopicMessageEdited  = "telegram.message.edited"
+	TopicMessageDeleted = "telegram.message.deleted"
+	TopicChannelJoined  = "telegram.channel.joined"
+)
+
+// Peer types of MessageEvent.ChatType
+const (
+	ChatTypeUser    = "user"
+	ChatTypeChat    = "chat"
+	ChatTypeChannel = "channel"
+)
+
+// channelJoinWindow is how recent the join date of a channel must be for an
+// updateChannel to be reported as a join rather than a settings change
+const channelJoinWindow = 5 * time.Minute
+
+// updatesRetryInterval is the pause before restarting a failed updates manager
+const updatesRetryInterval = 10 * time.Second
+
+// MessageEvent is published for new and edited messages
+type MessageEvent struct {
+	ChatID    int64     `json:"chat_id"`
+	ChatType  string    `json:"chat_type"`
+	ChatTitle string    `json:"chat_title,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	MessageID int       `json:"message_id"`
+	FromID    int64     `json:"from_id,omitempty"`
+	Text      string    `json:"text"`
+	Post      bool      `json:"post"`
+	Outgoing  bool      `json:"outgoing"`
+	Date      time.Time `json:"date"`
+	EditDate  time.Time `json:"edit_date,omitempty"`
+}
+
+// MessagesDeletedEvent is published when messages are deleted. Telegram
+// does not say which private chat or basic group deleted messages belonged
+// to, so ChannelID is only set for channels and supergroups.
+type MessagesDeletedEvent struct {
+	ChannelID  int64 `json:"channel_id,omitempty"`
+	MessageIDs []int `json:"message_ids"`
+}
+
+// ChannelJoinedEvent is published when the account joins a channel or
+// supergroup
+type ChannelJoinedEvent struct {
+	ChannelID int64     `json:"channel_id"`
+	Title     string    `json:"title"`
+	Username  string    `json:"username,omitempty"`
+	Broadcast bool      `json:"broadcast"`
+	Date      time.Time `json:"date"`
+}
+
+// newUpdateDispatcher creates the update dispatcher for a new client. All
+// handlers are registered here because the dispatcher must not be modified
+// once the client is running.
+func newUpdateDispatcher(loginTokens chan struct{}, bus *events.Bus) tg.UpdateDispatcher {
+	dispatcher := tg.NewUpdateDispatcher()
+	dispatcher.OnLoginToken(func(ctx context.Context, e tg.Entities, update *tg.UpdateLoginToken) error {
+		select {
+		case loginTokens <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	if bus == nil {
+		return dispatcher
+	}
+
+	publishMessage := func(topic string, e tg.Entities, msg tg.MessageClass) {
+		if m, ok := msg.(*tg.Message); ok {
+			bus.Publish(topic, messageEvent(e, m))
+		}
+	}
+	dispatcher.OnNewMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewMessage) error {
+		publishMessage(TopicMessageNew, e, update.Message)
+		return nil
+	})
+	dispatcher.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewChannelMessage) error {
+		publishMessage(TopicMessageNew, e, update.Message)
+		return nil
+	})
+	dispatcher.OnEditMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateEditMessage) error {
+		publishMessage(TopicMessageEdited, e, update.Message)
+		return nil
+	})
+	dispatcher.OnEditChannelMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateEditChannelMessage) error {
+		publishMessage(TopicMessageEdited, e, update.Message)
+		return nil
+	})
+	dispatcher.OnDeleteMessages(func(ctx context.Context, e tg.Entities, update *tg.UpdateDeleteMessages) error {
+		bus.Publish(TopicMessageDeleted, MessagesDeletedEvent{MessageIDs: update.Messages})
+		return nil
+	})
+	dispatcher.OnDeleteChannelMessages(func(ctx context.Context, e tg.Entities, update *tg.UpdateDeleteChannelMessages) error {
+		bus.Publish(TopicMessageDeleted, MessagesDeletedEvent{ChannelID: update.ChannelID, MessageIDs: update.Messages})
+		return nil
+	})
+	dispatcher.OnChannel(func(ctx context.Context, e tg.Entities, update *tg.UpdateChannel) error {
+		// updateChannel is sent for any change of a channel, it is a join
+		// only when we are a member and the join date is fresh
+		channel, ok := e.Channels[update.ChannelID]
+		if !ok || channel.Left {
+			return nil
+		}
+		joined := time.Unix(int64(channel.Date), 0)
+		if time.Since(joined) > channelJoinWindow {
+			return nil
+		}
+		bus.Publish(TopicChannelJoined, ChannelJoinedEvent{
+			ChannelID: channel.ID,
+			Title:     channel.Title,
+			Username:  channel.Username,
+			Broadcast: channel.Broadcast,
+			Date:      joined,
+		})
+		return nil
+	})
+	return dispatcher
+}
+
+// messageEvent converts a message into its event form, resolving the chat
+// from the entities attached to the update
+func messageEvent(e tg.Entities, m *tg.Message) MessageEvent {
+	event := MessageEvent{
+		MessageID: m.ID,
+		Text:      m.Message,
+		Post:      m.Post,
+		Outgoing:  m.Out,
+		Date:      time.Unix(int64(m.Date), 0),
+	}
+	if editDate, ok := m.GetEditDate(); ok {
+		event.EditDate = time.Unix(int64(editDate), 0)
+	}
+	if from, ok := m.GetFromID(); ok {
+		if user, ok := from.(*tg.PeerUser); ok {
+			event.FromID = user.UserID
+		}
+	}
+
+	switch peer := m.PeerID.(type) {
+	case *tg.PeerUser:
+		event.ChatID = peer.UserID
+		event.ChatType = ChatTypeUser
+		if user, ok := e.Users[peer.UserID]; ok {
+			event.ChatTitle = user.FirstName + " " + user.LastName
+			event.Username = user.Username
+		}
+		if event.FromID == 0 && !m.Out {
+			event.FromID = peer.UserID
+		}
+	case *tg.PeerChat:
+		event.ChatID = peer.ChatID
+		event.ChatType = ChatTypeChat
+		if chat, ok := e.Chats[peer.ChatID]; ok {
+			event.ChatTitle = chat.Title
+		}
+	case *tg.PeerChannel:
+		event.ChatID = peer.ChannelID
+		event.ChatType = ChatTypeChannel
+		if channel, ok := e.Channels[peer.ChannelID]; ok {
+			event.ChatTitle = channel.Title
+			event.Username = channel.Username
+		}
+	}
+	return event
+}
+
+// newUpdatesManager wraps the dispatcher in a manager that tracks pts/qts/seq
+// and fetches differences when updates were missed
+func newUpdatesManager(logger *zap.Logger, dispatcher tg.UpdateDispatcher, state *updateStateStorage) *updates.Manager {
+	return updates.New(updates.Config{
+		Handler:      dispatcher,
+		Storage:      state,
+		AccessHasher: state,
+		Logger:       logger.Named("updates"),
+		OnChannelTooLong: func(channelID int64) {
+			logger.Warn("Channel update gap too long, some messages were skipped",
+				zap.Int64("channel_id", channelID))
+		},
+	})
+}
+
+// runUpdates blocks until ctx is done, running the updates manager whenever
+// the client is authorized. Before authorization updates are passed straight
+// to the dispatcher, which is all the login flow needs.
+func (s *TelegramService) runUpdates(ctx context.Context, client *telegram.Client, manager *updates.Manager) error {
+	for {
+		status, err := client.Auth().Status(ctx)
+		if err == nil && status.Authorized {
+			err = manager.Run(ctx, client.API(), status.User.ID, updates.AuthOptions{
+				OnStart: func(ctx context.Context) {
+					s.logger.Info("Listening for Telegram updates", zap.Int64("user_id", status.User.ID))
+				},
+			})
+			if ctx.Err() != nil {
+				return nil
+			}
+			s.logger.Warn("Updates manager stopped, restarting", zap.Error(err))
+			manager.Reset()
+		} else if err != nil && ctx.Err() == nil {
+			s.logger.Warn("Failed to check authorization for updates", zap.Error(err))
+		}
+
+		// Retry after failures, otherwise sleep until somebody logs in
+		var retry <-chan time.Time
+		if err != nil || status.Authorized {
+			retry = time.After(updatesRetryInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.authorized:
+		case <-retry:
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package timeseries
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-vue/pkg/storage"
+)
+
+const (
+	prefix = "timeseries/"
+	// chunkLayout groups the points of a series into one key per month
+	chunkLayout = "2006-01"
+)
+
+// Point is one value of a series
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Kline names the series of one candle field, for example
+// Kline("BTCUSDT", "1d", "close") is binance/BTCUSDT/1d/close
+func Kline(symbol, interval, field string) string {
+	return "binance/" + strings.ToUpper(symbol) + "/" + interval + "/" + field
+}
+
+// Indicator names the stored history of a market indicator, keyed like its
+// API endpoint, for example indicator/fear-greed
+func Indicator(metric string) string {
+	return "indicator/" + metric
+}
+
+// Store keeps time series in a key/value store, one key per series and month
+type Store struct {
+	store storage.Store
+	mu    sync.Mutex
+}
+
+// NewStore creates a time series store on top of store
+func NewStore(store storage.Store) *Store {
+	return &Store{store: store}
+}
+
+func chunkKey(series string, t time.Time) string {
+	return prefix + series + "/" + t.UTC().Format(chunkLayout)
+}
+
+// chunks returns the chunk keys of series in time order
+func (s *Store) chunks(ctx context.Context, series string) ([]string, error) {
+	keys, err := s.store.List(ctx, prefix+series+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list series %s: %v", series, err)
+	}
+	var chunks []string
+	for _, key := range keys {
+		month := strings.TrimPrefix(key, prefix+series+"/")
+		// skip the chunks of series nested below this one
+		if _, err := time.Parse(chunkLayout, month); err == nil {
+			chunks = append(chunks, key)
+		}
+	}
+	sort.Strings(chunks)
+	return chunks, nil
+}
+
+func (s *Store) load(ctx context.Context, key string) ([]Point, error) {
+	data, err := s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %v", key, err)
+	}
+	var points []Point
+	if err := json.Unmarshal(data, &points); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", key, err)
+	}
+	return points, nil
+}
+
+// Write merges points into series. A point replaces any stored point with
+// the same time, so writing the same data twice is harmless. It returns
+// the number of points that were not stored before.
+func (s *Store) Write(ctx context.Context, series string, points []Point) (int, error) {
+	byChunk := make(map[string][]Point)
+	for _, point := range points {
+		key := chunkKey(series, point.Time)
+		byChunk[key] = append(byChunk[key], point)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := 0
+	for key, points := range byChunk {
+		stored, err := s.load(ctx, key)
+		if err != nil {
+			return added, err
+		}
+		merged := make(map[int64]Point, len(stored)+len(points))
+		for _, point := range stored {
+			merged[point.Time.Unix()] = point
+		}
+		for _, point := range points {
+			if _, ok := merged[point.Time.Unix()]; !ok {
+				added++
+			}
+			merged[point.Time.Unix()] = Point{Time: point.Time.UTC(), Value: point.Value}
+		}
+
+		chunk := make([]Point, 0, len(merged))
+		for _, point := range merged {
+			chunk = append(chunk, point)
+		}
+		sort.Slice(chunk, func(i, j int) bool { return chunk[i].Time.Before(chunk[j].Time) })
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return added, err
+		}
+		if err := s.store.Put(ctx, key, data); err != nil {
+			return added, fmt.Errorf("failed to save %s: %v", key, err)
+		}
+	}
+	return added, nil
+}
+
+// Range returns the points of series from from up to, but excluding, to in
+// time order. A zero from or to leaves that side unbounded.
+func (s *Store) Range(ctx context.Context, series string, from, to time.Time) ([]Point, error) {
+	chunks, err := s.chunks(ctx, series)
+	if err != nil {
+		return nil, err
+	}
+	points := []Point{}
+	for _, key := range chunks {
+		if !from.IsZero() && key < chunkKey(series, from) {
+			continue
+		}
+		if !to.IsZero() && key > chunkKey(series, to) {
+			break
+		}
+		chunk, err := s.load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range chunk {
+			if (from.IsZero() || !point.Time.Before(from)) && (to.IsZero() || point.Time.Before(to)) {
+				points = append(points, point)
+			}
+		}
+	}
+	return points, nil
+}
+
+// Last returns the latest point of series, or nil when it is empty
+func (s *Store) Last(ctx context.Context, series string) (*Point, error) {
+	chunks, err := s.chunks(ctx, series)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(chunks) - 1; i >= 0; i-- {
+		chunk, err := s.load(ctx, chunks[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) > 0 {
+			return &chunk[len(chunk)-1], nil
+		}
+	}
+	return nil, nil
+}
+
+// Series lists the names of all stored series
+func (s *Store) Series(ctx context.Context) ([]string, error) {
+	keys, err := s.store.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list series: %v", err)
+	}
+	seen := make(map[string]bool)
+	var series []string
+	for _, key := range keys {
+		i := strings.LastIndex(key, "/")
+		name := strings.TrimPrefix(key[:i], prefix)
+		if !seen[name] {
+			seen[name] = true
+			series = append(series, name)
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,66 @@
+package timeseries
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-vue/pkg/storage"
+)
+
+func TestStore(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := NewStore(store)
+	ctx := context.Background()
+	name := Kline("btcusdt", "1d", "close")
+	start := time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC)
+
+	var points []Point
+	for i := 0; i < 4; i++ {
+		points = append(points, Point{Time: start.AddDate(0, 0, i), Value: float64(i)})
+	}
+	added, err := series.Write(ctx, name, points)
+	if err != nil || added != 4 {
+		t.Fatalf("Write = %d, %v", added, err)
+	}
+	// writing again only adds the new point and replaces the changed one
+	points = append(points[2:], Point{Time: start.AddDate(0, 0, 4), Value: 4})
+	points[0].Value = 20
+	if added, err = series.Write(ctx, name, points); err != nil || added != 1 {
+		t.Fatalf("second Write = %d, %v", added, err)
+	}
+	// a nested series does not leak into its parent
+	if _, err := series.Write(ctx, name+"/nested", points); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := series.Range(ctx, name, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 5 || all[2].Value != 20 || !all[0].Time.Equal(start) {
+		t.Fatalf("unexpected points %+v", all)
+	}
+	window, err := series.Range(ctx, name, start.AddDate(0, 0, 1), start.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(window) != 2 || window[0].Value != 1 || window[1].Value != 20 {
+		t.Fatalf("unexpected window %+v", window)
+	}
+
+	last, err := series.Last(ctx, name)
+	if err != nil || last == nil || last.Value != 4 {
+		t.Fatalf("Last = %+v, %v", last, err)
+	}
+	if last, err := series.Last(ctx, "missing"); err != nil || last != nil {
+		t.Fatalf("Last of a missing series = %+v, %v", last, err)
+	}
+	names, err := series.Series(ctx)
+	if err != nil || len(names) != 2 || names[0] != "binance/BTCUSDT/1d/close" {
+		t.Fatalf("Series = %v, %v", names, err)
+	}
+}